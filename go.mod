@@ -22,6 +22,7 @@ require (
 	github.com/smartystreets/goconvey v1.8.1
 	github.com/spf13/pflag v1.0.5
 	go.etcd.io/etcd v3.3.27+incompatible
+	golang.org/x/crypto v0.21.0
 	golang.org/x/image v0.15.0
 	golang.org/x/net v0.22.0
 	golang.org/x/text v0.14.0
@@ -87,7 +88,6 @@ require (
 	github.com/xujiajun/utils v0.0.0-20220904132955-5f7c5b914235 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
-	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/mod v0.12.0 // indirect
 	golang.org/x/sync v0.3.0 // indirect
 	golang.org/x/sys v0.29.0 // indirect
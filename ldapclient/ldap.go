@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -113,7 +114,9 @@ type TLdapClient struct {
 	MailDomain string   `json:"mailDomain"`
 	TLS        bool     `json:"tls"`
 	StartTLS   bool     `json:"startTLS"`
-	Conn       *ldap.Conn
+	// 连接和每个请求的超时，为0时使用 ldap.DefaultTimeout（连接）且请求不超时
+	Timeout time.Duration `json:"timeout"`
+	Conn    *ldap.Conn
 }
 
 func (lc *TLdapClient) Close() {
@@ -124,14 +127,22 @@ func (lc *TLdapClient) Close() {
 }
 
 func (lc *TLdapClient) Connect() (err error) {
+	dialer := &net.Dialer{Timeout: ldap.DefaultTimeout}
+	if lc.Timeout > 0 {
+		dialer.Timeout = lc.Timeout
+	}
 	if lc.TLS {
-		lc.Conn, err = ldap.DialTLS("tcp", lc.Addr, &tls.Config{InsecureSkipVerify: true})
+		lc.Conn, err = ldap.DialURL("ldaps://"+lc.Addr, ldap.DialWithDialer(dialer),
+			ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
 	} else {
-		lc.Conn, err = ldap.Dial("tcp", lc.Addr)
+		lc.Conn, err = ldap.DialURL("ldap://"+lc.Addr, ldap.DialWithDialer(dialer))
 	}
 	if err != nil {
 		return err
 	}
+	if lc.Timeout > 0 {
+		lc.Conn.SetTimeout(lc.Timeout)
+	}
 	//lc.Conn.Debug = true
 
 	if !lc.TLS && lc.StartTLS {
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/tea4go/gh/ldapserver"
 	"github.com/tea4go/gh/utils"
 )
 
@@ -198,7 +199,22 @@ func TestTLdapClient_Close_NoConn(t *testing.T) {
 }
 
 func TestTLdapClient_Connect(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, _ := testLdapClient(t)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+	if c.IsClosing() {
+		t.Error("IsClosing should be false after Connect")
+	}
+	c.Close()
+
+	c.BindPass = "wrong"
+	if err := c.Connect(); err == nil {
+		t.Error("Connect with wrong password should return error")
+	}
+	if c.Conn != nil {
+		t.Error("Conn should be nil when Connect fails")
+	}
 }
 
 func TestTLdapClient_Bind(t *testing.T) {
@@ -386,94 +402,394 @@ func TestTLdapClient_Auth_EmptyPassword(t *testing.T) {
 	}
 }
 
+// testLDIF is the directory of the in-memory test server
+const testLDIF = `dn: dc=example,dc=com
+objectClass: domain
+dc: example
+
+dn: cn=admin,dc=example,dc=com
+objectClass: person
+cn: admin
+userPassword: admin-pw
+
+dn: OU=Users,dc=example,dc=com
+objectClass: organizationalUnit
+ou: Users
+
+dn: CN=u001,OU=Users,dc=example,dc=com
+objectClass: user
+cn: u001
+sAMAccountName: u001
+sn: Zhang San
+mail: u001@example.com
+userAccountControl: 514
+distinguishedName: CN=u001,OU=Users,dc=example,dc=com
+whenCreated: 20210102030405.0Z
+userPassword: u001-pw
+
+dn: CN=u002,OU=Users,dc=example,dc=com
+objectClass: user
+cn: u002
+sAMAccountName: u002
+sn: Li Si
+userAccountControl: 512
+distinguishedName: CN=u002,OU=Users,dc=example,dc=com
+userPassword: u002-pw
+`
+
+// testLdapClient starts an LDAP server with the in-memory directory of testLDIF
+// and returns an unconnected client of it
+func testLdapClient(t *testing.T) (*TLdapClient, *ldapserver.MemoryBackend) {
+	t.Helper()
+	backend := ldapserver.NewMemoryBackend()
+	if err := backend.LoadLDIF(strings.NewReader(testLDIF)); err != nil {
+		t.Fatalf("LoadLDIF error: %v", err)
+	}
+	routes := ldapserver.NewRouteMux()
+	backend.Mount(routes)
+
+	server := ldapserver.NewServer()
+	server.Handle(routes)
+	server.SetClients("127.0.0.1/8")
+	ch := make(chan error, 1)
+	go server.ListenAndServe("127.0.0.1:0", ch)
+	if err := <-ch; err != nil {
+		t.Fatalf("ListenAndServe error: %v", err)
+	}
+	t.Cleanup(server.Stop)
+
+	return &TLdapClient{
+		Addr:       server.Listener.Addr().String(),
+		BaseDn:     "dc=example,dc=com",
+		BindDn:     "cn=admin,dc=example,dc=com",
+		BindPass:   "admin-pw",
+		AuthFilter: "(&(objectClass=user)(sAMAccountName=%s))",
+		MailDomain: "@example.com",
+	}, backend
+}
+
+// testConnect connects the client of testLdapClient
+func testConnect(t *testing.T) (*TLdapClient, *ldapserver.MemoryBackend) {
+	t.Helper()
+	c, backend := testLdapClient(t)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+	t.Cleanup(c.Close)
+	return c, backend
+}
+
 func TestTLdapClient_SearchUser(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, _ := testConnect(t)
+	user, err := c.SearchUser("u001")
+	if err != nil {
+		t.Fatalf("SearchUser error: %v", err)
+	}
+	if user.DN != "CN=u001,OU=Users,dc=example,dc=com" {
+		t.Errorf("DN = %q", user.DN)
+	}
+	if user.GetAttr("sn") != "Zhang San" {
+		t.Errorf("sn = %q, want %q", user.GetAttr("sn"), "Zhang San")
+	}
+	if _, err := c.SearchUser("nobody"); err == nil || !strings.Contains(err.Error(), "没有找到用户") {
+		t.Errorf("SearchUser(nobody) error = %v, should mention user not found", err)
+	}
 }
 
 func TestTLdapClient_Search(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, _ := testConnect(t)
+	results, err := c.Search("(objectClass=user)", ldap.ScopeWholeSubtree)
+	if err != nil {
+		t.Fatalf("Search error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("len(results) = %d, want 2", len(results))
+	}
+	if _, err := c.Search("(objectClass=group)", ldap.ScopeWholeSubtree); err == nil {
+		t.Error("Search without results should return error")
+	}
 }
 
 func TestTLdapClient_SearchBase(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, _ := testConnect(t)
+	results, err := c.SearchBase("(objectClass=*)")
+	if err != nil {
+		t.Fatalf("SearchBase error: %v", err)
+	}
+	if len(results) != 1 || results[0].DN != "dc=example,dc=com" {
+		t.Errorf("SearchBase results = %v, want the base entry", results)
+	}
 }
 
 func TestTLdapClient_SearchSubOne(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, _ := testConnect(t)
+	results, err := c.SearchSubOne("(objectClass=*)")
+	if err != nil {
+		t.Fatalf("SearchSubOne error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("len(results) = %d, want 2", len(results))
+	}
 }
 
 func TestTLdapClient_SearchSubAll(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, _ := testConnect(t)
+	results, err := c.SearchSubAll("(sAMAccountName=u00*)")
+	if err != nil {
+		t.Fatalf("SearchSubAll error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("len(results) = %d, want 2", len(results))
+	}
 }
 
 func TestTLdapClient_CreateUser(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, backend := testConnect(t)
+	dn, _, err := c.CreateUser("OU=Users", &TLdapUser{StaffCode: "u003", StaffName: "Wang", Email: "wang"})
+	if err != nil {
+		t.Fatalf("CreateUser error: %v", err)
+	}
+	if dn != "CN=u003,OU=Users,dc=example,dc=com" {
+		t.Errorf("dn = %q", dn)
+	}
+	entry := backend.GetEntry(dn)
+	if entry == nil {
+		t.Fatal("user should be created")
+	}
+	if v := entry.GetAttributeValue("userPrincipalName"); v != "u003@example.com" {
+		t.Errorf("userPrincipalName = %q, want u003@example.com", v)
+	}
+	if _, _, err := c.CreateUser("OU=Users", &TLdapUser{StaffCode: "u003"}); err == nil {
+		t.Error("CreateUser of an existing user should return error")
+	}
 }
 
 func TestTLdapClient_ChangePassword(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, backend := testConnect(t)
+	if err := c.ChangePassword("OU=Users", "u001", "new-pw"); err != nil {
+		t.Fatalf("ChangePassword error: %v", err)
+	}
+	if backend.GetEntry("CN=u001,OU=Users,dc=example,dc=com").GetAttribute("unicodePwd") == nil {
+		t.Error("unicodePwd should be set")
+	}
+	if err := c.ChangePassword("OU=Users", "nobody", "new-pw"); err == nil {
+		t.Error("ChangePassword of a missing user should return error")
+	}
 }
 
 func TestTLdapClient_EnableAccount(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, backend := testConnect(t)
+	if err := c.EnableAccount("u001"); err != nil {
+		t.Fatalf("EnableAccount error: %v", err)
+	}
+	if v := backend.GetEntry("CN=u001,OU=Users,dc=example,dc=com").GetAttributeValue("userAccountControl"); v != "66048" {
+		t.Errorf("userAccountControl = %s, want 66048", v)
+	}
 }
 
 func TestTLdapClient_DisableAccount(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, backend := testConnect(t)
+	if err := c.DisableAccount("u002"); err != nil {
+		t.Fatalf("DisableAccount error: %v", err)
+	}
+	if v := backend.GetEntry("CN=u002,OU=Users,dc=example,dc=com").GetAttributeValue("userAccountControl"); v != "514" {
+		t.Errorf("userAccountControl = %s, want 514", v)
+	}
+	if err := c.DisableAccount("nobody"); err == nil {
+		t.Error("DisableAccount of a missing user should return error")
+	}
 }
 
 func TestTLdapClient_DeleteUser(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, backend := testConnect(t)
+	if err := c.DeleteUser("OU=Users", "u002"); err != nil {
+		t.Fatalf("DeleteUser error: %v", err)
+	}
+	if backend.GetEntry("CN=u002,OU=Users,dc=example,dc=com") != nil {
+		t.Error("user should be deleted")
+	}
+	if err := c.DeleteUser("OU=Users", "u002"); err == nil {
+		t.Error("DeleteUser of a missing user should return error")
+	}
 }
 
 func TestTLdapClient_CreatePath(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, backend := testConnect(t)
+	if err := c.CreatePath("", "Dept"); err != nil {
+		t.Fatalf("CreatePath error: %v", err)
+	}
+	if err := c.CreatePath("OU=Dept", "Team"); err != nil {
+		t.Fatalf("CreatePath of a sub path error: %v", err)
+	}
+	if entry := backend.GetEntry("OU=Team,OU=Dept,dc=example,dc=com"); entry == nil || entry.GetAttributeValue("ou") != "Team" {
+		t.Errorf("path entry = %v", entry)
+	}
+	if err := c.CreatePath("OU=Missing", "Team"); err == nil {
+		t.Error("CreatePath under a missing path should return error")
+	}
 }
 
 func TestTLdapClient_DeletePath(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, backend := testConnect(t)
+	if err := c.DeletePath("", "Users"); err == nil {
+		t.Error("DeletePath of a path with users should return error")
+	}
+	if err := c.CreatePath("", "Empty"); err != nil {
+		t.Fatalf("CreatePath error: %v", err)
+	}
+	if err := c.DeletePath("", "Empty"); err != nil {
+		t.Fatalf("DeletePath error: %v", err)
+	}
+	if backend.GetEntry("OU=Empty,dc=example,dc=com") != nil {
+		t.Error("path should be deleted")
+	}
 }
 
 func TestTLdapClient_CreateGroup(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, backend := testConnect(t)
+	if err := c.CreateGroup("OU=Users", "admins"); err != nil {
+		t.Fatalf("CreateGroup error: %v", err)
+	}
+	if entry := backend.GetEntry("CN=admins,OU=Users,dc=example,dc=com"); entry == nil || entry.GetAttributeValue("sAMAccountName") != "admins" {
+		t.Errorf("group entry = %v", entry)
+	}
+	if err := c.CreateGroup("OU=Users", "admins"); err == nil {
+		t.Error("CreateGroup of an existing group should return error")
+	}
 }
 
 func TestTLdapClient_DeleteGroup(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, backend := testConnect(t)
+	if err := c.CreateGroup("", "admins"); err != nil {
+		t.Fatalf("CreateGroup error: %v", err)
+	}
+	if err := c.DeleteGroup("", "admins"); err != nil {
+		t.Fatalf("DeleteGroup error: %v", err)
+	}
+	if backend.GetEntry("CN=admins,dc=example,dc=com") != nil {
+		t.Error("group should be deleted")
+	}
 }
 
 func TestTLdapClient_AddGroupUser(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, backend := testConnect(t)
+	if err := c.CreateGroup("", "admins"); err != nil {
+		t.Fatalf("CreateGroup error: %v", err)
+	}
+	if err := c.AddGroupUser("", "admins", "CN=u001,OU=Users"); err != nil {
+		t.Fatalf("AddGroupUser error: %v", err)
+	}
+	if v := backend.GetEntry("CN=admins,dc=example,dc=com").GetAttributeValue("member"); v != "CN=u001,OU=Users,dc=example,dc=com" {
+		t.Errorf("member = %q", v)
+	}
+	if err := c.AddGroupUser("", "admins", "cn=U001, ou=users"); err == nil {
+		t.Error("AddGroupUser of an existing member should return error")
+	}
+	results, err := c.SearchSubAll("(member=cn=u001,ou=users,dc=example,dc=com)")
+	if err != nil || len(results) != 1 {
+		t.Errorf("search by member = %v, %v, want the group", results, err)
+	}
 }
 
 func TestTLdapClient_DelGroupUser(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, backend := testConnect(t)
+	if err := c.CreateGroup("", "admins"); err != nil {
+		t.Fatalf("CreateGroup error: %v", err)
+	}
+	if err := c.AddGroupUser("", "admins", "CN=u001,OU=Users"); err != nil {
+		t.Fatalf("AddGroupUser error: %v", err)
+	}
+	if err := c.DelGroupUser("", "admins", "CN=u001,OU=Users"); err != nil {
+		t.Fatalf("DelGroupUser error: %v", err)
+	}
+	if backend.GetEntry("CN=admins,dc=example,dc=com").GetAttribute("member") != nil {
+		t.Error("member should be removed")
+	}
+	if err := c.DelGroupUser("", "admins", "CN=u001,OU=Users"); err == nil {
+		t.Error("DelGroupUser of a missing member should return error")
+	}
 }
 
 func TestTLdapClient_SetExternalEmailAddress(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, backend := testConnect(t)
+	if err := c.SetExternalEmailAddress("OU=Users", "u001", "zhang@mail.com", "zhang"); err != nil {
+		t.Fatalf("SetExternalEmailAddress error: %v", err)
+	}
+	entry := backend.GetEntry("CN=u001,OU=Users,dc=example,dc=com")
+	if v := entry.GetAttributeValue("mail"); v != "zhang@mail.com" {
+		t.Errorf("mail = %q, want zhang@mail.com", v)
+	}
+	if v := entry.GetAttributeValues("proxyAddresses"); len(v) != 2 || v[0] != "SMTP:zhang@mail.com" {
+		t.Errorf("proxyAddresses = %v", v)
+	}
 }
 
 func TestTLdapClient_GetSearchResult(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, _ := testConnect(t)
+	sr, err := c.Conn.Search(ldap.NewSearchRequest("CN=u001,OU=Users,dc=example,dc=com", ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+	if err != nil || len(sr.Entries) != 1 {
+		t.Fatalf("Search error: %v", err)
+	}
+	user := c.GetSearchResult(sr.Entries[0])
+	created := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC).Local().Format(utils.DateTimeFormat)
+	if user.GetAttr("whenCreated") != created {
+		t.Errorf("whenCreated = %q, want %q", user.GetAttr("whenCreated"), created)
+	}
+	if user.GetAttrByInt("userAccountControl") != 514 {
+		t.Errorf("userAccountControl = %d, want 514", user.GetAttrByInt("userAccountControl"))
+	}
 }
 
 // --- Package-level function tests ---
 
 func TestPackage_Search(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, _ := testLdapClient(t)
+	results, err := Search(c, "(objectClass=domain)")
+	if err != nil {
+		t.Fatalf("Search error: %v", err)
+	}
+	if len(results) != 1 || results[0].DN != "dc=example,dc=com" {
+		t.Errorf("Search results = %v, want the base entry", results)
+	}
+	if !c.IsClosing() {
+		t.Error("Search should close the connection")
+	}
 }
 
 func TestPackage_Auth(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, _ := testLdapClient(t)
+	if success, err := Auth(c, "u001", "u001-pw"); !success || err != nil {
+		t.Errorf("Auth = %v, %v, want success", success, err)
+	}
+	if success, err := Auth(c, "u001", "wrong"); success || err == nil {
+		t.Errorf("Auth with wrong password = %v, %v, want error", success, err)
+	}
+	if success, err := Auth(c, "nobody", "u001-pw"); success || err == nil {
+		t.Errorf("Auth of a missing user = %v, %v, want error", success, err)
+	}
 }
 
 func TestPackage_SearchUser(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, _ := testLdapClient(t)
+	user, err := SearchUser(c, "u002")
+	if err != nil {
+		t.Fatalf("SearchUser error: %v", err)
+	}
+	if user.GetAttr("sn") != "Li Si" {
+		t.Errorf("sn = %q, want %q", user.GetAttr("sn"), "Li Si")
+	}
 }
 
 func TestPackage_HealthCheck(t *testing.T) {
-	t.Skip("requires LDAP server")
+	c, _ := testLdapClient(t)
+	if success, err := HealthCheck(c); !success || err != nil {
+		t.Errorf("HealthCheck = %v, %v, want success", success, err)
+	}
+	c.BindPass = "wrong"
+	if success, err := HealthCheck(c); success || err == nil {
+		t.Errorf("HealthCheck with wrong password = %v, %v, want error", success, err)
+	}
 }
 
 // --- ParseTicks / TicksToTime tests ---
@@ -2,11 +2,14 @@ package ldapserver
 
 import (
 	"bufio"
+	"crypto/tls"
+	"errors"
 	"net"
 	"sync"
 	"time"
 
 	ldap "github.com/openstandia/goldap/message"
+	proxyproto "github.com/pires/go-proxyproto"
 	logs "github.com/tea4go/gh/log4go"
 )
 
@@ -22,7 +25,9 @@ type client struct {
 	requestList map[int]*Message
 	mutex       sync.Mutex
 	writeDone   chan bool
+	writeMutex  sync.Mutex // protects bw and rwc while StartTLS upgrades the connection
 	rawData     []byte
+	bindDN      string // DN of the last successful Bind, protected by mutex
 }
 
 func (c *client) GetConn() net.Conn {
@@ -39,6 +44,41 @@ func (c *client) SetConn(conn net.Conn) {
 	c.bw = bufio.NewWriter(c.rwc)
 }
 
+// GetBindDN returns the DN set by the last Bind handler, "" when the
+// connection is anonymous.
+func (c *client) GetBindDN() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.bindDN
+}
+
+func (c *client) SetBindDN(dn string) {
+	c.mutex.Lock()
+	c.bindDN = dn
+	c.mutex.Unlock()
+}
+
+// GetTLSState returns the TLS state of the connection, established by StartTLS
+// or by ListenAndServeTLS, nil if the connection is not encrypted.
+func (c *client) GetTLSState() *tls.ConnectionState {
+	// StartTLS replaces rwc under writeMutex
+	c.writeMutex.Lock()
+	conn := c.rwc
+	c.writeMutex.Unlock()
+	if pc, ok := conn.(*proxyproto.Conn); ok {
+		conn = pc.Raw()
+	}
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tc.ConnectionState()
+	if !state.HandshakeComplete {
+		return nil
+	}
+	return &state
+}
+
 func (c *client) GetMessageByID(messageID int) (*Message, bool) {
 	if requestToAbandon, ok := c.requestList[messageID]; ok {
 		return requestToAbandon, true
@@ -82,11 +122,23 @@ func (c *client) serve() {
 	}()
 
 	// Listen for server signal to shutdown
+	// rwc may be replaced by StartTLS, the deadline is set on the original connection
+	rwc := c.rwc
 	go func() {
 		for {
 			select {
 			case <-c.srv.chDone: // server signals shutdown process
+				// the client may be closing at the same time, chanOut is closed
+				// once close has waited for wg
+				c.mutex.Lock()
+				select {
+				case <-c.closing:
+					c.mutex.Unlock()
+					return
+				default:
+				}
 				c.wg.Add(1)
+				c.mutex.Unlock()
 				r := NewExtendedResponse(LDAPResultUnwillingToPerform)
 				r.SetDiagnosticMessage("server is about to stop")
 				r.SetResponseName(NoticeOfDisconnection)
@@ -95,7 +147,7 @@ func (c *client) serve() {
 
 				c.chanOut <- m
 				c.wg.Done()
-				c.rwc.SetReadDeadline(time.Now().Add(time.Millisecond))
+				rwc.SetReadDeadline(time.Now().Add(time.Millisecond))
 				return
 			case <-c.closing:
 				return
@@ -147,6 +199,13 @@ func (c *client) serve() {
 		// goroutine, connection has to remain free until TLS is OK
 		// @see RFC https://tools.ietf.org/html/rfc4511#section-4.14.1
 		if req, ok := message.ProtocolOp().(ldap.ExtendedRequest); ok {
+			if req.RequestName() == NoticeOfStartTLS && c.srv.TLSConfig != nil {
+				if err := c.startTLS(message.MessageID().Int()); err != nil {
+					logs.Debug("客户端[%d]： StartTLS失败(%s)", c.Numero, err)
+					return
+				}
+				continue
+			}
 			if req.RequestName() == NoticeOfStartTLS {
 				c.wg.Add(1)
 				c.ProcessRequestMessage(&message)
@@ -156,8 +215,10 @@ func (c *client) serve() {
 
 		// TODO: go/non go routine choice should be done in the ProcessRequestMessage
 		// not in the client.serve func
+		// The request is registered before the goroutine starts, so that a
+		// following StartTLS sees it as outstanding.
 		c.wg.Add(1)
-		go c.ProcessRequestMessage(&message)
+		go c.processRequest(c.newRequest(&message))
 	}
 
 }
@@ -170,7 +231,9 @@ func (c *client) serve() {
 // * signal to server that client shutdown is ok
 func (c *client) close() {
 	logs.Debug("客户端[%d]%s断开连接 ......", c.Numero, c.Addr().String())
+	c.mutex.Lock()
 	close(c.closing)
+	c.mutex.Unlock()
 
 	// stop reading from client
 	c.rwc.SetReadDeadline(time.Now().Add(time.Millisecond))
@@ -195,10 +258,67 @@ func (c *client) close() {
 func (c *client) writeMessage(m *ldap.LDAPMessage) {
 	data, _ := m.Write()
 	//logs.Debug("client [%d]: >>> %s", c.Numero, m.ProtocolOpName())
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
 	c.bw.Write(data.Bytes())
 	c.bw.Flush()
 }
 
+// startTLS answers a StartTLS request and upgrades the connection with
+// Server.TLSConfig. The request is refused with operationsError when TLS is
+// already established or other requests are outstanding (RFC 4511 4.14.1).
+// A non-nil error means the connection can not be used anymore.
+func (c *client) startTLS(messageID int) error {
+	c.mutex.Lock()
+	outstanding := len(c.requestList)
+	c.mutex.Unlock()
+
+	diagnostic := ""
+	switch {
+	case c.GetTLSState() != nil:
+		diagnostic = "TLS already established"
+	case outstanding > 0:
+		diagnostic = "outstanding operations"
+	}
+	if diagnostic != "" {
+		r := NewExtendedResponse(LDAPResultOperationsError)
+		r.SetResponseName(NoticeOfStartTLS)
+		r.SetDiagnosticMessage(diagnostic)
+		m := ldap.NewLDAPMessageWithProtocolOp(r)
+		m.SetMessageID(messageID)
+		c.chanOut <- m
+		return nil
+	}
+
+	r := NewExtendedResponse(LDAPResultSuccess)
+	r.SetResponseName(NoticeOfStartTLS)
+	m := ldap.NewLDAPMessageWithProtocolOp(r)
+	m.SetMessageID(messageID)
+
+	// the response has to be written before the TLS handshake, nothing
+	// else may be written in between
+	data, _ := m.Write()
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.bw.Write(data.Bytes())
+	if err := c.bw.Flush(); err != nil {
+		return err
+	}
+	if c.br.Buffered() > 0 {
+		return errors.New("data received before TLS handshake")
+	}
+
+	conn := tls.Server(c.rwc, c.srv.TLSConfig)
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	c.rwc = conn
+	c.br = bufio.NewReader(c.rwc)
+	c.bw = bufio.NewWriter(c.rwc)
+	logs.Debug("客户端[%d]： StartTLS成功", c.Numero)
+	return nil
+}
+
 // ResponseWriter interface is used by an LDAP handler to
 // construct an LDAP response.
 type ResponseWriter interface {
@@ -218,23 +338,30 @@ func (w responseWriterImpl) Write(po ldap.ProtocolOp) {
 }
 
 func (c *client) ProcessRequestMessage(message *ldap.LDAPMessage) {
-	defer c.wg.Done()
+	c.processRequest(c.newRequest(message))
+}
 
-	var m Message
-	m = Message{
+// newRequest wraps message and registers it as outstanding until
+// processRequest returns.
+func (c *client) newRequest(message *ldap.LDAPMessage) *Message {
+	m := &Message{
 		LDAPMessage: message,
 		Done:        make(chan bool, 2),
 		Client:      c,
 	}
+	c.registerRequest(m)
+	return m
+}
 
-	c.registerRequest(&m)
-	defer c.unregisterRequest(&m)
+func (c *client) processRequest(m *Message) {
+	defer c.wg.Done()
+	defer c.unregisterRequest(m)
 
 	var w responseWriterImpl
 	w.chanOut = c.chanOut
 	w.messageID = m.MessageID().Int()
 
-	c.srv.Handler.ServeLDAP(w, &m)
+	c.srv.Handler.ServeLDAP(w, m)
 }
 
 func (c *client) registerRequest(m *Message) {
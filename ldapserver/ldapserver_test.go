@@ -3,14 +3,22 @@ package ldapserver
 import (
 	"bufio"
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"math/big"
 	"net"
 	"strings"
 	"testing"
 	"time"
 
-	proxyproto "github.com/pires/go-proxyproto"
+	goldap "github.com/go-ldap/ldap/v3"
 	ldap "github.com/openstandia/goldap/message"
+	proxyproto "github.com/pires/go-proxyproto"
 )
 
 // ========== Server creation ==========
@@ -1486,3 +1494,625 @@ func TestRoute_Match_DefaultCase(t *testing.T) {
 		t.Error("Default case should return true")
 	}
 }
+
+// ========== StartTLS ==========
+
+func testTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestServer_StartTLS(t *testing.T) {
+	mux := NewRouteMux()
+	mux.Bind(func(w ResponseWriter, m *Message) {
+		if m.GetTLSState() == nil {
+			res := NewBindResponse(LDAPResultConfidentialityRequired)
+			res.SetDiagnosticMessage("StartTLS required")
+			w.Write(res)
+			return
+		}
+		w.Write(NewBindResponse(LDAPResultSuccess))
+	})
+	mux.Extended(func(w ResponseWriter, m *Message) {
+		t.Error("StartTLS should not reach the handler")
+	}).RequestName(NoticeOfStartTLS)
+
+	s := NewServer()
+	s.Handle(mux)
+	s.SetClients("127.0.0.1/8")
+	s.TLSConfig = testTLSConfig(t)
+	ch := make(chan error, 1)
+	go s.ListenAndServe("127.0.0.1:0", ch)
+	if err := <-ch; err != nil {
+		t.Fatalf("ListenAndServe: %v", err)
+	}
+	defer s.Stop()
+
+	conn, err := goldap.DialURL("ldap://" + s.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("DialURL: %v", err)
+	}
+	defer conn.Close()
+
+	err = conn.Bind("cn=admin", "secret")
+	if !goldap.IsErrorWithCode(err, LDAPResultConfidentialityRequired) {
+		t.Errorf("Bind without TLS: err = %v, want confidentialityRequired", err)
+	}
+
+	if err := conn.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("StartTLS: %v", err)
+	}
+	if _, ok := conn.TLSConnectionState(); !ok {
+		t.Error("connection should be encrypted after StartTLS")
+	}
+	if err := conn.Bind("cn=admin", "secret"); err != nil {
+		t.Errorf("Bind after StartTLS: %v", err)
+	}
+}
+
+func TestServer_StartTLS_Refused(t *testing.T) {
+	s := NewServer()
+	s.Handle(NewRouteMux())
+	s.SetClients("127.0.0.1/8")
+	s.TLSConfig = testTLSConfig(t)
+
+	serverPipe, clientPipe := net.Pipe()
+	defer serverPipe.Close()
+	c := s.newClient(clientPipe)
+	c.Numero = 1
+	c.chanOut = make(chan *ldap.LDAPMessage, 1)
+	c.requestList = make(map[int]*Message)
+
+	// StartTLS while another request is outstanding
+	c.requestList[2] = &Message{}
+	if err := c.startTLS(1); err != nil {
+		t.Fatalf("startTLS: %v", err)
+	}
+	m := <-c.chanOut
+	if _, ok := m.ProtocolOp().(ldap.ExtendedResponse); !ok {
+		t.Fatalf("response = %T, want ExtendedResponse", m.ProtocolOp())
+	}
+	data, _ := m.Write()
+	// resultCode ENUMERATED
+	if !bytes.Contains(data.Bytes(), []byte{0x0a, 0x01, LDAPResultOperationsError}) {
+		t.Errorf("response %x should have resultCode operationsError", data.Bytes())
+	}
+	if m.MessageID().Int() != 1 {
+		t.Errorf("MessageID = %d, want 1", m.MessageID().Int())
+	}
+}
+
+func TestServer_StartTLS_Pipelined(t *testing.T) {
+	release := make(chan struct{})
+	mux := NewRouteMux()
+	mux.Delete(func(w ResponseWriter, m *Message) {
+		<-release
+		w.Write(NewDeleteResponse(LDAPResultSuccess))
+	})
+
+	s := NewServer()
+	s.Handle(mux)
+	s.SetClients("127.0.0.1/8")
+	s.TLSConfig = testTLSConfig(t)
+	ch := make(chan error, 1)
+	go s.ListenAndServe("127.0.0.1:0", ch)
+	if err := <-ch; err != nil {
+		t.Fatalf("ListenAndServe: %v", err)
+	}
+	defer s.Stop()
+	defer close(release)
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	// DelRequest "cn=x" (ID 1) and StartTLS (ID 2) in a single write, the
+	// StartTLS is read before the goroutine handling the delete runs
+	request := []byte{0x30, 0x09, 0x02, 0x01, 0x01, 0x4a, 0x04, 'c', 'n', '=', 'x'}
+	request = append(request, 0x30, 0x1d, 0x02, 0x01, 0x02, 0x77, 0x18, 0x80, 0x16)
+	request = append(request, NoticeOfStartTLS...)
+	if _, err := conn.Write(request); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	// messageID 2, resultCode ENUMERATED operationsError
+	if !bytes.HasPrefix(buf[2:n], []byte{0x02, 0x01, 0x02}) || !bytes.Contains(buf[:n], []byte{0x0a, 0x01, LDAPResultOperationsError}) {
+		t.Errorf("response %x should refuse StartTLS with operationsError", buf[:n])
+	}
+}
+
+func TestMessage_GetTLSState(t *testing.T) {
+	m := &Message{}
+	if m.GetTLSState() != nil {
+		t.Error("GetTLSState without client should be nil")
+	}
+	serverPipe, clientPipe := net.Pipe()
+	defer serverPipe.Close()
+	defer clientPipe.Close()
+	m.Client = NewServer().newClient(clientPipe)
+	if m.GetTLSState() != nil {
+		t.Error("GetTLSState of a plain connection should be nil")
+	}
+}
+
+// ========== MemoryBackend ==========
+
+const testLDIF = `version: 1
+# test directory
+dn: dc=example,dc=com
+objectClass: top
+objectClass: domain
+dc: example
+
+dn: ou=People,dc=example,dc=com
+objectClass: organizationalUnit
+ou: People
+
+dn: uid=alice,ou=People,dc=example,dc=com
+objectClass: inetOrgPerson
+uid: alice
+cn: Alice
+ Smith
+sn: Smith
+mail: alice@example.com
+employeeNumber: 10
+userPassword: alice-pw
+
+dn: uid=bob,ou=People,dc=example,dc=com
+objectClass: inetOrgPerson
+uid: bob
+cn:: Qm9iIEpvbmVz
+sn: Jones
+employeeNumber: 9
+userPassword: {SSHA}C7WixiXe6Tf/MvwY/tx/gQB54ABzYWx0
+
+dn: cn=admins,dc=example,dc=com
+objectClass: groupOfNames
+cn: admins
+member: uid=alice, ou=people, dc=example, dc=com
+`
+
+func TestParseLDIF(t *testing.T) {
+	entries, err := ParseLDIF(strings.NewReader(testLDIF))
+	if err != nil {
+		t.Fatalf("ParseLDIF: %v", err)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("len(entries) = %d, want 5", len(entries))
+	}
+	alice := entries[2]
+	if alice.DN != "uid=alice,ou=People,dc=example,dc=com" {
+		t.Errorf("DN = %q", alice.DN)
+	}
+	if cn := alice.GetAttributeValue("CN"); cn != "AliceSmith" {
+		t.Errorf("folded cn = %q, want AliceSmith", cn)
+	}
+	if cn := entries[3].GetAttributeValue("cn"); cn != "Bob Jones" {
+		t.Errorf("base64 cn = %q, want Bob Jones", cn)
+	}
+	if oc := entries[0].GetAttributeValues("objectClass"); len(oc) != 2 {
+		t.Errorf("objectClass = %v, want 2 values", oc)
+	}
+
+	for _, data := range []string{
+		"cn: no dn\n",
+		"dn: cn=x\nchangetype: delete\n",
+		"dn: cn=x\njpegPhoto:< file:///tmp/x.jpg\n",
+		"dn: cn=x\ncn:: !!!\n",
+		"version: 2\n",
+	} {
+		if _, err := ParseLDIF(strings.NewReader(data)); err == nil {
+			t.Errorf("ParseLDIF(%q) should fail", data)
+		}
+	}
+}
+
+func TestParseDN(t *testing.T) {
+	a, naming, err := parseDN("UID=Alice+cn=A\\2C B , OU=People,dc=Example")
+	if err != nil {
+		t.Fatalf("parseDN: %v", err)
+	}
+	b, _, _ := parseDN("cn=a\\, b+uid=alice,ou=people,DC=example")
+	if strings.Join(a, ",") != strings.Join(b, ",") {
+		t.Errorf("%v != %v", a, b)
+	}
+	if len(naming) != 2 || naming[0].attr != "uid" || naming[1].value != "a, b" {
+		t.Errorf("naming = %v", naming)
+	}
+	for _, dn := range []string{"cn", "=x", "cn=x,", "cn=x\\"} {
+		if _, _, err := parseDN(dn); err == nil {
+			t.Errorf("parseDN(%q) should fail", dn)
+		}
+	}
+}
+
+func TestMemoryBackend_LoadLDIF(t *testing.T) {
+	b := NewMemoryBackend()
+	if err := b.LoadLDIF(strings.NewReader(testLDIF)); err != nil {
+		t.Fatalf("LoadLDIF: %v", err)
+	}
+	if e := b.GetEntry("UID=alice, ou=people,dc=EXAMPLE,dc=com"); e == nil || e.GetAttributeValue("sn") != "Smith" {
+		t.Errorf("GetEntry = %v", e)
+	}
+	// duplicates are refused, nothing is added
+	data := "dn: cn=new,dc=example,dc=com\ncn: new\n\ndn: dc=example,dc=com\ndc: example\n"
+	if err := b.LoadLDIF(strings.NewReader(data)); err == nil {
+		t.Error("LoadLDIF with an existing entry should fail")
+	}
+	if b.GetEntry("cn=new,dc=example,dc=com") != nil {
+		t.Error("no entry should be added when LoadLDIF fails")
+	}
+	// GetEntry returns a copy
+	b.GetEntry("dc=example,dc=com").AddAttributeValues("description", "changed")
+	if b.GetEntry("dc=example,dc=com").GetAttribute("description") != nil {
+		t.Error("changing the result of GetEntry should not change the backend")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	tests := []struct {
+		stored, password string
+		want             bool
+	}{
+		{"secret", "secret", true},
+		{"secret", "Secret", false},
+		{"{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", "secret", true},
+		{"{sha}5en6G6MezRroT3XKqkdPOmY/BfQ=", "wrong", false},
+		{"{SSHA}C7WixiXe6Tf/MvwY/tx/gQB54ABzYWx0", "bob-pw", true},
+		{"{SSHA}C7WixiXe6Tf/MvwY/tx/gQB54ABzYWx0", "alice-pw", false},
+		{"{SSHA}invalid", "", false},
+	}
+	for _, tt := range tests {
+		if got := checkPassword([]string{tt.stored}, tt.password); got != tt.want {
+			t.Errorf("checkPassword(%q, %q) = %v, want %v", tt.stored, tt.password, got, tt.want)
+		}
+	}
+}
+
+// testMemoryServer starts a server with the test directory and returns a connection
+func testMemoryServer(t *testing.T) (*MemoryBackend, *goldap.Conn) {
+	t.Helper()
+	b := NewMemoryBackend()
+	if err := b.LoadLDIF(strings.NewReader(testLDIF)); err != nil {
+		t.Fatalf("LoadLDIF: %v", err)
+	}
+	mux := NewRouteMux()
+	b.Mount(mux)
+
+	s := NewServer()
+	s.Handle(mux)
+	s.SetClients("127.0.0.1/8")
+	ch := make(chan error, 1)
+	go s.ListenAndServe("127.0.0.1:0", ch)
+	if err := <-ch; err != nil {
+		t.Fatalf("ListenAndServe: %v", err)
+	}
+	t.Cleanup(s.Stop)
+
+	conn, err := goldap.DialURL("ldap://" + s.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("DialURL: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return b, conn
+}
+
+func testSearch(t *testing.T, conn *goldap.Conn, base string, scope int, filter string, attrs ...string) []string {
+	t.Helper()
+	res, err := conn.Search(goldap.NewSearchRequest(base, scope, goldap.NeverDerefAliases, 0, 0, false, filter, attrs, nil))
+	if err != nil {
+		t.Fatalf("Search(%s, %s): %v", base, filter, err)
+	}
+	var dns []string
+	for _, e := range res.Entries {
+		dns = append(dns, e.DN)
+	}
+	return dns
+}
+
+func TestMemoryBackend_Bind(t *testing.T) {
+	_, conn := testMemoryServer(t)
+	tests := []struct {
+		dn, password string
+		code         uint16
+	}{
+		{"uid=alice,ou=People,dc=example,dc=com", "alice-pw", LDAPResultSuccess},
+		{"UID=Alice, OU=people,dc=example,dc=com", "alice-pw", LDAPResultSuccess},
+		{"uid=bob,ou=People,dc=example,dc=com", "bob-pw", LDAPResultSuccess},
+		{"uid=alice,ou=People,dc=example,dc=com", "ALICE-PW", LDAPResultInvalidCredentials},
+		{"uid=nobody,ou=People,dc=example,dc=com", "alice-pw", LDAPResultInvalidCredentials},
+		{"ou=People,dc=example,dc=com", "x", LDAPResultInvalidCredentials},
+	}
+	for _, tt := range tests {
+		err := conn.Bind(tt.dn, tt.password)
+		if tt.code == LDAPResultSuccess && err != nil || tt.code != LDAPResultSuccess && !goldap.IsErrorWithCode(err, tt.code) {
+			t.Errorf("Bind(%s, %s) = %v, want %d", tt.dn, tt.password, err, tt.code)
+		}
+	}
+	if err := conn.UnauthenticatedBind("uid=alice,ou=People,dc=example,dc=com"); !goldap.IsErrorWithCode(err, LDAPResultUnwillingToPerform) {
+		t.Errorf("unauthenticated Bind = %v, want unwillingToPerform", err)
+	}
+	if err := conn.UnauthenticatedBind(""); err != nil {
+		t.Errorf("anonymous Bind = %v", err)
+	}
+}
+
+func TestMemoryBackend_Search(t *testing.T) {
+	_, conn := testMemoryServer(t)
+	base := "dc=example,dc=com"
+	sub, one, obj := goldap.ScopeWholeSubtree, goldap.ScopeSingleLevel, goldap.ScopeBaseObject
+	tests := []struct {
+		base   string
+		scope  int
+		filter string
+		want   string
+	}{
+		{base, sub, "(objectClass=*)", "dc=example,dc=com;cn=admins,dc=example,dc=com;ou=People,dc=example,dc=com;uid=alice,ou=People,dc=example,dc=com;uid=bob,ou=People,dc=example,dc=com"},
+		{base, one, "(objectClass=*)", "cn=admins,dc=example,dc=com;ou=People,dc=example,dc=com"},
+		{"OU=people, DC=example,dc=com", obj, "(objectClass=*)", "ou=People,dc=example,dc=com"},
+		{base, sub, "(uid=ALICE)", "uid=alice,ou=People,dc=example,dc=com"},
+		{base, sub, "(&(objectClass=inetOrgPerson)(!(uid=alice)))", "uid=bob,ou=People,dc=example,dc=com"},
+		{base, sub, "(|(uid=bob)(cn=admins))", "cn=admins,dc=example,dc=com;uid=bob,ou=People,dc=example,dc=com"},
+		{base, sub, "(cn=bob*)", "uid=bob,ou=People,dc=example,dc=com"},
+		{base, sub, "(cn=*li*sm*h)", "uid=alice,ou=People,dc=example,dc=com"},
+		{base, sub, "(cn=*ones)", "uid=bob,ou=People,dc=example,dc=com"},
+		{base, sub, "(mail=*)", "uid=alice,ou=People,dc=example,dc=com"},
+		{base, sub, "(employeeNumber>=10)", "uid=alice,ou=People,dc=example,dc=com"},
+		{base, sub, "(employeeNumber<=9)", "uid=bob,ou=People,dc=example,dc=com"},
+		{base, sub, "(sn>=K)", "uid=alice,ou=People,dc=example,dc=com"},
+		{base, sub, "(cn~=bobjones)", "uid=bob,ou=People,dc=example,dc=com"},
+		{base, sub, "(member=uid=alice,ou=People,dc=example,dc=com)", "cn=admins,dc=example,dc=com"},
+		{base, sub, "(userPassword=ALICE-PW)", ""},
+		{base, sub, "(cn:caseExactMatch:=admins)", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(testSearch(t, conn, tt.base, tt.scope, tt.filter), ";"); got != tt.want {
+			t.Errorf("Search(%s, %d, %s) = %s, want %s", tt.base, tt.scope, tt.filter, got, tt.want)
+		}
+	}
+
+	_, err := conn.Search(goldap.NewSearchRequest("dc=missing", sub, goldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+	if !goldap.IsErrorWithCode(err, LDAPResultNoSuchObject) {
+		t.Errorf("Search of a missing base = %v, want noSuchObject", err)
+	}
+	res, err := conn.Search(goldap.NewSearchRequest(base, sub, goldap.NeverDerefAliases, 2, 0, false, "(objectClass=*)", nil, nil))
+	if !goldap.IsErrorWithCode(err, LDAPResultSizeLimitExceeded) || res == nil || len(res.Entries) != 2 {
+		t.Errorf("Search with SizeLimit = %v, want 2 entries and sizeLimitExceeded", err)
+	}
+}
+
+func TestMemoryBackend_SearchAttributes(t *testing.T) {
+	_, conn := testMemoryServer(t)
+	search := func(attrs []string, typesOnly bool) *goldap.Entry {
+		res, err := conn.Search(goldap.NewSearchRequest("uid=alice,ou=People,dc=example,dc=com", goldap.ScopeBaseObject,
+			goldap.NeverDerefAliases, 0, 0, typesOnly, "(objectClass=*)", attrs, nil))
+		if err != nil || len(res.Entries) != 1 {
+			t.Fatalf("Search: %v", err)
+		}
+		return res.Entries[0]
+	}
+	if e := search(nil, false); len(e.Attributes) != 6 {
+		t.Errorf("all attributes: %d, want 6 without userPassword", len(e.Attributes))
+	}
+	if e := search([]string{"CN", "mail"}, false); len(e.Attributes) != 2 || e.GetAttributeValue("cn") != "AliceSmith" {
+		t.Errorf("selected attributes: %v", e.Attributes)
+	}
+	if e := search([]string{"1.1"}, false); len(e.Attributes) != 0 {
+		t.Errorf("1.1: %v, want no attributes", e.Attributes)
+	}
+	if e := search([]string{"mail"}, true); len(e.Attributes) != 1 || len(e.Attributes[0].Values) != 0 {
+		t.Errorf("typesOnly: %v, want mail without values", e.Attributes)
+	}
+
+	res, err := conn.Search(goldap.NewSearchRequest("", goldap.ScopeBaseObject, goldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+	if err != nil || len(res.Entries) != 1 {
+		t.Fatalf("root DSE: %v", err)
+	}
+	if nc := res.Entries[0].GetAttributeValues("namingContexts"); len(nc) != 1 || nc[0] != "dc=example,dc=com" {
+		t.Errorf("namingContexts = %v", nc)
+	}
+}
+
+func TestMemoryBackend_AddDelete(t *testing.T) {
+	b, conn := testMemoryServer(t)
+	if err := conn.Bind("uid=alice,ou=People,dc=example,dc=com", "alice-pw"); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	add := goldap.NewAddRequest("uid=carol,ou=People,dc=example,dc=com", nil)
+	add.Attribute("objectClass", []string{"inetOrgPerson"})
+	add.Attribute("uid", []string{"carol"})
+	add.Attribute("userPassword", []string{"carol-pw"})
+	if err := conn.Add(add); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := conn.Bind("uid=carol,ou=People,dc=example,dc=com", "carol-pw"); err != nil {
+		t.Errorf("Bind of the added entry: %v", err)
+	}
+	if err := conn.Add(add); !goldap.IsErrorWithCode(err, LDAPResultEntryAlreadyExists) {
+		t.Errorf("Add of an existing entry = %v, want entryAlreadyExists", err)
+	}
+	orphan := goldap.NewAddRequest("uid=x,ou=missing,dc=example,dc=com", nil)
+	orphan.Attribute("uid", []string{"x"})
+	if err := conn.Add(orphan); !goldap.IsErrorWithCode(err, LDAPResultNoSuchObject) {
+		t.Errorf("Add without parent = %v, want noSuchObject", err)
+	}
+	invalid := goldap.NewAddRequest("invalid", nil)
+	invalid.Attribute("cn", []string{"x"})
+	if err := conn.Add(invalid); !goldap.IsErrorWithCode(err, LDAPResultInvalidDNSyntax) {
+		t.Errorf("Add with invalid DN = %v, want invalidDNSyntax", err)
+	}
+
+	if err := conn.Del(goldap.NewDelRequest("ou=People,dc=example,dc=com", nil)); !goldap.IsErrorWithCode(err, LDAPResultNotAllowedOnNonLeaf) {
+		t.Errorf("Delete of a non-leaf = %v, want notAllowedOnNonLeaf", err)
+	}
+	if err := conn.Del(goldap.NewDelRequest("uid=carol,ou=People,dc=example,dc=com", nil)); err != nil {
+		t.Errorf("Delete: %v", err)
+	}
+	if b.GetEntry("uid=carol,ou=People,dc=example,dc=com") != nil {
+		t.Error("entry should be deleted")
+	}
+	if err := conn.Del(goldap.NewDelRequest("uid=carol,ou=People,dc=example,dc=com", nil)); !goldap.IsErrorWithCode(err, LDAPResultNoSuchObject) {
+		t.Errorf("Delete of a missing entry = %v, want noSuchObject", err)
+	}
+}
+
+func TestMemoryBackend_Modify(t *testing.T) {
+	b, conn := testMemoryServer(t)
+	dn := "uid=alice,ou=People,dc=example,dc=com"
+	if err := conn.Bind(dn, "alice-pw"); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+
+	mod := goldap.NewModifyRequest(dn, nil)
+	mod.Add("telephoneNumber", []string{"1234"})
+	mod.Replace("mail", []string{"a@example.com", "alice@example.org"})
+	mod.Delete("employeeNumber", nil)
+	mod.Delete("objectClass", []string{"INETORGPERSON"})
+	mod.Add("objectClass", []string{"person"})
+	if err := conn.Modify(mod); err != nil {
+		t.Fatalf("Modify: %v", err)
+	}
+	e := b.GetEntry(dn)
+	if e.GetAttributeValue("telephoneNumber") != "1234" || len(e.GetAttributeValues("mail")) != 2 ||
+		e.GetAttribute("employeeNumber") != nil || e.GetAttributeValue("objectClass") != "person" {
+		t.Errorf("entry after Modify: %v", e.Attributes)
+	}
+
+	// a failing change leaves the entry unchanged
+	tests := []struct {
+		mod  func(*goldap.ModifyRequest)
+		code uint16
+	}{
+		{func(m *goldap.ModifyRequest) { m.Add("mail", []string{"A@example.com"}) }, LDAPResultAttributeOrValueExists},
+		{func(m *goldap.ModifyRequest) { m.Delete("mail", []string{"missing@example.com"}) }, LDAPResultNoSuchAttribute},
+		{func(m *goldap.ModifyRequest) { m.Delete("description", nil) }, LDAPResultNoSuchAttribute},
+		{func(m *goldap.ModifyRequest) { m.Replace("uid", []string{"alice2"}) }, LDAPResultNotAllowedOnRDN},
+	}
+	for _, tt := range tests {
+		mod := goldap.NewModifyRequest(dn, nil)
+		mod.Replace("sn", []string{"Changed"})
+		tt.mod(mod)
+		if err := conn.Modify(mod); !goldap.IsErrorWithCode(err, tt.code) {
+			t.Errorf("Modify = %v, want %d", err, tt.code)
+		}
+		if sn := b.GetEntry(dn).GetAttributeValue("sn"); sn != "Smith" {
+			t.Errorf("sn = %s after a failed Modify, want Smith", sn)
+		}
+	}
+
+	mod = goldap.NewModifyRequest("uid=nobody,dc=example,dc=com", nil)
+	mod.Replace("sn", []string{"x"})
+	if err := conn.Modify(mod); !goldap.IsErrorWithCode(err, LDAPResultNoSuchObject) {
+		t.Errorf("Modify of a missing entry = %v, want noSuchObject", err)
+	}
+}
+
+func TestMemoryBackend_Compare(t *testing.T) {
+	_, conn := testMemoryServer(t)
+	dn := "uid=alice,ou=People,dc=example,dc=com"
+	if ok, err := conn.Compare(dn, "sn", "SMITH"); err != nil || !ok {
+		t.Errorf("Compare sn = %v, %v, want true", ok, err)
+	}
+	if ok, err := conn.Compare(dn, "sn", "Jones"); err != nil || ok {
+		t.Errorf("Compare sn = %v, %v, want false", ok, err)
+	}
+	if _, err := conn.Compare(dn, "description", "x"); !goldap.IsErrorWithCode(err, LDAPResultNoSuchAttribute) {
+		t.Errorf("Compare of a missing attribute = %v, want noSuchAttribute", err)
+	}
+	if _, err := conn.Compare("uid=nobody,dc=example,dc=com", "sn", "x"); !goldap.IsErrorWithCode(err, LDAPResultNoSuchObject) {
+		t.Errorf("Compare of a missing entry = %v, want noSuchObject", err)
+	}
+}
+
+func TestMemoryBackend_Access(t *testing.T) {
+	b, conn := testMemoryServer(t)
+	dn := "uid=alice,ou=People,dc=example,dc=com"
+	password := func(attrs ...string) []string {
+		res, err := conn.Search(goldap.NewSearchRequest(dn, goldap.ScopeBaseObject, goldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", attrs, nil))
+		if err != nil || len(res.Entries) != 1 {
+			t.Fatalf("Search: %v", err)
+		}
+		return res.Entries[0].GetAttributeValues("userPassword")
+	}
+	anonymous := func() {
+		t.Helper()
+		if v := password("userPassword"); len(v) != 0 {
+			t.Errorf("anonymous userPassword = %v, want none", v)
+		}
+		if got := testSearch(t, conn, dn, goldap.ScopeBaseObject, "(userPassword=alice-pw)"); len(got) != 0 {
+			t.Errorf("anonymous filter on userPassword = %v, want no entries", got)
+		}
+		if _, err := conn.Compare(dn, "userPassword", "alice-pw"); !goldap.IsErrorWithCode(err, LDAPResultInsufficientAccessRights) {
+			t.Errorf("anonymous Compare of userPassword = %v, want insufficientAccessRights", err)
+		}
+
+		add := goldap.NewAddRequest("uid=carol,ou=People,dc=example,dc=com", nil)
+		add.Attribute("uid", []string{"carol"})
+		if err := conn.Add(add); !goldap.IsErrorWithCode(err, LDAPResultInsufficientAccessRights) {
+			t.Errorf("anonymous Add = %v, want insufficientAccessRights", err)
+		}
+		mod := goldap.NewModifyRequest(dn, nil)
+		mod.Replace("sn", []string{"Changed"})
+		if err := conn.Modify(mod); !goldap.IsErrorWithCode(err, LDAPResultInsufficientAccessRights) {
+			t.Errorf("anonymous Modify = %v, want insufficientAccessRights", err)
+		}
+		if err := conn.Del(goldap.NewDelRequest(dn, nil)); !goldap.IsErrorWithCode(err, LDAPResultInsufficientAccessRights) {
+			t.Errorf("anonymous Delete = %v, want insufficientAccessRights", err)
+		}
+		if e := b.GetEntry(dn); e == nil || e.GetAttributeValue("sn") != "Smith" {
+			t.Error("entry changed by an anonymous connection")
+		}
+	}
+
+	anonymous()
+	if err := conn.UnauthenticatedBind(""); err != nil {
+		t.Fatalf("anonymous Bind: %v", err)
+	}
+	anonymous()
+
+	if err := conn.Bind("uid=bob,ou=People,dc=example,dc=com", "bob-pw"); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	if v := password(); len(v) != 0 {
+		t.Errorf("userPassword of all attributes = %v, want none", v)
+	}
+	if v := password("*"); len(v) != 0 {
+		t.Errorf("userPassword of \"*\" = %v, want none", v)
+	}
+	if v := password("userPassword"); len(v) != 1 || v[0] != "alice-pw" {
+		t.Errorf("requested userPassword = %v, want alice-pw", v)
+	}
+	if got := testSearch(t, conn, dn, goldap.ScopeBaseObject, "(userPassword=alice-pw)"); len(got) != 1 {
+		t.Errorf("bound filter on userPassword = %v, want alice", got)
+	}
+
+	// a failed Bind makes the connection anonymous again
+	if err := conn.Bind("uid=bob,ou=People,dc=example,dc=com", "wrong"); !goldap.IsErrorWithCode(err, LDAPResultInvalidCredentials) {
+		t.Fatalf("Bind = %v, want invalidCredentials", err)
+	}
+	anonymous()
+}
@@ -0,0 +1,115 @@
+package ldapserver
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ParseLDIF parses the content records of an LDIF file (RFC 2849):
+// entries are separated by empty lines, lines starting with a space continue
+// the previous line, "attr:: value" is base64 encoded and lines starting
+// with # are comments. Change records and "attr:< url" are not supported.
+func ParseLDIF(r io.Reader) ([]*Entry, error) {
+	var entries []*Entry
+	var entry *Entry
+	var line string
+	lineNo, start := 0, 0
+
+	flush := func() error {
+		if line == "" {
+			return nil
+		}
+		defer func() { line = "" }()
+		if strings.HasPrefix(line, "#") {
+			return nil
+		}
+		name, value, err := parseLDIFLine(line)
+		if err != nil {
+			return fmt.Errorf("LDIF第%d行错误，%s", start, err)
+		}
+		switch {
+		case entry == nil && len(entries) == 0 && strings.EqualFold(name, "version"):
+			if value != "1" {
+				return fmt.Errorf("LDIF第%d行错误，不支持的版本(%s)", start, value)
+			}
+		case entry == nil:
+			if !strings.EqualFold(name, "dn") {
+				return fmt.Errorf("LDIF第%d行错误，记录必须以dn开始", start)
+			}
+			entry = &Entry{DN: value}
+		case strings.EqualFold(name, "changetype"):
+			return fmt.Errorf("LDIF第%d行错误，不支持修改记录(changetype: %s)", start, value)
+		default:
+			entry.AddAttributeValues(name, value)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lineNo++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.HasPrefix(text, " ") && line != "" {
+			line += text[1:]
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		if text == "" {
+			if entry != nil {
+				entries = append(entries, entry)
+				entry = nil
+			}
+			continue
+		}
+		line, start = text, lineNo
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ParseLDIFFile parses an LDIF file, see ParseLDIF.
+func ParseLDIFFile(filename string) ([]*Entry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseLDIF(f)
+}
+
+// "name: value" or "name:: base64"
+func parseLDIFLine(line string) (name, value string, err error) {
+	i := strings.IndexByte(line, ':')
+	if i <= 0 {
+		return "", "", fmt.Errorf("缺少属性名(%s)", line)
+	}
+	name, value = line[:i], line[i+1:]
+	switch {
+	case strings.HasPrefix(value, ":"):
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			return "", "", fmt.Errorf("属性(%s)的base64编码错误，%s", name, err)
+		}
+		value = string(data)
+	case strings.HasPrefix(value, "<"):
+		return "", "", fmt.Errorf("不支持URL格式的属性值(%s)", name)
+	default:
+		value = strings.TrimLeft(value, " ")
+	}
+	return name, value, nil
+}
@@ -0,0 +1,936 @@
+package ldapserver
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	ldap "github.com/openstandia/goldap/message"
+	logs "github.com/tea4go/gh/log4go"
+)
+
+// Entry is a directory entry of MemoryBackend.
+type Entry struct {
+	DN         string
+	Attributes []*EntryAttribute
+}
+
+// EntryAttribute is an attribute of an Entry, names are case-insensitive.
+type EntryAttribute struct {
+	Name   string
+	Values []string
+}
+
+// GetAttribute returns the attribute with the given name, nil if the entry
+// does not have it.
+func (e *Entry) GetAttribute(name string) *EntryAttribute {
+	for _, attr := range e.Attributes {
+		if strings.EqualFold(attr.Name, name) {
+			return attr
+		}
+	}
+	return nil
+}
+
+// GetAttributeValues returns the values of the attribute, nil if the entry
+// does not have it.
+func (e *Entry) GetAttributeValues(name string) []string {
+	if attr := e.GetAttribute(name); attr != nil {
+		return attr.Values
+	}
+	return nil
+}
+
+// GetAttributeValue returns the first value of the attribute, "" if the entry
+// does not have it.
+func (e *Entry) GetAttributeValue(name string) string {
+	if values := e.GetAttributeValues(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// AddAttributeValues appends values to the attribute, the attribute is
+// created when the entry does not have it.
+func (e *Entry) AddAttributeValues(name string, values ...string) {
+	if attr := e.GetAttribute(name); attr != nil {
+		attr.Values = append(attr.Values, values...)
+		return
+	}
+	e.Attributes = append(e.Attributes, &EntryAttribute{Name: name, Values: append([]string(nil), values...)})
+}
+
+func (e *Entry) removeAttribute(name string) {
+	for i, attr := range e.Attributes {
+		if strings.EqualFold(attr.Name, name) {
+			e.Attributes = append(e.Attributes[:i:i], e.Attributes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (e *Entry) clone() *Entry {
+	c := &Entry{DN: e.DN, Attributes: make([]*EntryAttribute, len(e.Attributes))}
+	for i, attr := range e.Attributes {
+		c.Attributes[i] = &EntryAttribute{Name: attr.Name, Values: append([]string(nil), attr.Values...)}
+	}
+	return c
+}
+
+// resultError is an LDAP result code with its diagnostic message
+type resultError struct {
+	code    int
+	message string
+}
+
+func (e *resultError) Error() string {
+	return e.message
+}
+
+func newResultError(code int, format string, args ...interface{}) error {
+	return &resultError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func resultOf(err error) (int, string) {
+	if err == nil {
+		return LDAPResultSuccess, ""
+	}
+	if re, ok := err.(*resultError); ok {
+		return re.code, re.message
+	}
+	return LDAPResultOther, err.Error()
+}
+
+// MemoryBackend is an in-memory directory information tree, loadable from
+// LDIF. Mount registers its Bind, Search, Add, Modify, Delete and Compare
+// handlers on a RouteMux:
+//
+//	backend := ldapserver.NewMemoryBackend()
+//	if err := backend.LoadLDIFFile("data.ldif"); err != nil {
+//		...
+//	}
+//	routes := ldapserver.NewRouteMux()
+//	backend.Mount(routes)
+//	server.Handle(routes)
+//
+// Simple Bind checks PasswordAttr (plain text, {SHA} or {SSHA}), an empty
+// name and password is an anonymous Bind. Values are compared case-insensitively
+// except PasswordAttr, ordering filters compare integers numerically. Modify
+// applies all changes or none. There is no schema.
+//
+// Access control is minimal, the backend is meant for tests and small
+// directories: Add, Modify and Delete need a non-anonymous Bind, then any entry
+// can be changed. PasswordAttr is returned by Search only when it is listed
+// explicitly by a bound connection, anonymous connections can not use it in
+// filters or Compare.
+type MemoryBackend struct {
+	// PasswordAttr is the attribute checked by simple Bind, "userPassword" when empty.
+	PasswordAttr string
+
+	mu      sync.RWMutex
+	entries map[string]*memoryEntry // normalized DN -> entry
+}
+
+// entries are never changed in place, Modify replaces them, so a search
+// result can be written without holding the lock
+type memoryEntry struct {
+	entry  *Entry
+	rdns   []string // normalized RDNs, the RDN of the entry first
+	naming []dnAVA  // attribute values of the RDN
+}
+
+func (me *memoryEntry) key() string {
+	return strings.Join(me.rdns, ",")
+}
+
+func (me *memoryEntry) parent() string {
+	if len(me.rdns) == 0 {
+		return ""
+	}
+	return strings.Join(me.rdns[1:], ",")
+}
+
+// NewMemoryBackend returns an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{entries: make(map[string]*memoryEntry)}
+}
+
+func (b *MemoryBackend) passwordAttr() string {
+	if b.PasswordAttr == "" {
+		return "userPassword"
+	}
+	return b.PasswordAttr
+}
+
+// LoadLDIF adds the entries of an LDIF file, see ParseLDIF. The parent entries
+// do not have to exist. Nothing is added when an entry is invalid or exists.
+func (b *MemoryBackend) LoadLDIF(r io.Reader) error {
+	entries, err := ParseLDIF(r)
+	if err != nil {
+		return err
+	}
+	return b.addEntries(entries)
+}
+
+// LoadLDIFFile adds the entries of an LDIF file, see LoadLDIF.
+func (b *MemoryBackend) LoadLDIFFile(filename string) error {
+	entries, err := ParseLDIFFile(filename)
+	if err != nil {
+		return err
+	}
+	return b.addEntries(entries)
+}
+
+// AddEntry adds a copy of the entry, the parent entry does not have to exist.
+func (b *MemoryBackend) AddEntry(entry *Entry) error {
+	return b.addEntries([]*Entry{entry})
+}
+
+// GetEntry returns a copy of the entry, nil if it does not exist.
+func (b *MemoryBackend) GetEntry(dn string) *Entry {
+	rdns, _, err := parseDN(dn)
+	if err != nil {
+		return nil
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if me := b.entries[strings.Join(rdns, ",")]; me != nil {
+		return me.entry.clone()
+	}
+	return nil
+}
+
+func (b *MemoryBackend) addEntries(entries []*Entry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	added := make(map[string]*memoryEntry, len(entries))
+	for _, entry := range entries {
+		me, err := newMemoryEntry(entry)
+		if err != nil {
+			return err
+		}
+		key := me.key()
+		if b.entries[key] != nil || added[key] != nil {
+			return newResultError(LDAPResultEntryAlreadyExists, "entry %s already exists", entry.DN)
+		}
+		added[key] = me
+	}
+	if b.entries == nil {
+		b.entries = make(map[string]*memoryEntry)
+	}
+	for key, me := range added {
+		b.entries[key] = me
+	}
+	return nil
+}
+
+func newMemoryEntry(entry *Entry) (*memoryEntry, error) {
+	rdns, naming, err := parseDN(entry.DN)
+	if err != nil {
+		return nil, err
+	}
+	if len(rdns) == 0 {
+		return nil, newResultError(LDAPResultInvalidDNSyntax, "empty DN")
+	}
+	return &memoryEntry{entry: entry.clone(), rdns: rdns, naming: naming}, nil
+}
+
+// Mount registers the Bind, Search, Add, Modify, Delete and Compare handlers
+// of the backend on mux.
+func (b *MemoryBackend) Mount(mux *RouteMux) {
+	mux.Bind(b.HandleBind).Label("MemoryBackend Bind")
+	mux.Search(b.HandleSearch).Label("MemoryBackend Search")
+	mux.Add(b.HandleAdd).Label("MemoryBackend Add")
+	mux.Modify(b.HandleModify).Label("MemoryBackend Modify")
+	mux.Delete(b.HandleDelete).Label("MemoryBackend Delete")
+	mux.Compare(b.HandleCompare).Label("MemoryBackend Compare")
+}
+
+// HandleBind handles a simple Bind with the password of the entry.
+func (b *MemoryBackend) HandleBind(w ResponseWriter, m *Message) {
+	r := m.GetBindRequest()
+	if r.AuthenticationChoice() != "simple" {
+		res := NewBindResponse(LDAPResultAuthMethodNotSupported)
+		res.SetDiagnosticMessage("only simple bind is supported")
+		w.Write(res)
+		return
+	}
+	name, password := string(r.Name()), string(r.AuthenticationSimple())
+	// RFC 4513 4: the connection is anonymous until a Bind succeeds
+	m.SetBindDN("")
+	if name == "" && password == "" {
+		w.Write(NewBindResponse(LDAPResultSuccess))
+		return
+	}
+	if password == "" {
+		// RFC 4513 5.1.2: unauthenticated bind
+		res := NewBindResponse(LDAPResultUnwillingToPerform)
+		res.SetDiagnosticMessage("unauthenticated bind is not allowed")
+		w.Write(res)
+		return
+	}
+
+	entry := b.GetEntry(name)
+	if entry == nil || !checkPassword(entry.GetAttributeValues(b.passwordAttr()), password) {
+		logs.Debug("内存目录：用户(%s)绑定失败", name)
+		w.Write(NewBindResponse(LDAPResultInvalidCredentials))
+		return
+	}
+	m.SetBindDN(entry.DN)
+	w.Write(NewBindResponse(LDAPResultSuccess))
+}
+
+// HandleSearch handles a Search, the root DSE is returned for a base search of "".
+func (b *MemoryBackend) HandleSearch(w ResponseWriter, m *Message) {
+	r := m.GetSearchRequest()
+	bound := m.GetBindDN() != ""
+	entries, err := b.search(string(r.BaseObject()), int(r.Scope()), r.Filter(), bound)
+	if err != nil {
+		code, message := resultOf(err)
+		res := NewSearchResultDoneResponse(code)
+		res.SetDiagnosticMessage(message)
+		w.Write(res)
+		return
+	}
+
+	sizeLimit := int(r.SizeLimit())
+	for i, entry := range entries {
+		select {
+		case <-m.Done:
+			logs.Debug("内存目录：搜索(%s)已放弃", r.BaseObject())
+			return
+		default:
+		}
+		if sizeLimit > 0 && i >= sizeLimit {
+			w.Write(NewSearchResultDoneResponse(LDAPResultSizeLimitExceeded))
+			return
+		}
+		if !bound || !selected(r.Attributes(), b.passwordAttr()) {
+			entry = b.withoutPassword(entry)
+		}
+		w.Write(searchResultEntry(entry, r.Attributes(), bool(r.TypesOnly())))
+	}
+	w.Write(NewSearchResultDoneResponse(LDAPResultSuccess))
+}
+
+// HandleAdd handles an Add, the parent entry must exist.
+func (b *MemoryBackend) HandleAdd(w ResponseWriter, m *Message) {
+	r := m.GetAddRequest()
+	if err := bindRequired(m); err != nil {
+		code, message := resultOf(err)
+		res := NewAddResponse(code)
+		res.SetDiagnosticMessage(message)
+		w.Write(res)
+		return
+	}
+	entry := &Entry{DN: string(r.Entry())}
+	attributes := r.Attributes()
+	for i := range attributes {
+		attr := &attributes[i]
+		values := make([]string, len(attr.Vals()))
+		for j, value := range attr.Vals() {
+			values[j] = string(value)
+		}
+		entry.AddAttributeValues(string(attr.Type_()), values...)
+	}
+
+	err := b.add(entry)
+	code, message := resultOf(err)
+	res := NewAddResponse(code)
+	res.SetDiagnosticMessage(message)
+	w.Write(res)
+}
+
+// HandleModify handles a Modify, all changes are applied or none.
+func (b *MemoryBackend) HandleModify(w ResponseWriter, m *Message) {
+	r := m.GetModifyRequest()
+	if err := bindRequired(m); err != nil {
+		code, message := resultOf(err)
+		res := NewModifyResponse(code)
+		res.SetDiagnosticMessage(message)
+		w.Write(res)
+		return
+	}
+	var changes []memoryChange
+	for _, change := range r.Changes() {
+		attr := change.Modification()
+		values := make([]string, len(attr.Vals()))
+		for i, value := range attr.Vals() {
+			values[i] = string(value)
+		}
+		changes = append(changes, memoryChange{operation: int(change.Operation()), name: string(attr.Type_()), values: values})
+	}
+
+	err := b.modify(string(r.Object()), changes)
+	code, message := resultOf(err)
+	res := NewModifyResponse(code)
+	res.SetDiagnosticMessage(message)
+	w.Write(res)
+}
+
+// HandleDelete handles a Delete of a leaf entry.
+func (b *MemoryBackend) HandleDelete(w ResponseWriter, m *Message) {
+	r := m.GetDeleteRequest()
+	err := bindRequired(m)
+	if err == nil {
+		err = b.delete(string(r))
+	}
+	code, message := resultOf(err)
+	res := NewDeleteResponse(code)
+	res.SetDiagnosticMessage(message)
+	w.Write(res)
+}
+
+// HandleCompare handles a Compare with the equality matching of the backend.
+func (b *MemoryBackend) HandleCompare(w ResponseWriter, m *Message) {
+	r := m.GetCompareRequest()
+	ava := r.Ava()
+	name, value := string(ava.AttributeDesc()), string(ava.AssertionValue())
+
+	code, message := LDAPResultCompareFalse, ""
+	if entry := b.GetEntry(string(r.Entry())); entry == nil {
+		code, message = LDAPResultNoSuchObject, fmt.Sprintf("entry %s does not exist", r.Entry())
+	} else if strings.EqualFold(name, b.passwordAttr()) && m.GetBindDN() == "" {
+		code, message = LDAPResultInsufficientAccessRights, fmt.Sprintf("attribute %s needs a bind", name)
+	} else if attr := entry.GetAttribute(name); attr == nil {
+		code, message = LDAPResultNoSuchAttribute, fmt.Sprintf("entry %s has no attribute %s", r.Entry(), name)
+	} else if b.hasValue(attr, value) {
+		code = LDAPResultCompareTrue
+	}
+	res := NewCompareResponse(code)
+	res.SetDiagnosticMessage(message)
+	w.Write(res)
+}
+
+// Add, Modify and Delete need a non-anonymous Bind
+func bindRequired(m *Message) error {
+	if m.GetBindDN() == "" {
+		return newResultError(LDAPResultInsufficientAccessRights, "anonymous connections can not change entries")
+	}
+	return nil
+}
+
+// withoutPassword returns the entry without PasswordAttr, the entry itself
+// when it does not have it
+func (b *MemoryBackend) withoutPassword(entry *Entry) *Entry {
+	if entry.GetAttribute(b.passwordAttr()) == nil {
+		return entry
+	}
+	c := &Entry{DN: entry.DN}
+	for _, attr := range entry.Attributes {
+		if !strings.EqualFold(attr.Name, b.passwordAttr()) {
+			c.Attributes = append(c.Attributes, attr)
+		}
+	}
+	return c
+}
+
+func (b *MemoryBackend) add(entry *Entry) error {
+	me, err := newMemoryEntry(entry)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := me.key()
+	if b.entries[key] != nil {
+		return newResultError(LDAPResultEntryAlreadyExists, "entry %s already exists", entry.DN)
+	}
+	if parent := me.parent(); parent != "" && b.entries[parent] == nil {
+		return newResultError(LDAPResultNoSuchObject, "parent of %s does not exist", entry.DN)
+	}
+	if b.entries == nil {
+		b.entries = make(map[string]*memoryEntry)
+	}
+	b.entries[key] = me
+	logs.Debug("内存目录：添加条目(%s)", entry.DN)
+	return nil
+}
+
+func (b *MemoryBackend) delete(dn string) error {
+	rdns, _, err := parseDN(dn)
+	if err != nil {
+		return err
+	}
+	key := strings.Join(rdns, ",")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.entries[key] == nil {
+		return newResultError(LDAPResultNoSuchObject, "entry %s does not exist", dn)
+	}
+	for _, me := range b.entries {
+		if me.parent() == key {
+			return newResultError(LDAPResultNotAllowedOnNonLeaf, "entry %s has subordinates", dn)
+		}
+	}
+	delete(b.entries, key)
+	logs.Debug("内存目录：删除条目(%s)", dn)
+	return nil
+}
+
+// a change of a Modify request
+type memoryChange struct {
+	operation int
+	name      string
+	values    []string
+}
+
+func (b *MemoryBackend) modify(dn string, changes []memoryChange) error {
+	rdns, _, err := parseDN(dn)
+	if err != nil {
+		return err
+	}
+	key := strings.Join(rdns, ",")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	me := b.entries[key]
+	if me == nil {
+		return newResultError(LDAPResultNoSuchObject, "entry %s does not exist", dn)
+	}
+
+	entry := me.entry.clone()
+	for _, change := range changes {
+		if err := b.applyChange(entry, change); err != nil {
+			return err
+		}
+	}
+	// the values of the RDN can not be removed
+	for _, ava := range me.naming {
+		if b.hasNamingValue(me.entry, ava) && !b.hasNamingValue(entry, ava) {
+			return newResultError(LDAPResultNotAllowedOnRDN, "attribute %s of the RDN can not be removed", ava.attr)
+		}
+	}
+
+	b.entries[key] = &memoryEntry{entry: entry, rdns: me.rdns, naming: me.naming}
+	logs.Debug("内存目录：修改条目(%s)", dn)
+	return nil
+}
+
+func (b *MemoryBackend) applyChange(entry *Entry, change memoryChange) error {
+	attr := entry.GetAttribute(change.name)
+	switch change.operation {
+	case ModifyRequestChangeOperationAdd:
+		if attr == nil {
+			attr = &EntryAttribute{Name: change.name}
+			entry.Attributes = append(entry.Attributes, attr)
+		}
+		for _, value := range change.values {
+			if b.hasValue(attr, value) {
+				return newResultError(LDAPResultAttributeOrValueExists, "value %s of attribute %s already exists", value, change.name)
+			}
+			attr.Values = append(attr.Values, value)
+		}
+		if len(attr.Values) == 0 {
+			return newResultError(LDAPResultProtocolError, "no values to add to attribute %s", change.name)
+		}
+	case ModifyRequestChangeOperationDelete:
+		if attr == nil {
+			return newResultError(LDAPResultNoSuchAttribute, "attribute %s does not exist", change.name)
+		}
+		for _, value := range change.values {
+			i := b.indexValue(attr, value)
+			if i < 0 {
+				return newResultError(LDAPResultNoSuchAttribute, "value %s of attribute %s does not exist", value, change.name)
+			}
+			attr.Values = append(attr.Values[:i:i], attr.Values[i+1:]...)
+		}
+		if len(change.values) == 0 || len(attr.Values) == 0 {
+			entry.removeAttribute(change.name)
+		}
+	case ModifyRequestChangeOperationReplace:
+		if len(change.values) == 0 {
+			entry.removeAttribute(change.name)
+			return nil
+		}
+		if attr == nil {
+			attr = &EntryAttribute{Name: change.name}
+			entry.Attributes = append(entry.Attributes, attr)
+		}
+		attr.Values = append([]string(nil), change.values...)
+	default:
+		return newResultError(LDAPResultProtocolError, "unsupported modify operation %d", change.operation)
+	}
+	return nil
+}
+
+func (b *MemoryBackend) hasNamingValue(entry *Entry, ava dnAVA) bool {
+	attr := entry.GetAttribute(ava.attr)
+	return attr != nil && b.hasValue(attr, ava.value)
+}
+
+// anonymous searches can not match PasswordAttr
+func (b *MemoryBackend) search(baseDN string, scope int, filter ldap.Filter, bound bool) ([]*Entry, error) {
+	base, _, err := parseDN(baseDN)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if len(base) == 0 && scope == SearchRequestScopeBaseObject {
+		root := b.rootDSE()
+		if b.match(root, filter) {
+			return []*Entry{root}, nil
+		}
+		return nil, nil
+	}
+	if len(base) > 0 && b.entries[strings.Join(base, ",")] == nil {
+		return nil, newResultError(LDAPResultNoSuchObject, "entry %s does not exist", baseDN)
+	}
+
+	var found []*memoryEntry
+	for _, me := range b.entries {
+		depth := len(me.rdns) - len(base)
+		if depth < 0 || !equalRDNs(me.rdns[depth:], base) {
+			continue
+		}
+		switch {
+		case scope == SearchRequestScopeBaseObject && depth != 0:
+			continue
+		case scope == SearchRequestSingleLevel && depth != 1:
+			continue
+		}
+		entry := me.entry
+		if !bound {
+			entry = b.withoutPassword(entry)
+		}
+		if b.match(entry, filter) {
+			found = append(found, me)
+		}
+	}
+	// parents before children
+	sort.Slice(found, func(i, j int) bool {
+		if len(found[i].rdns) != len(found[j].rdns) {
+			return len(found[i].rdns) < len(found[j].rdns)
+		}
+		return found[i].key() < found[j].key()
+	})
+	entries := make([]*Entry, len(found))
+	for i, me := range found {
+		entries[i] = me.entry
+	}
+	return entries, nil
+}
+
+// the root DSE lists the top entries as naming contexts
+func (b *MemoryBackend) rootDSE() *Entry {
+	root := &Entry{}
+	root.AddAttributeValues("objectClass", "top")
+	root.AddAttributeValues("supportedLDAPVersion", "3")
+	var contexts []string
+	for _, me := range b.entries {
+		if b.entries[me.parent()] == nil {
+			contexts = append(contexts, me.entry.DN)
+		}
+	}
+	sort.Strings(contexts)
+	if len(contexts) > 0 {
+		root.AddAttributeValues("namingContexts", contexts...)
+	}
+	return root
+}
+
+func equalRDNs(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// attributes "*" or none selects all attributes, "1.1" none
+func searchResultEntry(entry *Entry, selection ldap.AttributeSelection, typesOnly bool) ldap.SearchResultEntry {
+	res := NewSearchResultEntry(entry.DN)
+	all := len(selection) == 0
+	for _, name := range selection {
+		if name == "*" {
+			all = true
+		}
+	}
+	for _, attr := range entry.Attributes {
+		if !all && !selected(selection, attr.Name) {
+			continue
+		}
+		if typesOnly {
+			res.AddAttribute(ldap.AttributeDescription(attr.Name))
+			continue
+		}
+		values := make([]ldap.AttributeValue, len(attr.Values))
+		for i, value := range attr.Values {
+			values[i] = ldap.AttributeValue(value)
+		}
+		res.AddAttribute(ldap.AttributeDescription(attr.Name), values...)
+	}
+	return res
+}
+
+func selected(selection ldap.AttributeSelection, name string) bool {
+	for _, s := range selection {
+		if strings.EqualFold(string(s), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// match evaluates a search filter, extensible match is not supported
+func (b *MemoryBackend) match(entry *Entry, filter ldap.Filter) bool {
+	switch f := filter.(type) {
+	case ldap.FilterAnd:
+		for _, sub := range f {
+			if !b.match(entry, sub) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, sub := range f {
+			if b.match(entry, sub) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !b.match(entry, f.Filter)
+	case ldap.FilterPresent:
+		// every entry has an object class
+		return strings.EqualFold(string(f), "objectClass") || entry.GetAttribute(string(f)) != nil
+	case ldap.FilterEqualityMatch:
+		ava := ldap.AttributeValueAssertion(f)
+		attr := entry.GetAttribute(string(ava.AttributeDesc()))
+		return attr != nil && b.hasValue(attr, string(ava.AssertionValue()))
+	case ldap.FilterApproxMatch:
+		ava := ldap.AttributeValueAssertion(f)
+		assertion := approxValue(string(ava.AssertionValue()))
+		for _, value := range entry.GetAttributeValues(string(ava.AttributeDesc())) {
+			if approxValue(value) == assertion {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterGreaterOrEqual:
+		ava := ldap.AttributeValueAssertion(f)
+		for _, value := range entry.GetAttributeValues(string(ava.AttributeDesc())) {
+			if compareValues(value, string(ava.AssertionValue())) >= 0 {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterLessOrEqual:
+		ava := ldap.AttributeValueAssertion(f)
+		for _, value := range entry.GetAttributeValues(string(ava.AttributeDesc())) {
+			if compareValues(value, string(ava.AssertionValue())) <= 0 {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterSubstrings:
+		for _, value := range entry.GetAttributeValues(string(f.Type_())) {
+			if matchSubstrings(value, f.Substrings()) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func (b *MemoryBackend) hasValue(attr *EntryAttribute, value string) bool {
+	return b.indexValue(attr, value) >= 0
+}
+
+func (b *MemoryBackend) indexValue(attr *EntryAttribute, value string) int {
+	exact := strings.EqualFold(attr.Name, b.passwordAttr())
+	for i, v := range attr.Values {
+		if v == value || !exact && equalValues(v, value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// case-insensitive, DN values are compared normalized
+func equalValues(a, b string) bool {
+	if strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b)) {
+		return true
+	}
+	if !strings.Contains(a, "=") || !strings.Contains(b, "=") {
+		return false
+	}
+	dnA, _, errA := parseDN(a)
+	dnB, _, errB := parseDN(b)
+	return errA == nil && errB == nil && len(dnA) > 0 && strings.Join(dnA, ",") == strings.Join(dnB, ",")
+}
+
+// approximate match ignores case and spaces
+func approxValue(value string) string {
+	return strings.ToLower(strings.Join(strings.Fields(value), ""))
+}
+
+// integers are compared numerically, other values case-insensitively
+func compareValues(a, b string) int {
+	x, errA := strconv.ParseInt(strings.TrimSpace(a), 10, 64)
+	y, errB := strconv.ParseInt(strings.TrimSpace(b), 10, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func matchSubstrings(value string, substrings []ldap.Substring) bool {
+	value = strings.ToLower(value)
+	for _, substring := range substrings {
+		switch s := substring.(type) {
+		case ldap.SubstringInitial:
+			prefix := strings.ToLower(string(s))
+			if !strings.HasPrefix(value, prefix) {
+				return false
+			}
+			value = value[len(prefix):]
+		case ldap.SubstringAny:
+			part := strings.ToLower(string(s))
+			i := strings.Index(value, part)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(part):]
+		case ldap.SubstringFinal:
+			if !strings.HasSuffix(value, strings.ToLower(string(s))) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkPassword checks a password in plain text, {SHA} or {SSHA}
+func checkPassword(stored []string, password string) bool {
+	for _, value := range stored {
+		var ok bool
+		switch {
+		case strings.HasPrefix(strings.ToUpper(value), "{SHA}"):
+			sum := sha1.Sum([]byte(password))
+			ok = subtle.ConstantTimeCompare([]byte(value[5:]), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+		case strings.HasPrefix(strings.ToUpper(value), "{SSHA}"):
+			data, err := base64.StdEncoding.DecodeString(value[6:])
+			if err != nil || len(data) <= sha1.Size {
+				continue
+			}
+			sum := sha1.Sum(append([]byte(password), data[sha1.Size:]...))
+			ok = subtle.ConstantTimeCompare(data[:sha1.Size], sum[:]) == 1
+		default:
+			ok = subtle.ConstantTimeCompare([]byte(value), []byte(password)) == 1
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// an attribute value of an RDN, normalized
+type dnAVA struct {
+	attr  string
+	value string
+}
+
+// parseDN returns the normalized RDNs of a DN (lower case, without
+// insignificant spaces, the values of a multi-valued RDN sorted), the RDN of
+// the entry first, and the attribute values of the first RDN.
+func parseDN(dn string) (rdns []string, naming []dnAVA, err error) {
+	dn = strings.TrimSpace(dn)
+	if dn == "" {
+		return nil, nil, nil
+	}
+
+	var avas []dnAVA
+	var buf strings.Builder
+	attr, inValue := "", false
+	endAVA := func() error {
+		value := strings.TrimSpace(buf.String())
+		buf.Reset()
+		if !inValue || attr == "" {
+			return newResultError(LDAPResultInvalidDNSyntax, "invalid DN %s", dn)
+		}
+		avas = append(avas, dnAVA{attr: strings.ToLower(attr), value: strings.ToLower(value)})
+		attr, inValue = "", false
+		return nil
+	}
+	endRDN := func() {
+		if rdns == nil {
+			naming = avas
+		}
+		parts := make([]string, len(avas))
+		for i, ava := range avas {
+			parts[i] = ava.attr + "=" + escapeDNValue(ava.value)
+		}
+		sort.Strings(parts)
+		rdns = append(rdns, strings.Join(parts, "+"))
+		avas = nil
+	}
+
+	for i := 0; i < len(dn); i++ {
+		c := dn[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(dn) {
+				return nil, nil, newResultError(LDAPResultInvalidDNSyntax, "invalid DN %s", dn)
+			}
+			if i+2 < len(dn) {
+				if v, err := strconv.ParseUint(dn[i+1:i+3], 16, 8); err == nil {
+					buf.WriteByte(byte(v))
+					i += 2
+					continue
+				}
+			}
+			buf.WriteByte(dn[i+1])
+			i++
+		case c == '=' && !inValue:
+			attr, inValue = strings.TrimSpace(buf.String()), true
+			buf.Reset()
+		case c == '+':
+			if err := endAVA(); err != nil {
+				return nil, nil, err
+			}
+		case c == ',' || c == ';':
+			if err := endAVA(); err != nil {
+				return nil, nil, err
+			}
+			endRDN()
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	if err := endAVA(); err != nil {
+		return nil, nil, err
+	}
+	endRDN()
+	return rdns, naming, nil
+}
+
+func escapeDNValue(value string) string {
+	var buf strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\', ',', '+', '=', ';':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
@@ -1,6 +1,8 @@
 package ldapserver
 
 import (
+	"crypto/tls"
+
 	ldap "github.com/openstandia/goldap/message"
 )
 
@@ -21,6 +23,32 @@ func (m *Message) Abandon() {
 	m.Done <- true
 }
 
+// GetTLSState returns the TLS state of the client connection, nil if the
+// connection is not encrypted. Handlers can use it to require StartTLS before Bind.
+func (m *Message) GetTLSState() *tls.ConnectionState {
+	if m.Client == nil {
+		return nil
+	}
+	return m.Client.GetTLSState()
+}
+
+// GetBindDN returns the DN the connection is bound to, "" when it is anonymous.
+// The server does not track Binds itself, a Bind handler records the result
+// with SetBindDN.
+func (m *Message) GetBindDN() string {
+	if m.Client == nil {
+		return ""
+	}
+	return m.Client.GetBindDN()
+}
+
+// SetBindDN records the DN the connection is bound to, "" makes it anonymous.
+func (m *Message) SetBindDN(dn string) {
+	if m.Client != nil {
+		m.Client.SetBindDN(dn)
+	}
+}
+
 func (m *Message) GetAbandonRequest() ldap.AbandonRequest {
 	return m.ProtocolOp().(ldap.AbandonRequest)
 }
@@ -28,6 +28,10 @@ type Server struct {
 	// If it returns non-nil, the connection is closed.
 	onNewConnection func(c net.Conn) error
 
+	// TLSConfig, if non-nil, enables the StartTLS extended operation (RFC 4511 4.14),
+	// the server upgrades the connection itself and StartTLS never reaches the Handler.
+	TLSConfig *tls.Config
+
 	// Handler handles ldap message received from client
 	// it SHOULD "implement" RequestHandler interface
 	Handler Handler
@@ -35,6 +35,7 @@ package logs
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -95,7 +96,7 @@ type TLogger struct {
 	msgChanLen    int64         // 日志对象通道大小
 	msgChan       chan *tLogMsg // 日志对象通道
 	signalChan    chan string   // 控制（flush / close）消息通道
-	lastTime      time.Time     // 最后写入日志时间
+	lastTime      atomic.Int64  // 最后写入日志时间（UnixNano）
 	wg            sync.WaitGroup
 	outputs       []*nameLogger
 }
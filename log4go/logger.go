@@ -173,7 +173,7 @@ func (bl *TLogger) Write(p []byte) (n int, err error) {
 }
 
 func (bl *TLogger) writeMsg(logLevel int, msg string, v ...interface{}) error {
-	bl.lastTime = time.Now()
+	bl.lastTime.Store(time.Now().UnixNano())
 
 	// 如果没有初始化，则初始化控制台日志
 	if !bl.init_flag {
@@ -303,7 +303,11 @@ func (bl *TLogger) GetLevel(adapters ...string) int {
 
 // GetLastLogTime 获取最后日志时间
 func (bl *TLogger) GetLastLogTime() time.Time {
-	return bl.lastTime
+	nsec := bl.lastTime.Load()
+	if nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec)
 }
 
 // SetLogFuncCallDepth set log funcCallDepth
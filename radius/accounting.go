@@ -0,0 +1,312 @@
+package radius
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	logs "github.com/tea4go/gh/log4go"
+)
+
+// 会话超过 StaleTimeout 没有收到计费包时视为过期，没有设置时按 Acct-Interim-Interval
+// 的倍数计算，包里也没有时使用默认值。
+const (
+	defaultStaleTimeout   = time.Hour
+	staleIntervalMultiple = 3
+)
+
+// TAcctSession 是一个计费会话，由 NAS 和 Acct-Session-Id 标识。
+type TAcctSession struct {
+	SessionId        string    `json:"session_id"`
+	NAS              string    `json:"nas"` // NAS-IP-Address，没有时为 NAS-Identifier 或客户端IP
+	UserName         string    `json:"user_name"`
+	FramedIP         string    `json:"framed_ip,omitempty"`
+	CallingStationId string    `json:"calling_station_id,omitempty"`
+	CalledStationId  string    `json:"called_station_id,omitempty"`
+	NASPort          uint32    `json:"nas_port,omitempty"`
+	InterimInterval  uint32    `json:"interim_interval,omitempty"` // Acct-Interim-Interval，秒
+	StartTime        time.Time `json:"start_time"`
+	UpdateTime       time.Time `json:"update_time"` // 最近一次收到计费包的时间
+	StopTime         time.Time `json:"stop_time,omitempty"`
+	SessionTime      uint32    `json:"session_time"` // Acct-Session-Time，秒
+	InputOctets      uint64    `json:"input_octets"` // 包括 Acct-Input-Gigawords
+	OutputOctets     uint64    `json:"output_octets"`
+	InputPackets     uint32    `json:"input_packets"`
+	OutputPackets    uint32    `json:"output_packets"`
+	TerminateCause   string    `json:"terminate_cause,omitempty"`
+	Active           bool      `json:"active"`
+}
+
+// Key 返回会话的唯一标识
+func (s *TAcctSession) Key() string {
+	return s.NAS + "/" + s.SessionId
+}
+
+func (s *TAcctSession) String() string {
+	return fmt.Sprintf("会话[%s] 用户=%s 时长=%ds 上行=%d 下行=%d", s.Key(), s.UserName, s.SessionTime, s.InputOctets, s.OutputOctets)
+}
+
+// AcctHandler 处理 Accounting-Request：按 Start/Interim-Update/Stop 跟踪会话、
+// 计算用量并写入 Storage，成功后回复 Accounting-Response。写入失败时不回复，
+// NAS 会重发。Accounting-On/Off 结束该 NAS 的所有会话。Request Authenticator 由 Server 校验。
+//
+//	acct, err := radius.NewAcctHandler(storage)
+//	server.Handler = acct
+type AcctHandler struct {
+	// 会话存储，为nil时只保存在内存中
+	Storage IAcctStorage
+	// 会话超过该时间没有收到计费包即视为过期，默认为 Acct-Interim-Interval 的3倍，
+	// 没有 Acct-Interim-Interval 时为1小时
+	StaleTimeout time.Duration
+	// 处理其他请求（如 Access-Request），为nil时忽略
+	Next Handler
+
+	mu       sync.Mutex
+	sessions map[string]*TAcctSession // 活动会话
+}
+
+// NewAcctHandler 返回计费处理器，并从 storage 中加载活动会话。
+func NewAcctHandler(storage IAcctStorage) (*AcctHandler, error) {
+	h := &AcctHandler{
+		Storage:  storage,
+		sessions: make(map[string]*TAcctSession),
+	}
+	if storage == nil {
+		return h, nil
+	}
+	sessions, err := storage.ListSessions()
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		if session.Active {
+			h.sessions[session.Key()] = session
+		}
+	}
+	return h, nil
+}
+
+func (h *AcctHandler) ServeRadius(w ResponseWriter, p *TDataPacket) {
+	if p.Code != CodeAccountingRequest {
+		if h.Next != nil {
+			h.Next.ServeRadius(w, p)
+		}
+		return
+	}
+	if _, err := h.Account(p, addrIP(w.RemoteAddr()).String()); err != nil {
+		logs.Warning("[%s]==>处理计费请求包(#%d)失败，%s", w.RemoteAddr(), p.Identifier, err.Error())
+		return
+	}
+	w.AccountingResponse()
+}
+
+// Account 按计费请求更新会话，nas 为请求的来源（NAS-IP-Address 和 NAS-Identifier 都没有时使用），
+// 返回更新后的会话，Accounting-On/Off 返回nil。
+func (h *AcctHandler) Account(p *TDataPacket, nas string) (*TAcctSession, error) {
+	statusName := p.GetValueName("Acct-Status-Type")
+	if statusName == "" {
+		return nil, errors.New("取属性(Acct-Status-Type)失败。")
+	}
+	if ip, ok := p.GetValue("NAS-IP-Address").(fmt.Stringer); ok {
+		nas = ip.String()
+	} else if id := p.GetString("NAS-Identifier"); id != "" {
+		nas = id
+	}
+
+	// 计费包可能延迟发送，事件时间要减去 Acct-Delay-Time
+	now := time.Now()
+	eventTime := now
+	if delay, ok := p.GetValue("Acct-Delay-Time").(uint32); ok {
+		eventTime = eventTime.Add(-time.Duration(delay) * time.Second)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sessions == nil {
+		h.sessions = make(map[string]*TAcctSession)
+	}
+
+	switch statusName {
+	case "Accounting-On", "Accounting-Off":
+		return nil, h.stopNAS(nas, eventTime)
+	case "Start", "Interim-Update", "Stop":
+	default:
+		return nil, fmt.Errorf("不支持的计费类型(Acct-Status-Type=%s)", statusName)
+	}
+
+	sessionID := p.GetString("Acct-Session-Id")
+	if sessionID == "" {
+		return nil, errors.New("取属性(Acct-Session-Id)失败。")
+	}
+	key := nas + "/" + sessionID
+
+	session := h.sessions[key]
+	if session == nil {
+		// 收到 Interim-Update/Stop 时可能丢了 Start，按收到的包建立会话
+		session = &TAcctSession{SessionId: sessionID, NAS: nas, Active: true}
+		session.StartTime = eventTime
+		if statusName != "Start" {
+			if sessionTime, ok := p.GetValue("Acct-Session-Time").(uint32); ok {
+				session.StartTime = eventTime.Add(-time.Duration(sessionTime) * time.Second)
+			}
+			logs.Warning("计费会话(%s)没有收到Start，按%s建立。", key, statusName)
+		}
+	} else {
+		copied := *session
+		session = &copied
+	}
+	session.update(p)
+	session.UpdateTime = now
+
+	if statusName == "Stop" {
+		session.Active = false
+		session.StopTime = eventTime
+		session.TerminateCause = p.GetValueName("Acct-Terminate-Cause")
+	}
+
+	if h.Storage != nil {
+		if err := h.Storage.SaveSession(session); err != nil {
+			return nil, err
+		}
+	}
+	if session.Active {
+		h.sessions[key] = session
+	} else {
+		delete(h.sessions, key)
+	}
+	logs.Debug("计费%s %s", statusName, session.String())
+	return session, nil
+}
+
+// 用计费包中的属性更新会话
+func (s *TAcctSession) update(p *TDataPacket) {
+	if name := p.GetString("User-Name"); name != "" {
+		s.UserName = name
+	}
+	if ip := p.GetString("Framed-IP-Address"); ip != "" {
+		s.FramedIP = ip
+	}
+	if id := p.GetString("Calling-Station-Id"); id != "" {
+		s.CallingStationId = id
+	}
+	if id := p.GetString("Called-Station-Id"); id != "" {
+		s.CalledStationId = id
+	}
+	if port, ok := p.GetValue("NAS-Port").(uint32); ok {
+		s.NASPort = port
+	}
+	if interval, ok := p.GetValue("Acct-Interim-Interval").(uint32); ok {
+		s.InterimInterval = interval
+	}
+	if v, ok := p.GetValue("Acct-Session-Time").(uint32); ok {
+		s.SessionTime = v
+	}
+	if v, ok := p.GetValue("Acct-Input-Octets").(uint32); ok {
+		giga, _ := p.GetValue("Acct-Input-Gigawords").(uint32)
+		s.InputOctets = uint64(giga)<<32 | uint64(v)
+	}
+	if v, ok := p.GetValue("Acct-Output-Octets").(uint32); ok {
+		giga, _ := p.GetValue("Acct-Output-Gigawords").(uint32)
+		s.OutputOctets = uint64(giga)<<32 | uint64(v)
+	}
+	if v, ok := p.GetValue("Acct-Input-Packets").(uint32); ok {
+		s.InputPackets = v
+	}
+	if v, ok := p.GetValue("Acct-Output-Packets").(uint32); ok {
+		s.OutputPackets = v
+	}
+}
+
+// NAS 重启，结束该 NAS 的所有活动会话
+func (h *AcctHandler) stopNAS(nas string, eventTime time.Time) error {
+	for key, session := range h.sessions {
+		if session.NAS != nas {
+			continue
+		}
+		if err := h.stopSession(key, session, eventTime, "NAS-Reboot"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *AcctHandler) stopSession(key string, session *TAcctSession, stopTime time.Time, cause string) error {
+	stopped := *session
+	stopped.Active = false
+	stopped.StopTime = stopTime
+	stopped.TerminateCause = cause
+	if h.Storage != nil {
+		if err := h.Storage.SaveSession(&stopped); err != nil {
+			return err
+		}
+	}
+	delete(h.sessions, key)
+	logs.Info("结束计费%s，原因：%s", stopped.String(), cause)
+	return nil
+}
+
+// ActiveSessions 返回用户的活动会话，username 为空时返回所有活动会话，按开始时间排序。
+func (h *AcctHandler) ActiveSessions(username string) []*TAcctSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.filter(func(s *TAcctSession) bool {
+		return username == "" || s.UserName == username
+	})
+}
+
+// StaleSessions 返回超过 StaleTimeout 没有收到计费包的活动会话。
+func (h *AcctHandler) StaleSessions() []*TAcctSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	return h.filter(func(s *TAcctSession) bool {
+		return h.isStale(s, now)
+	})
+}
+
+// CloseStaleSessions 结束过期的会话（Terminate-Cause 为 "Stale"），返回结束的会话。
+func (h *AcctHandler) CloseStaleSessions() ([]*TAcctSession, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	stale := h.filter(func(s *TAcctSession) bool {
+		return h.isStale(s, now)
+	})
+	for _, session := range stale {
+		if err := h.stopSession(session.Key(), session, session.UpdateTime, "Stale"); err != nil {
+			return nil, err
+		}
+		session.Active = false
+		session.StopTime = session.UpdateTime
+		session.TerminateCause = "Stale"
+	}
+	return stale, nil
+}
+
+func (h *AcctHandler) isStale(s *TAcctSession, now time.Time) bool {
+	timeout := h.StaleTimeout
+	if timeout == 0 {
+		timeout = defaultStaleTimeout
+		if s.InterimInterval > 0 {
+			timeout = staleIntervalMultiple * time.Duration(s.InterimInterval) * time.Second
+		}
+	}
+	return now.Sub(s.UpdateTime) > timeout
+}
+
+// 返回匹配的会话副本，按开始时间排序
+func (h *AcctHandler) filter(match func(s *TAcctSession) bool) []*TAcctSession {
+	result := make([]*TAcctSession, 0)
+	for _, session := range h.sessions {
+		if match(session) {
+			copied := *session
+			result = append(result, &copied)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+	return result
+}
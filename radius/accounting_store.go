@@ -0,0 +1,178 @@
+package radius
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/nutsdb/nutsdb"
+	"github.com/tea4go/gh/nustdbclient"
+)
+
+// IAcctStorage 是计费会话的存储，SaveSession 按 Key() 覆盖已有的记录。
+type IAcctStorage interface {
+	SaveSession(session *TAcctSession) error
+	// GetSession 返回会话，不存在时返回nil
+	GetSession(key string) (*TAcctSession, error)
+	// ListSessions 返回所有会话（包括已经结束的）
+	ListSessions() ([]*TAcctSession, error)
+}
+
+// TFileAcctStorage 把会话按 JSON 行追加到文件中，同一个会话以最后一行为准，
+// 文件本身就是完整的计费流水。
+type TFileAcctStorage struct {
+	filename string
+	mu       sync.Mutex
+	file     *os.File
+	sessions map[string]*TAcctSession
+}
+
+// NewFileAcctStorage 打开（不存在时创建）计费文件，并加载已有的会话。
+func NewFileAcctStorage(filename string) (*TFileAcctStorage, error) {
+	s := &TFileAcctStorage{
+		filename: filename,
+		sessions: make(map[string]*TAcctSession),
+	}
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		session := &TAcctSession{}
+		if err := json.Unmarshal([]byte(line), session); err != nil {
+			file.Close()
+			return nil, errors.New("计费文件格式错误，" + err.Error())
+		}
+		s.sessions[session.Key()] = session
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.file = file
+	return s, nil
+}
+
+func (s *TFileAcctStorage) SaveSession(session *TAcctSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	copied := *session
+	s.sessions[session.Key()] = &copied
+	return nil
+}
+
+func (s *TFileAcctStorage) GetSession(key string) (*TAcctSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session := s.sessions[key]
+	if session == nil {
+		return nil, nil
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (s *TFileAcctStorage) ListSessions() ([]*TAcctSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]*TAcctSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		copied := *session
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+// Close 关闭计费文件
+func (s *TFileAcctStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// 计费会话在 NustDB 中的键前缀
+const nustDBAcctPrefix = "radius_acct:"
+
+// TNustDBAcctStorage 把会话以 JSON 保存在 NustDB 的默认 Bucket 中。
+type TNustDBAcctStorage struct {
+	client *nustdbclient.TNustDBClient
+}
+
+// NewNustDBAcctStorage 返回使用 client 的存储
+//
+//	client, err := nustdbclient.InitInstance("radius", "./data", false)
+//	storage := radius.NewNustDBAcctStorage(client)
+func NewNustDBAcctStorage(client *nustdbclient.TNustDBClient) *TNustDBAcctStorage {
+	return &TNustDBAcctStorage{client: client}
+}
+
+func (s *TNustDBAcctStorage) SaveSession(session *TAcctSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.client.SetValue(nustDBAcctPrefix+session.Key(), string(data))
+}
+
+func (s *TNustDBAcctStorage) GetSession(key string) (*TAcctSession, error) {
+	value, err := s.client.GetValue(nustDBAcctPrefix + key)
+	if err != nil {
+		if errors.Is(err, nutsdb.ErrKeyNotFound) || errors.Is(err, nutsdb.ErrNotFoundKey) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	session := &TAcctSession{}
+	if err := json.Unmarshal([]byte(value), session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *TNustDBAcctStorage) ListSessions() ([]*TAcctSession, error) {
+	items, err := s.client.GetAllValue("")
+	if err != nil {
+		if errors.Is(err, nutsdb.ErrBucketEmpty) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	result := make([]*TAcctSession, 0, len(items))
+	for _, item := range items {
+		if !strings.HasPrefix(item.Key, nustDBAcctPrefix) {
+			continue
+		}
+		session := &TAcctSession{}
+		if err := json.Unmarshal([]byte(item.Value), session); err != nil {
+			return nil, err
+		}
+		result = append(result, session)
+	}
+	return result, nil
+}
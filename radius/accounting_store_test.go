@@ -0,0 +1,86 @@
+package radius
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tea4go/gh/nustdbclient"
+)
+
+// testAcctStorage tests save, get and list of an IAcctStorage
+func testAcctStorage(t *testing.T, storage IAcctStorage) {
+	t.Helper()
+	if session, err := storage.GetSession("nas/missing"); err != nil || session != nil {
+		t.Errorf("Expected nil for missing session, got %v, %v", session, err)
+	}
+
+	session := &TAcctSession{SessionId: "s1", NAS: "nas", UserName: "alice", StartTime: time.Now().Truncate(time.Second), Active: true}
+	if err := storage.SaveSession(session); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+	session.InputOctets = 1 << 33
+	session.Active = false
+	if err := storage.SaveSession(session); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+	storage.SaveSession(&TAcctSession{SessionId: "s2", NAS: "nas", UserName: "bob", Active: true})
+
+	got, err := storage.GetSession("nas/s1")
+	if err != nil || got == nil {
+		t.Fatalf("GetSession failed: %v", err)
+	}
+	if got.Active || got.InputOctets != 1<<33 || !got.StartTime.Equal(session.StartTime) {
+		t.Errorf("Expected latest session, got %+v", got)
+	}
+	sessions, err := storage.ListSessions()
+	if err != nil || len(sessions) != 2 {
+		t.Errorf("Expected 2 sessions, got %d, %v", len(sessions), err)
+	}
+}
+
+// TestFileAcctStorage tests TFileAcctStorage and reloading the file
+func TestFileAcctStorage(t *testing.T) {
+	filename := t.TempDir() + "/acct.log"
+	storage, err := NewFileAcctStorage(filename)
+	if err != nil {
+		t.Fatalf("NewFileAcctStorage failed: %v", err)
+	}
+	testAcctStorage(t, storage)
+	storage.Close()
+	if err := storage.SaveSession(&TAcctSession{SessionId: "s3"}); err == nil {
+		t.Error("Expected error after Close")
+	}
+
+	storage, err = NewFileAcctStorage(filename)
+	if err != nil {
+		t.Fatalf("NewFileAcctStorage failed: %v", err)
+	}
+	defer storage.Close()
+	h, err := NewAcctHandler(storage)
+	if err != nil {
+		t.Fatalf("NewAcctHandler failed: %v", err)
+	}
+	active := h.ActiveSessions("")
+	if len(active) != 1 || active[0].UserName != "bob" {
+		t.Errorf("Expected bob to be loaded as active, got %v", active)
+	}
+
+	os.WriteFile(filename, []byte("{bad json\n"), 0644)
+	if _, err := NewFileAcctStorage(filename); err == nil {
+		t.Error("Expected error for invalid file")
+	}
+}
+
+// TestNustDBAcctStorage tests TNustDBAcctStorage
+func TestNustDBAcctStorage(t *testing.T) {
+	client, err := nustdbclient.InitInstance("radius_test", t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("InitInstance failed: %v", err)
+	}
+	storage := NewNustDBAcctStorage(client)
+	if sessions, err := storage.ListSessions(); err != nil || len(sessions) != 0 {
+		t.Errorf("Expected empty storage, got %d, %v", len(sessions), err)
+	}
+	testAcctStorage(t, storage)
+}
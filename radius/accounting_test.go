@@ -0,0 +1,211 @@
+package radius
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// newAcctRequest returns an Accounting-Request for session on NAS 10.0.0.1
+func newAcctRequest(status string, session string, attrs ...interface{}) *TDataPacket {
+	packet := NewPacket(CodeAccountingRequest, []byte("secret"))
+	packet.AddAttr("Acct-Status-Type", status)
+	packet.AddAttr("NAS-IP-Address", net.ParseIP("10.0.0.1").To4())
+	if session != "" {
+		packet.AddAttr("Acct-Session-Id", session)
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		packet.AddAttr(attrs[i].(string), attrs[i+1])
+	}
+	return packet
+}
+
+// TestAcctHandlerSessionLifecycle tests Start, Interim-Update and Stop of a session
+func TestAcctHandlerSessionLifecycle(t *testing.T) {
+	h, err := NewAcctHandler(nil)
+	if err != nil {
+		t.Fatalf("NewAcctHandler failed: %v", err)
+	}
+
+	session, err := h.Account(newAcctRequest("Start", "s1", "User-Name", "alice", "Acct-Interim-Interval", uint32(60)), "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if session.Key() != "10.0.0.1/s1" || !session.Active || session.UserName != "alice" {
+		t.Errorf("Expected active session 10.0.0.1/s1 of alice, got %s", session)
+	}
+
+	_, err = h.Account(newAcctRequest("Interim-Update", "s1",
+		"Acct-Session-Time", uint32(60),
+		"Acct-Input-Octets", uint32(100),
+		"Acct-Input-Gigawords", uint32(1),
+		"Acct-Output-Octets", uint32(200)), "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Interim-Update failed: %v", err)
+	}
+	active := h.ActiveSessions("alice")
+	if len(active) != 1 {
+		t.Fatalf("Expected 1 active session, got %d", len(active))
+	}
+	if active[0].InputOctets != 1<<32+100 || active[0].OutputOctets != 200 || active[0].SessionTime != 60 {
+		t.Errorf("Expected usage to be updated, got %s", active[0])
+	}
+	if len(h.ActiveSessions("bob")) != 0 {
+		t.Error("Expected no active session for bob")
+	}
+
+	session, err = h.Account(newAcctRequest("Stop", "s1",
+		"Acct-Session-Time", uint32(90),
+		"Acct-Terminate-Cause", "User-Request"), "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if session.Active || session.TerminateCause != "User-Request" || session.StopTime.IsZero() {
+		t.Errorf("Expected stopped session, got %+v", session)
+	}
+	if session.UserName != "alice" || session.InputOctets != 1<<32+100 {
+		t.Errorf("Expected Stop to keep earlier values, got %s", session)
+	}
+	if len(h.ActiveSessions("")) != 0 {
+		t.Error("Expected no active session after Stop")
+	}
+}
+
+// TestAcctHandlerMissedStart tests sessions created from Interim-Update and the NAS key fallback
+func TestAcctHandlerMissedStart(t *testing.T) {
+	h, _ := NewAcctHandler(nil)
+
+	packet := NewPacket(CodeAccountingRequest, []byte("secret"))
+	packet.AddAttr("Acct-Status-Type", "Interim-Update")
+	packet.AddAttr("Acct-Session-Id", "s2")
+	packet.AddAttr("Acct-Session-Time", uint32(600))
+	session, err := h.Account(packet, "192.168.1.1")
+	if err != nil {
+		t.Fatalf("Interim-Update failed: %v", err)
+	}
+	if session.NAS != "192.168.1.1" {
+		t.Errorf("Expected NAS 192.168.1.1, got %s", session.NAS)
+	}
+	if started := time.Since(session.StartTime); started < 599*time.Second || started > 601*time.Second {
+		t.Errorf("Expected start time 600s ago, got %s", started)
+	}
+
+	packet.AddAttr("NAS-Identifier", "nas-1")
+	if session, _ := h.Account(packet, "192.168.1.1"); session.NAS != "nas-1" {
+		t.Errorf("Expected NAS-Identifier to be used, got %s", session.NAS)
+	}
+	if len(h.ActiveSessions("")) != 2 {
+		t.Errorf("Expected 2 active sessions, got %d", len(h.ActiveSessions("")))
+	}
+
+	if _, err := h.Account(newAcctRequest("Start", ""), ""); err == nil {
+		t.Error("Expected error without Acct-Session-Id")
+	}
+	if _, err := h.Account(NewPacket(CodeAccountingRequest, []byte("secret")), ""); err == nil {
+		t.Error("Expected error without Acct-Status-Type")
+	}
+}
+
+// TestAcctHandlerAccountingOn tests that Accounting-On stops all sessions of the NAS
+func TestAcctHandlerAccountingOn(t *testing.T) {
+	storage, err := NewFileAcctStorage(t.TempDir() + "/acct.log")
+	if err != nil {
+		t.Fatalf("NewFileAcctStorage failed: %v", err)
+	}
+	defer storage.Close()
+	h, _ := NewAcctHandler(storage)
+
+	h.Account(newAcctRequest("Start", "a", "User-Name", "alice"), "")
+	h.Account(newAcctRequest("Start", "b", "User-Name", "bob"), "")
+	other := newAcctRequest("Start", "c", "User-Name", "carol")
+	other.Set("NAS-IP-Address", net.ParseIP("10.0.0.2").To4())
+	h.Account(other, "")
+
+	if _, err := h.Account(newAcctRequest("Accounting-On", ""), ""); err != nil {
+		t.Fatalf("Accounting-On failed: %v", err)
+	}
+	active := h.ActiveSessions("")
+	if len(active) != 1 || active[0].UserName != "carol" {
+		t.Errorf("Expected only carol to be active, got %v", active)
+	}
+	session, _ := storage.GetSession("10.0.0.1/a")
+	if session == nil || session.Active || session.TerminateCause != "NAS-Reboot" {
+		t.Errorf("Expected stored session to be stopped by NAS-Reboot, got %+v", session)
+	}
+}
+
+// TestAcctHandlerStaleSessions tests stale session detection
+func TestAcctHandlerStaleSessions(t *testing.T) {
+	h, _ := NewAcctHandler(nil)
+	h.Account(newAcctRequest("Start", "s1", "User-Name", "alice"), "")
+	h.Account(newAcctRequest("Start", "s2", "User-Name", "bob", "Acct-Interim-Interval", uint32(1)), "")
+
+	// back-date bob's last update past 3 interim intervals
+	h.mu.Lock()
+	h.sessions["10.0.0.1/s2"].UpdateTime = time.Now().Add(-4 * time.Second)
+	h.mu.Unlock()
+
+	stale := h.StaleSessions()
+	if len(stale) != 1 || stale[0].UserName != "bob" {
+		t.Fatalf("Expected bob to be stale, got %v", stale)
+	}
+
+	h.StaleTimeout = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	closed, err := h.CloseStaleSessions()
+	if err != nil {
+		t.Fatalf("CloseStaleSessions failed: %v", err)
+	}
+	if len(closed) != 2 || closed[0].TerminateCause != "Stale" || closed[0].Active {
+		t.Errorf("Expected 2 stale sessions closed, got %v", closed)
+	}
+	if len(h.ActiveSessions("")) != 0 {
+		t.Error("Expected no active session after closing stale sessions")
+	}
+}
+
+// TestAcctHandlerServer tests accounting through a server and client
+func TestAcctHandlerServer(t *testing.T) {
+	secret := []byte("secret")
+	h, _ := NewAcctHandler(nil)
+	h.Next = HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+		w.AccessAccept()
+	})
+	server := &Server{
+		Dictionary: Builtin,
+		Handler:    h,
+		ClientsMap: map[string]string{"127.0.0.1": string(secret)},
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	go server.Serve(pc)
+	defer server.Close()
+	addr := pc.LocalAddr().String()
+
+	client := &Client{ReadTimeout: time.Second}
+	defer client.Close()
+
+	request := NewPacket(CodeAccountingRequest, secret)
+	request.AddAttr("Acct-Status-Type", "Start")
+	request.AddAttr("Acct-Session-Id", "s1")
+	request.AddAttr("User-Name", "alice")
+	response, err := client.SendPacket(request, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccountingResponse {
+		t.Errorf("Expected Accounting-Response, got %d", response.Code)
+	}
+	active := h.ActiveSessions("alice")
+	if len(active) != 1 || active[0].NAS != "127.0.0.1" {
+		t.Errorf("Expected session keyed by client IP, got %v", active)
+	}
+
+	access := NewPacket(CodeAccessRequest, secret)
+	access.AddAttr("User-Name", "alice")
+	if response, err := client.SendPacket(access, addr); err != nil || response.Code != CodeAccessAccept {
+		t.Errorf("Expected Access-Request to reach Next, got %v", err)
+	}
+}
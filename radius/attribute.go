@@ -3,6 +3,7 @@ package radius
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 )
 
@@ -10,6 +11,8 @@ import (
 type TAttribute struct {
 	AttrId    byte
 	AttrValue interface{}
+	VendorId  uint32 // 厂商属性的厂商号，0为标准属性
+	Tag       byte   // 带 has_tag 属性的 Tag（RFC 2868），0为没有
 }
 
 //AttributeCodec定义了如何对属性进行编码和解码数据。
@@ -30,6 +33,28 @@ type IAttributeStringer interface {
 	String(value interface{}) string
 }
 
+// Vendor-Specific 属性号
+const attrVendorSpecific = 26
+
+// TVendorAttr 是 Vendor-Specific(26) 中的一个厂商属性。
+type TVendorAttr struct {
+	VendorId uint32
+	TypeId   byte
+	Value    []byte
+}
+
+// Encode 编码为 Vendor-Specific 属性值
+func (v TVendorAttr) Encode() ([]byte, error) {
+	if len(v.Value) > 247 {
+		return nil, errors.New("radius: vendor attribute is too long")
+	}
+	return EncodeAVPairByte(v.VendorId, v.TypeId, v.Value), nil
+}
+
+func (v TVendorAttr) String() string {
+	return fmt.Sprintf("[%d:%d] 0x%x", v.VendorId, v.TypeId, v.Value)
+}
+
 // EncodeAVPair encodes AVPair into Vendor-Specific attribute format (string)
 func EncodeAVPair(vendorID uint32, typeID uint8, value string) (vsa []byte) {
 	return EncodeAVPairByte(vendorID, typeID, []byte(value))
@@ -19,6 +19,17 @@ var (
 	AttributeVendor  IAttributeCodec // Vendor-Specific
 )
 
+// 字典文件中的其他属性值格式。
+var (
+	AttributeByte        IAttributeCodec // uint8
+	AttributeShort       IAttributeCodec // uint16
+	AttributeSigned      IAttributeCodec // int32
+	AttributeInteger64   IAttributeCodec // uint64
+	AttributeIPv6Address IAttributeCodec // net.IP
+	AttributeIPv6Prefix  IAttributeCodec // *net.IPNet
+	AttributeEther       IAttributeCodec // net.HardwareAddr
+)
+
 func init() {
 	AttributeText = attributeText{}
 	AttributeString = attributeString{}
@@ -27,6 +38,14 @@ func init() {
 	AttributeTime = attributeTime{}
 	AttributeUnknown = attributeUnknown{}
 	AttributeVendor = attributeVendor{}
+
+	AttributeByte = attributeByte{}
+	AttributeShort = attributeShort{}
+	AttributeSigned = attributeSigned{}
+	AttributeInteger64 = attributeInteger64{}
+	AttributeIPv6Address = attributeIPv6Address{}
+	AttributeIPv6Prefix = attributeIPv6Prefix{}
+	AttributeEther = attributeEther{}
 }
 
 type attributeVendor struct{}
@@ -45,6 +64,12 @@ func (attributeVendor) Decode(packet *TDataPacket, value []byte) (interface{}, e
 
 func (attributeVendor) Encode(packet *TDataPacket, value interface{}) ([]byte, error) {
 	//fmt.Println("AttributeVendor.Encode()", VerdorID, VerdorTypeID, value.(string))
+	switch vsa := value.(type) {
+	case TVendorAttr:
+		return vsa.Encode()
+	case *TVendorAttr:
+		return vsa.Encode()
+	}
 	if VerdorID > 0 {
 		return EncodeAVPair(VerdorID, VerdorTypeID, value.(string)), nil
 	} else {
@@ -196,3 +221,166 @@ func (attributeTime) Encode(packet *TDataPacket, value interface{}) ([]byte, err
 func (attributeTime) GetCodeName() string {
 	return "AttributeTime"
 }
+
+type attributeByte struct{}
+
+func (attributeByte) Decode(packet *TDataPacket, value []byte) (interface{}, error) {
+	if len(value) != 1 {
+		return nil, errors.New("radius: byte attribute has invalid size")
+	}
+	return value[0], nil
+}
+
+func (attributeByte) Encode(packet *TDataPacket, value interface{}) ([]byte, error) {
+	b, ok := value.(uint8)
+	if !ok {
+		return nil, errors.New("radius: byte attribute must be uint8")
+	}
+	return []byte{b}, nil
+}
+
+func (attributeByte) GetCodeName() string {
+	return "AttributeByte"
+}
+
+type attributeShort struct{}
+
+func (attributeShort) Decode(packet *TDataPacket, value []byte) (interface{}, error) {
+	if len(value) != 2 {
+		return nil, errors.New("radius: short attribute has invalid size")
+	}
+	return binary.BigEndian.Uint16(value), nil
+}
+
+func (attributeShort) Encode(packet *TDataPacket, value interface{}) ([]byte, error) {
+	short, ok := value.(uint16)
+	if !ok {
+		return nil, errors.New("radius: short attribute must be uint16")
+	}
+	raw := make([]byte, 2)
+	binary.BigEndian.PutUint16(raw, short)
+	return raw, nil
+}
+
+func (attributeShort) GetCodeName() string {
+	return "AttributeShort"
+}
+
+type attributeSigned struct{}
+
+func (attributeSigned) Decode(packet *TDataPacket, value []byte) (interface{}, error) {
+	if len(value) != 4 {
+		return nil, errors.New("radius: signed attribute has invalid size")
+	}
+	return int32(binary.BigEndian.Uint32(value)), nil
+}
+
+func (attributeSigned) Encode(packet *TDataPacket, value interface{}) ([]byte, error) {
+	signed, ok := value.(int32)
+	if !ok {
+		return nil, errors.New("radius: signed attribute must be int32")
+	}
+	raw := make([]byte, 4)
+	binary.BigEndian.PutUint32(raw, uint32(signed))
+	return raw, nil
+}
+
+func (attributeSigned) GetCodeName() string {
+	return "AttributeSigned"
+}
+
+type attributeInteger64 struct{}
+
+func (attributeInteger64) Decode(packet *TDataPacket, value []byte) (interface{}, error) {
+	if len(value) != 8 {
+		return nil, errors.New("radius: integer64 attribute has invalid size")
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+func (attributeInteger64) Encode(packet *TDataPacket, value interface{}) ([]byte, error) {
+	integer, ok := value.(uint64)
+	if !ok {
+		return nil, errors.New("radius: integer64 attribute must be uint64")
+	}
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, integer)
+	return raw, nil
+}
+
+func (attributeInteger64) GetCodeName() string {
+	return "AttributeInteger64"
+}
+
+type attributeIPv6Address struct{}
+
+func (attributeIPv6Address) Decode(packet *TDataPacket, value []byte) (interface{}, error) {
+	if len(value) != net.IPv6len {
+		return nil, errors.New("radius: ipv6addr attribute has invalid size")
+	}
+	v := make([]byte, len(value))
+	copy(v, value)
+	return net.IP(v), nil
+}
+
+func (attributeIPv6Address) Encode(packet *TDataPacket, value interface{}) ([]byte, error) {
+	ip, ok := value.(net.IP)
+	if !ok || len(ip) != net.IPv6len {
+		return nil, errors.New("radius: ipv6addr attribute must be an IPv6 net.IP")
+	}
+	return []byte(ip), nil
+}
+
+func (attributeIPv6Address) GetCodeName() string {
+	return "AttributeIPv6Address"
+}
+
+type attributeIPv6Prefix struct{}
+
+// Reserved(1) + Prefix-Length(1) + Prefix(0-16)，RFC 3162
+func (attributeIPv6Prefix) Decode(packet *TDataPacket, value []byte) (interface{}, error) {
+	if len(value) < 2 || len(value) > 18 || value[1] > 128 {
+		return nil, errors.New("radius: ipv6prefix attribute has invalid size")
+	}
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, value[2:])
+	mask := net.CIDRMask(int(value[1]), 128)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+}
+
+func (attributeIPv6Prefix) Encode(packet *TDataPacket, value interface{}) ([]byte, error) {
+	prefix, ok := value.(*net.IPNet)
+	if !ok || len(prefix.IP) != net.IPv6len {
+		return nil, errors.New("radius: ipv6prefix attribute must be an IPv6 *net.IPNet")
+	}
+	ones, _ := prefix.Mask.Size()
+	raw := []byte{0, byte(ones)}
+	return append(raw, prefix.IP.Mask(prefix.Mask)[:(ones+7)/8]...), nil
+}
+
+func (attributeIPv6Prefix) GetCodeName() string {
+	return "AttributeIPv6Prefix"
+}
+
+type attributeEther struct{}
+
+func (attributeEther) Decode(packet *TDataPacket, value []byte) (interface{}, error) {
+	if len(value) != 6 {
+		return nil, errors.New("radius: ether attribute has invalid size")
+	}
+	v := make([]byte, len(value))
+	copy(v, value)
+	return net.HardwareAddr(v), nil
+}
+
+func (attributeEther) Encode(packet *TDataPacket, value interface{}) ([]byte, error) {
+	mac, ok := value.(net.HardwareAddr)
+	if !ok || len(mac) != 6 {
+		return nil, errors.New("radius: ether attribute must be a 6 byte net.HardwareAddr")
+	}
+	return []byte(mac), nil
+}
+
+func (attributeEther) GetCodeName() string {
+	return "AttributeEther"
+}
@@ -0,0 +1,111 @@
+package radius
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultDuplicateTTL = 5 * time.Second
+
+// 重复请求的标识，重发的请求 Identifier 和 Authenticator 都不变
+type requestKey struct {
+	addr          string
+	identifier    byte
+	authenticator [16]byte
+}
+
+type cacheEntry struct {
+	response []byte // nil 表示正在处理
+	expires  time.Time
+}
+
+// 响应缓存，用于回复重复请求（RFC 5080 2.2.2）
+type responseCache struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[requestKey]*cacheEntry
+	lastSweep time.Time
+
+	answered uint64 // 用缓存回复的重复请求
+	dropped  uint64 // 正在处理时丢弃的重复请求
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	if ttl <= 0 {
+		ttl = defaultDuplicateTTL
+	}
+	return &responseCache{
+		ttl:       ttl,
+		entries:   make(map[requestKey]*cacheEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// begin 登记请求。新请求返回 isNew=true；重复请求返回缓存的响应，
+// 原请求还在处理时响应为nil。
+func (c *responseCache) begin(key requestKey) (response []byte, isNew bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) >= c.ttl {
+		c.sweep(now)
+	}
+
+	entry := c.entries[key]
+	if entry == nil || (entry.response != nil && now.After(entry.expires)) {
+		c.entries[key] = &cacheEntry{}
+		return nil, true
+	}
+	if entry.response == nil {
+		atomic.AddUint64(&c.dropped, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&c.answered, 1)
+	return entry.response, false
+}
+
+// finish 缓存请求的响应，没有响应时删除记录，重发的请求会重新处理。
+func (c *responseCache) finish(key requestKey, response []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if response == nil {
+		delete(c.entries, key)
+		return
+	}
+	c.entries[key] = &cacheEntry{response: response, expires: time.Now().Add(c.ttl)}
+}
+
+// 删除过期的响应，正在处理的请求不删除
+func (c *responseCache) sweep(now time.Time) {
+	for key, entry := range c.entries {
+		if entry.response != nil && now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.lastSweep = now
+}
+
+func (c *responseCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// TDuplicateStats 是重复请求的统计
+type TDuplicateStats struct {
+	Answered uint64 // 用缓存的响应回复
+	Dropped  uint64 // 原请求正在处理，丢弃
+}
+
+// DuplicateStats 返回服务器收到的重复请求数
+func (s *Server) DuplicateStats() TDuplicateStats {
+	if s.cache == nil {
+		return TDuplicateStats{}
+	}
+	return TDuplicateStats{
+		Answered: atomic.LoadUint64(&s.cache.answered),
+		Dropped:  atomic.LoadUint64(&s.cache.dropped),
+	}
+}
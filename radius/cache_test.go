@@ -0,0 +1,114 @@
+package radius
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestResponseCache tests begin and finish of responseCache
+func TestResponseCache(t *testing.T) {
+	cache := newResponseCache(50 * time.Millisecond)
+	key := requestKey{addr: "127.0.0.1:1000", identifier: 1}
+
+	if _, isNew := cache.begin(key); !isNew {
+		t.Fatal("Expected new request")
+	}
+	if response, isNew := cache.begin(key); isNew || response != nil {
+		t.Error("Expected in-progress duplicate to be dropped")
+	}
+
+	cache.finish(key, []byte("response"))
+	if response, isNew := cache.begin(key); isNew || string(response) != "response" {
+		t.Errorf("Expected cached response, got %q", response)
+	}
+
+	// another request reusing the identifier
+	other := key
+	other.authenticator[0] = 1
+	if _, isNew := cache.begin(other); !isNew {
+		t.Error("Expected request with another authenticator to be new")
+	}
+	cache.finish(other, nil)
+	if _, isNew := cache.begin(other); !isNew {
+		t.Error("Expected request without response to be processed again")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, isNew := cache.begin(key); !isNew {
+		t.Error("Expected expired response to be removed")
+	}
+	if cache.len() != 2 {
+		t.Errorf("Expected 2 in-progress entries after sweep, got %d", cache.len())
+	}
+	if cache.answered != 1 || cache.dropped != 1 {
+		t.Errorf("Expected 1 answered and 1 dropped, got %d/%d", cache.answered, cache.dropped)
+	}
+}
+
+// TestServerDuplicateRequests tests that duplicates are dropped or answered from cache
+func TestServerDuplicateRequests(t *testing.T) {
+	secret := []byte("secret")
+	release := make(chan struct{})
+	var calls int32
+	server := &Server{
+		Addr:       "127.0.0.1",
+		Dictionary: Builtin,
+		Handler: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			w.AccessAccept()
+		}),
+		ClientsMap: map[string]string{"127.0.0.1": string(secret)},
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	go server.Serve(pc)
+	defer server.Close()
+
+	addr := pc.LocalAddr().String()
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	packet := NewPacket(CodeAccessRequest, secret)
+	packet.AddAttr("User-Name", "testuser")
+	data, _ := packet.Encode()
+
+	conn.Write(data)
+	time.Sleep(50 * time.Millisecond)
+	conn.Write(data) // in progress
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	read := func() []byte {
+		var buff [maxPacketSize]byte
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buff[:])
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		return buff[:n]
+	}
+	first := read()
+
+	conn.Write(data) // answered from cache
+	second := read()
+	if !bytes.Equal(first, second) {
+		t.Error("Expected the cached response to be identical")
+	}
+
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Expected handler to be called once, got %d", atomic.LoadInt32(&calls))
+	}
+	stats := server.DuplicateStats()
+	if stats.Answered != 1 || stats.Dropped != 1 {
+		t.Errorf("Expected 1 answered and 1 dropped duplicate, got %+v", stats)
+	}
+}
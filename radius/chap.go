@@ -0,0 +1,60 @@
+package radius
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+// ErrAuthFailed 表示密码校验失败。
+var ErrAuthFailed = errors.New("radius: authentication failed")
+
+// VerifyCHAP 用明文密码校验 Access-Request 中的 CHAP-Password（RFC 2865 5.3）。
+// 有 CHAP-Challenge 时使用它作为挑战值，否则使用 Request Authenticator。
+// 密码不匹配返回 ErrAuthFailed。
+func (p *TDataPacket) VerifyCHAP(password string) error {
+	if p.Code != CodeAccessRequest {
+		return fmt.Errorf("只接收AccessRequest(Code=%d)请求包，当前为(Code=%d)", CodeAccessRequest, p.Code)
+	}
+	chapPassword, ok := p.GetValue("CHAP-Password").([]byte)
+	if !ok {
+		return errors.New("取属性(CHAP-Password)失败。")
+	}
+	if len(chapPassword) != 1+md5.Size {
+		return errors.New("radius: invalid CHAP-Password attribute length")
+	}
+
+	expected := chapResponse(chapPassword[0], password, p.chapChallenge())
+	if subtle.ConstantTimeCompare(expected, chapPassword[1:]) != 1 {
+		return ErrAuthFailed
+	}
+	return nil
+}
+
+// SetCHAPPassword 用明文密码生成 CHAP-Password，挑战值为 Request Authenticator。
+func (p *TDataPacket) SetCHAPPassword(password string) error {
+	var ident [1]byte
+	if _, err := rand.Read(ident[:]); err != nil {
+		return err
+	}
+	value := append(ident[:], chapResponse(ident[0], password, p.chapChallenge())...)
+	return p.Set("CHAP-Password", value)
+}
+
+func (p *TDataPacket) chapChallenge() []byte {
+	if challenge, ok := p.GetValue("CHAP-Challenge").([]byte); ok && len(challenge) > 0 {
+		return challenge
+	}
+	return p.Authenticator[:]
+}
+
+// MD5(Ident + Password + Challenge)
+func chapResponse(ident byte, password string, challenge []byte) []byte {
+	hash := md5.New()
+	hash.Write([]byte{ident})
+	hash.Write([]byte(password))
+	hash.Write(challenge)
+	return hash.Sum(nil)
+}
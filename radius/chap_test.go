@@ -0,0 +1,67 @@
+package radius
+
+import (
+	"testing"
+)
+
+// TestVerifyCHAP tests VerifyCHAP with and without CHAP-Challenge
+func TestVerifyCHAP(t *testing.T) {
+	secret := []byte("secret")
+	for _, challenge := range [][]byte{nil, []byte("0123456789abcdef")} {
+		packet := NewPacket(CodeAccessRequest, secret)
+		packet.AddAttr("User-Name", "testuser")
+		if challenge != nil {
+			packet.AddAttr("CHAP-Challenge", challenge)
+		}
+		if err := packet.SetCHAPPassword("password"); err != nil {
+			t.Fatalf("SetCHAPPassword failed: %v", err)
+		}
+
+		data, err := packet.Encode()
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		received, err := ParsePacket(data, secret, Builtin)
+		if err != nil {
+			t.Fatalf("ParsePacket failed: %v", err)
+		}
+
+		if err := received.VerifyCHAP("password"); err != nil {
+			t.Errorf("Expected valid CHAP-Password, got %v", err)
+		}
+		if err := received.VerifyCHAP("wrong"); err != ErrAuthFailed {
+			t.Errorf("Expected ErrAuthFailed, got %v", err)
+		}
+	}
+}
+
+// TestVerifyCHAPKnownValue tests VerifyCHAP with a precomputed CHAP-Password
+func TestVerifyCHAPKnownValue(t *testing.T) {
+	packet := NewPacket(CodeAccessRequest, []byte("secret"))
+	copy(packet.Authenticator[:], "0123456789abcdef")
+	// MD5(0x01 + "password" + "0123456789abcdef")
+	response := chapResponse(1, "password", []byte("0123456789abcdef"))
+	packet.AddAttr("CHAP-Password", append([]byte{1}, response...))
+
+	if err := packet.VerifyCHAP("password"); err != nil {
+		t.Errorf("Expected valid CHAP-Password, got %v", err)
+	}
+}
+
+// TestVerifyCHAPErrors tests VerifyCHAP with invalid packets
+func TestVerifyCHAPErrors(t *testing.T) {
+	packet := NewPacket(CodeAccessAccept, []byte("secret"))
+	if err := packet.VerifyCHAP("password"); err == nil {
+		t.Error("Expected error for Access-Accept")
+	}
+
+	packet = NewPacket(CodeAccessRequest, []byte("secret"))
+	if err := packet.VerifyCHAP("password"); err == nil {
+		t.Error("Expected error without CHAP-Password")
+	}
+
+	packet.AddAttr("CHAP-Password", []byte{1, 2, 3})
+	if err := packet.VerifyCHAP("password"); err == nil || err == ErrAuthFailed {
+		t.Errorf("Expected length error, got %v", err)
+	}
+}
@@ -1,103 +1,534 @@
 package radius
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
-	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	logs "github.com/tea4go/gh/log4go"
 )
 
+// Client 选择服务器的策略
+const (
+	BalanceFailover   = iota // 按顺序使用，前面的服务器不可用时才使用后面的
+	BalanceRoundRobin        // 轮流使用，不可用时使用下一个
+)
+
+var (
+	// ErrNoServer 表示 Client.Servers 为空。
+	ErrNoServer = errors.New("radius: no server configured")
+	// ErrTimeout 表示重发后仍然没有收到有效的响应。
+	ErrTimeout = errors.New("radius: timeout waiting for response")
+	// ErrClientClosed 表示 Client 已经关闭。
+	ErrClientClosed = errors.New("radius: client closed")
+)
+
 // Client is a RADIUS client that can send and receive packets to and from a
 // RADIUS server.
+//
+// 同一个服务器的请求共用连接，按 Identifier 匹配响应，因此 Client 可以
+// 被多个 goroutine 同时使用。每个连接最多同时有 256 个请求，超过时自动增加连接。
+// 响应的 Response Authenticator 和 Message-Authenticator 校验失败时丢弃，继续等待。
+//
+// 连接在第一次发送时建立，每个连接有一个接收的 goroutine。连接上没有请求的时间超过
+// IdleTimeout 后关闭，下次发送时重新建立，因此不调用 Close 也不会泄漏连接；
+// 长期使用的 Client 应复用，不再使用时调用 Close 立即关闭所有连接。
 type Client struct {
 	// Network on which to make the connection. Defaults to "udp".
+	// "tcp" 为 RADIUS over TCP（RFC 6613），同时设置 TLSConfig 为 RadSec（RFC 6614）。
 	Net string
 
+	// RadSec 的 TLS 配置，数据包的共享密钥通常使用 RadSecSecret。
+	TLSConfig *tls.Config
+
 	// Local address to use for outgoing connections (can be nil).
 	LocalAddr net.Addr
 
 	// Timeouts for various operations. Default values for each field is 10
-	// seconds.
+	// seconds. ReadTimeout 为发送后等待响应的总时间，包括重发。
 	DialTimeout  time.Duration
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+
+	// 没有收到响应时的重发次数和间隔，默认不重发。
+	// RetryInterval 为 0 时 ReadTimeout 按 Retries+1 平分。
+	Retries       int
+	RetryInterval time.Duration
+
+	// Exchange 使用的服务器地址（host:port）和选择策略。
+	Servers []string
+	Balance int
+
+	// 服务器没有响应后标记为不可用，DeadTime 内 Exchange 不再使用，默认 30 秒。
+	// 所有服务器都不可用时仍然按顺序尝试。
+	DeadTime time.Duration
+
+	// 连接上最后一个请求完成后保持的时间，超过后关闭连接，默认 5 秒。
+	IdleTimeout time.Duration
+
+	mu     sync.Mutex
+	conns  map[string][]*clientConn
+	dead   map[string]time.Time
+	next   int
+	closed bool
 }
 
-// TODO: add ability to resend packets every X seconds
+const defaultTimeout = 10 * time.Second
+const defaultDeadTime = 30 * time.Second
+const defaultIdleTimeout = 5 * time.Second
+
+// 空闲超时关闭连接时的错误，不会返回给调用者
+var errIdleConn = errors.New("radius: idle connection closed")
 
-// Exchange sends the packet to the given server address and waits for a
-// response. nil and an error is returned upon failure.
+// SendPacket 把数据包发送到指定的服务器并等待响应，没有响应时按 Retries 重发。
+//
+// 数据包的 Identifier 由 Client 分配。Access-Request 既没有 NAS-IP-Address
+// 也没有 NAS-Identifier 时，用本地地址添加 NAS-IP-Address。
 func (c *Client) SendPacket(packet *TDataPacket, addr string) (*TDataPacket, error) {
+	return c.exchange(packet, addr)
+}
+
+// Exchange 把数据包发送到 Servers 中的服务器并等待响应。
+// 服务器没有响应时标记为不可用，并改用下一个服务器。
+func (c *Client) Exchange(packet *TDataPacket) (*TDataPacket, error) {
+	servers := c.selectServers()
+	if len(servers) == 0 {
+		return nil, ErrNoServer
+	}
+
+	var lastErr error
+	for _, addr := range servers {
+		response, err := c.exchange(packet, addr)
+		if err == nil {
+			c.markAlive(addr)
+			return response, nil
+		}
+		if err == ErrClientClosed {
+			return nil, err
+		}
+		logs.Warning("RadiusServer(%s)没有响应，%s", addr, err.Error())
+		c.markDead(addr)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// Close 关闭 Client 的所有连接，正在等待的请求返回 ErrClientClosed。
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	conns := c.conns
+	c.conns = nil
+	c.mu.Unlock()
+
+	for _, list := range conns {
+		for _, cc := range list {
+			cc.close(ErrClientClosed)
+		}
+	}
+	return nil
+}
+
+// IsServerAlive 返回服务器是否可用（没有被标记为不可用）。
+func (c *Client) IsServerAlive(addr string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !time.Now().Before(c.dead[addr])
+}
+
+// 按策略排列服务器，可用的在前面。
+func (c *Client) selectServers() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.Servers)
+	if n == 0 {
+		return nil
+	}
+	start := 0
+	if c.Balance == BalanceRoundRobin {
+		start = c.next % n
+		c.next++
+	}
+
+	now := time.Now()
+	alive := make([]string, 0, n)
+	dead := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		addr := c.Servers[(start+i)%n]
+		if now.Before(c.dead[addr]) {
+			dead = append(dead, addr)
+		} else {
+			alive = append(alive, addr)
+		}
+	}
+	return append(alive, dead...)
+}
+
+func (c *Client) markDead(addr string) {
+	deadTime := c.DeadTime
+	if deadTime == 0 {
+		deadTime = defaultDeadTime
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dead == nil {
+		c.dead = make(map[string]time.Time)
+	}
+	c.dead[addr] = time.Now().Add(deadTime)
+}
+
+func (c *Client) markAlive(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.dead, addr)
+}
+
+func (c *Client) exchange(packet *TDataPacket, addr string) (*TDataPacket, error) {
+	cc, id, ch, err := c.allocate(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer cc.release(id)
+
+	packet.Identifier = id
+	if packet.Code == CodeAccessRequest && packet.FindAttr("NAS-IP-Address") == nil && packet.FindAttr("NAS-Identifier") == nil {
+		if ip := addrIP(cc.conn.LocalAddr()); ip != nil && !ip.IsUnspecified() {
+			packet.AddAttr("NAS-IP-Address", ip)
+		}
+	}
+
+	logs.Debug("发送%s", packet.String())
+	wire, err := packet.Encode()
+	if err != nil {
+		return nil, err
+	}
+	// Accounting-Request 的 Authenticator 在 Encode 时计算，校验响应需要发送的值
+	request := *packet
+	copy(request.Authenticator[:], wire[4:20])
+
+	readTimeout := c.ReadTimeout
+	if readTimeout == 0 {
+		readTimeout = defaultTimeout
+	}
+	// TCP/TLS 由传输层保证送达，不重发（RFC 6613 2.6.2）
+	retries := c.Retries
+	if cc.stream {
+		retries = 0
+	}
+	interval := c.RetryInterval
+	if interval == 0 {
+		interval = readTimeout / time.Duration(retries+1)
+	}
+	deadline := time.Now().Add(readTimeout)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	for sent := 0; ; {
+		if sent > 0 {
+			logs.Debug("请求包(#%d)没有响应，第%d次重发。", id, sent)
+		}
+		if err := cc.write(wire, c.WriteTimeout); err != nil {
+			return nil, err
+		}
+		sent++
+
+		wait := time.Until(deadline)
+		if sent <= retries && interval < wait {
+			wait = interval
+		}
+		timer.Reset(wait)
+
+	waitResponse:
+		for {
+			select {
+			case data := <-ch:
+				received, err := ParsePacket(data, packet.Secret, packet.Dictionary)
+				if err != nil {
+					logs.Warning("RadiusServer(%s)响应包(#%d)解析失败，%s", addr, id, err.Error())
+					continue
+				}
+				if !received.IsAuthentic(&request) {
+					logs.Warning("RadiusServer(%s)响应包(#%d)校验失败，已丢弃。", addr, id)
+					continue
+				}
+				if err := received.DecryptAttrs(&request); err != nil {
+					logs.Warning("RadiusServer(%s)响应包(#%d)解密属性失败，%s", addr, id, err.Error())
+					continue
+				}
+				logs.Debug("接收%s", received.String())
+				return received, nil
+			case <-timer.C:
+				break waitResponse
+			case <-cc.done:
+				return nil, cc.err
+			}
+		}
+
+		if sent > retries || !time.Now().Before(deadline) {
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// 分配一个连接和 Identifier，所有连接的 Identifier 都用完时新建连接。
+// 建立连接时不持有 c.mu，连不上的服务器不会阻塞发往其它服务器的请求。
+func (c *Client) allocate(addr string) (*clientConn, byte, chan []byte, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, 0, nil, ErrClientClosed
+	}
+	if cc, id, ch, ok := c.allocateConn(addr); ok {
+		c.mu.Unlock()
+		return cc, id, ch, nil
+	}
+	c.mu.Unlock()
+
+	cc, err := c.dial(addr)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		cc.conn.Close()
+		return nil, 0, nil, ErrClientClosed
+	}
+	// 其它请求可能同时建立了连接
+	if other, id, ch, ok := c.allocateConn(addr); ok {
+		cc.conn.Close()
+		return other, id, ch, nil
+	}
+	if c.conns == nil {
+		c.conns = make(map[string][]*clientConn)
+	}
+	c.conns[addr] = append(c.conns[addr], cc)
+	go func() {
+		cc.readLoop()
+		c.removeConn(addr, cc)
+	}()
+
+	id, ch, _ := cc.allocate()
+	return cc, id, ch, nil
+}
+
+// 在已有的连接上分配 Identifier，调用者持有 c.mu
+func (c *Client) allocateConn(addr string) (*clientConn, byte, chan []byte, bool) {
+	for _, cc := range c.conns[addr] {
+		if id, ch, ok := cc.allocate(); ok {
+			return cc, id, ch, true
+		}
+	}
+	return nil, 0, nil, false
+}
+
+func (c *Client) dial(addr string) (*clientConn, error) {
 	connNet := c.Net
 	if connNet == "" {
 		connNet = "udp"
 	}
+	stream := false
+	switch connNet {
+	case "udp", "udp4", "udp6":
+	case "tcp", "tcp4", "tcp6":
+		stream = true
+	default:
+		return nil, fmt.Errorf("radius: unsupported network %s", connNet)
+	}
 
-	const defaultTimeout = 10 * time.Second
 	dialTimeout := c.DialTimeout
 	if dialTimeout == 0 {
 		dialTimeout = defaultTimeout
 	}
-
 	dialer := net.Dialer{
 		Timeout:   dialTimeout,
 		LocalAddr: c.LocalAddr,
 	}
 	logs.Debug("连接RadiusServer(%s-%s),参数： Timeout = %.f, LocalAddr = %v", connNet, addr, dialTimeout.Seconds(), c.LocalAddr)
-	conn, err := dialer.Dial(connNet, addr)
+	var conn net.Conn
+	var err error
+	if stream && c.TLSConfig != nil {
+		conn, err = tls.DialWithDialer(&dialer, connNet, addr, c.TLSConfig)
+	} else {
+		conn, err = dialer.Dial(connNet, addr)
+	}
 	if err != nil {
 		return nil, err
 	}
+	cc := newClientConn(conn)
+	cc.stream = stream
+	cc.idleTimeout = c.IdleTimeout
+	if cc.idleTimeout == 0 {
+		cc.idleTimeout = defaultIdleTimeout
+	}
+	return cc, nil
+}
 
-	host, port, err := net.SplitHostPort(conn.LocalAddr().String())
-	if err == nil {
-		packet.AddAttr("NAS-IP-Address", net.ParseIP(host))
-		nasPort, _ := strconv.Atoi(port)
-		packet.AddAttr("NAS-Port", uint32(nasPort))
+func (c *Client) removeConn(addr string, cc *clientConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := c.conns[addr]
+	for i, v := range list {
+		if v == cc {
+			c.conns[addr] = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(c.conns[addr]) == 0 {
+		delete(c.conns, addr)
 	}
+}
 
-	logs.Debug("发送%s", packet.String())
-	packet_data, err := packet.Encode()
+// 共用的连接，按 Identifier 把响应分发给等待的请求。
+type clientConn struct {
+	conn    net.Conn
+	stream  bool // TCP/TLS
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	pending [256]chan []byte // nil 表示 Identifier 空闲
+	next    int
+	done    chan struct{}
+	err     error
+	once    sync.Once
 
-	if err != nil {
-		return nil, err
+	idleTimeout time.Duration
+	active      int         // 正在等待响应的请求数
+	idle        *time.Timer // 没有请求时关闭连接
+	closing     bool        // 已经因为空闲而关闭，不再分配 Identifier
+}
+
+func newClientConn(conn net.Conn) *clientConn {
+	return &clientConn{
+		conn: conn,
+		done: make(chan struct{}),
 	}
+}
 
-	writeTimeout := c.WriteTimeout
-	if writeTimeout == 0 {
-		writeTimeout = defaultTimeout
+func (cc *clientConn) allocate() (byte, chan []byte, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.closing {
+		return 0, nil, false
+	}
+	select {
+	case <-cc.done:
+		return 0, nil, false
+	default:
 	}
-	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	for i := 0; i < len(cc.pending); i++ {
+		id := (cc.next + i) % len(cc.pending)
+		if cc.pending[id] == nil {
+			ch := make(chan []byte, 4)
+			cc.pending[id] = ch
+			cc.next = id + 1
+			cc.active++
+			if cc.idle != nil {
+				cc.idle.Stop()
+				cc.idle = nil
+			}
+			return byte(id), ch, true
+		}
+	}
+	return 0, nil, false
+}
 
-	if _, err := conn.Write(packet_data); err != nil {
-		conn.Close()
-		return nil, err
+func (cc *clientConn) release(id byte) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.pending[id] = nil
+	cc.active--
+	if cc.active == 0 && cc.idleTimeout > 0 && cc.err == nil {
+		cc.idle = time.AfterFunc(cc.idleTimeout, cc.closeIdle)
 	}
+}
 
-	logs.Debug("准备读数据 ......")
-	var incoming [maxPacketSize]byte
+// 空闲超时后关闭连接，readLoop 随之退出并从 Client 中移除连接
+func (cc *clientConn) closeIdle() {
+	cc.mu.Lock()
+	if cc.active > 0 || cc.closing {
+		cc.mu.Unlock()
+		return
+	}
+	cc.closing = true
+	cc.mu.Unlock()
+	logs.Debug("RadiusServer(%s)的连接空闲超时，已关闭。", cc.conn.RemoteAddr())
+	cc.close(errIdleConn)
+}
 
-	readTimeout := c.ReadTimeout
-	if readTimeout == 0 {
-		readTimeout = defaultTimeout
+func (cc *clientConn) write(wire []byte, timeout time.Duration) error {
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	cc.wmu.Lock()
+	defer cc.wmu.Unlock()
+	cc.conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, err := cc.conn.Write(wire)
+	return err
+}
+
+func (cc *clientConn) readLoop() {
+	if cc.stream {
+		for {
+			data, err := readStreamPacket(cc.conn)
+			if err != nil {
+				cc.close(err)
+				return
+			}
+			cc.dispatch(data)
+		}
 	}
-	conn.SetReadDeadline(time.Now().Add(readTimeout))
 
+	var incoming [maxPacketSize]byte
 	for {
-		n, err := conn.Read(incoming[:])
+		n, err := cc.conn.Read(incoming[:])
 		if err != nil {
-			conn.Close()
-			return nil, err
+			// 对端端口不可达时 UDP 连接会返回错误，忽略后继续等待
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				continue
+			}
+			cc.close(err)
+			return
 		}
-		received, err := ParsePacket(incoming[:n], packet.Secret, packet.Dictionary)
-		if err != nil {
-			conn.Close()
-			return received, err
+		if n < 20 {
+			continue
 		}
+		data := make([]byte, n)
+		copy(data, incoming[:n])
+		cc.dispatch(data)
+	}
+}
 
-		logs.Debug("接收%s", received.String())
-		conn.Close()
-		return received, nil
+func (cc *clientConn) dispatch(data []byte) {
+	cc.mu.Lock()
+	ch := cc.pending[data[1]]
+	cc.mu.Unlock()
+	if ch == nil {
+		logs.Debug("收到没有对应请求的响应包(#%d)，已丢弃。", data[1])
+		return
 	}
+	select {
+	case ch <- data:
+	default:
+	}
+}
+
+func (cc *clientConn) close(err error) {
+	cc.once.Do(func() {
+		cc.mu.Lock()
+		cc.err = err
+		if cc.idle != nil {
+			cc.idle.Stop()
+		}
+		cc.mu.Unlock()
+		close(cc.done)
+		cc.conn.Close()
+	})
 }
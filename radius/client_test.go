@@ -1,6 +1,11 @@
 package radius
 
 import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -67,3 +72,315 @@ func TestClientSendPacketInvalidAddress(t *testing.T) {
 		t.Error("Expected error for invalid address")
 	}
 }
+
+// testClientServer starts a UDP server which answers requests with reply.
+// reply gets the parsed request and the number of requests received so far,
+// and returns the responses to send (none to drop the request).
+func testClientServer(t *testing.T, secret []byte, reply func(request *TDataPacket, n int) []*TDataPacket) (string, *int32) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var count int32
+	go func() {
+		var buff [maxPacketSize]byte
+		for {
+			n, addr, err := conn.ReadFromUDP(buff[:])
+			if err != nil {
+				return
+			}
+			request, err := ParsePacket(buff[:n], secret, Builtin)
+			if err != nil {
+				continue
+			}
+			for _, response := range reply(request, int(atomic.AddInt32(&count, 1))) {
+				data, err := response.Encode()
+				if err == nil {
+					conn.WriteToUDP(data, addr)
+				}
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), &count
+}
+
+func testClientResponse(request *TDataPacket, code Code, secret []byte) *TDataPacket {
+	return &TDataPacket{
+		Code:          code,
+		Identifier:    request.Identifier,
+		Authenticator: request.Authenticator,
+		Secret:        secret,
+		Dictionary:    Builtin,
+	}
+}
+
+// TestClientRetries tests that requests are resent until a response arrives
+func TestClientRetries(t *testing.T) {
+	secret := []byte("secret")
+	var wires [][]byte
+	var mu sync.Mutex
+	addr, count := testClientServer(t, secret, func(request *TDataPacket, n int) []*TDataPacket {
+		mu.Lock()
+		wires = append(wires, request.raw)
+		mu.Unlock()
+		if n < 3 {
+			return nil
+		}
+		return []*TDataPacket{testClientResponse(request, CodeAccessAccept, secret)}
+	})
+
+	client := &Client{ReadTimeout: 2 * time.Second, Retries: 3, RetryInterval: 100 * time.Millisecond}
+	defer client.Close()
+	packet := NewPacket(CodeAccessRequest, secret)
+	packet.AddAttr("User-Name", "testuser")
+	response, err := client.SendPacket(packet, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessAccept {
+		t.Errorf("Expected Access-Accept, got %d", response.Code)
+	}
+	if atomic.LoadInt32(count) != 3 {
+		t.Errorf("Expected 3 transmissions, got %d", atomic.LoadInt32(count))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, wire := range wires[1:] {
+		if !bytes.Equal(wire, wires[0]) {
+			t.Error("Expected retransmissions to be identical")
+		}
+	}
+
+	// no response at all
+	client.Retries = 1
+	start := time.Now()
+	client.ReadTimeout = 200 * time.Millisecond
+	dropAddr, dropCount := testClientServer(t, secret, func(request *TDataPacket, n int) []*TDataPacket { return nil })
+	if _, err := client.SendPacket(NewPacket(CodeAccessRequest, secret), dropAddr); err != ErrTimeout {
+		t.Errorf("Expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected timeout after ReadTimeout, took %v", elapsed)
+	}
+	if atomic.LoadInt32(dropCount) != 2 {
+		t.Errorf("Expected 2 transmissions, got %d", atomic.LoadInt32(dropCount))
+	}
+}
+
+// TestClientResponseVerification tests that forged responses are ignored
+func TestClientResponseVerification(t *testing.T) {
+	secret := []byte("secret")
+	addr, _ := testClientServer(t, secret, func(request *TDataPacket, n int) []*TDataPacket {
+		forged := testClientResponse(request, CodeAccessAccept, []byte("other"))
+		reject := testClientResponse(request, CodeAccessReject, secret)
+		return []*TDataPacket{forged, reject}
+	})
+
+	client := &Client{ReadTimeout: time.Second}
+	defer client.Close()
+	response, err := client.SendPacket(NewPacket(CodeAccessRequest, secret), addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessReject {
+		t.Errorf("Expected the authentic Access-Reject, got %d", response.Code)
+	}
+
+	forgedAddr, _ := testClientServer(t, secret, func(request *TDataPacket, n int) []*TDataPacket {
+		return []*TDataPacket{testClientResponse(request, CodeAccessAccept, []byte("other"))}
+	})
+	client.ReadTimeout = 200 * time.Millisecond
+	if _, err := client.SendPacket(NewPacket(CodeAccessRequest, secret), forgedAddr); err != ErrTimeout {
+		t.Errorf("Expected ErrTimeout for forged response, got %v", err)
+	}
+}
+
+// TestClientAccounting tests Accounting-Request and Accounting-Response verification
+func TestClientAccounting(t *testing.T) {
+	secret := []byte("secret")
+	addr, _ := testClientServer(t, secret, func(request *TDataPacket, n int) []*TDataPacket {
+		return []*TDataPacket{testClientResponse(request, CodeAccountingResponse, secret)}
+	})
+
+	client := &Client{ReadTimeout: time.Second}
+	defer client.Close()
+	packet := NewPacket(CodeAccountingRequest, secret)
+	packet.AddAttr("Acct-Status-Type", "Start")
+	packet.AddAttr("Acct-Session-Id", "abc")
+	response, err := client.SendPacket(packet, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccountingResponse {
+		t.Errorf("Expected Accounting-Response, got %d", response.Code)
+	}
+	if packet.FindAttr("NAS-IP-Address") != nil || packet.FindAttr("NAS-Port") != nil {
+		t.Error("Expected no NAS attributes added to Accounting-Request")
+	}
+}
+
+// TestClientNASIPAddress tests NAS-IP-Address added to Access-Request
+func TestClientNASIPAddress(t *testing.T) {
+	secret := []byte("secret")
+	addr, _ := testClientServer(t, secret, func(request *TDataPacket, n int) []*TDataPacket {
+		return []*TDataPacket{testClientResponse(request, CodeAccessAccept, secret)}
+	})
+	client := &Client{ReadTimeout: time.Second}
+	defer client.Close()
+
+	packet := NewPacket(CodeAccessRequest, secret)
+	if _, err := client.SendPacket(packet, addr); err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if ip, ok := packet.GetValue("NAS-IP-Address").(net.IP); !ok || !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("Expected NAS-IP-Address 127.0.0.1, got %v", packet.GetValue("NAS-IP-Address"))
+	}
+	if packet.FindAttr("NAS-Port") != nil {
+		t.Error("Expected no NAS-Port")
+	}
+
+	packet = NewPacket(CodeAccessRequest, secret)
+	packet.AddAttr("NAS-Identifier", "nas1")
+	if _, err := client.SendPacket(packet, addr); err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if packet.FindAttr("NAS-IP-Address") != nil {
+		t.Error("Expected no NAS-IP-Address with NAS-Identifier")
+	}
+}
+
+// TestClientConcurrent tests concurrent requests sharing a socket
+func TestClientConcurrent(t *testing.T) {
+	secret := []byte("secret")
+	addr, _ := testClientServer(t, secret, func(request *TDataPacket, n int) []*TDataPacket {
+		response := testClientResponse(request, CodeAccessAccept, secret)
+		response.AddAttr("Reply-Message", request.GetString("User-Name"))
+		return []*TDataPacket{response}
+	})
+
+	client := &Client{ReadTimeout: 2 * time.Second, Retries: 2}
+	defer client.Close()
+	var wg sync.WaitGroup
+	errs := make(chan error, 300)
+	for i := 0; i < 300; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("user%d", i)
+			packet := NewPacket(CodeAccessRequest, secret)
+			packet.AddAttr("User-Name", name)
+			response, err := client.SendPacket(packet, addr)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if response.GetString("Reply-Message") != name {
+				errs <- fmt.Errorf("expected response for %s, got %s", name, response.GetString("Reply-Message"))
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	client.mu.Lock()
+	conns := len(client.conns[addr])
+	client.mu.Unlock()
+	if conns < 1 || conns > 2 {
+		t.Errorf("Expected shared sockets, got %d", conns)
+	}
+}
+
+// TestClientFailover tests Exchange with failover and dead server marking
+func TestClientFailover(t *testing.T) {
+	secret := []byte("secret")
+	deadAddr, deadCount := testClientServer(t, secret, func(request *TDataPacket, n int) []*TDataPacket { return nil })
+	goodAddr, goodCount := testClientServer(t, secret, func(request *TDataPacket, n int) []*TDataPacket {
+		return []*TDataPacket{testClientResponse(request, CodeAccessAccept, secret)}
+	})
+
+	client := &Client{ReadTimeout: 200 * time.Millisecond, Servers: []string{deadAddr, goodAddr}}
+	defer client.Close()
+	if _, err := client.Exchange(NewPacket(CodeAccessRequest, secret)); err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if client.IsServerAlive(deadAddr) || !client.IsServerAlive(goodAddr) {
+		t.Error("Expected the first server to be marked dead")
+	}
+	if _, err := client.Exchange(NewPacket(CodeAccessRequest, secret)); err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if atomic.LoadInt32(deadCount) != 1 || atomic.LoadInt32(goodCount) != 2 {
+		t.Errorf("Expected dead server to be skipped, got %d/%d", atomic.LoadInt32(deadCount), atomic.LoadInt32(goodCount))
+	}
+
+	if _, err := (&Client{}).Exchange(NewPacket(CodeAccessRequest, secret)); err != ErrNoServer {
+		t.Errorf("Expected ErrNoServer, got %v", err)
+	}
+}
+
+// TestClientRoundRobin tests Exchange with BalanceRoundRobin
+func TestClientRoundRobin(t *testing.T) {
+	secret := []byte("secret")
+	accept := func(request *TDataPacket, n int) []*TDataPacket {
+		return []*TDataPacket{testClientResponse(request, CodeAccessAccept, secret)}
+	}
+	addr1, count1 := testClientServer(t, secret, accept)
+	addr2, count2 := testClientServer(t, secret, accept)
+
+	client := &Client{ReadTimeout: time.Second, Servers: []string{addr1, addr2}, Balance: BalanceRoundRobin}
+	defer client.Close()
+	for i := 0; i < 4; i++ {
+		if _, err := client.Exchange(NewPacket(CodeAccessRequest, secret)); err != nil {
+			t.Fatalf("Exchange failed: %v", err)
+		}
+	}
+	if atomic.LoadInt32(count1) != 2 || atomic.LoadInt32(count2) != 2 {
+		t.Errorf("Expected 2 requests per server, got %d/%d", atomic.LoadInt32(count1), atomic.LoadInt32(count2))
+	}
+}
+
+// TestClientClose tests SendPacket after Close
+func TestClientClose(t *testing.T) {
+	client := &Client{}
+	client.Close()
+	if _, err := client.SendPacket(NewPacket(CodeAccessRequest, []byte("secret")), "127.0.0.1:1812"); err != ErrClientClosed {
+		t.Errorf("Expected ErrClientClosed, got %v", err)
+	}
+}
+
+// TestClientIdleTimeout tests that idle connections are closed without Close
+func TestClientIdleTimeout(t *testing.T) {
+	secret := []byte("secret")
+	addr, _ := testClientServer(t, secret, func(request *TDataPacket, n int) []*TDataPacket {
+		return []*TDataPacket{testClientResponse(request, CodeAccessAccept, secret)}
+	})
+
+	client := &Client{ReadTimeout: time.Second, IdleTimeout: 50 * time.Millisecond}
+	connCount := func() int {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return len(client.conns[addr])
+	}
+	if _, err := client.SendPacket(NewPacket(CodeAccessRequest, secret), addr); err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if connCount() != 1 {
+		t.Fatalf("Expected 1 connection after SendPacket, got %d", connCount())
+	}
+	for deadline := time.Now().Add(2 * time.Second); connCount() != 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the idle connection to be closed")
+		}
+	}
+
+	// a new connection is made for the next request
+	if _, err := client.SendPacket(NewPacket(CodeAccessRequest, secret), addr); err != nil {
+		t.Errorf("SendPacket after idle timeout failed: %v", err)
+	}
+	client.Close()
+}
@@ -0,0 +1,402 @@
+// radclient 发送 RADIUS 请求并显示响应，用于排查问题和压力测试，用法同 FreeRADIUS 的 radclient：
+//
+//	echo 'User-Name = "bob", User-Password = "hello"' | radclient 127.0.0.1 auth testing123
+//	radclient -f acct.txt -c 1000 -p 50 -q -s 127.0.0.1:1813 acct testing123
+//
+// 属性文件每行一个或多个逗号分隔的属性（格式同 TDictionary.ParseAttr），空行分隔多个请求，
+// # 开头的行为注释。CHAP-Password 的值为明文密码，发送时按 CHAP 计算。
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	logs "github.com/tea4go/gh/log4go"
+	"github.com/tea4go/gh/radius"
+)
+
+// 标准程序块
+var appName string = "radclient"
+var appVer string = "v0.0.1"
+
+var (
+	files    []string
+	dictFile string
+	retries  int
+	timeout  float64
+	count    int
+	parallel int
+	proto    string
+	quiet    bool
+	summary  bool
+	debug    bool
+	version  bool
+)
+
+// 请求类型：Code 和默认端口
+var requestTypes = map[string]struct {
+	code radius.Code
+	port string
+}{
+	"auth":       {radius.CodeAccessRequest, "1812"},
+	"acct":       {radius.CodeAccountingRequest, "1813"},
+	"status":     {radius.CodeStatusServer, "1812"},
+	"coa":        {radius.CodeCoARequest, "3799"},
+	"disconnect": {radius.CodeDisconnectRequest, "3799"},
+}
+
+var codeNames = map[radius.Code]string{
+	radius.CodeAccessRequest:      "Access-Request",
+	radius.CodeAccessAccept:       "Access-Accept",
+	radius.CodeAccessReject:       "Access-Reject",
+	radius.CodeAccountingRequest:  "Accounting-Request",
+	radius.CodeAccountingResponse: "Accounting-Response",
+	radius.CodeAccessChallenge:    "Access-Challenge",
+	radius.CodeStatusServer:       "Status-Server",
+	radius.CodeDisconnectRequest:  "Disconnect-Request",
+	radius.CodeDisconnectACK:      "Disconnect-ACK",
+	radius.CodeDisconnectNAK:      "Disconnect-NAK",
+	radius.CodeCoARequest:         "CoA-Request",
+	radius.CodeCoAACK:             "CoA-ACK",
+	radius.CodeCoANAK:             "CoA-NAK",
+}
+
+func codeName(code radius.Code) string {
+	if name, ok := codeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("Code-%d", code)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `RADIUS 客户端测试工具 %s
+
+用法: radclient [选项] <服务器[:端口]> <auth|acct|status|coa|disconnect|auto> <共享密钥>
+
+  auto 按属性选择请求类型：有 Acct-Status-Type 时为 acct，否则为 auth。
+  有请求没有响应、或者收到 Access-Reject/NAK 时退出码为 1。
+
+选项:
+%s`, appVer, flag.CommandLine.FlagUsages())
+}
+
+func main() {
+	flag.StringSliceVarP(&files, "file", "f", nil, "属性文件，可以多次指定，默认读标准输入。")
+	flag.StringVarP(&dictFile, "dict", "d", "", "字典文件（FreeRADIUS 格式），在内置字典的基础上加载。")
+	flag.IntVarP(&retries, "retries", "r", 3, "没有响应时的重发次数。")
+	flag.Float64VarP(&timeout, "timeout", "t", 3, "每次发送等待响应的秒数。")
+	flag.IntVarP(&count, "count", "c", 1, "每个请求发送的次数。")
+	flag.IntVarP(&parallel, "parallel", "p", 1, "同时发送的请求数。")
+	flag.StringVarP(&proto, "proto", "P", "udp", "传输协议，udp 或 tcp（RFC 6613）。")
+	flag.BoolVarP(&quiet, "quiet", "q", false, "不显示请求和响应。")
+	flag.BoolVarP(&summary, "summary", "s", false, "显示统计信息。")
+	flag.BoolVarP(&debug, "debug", "x", false, "显示调试日志。")
+	flag.BoolVarP(&version, "version", "v", false, "显示版本号。")
+	flag.Usage = usage
+	flag.Parse()
+
+	if version {
+		fmt.Printf("%s %s\n", appName, appVer)
+		return
+	}
+	args := flag.Args()
+	if len(args) != 3 {
+		usage()
+		os.Exit(2)
+	}
+	if count < 1 || parallel < 1 || timeout <= 0 || retries < 0 {
+		fmt.Fprintln(os.Stderr, "参数错误：count、parallel 和 timeout 必须大于0，retries 不能小于0。")
+		os.Exit(2)
+	}
+	if debug {
+		logs.SetLogger(logs.AdapterConsole)
+		logs.SetLevel(logs.LevelDebug)
+	}
+
+	dict := radius.Builtin
+	if dictFile != "" {
+		var err error
+		if dict, err = radius.LoadDictionary(dictFile); err != nil {
+			fmt.Fprintf(os.Stderr, "加载字典文件失败，%s\n", err.Error())
+			os.Exit(2)
+		}
+	}
+
+	requests, err := readRequests(files, dict)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if len(requests) == 0 {
+		// Status-Server 可以不带属性
+		requests = append(requests, nil)
+	}
+
+	packetType := args[1]
+	if _, ok := requestTypes[packetType]; !ok && packetType != "auto" {
+		fmt.Fprintf(os.Stderr, "未知的请求类型(%s)\n", packetType)
+		os.Exit(2)
+	}
+
+	jobs := make([]*job, 0, len(requests))
+	for _, attrs := range requests {
+		reqType := requestType(packetType, attrs, dict)
+		jobs = append(jobs, &job{
+			code:  requestTypes[reqType].code,
+			addr:  serverAddr(args[0], requestTypes[reqType].port),
+			attrs: attrs,
+		})
+	}
+
+	client := &radius.Client{
+		Net:           proto,
+		Retries:       retries,
+		RetryInterval: time.Duration(timeout * float64(time.Second)),
+		ReadTimeout:   time.Duration(timeout * float64(time.Second) * float64(retries+1)),
+	}
+	defer client.Close()
+
+	stats := run(client, jobs, []byte(args[2]), dict)
+	if summary {
+		stats.print(os.Stdout)
+	}
+	if stats.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// 一个请求，按 count 发送多次
+type job struct {
+	code  radius.Code
+	addr  string
+	attrs []*radius.TAttribute
+}
+
+// requestType 返回请求的类型，auto 时有 Acct-Status-Type 为 acct，否则为 auth
+func requestType(packetType string, attrs []*radius.TAttribute, dict *radius.TDictionary) string {
+	if packetType != "auto" {
+		return packetType
+	}
+	for _, attr := range attrs {
+		if name, _ := dict.GetName(attr.AttrId); name == "Acct-Status-Type" && attr.VendorId == 0 {
+			return "acct"
+		}
+	}
+	return "auth"
+}
+
+// 没有端口时加上请求类型的默认端口
+func serverAddr(server, port string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), port)
+}
+
+// readRequests 读取属性文件，空行分隔多个请求
+func readRequests(files []string, dict *radius.TDictionary) ([][]*radius.TAttribute, error) {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	var requests [][]*radius.TAttribute
+	stdin := false
+	for _, filename := range files {
+		var r io.Reader = os.Stdin
+		if filename == "-" {
+			// 标准输入第二次读取时已经结束，请求会被静默丢弃
+			if stdin {
+				return nil, fmt.Errorf("标准输入(-)只能指定一次")
+			}
+			stdin = true
+		} else {
+			f, err := os.Open(filename)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+		parsed, err := parseRequests(r, dict)
+		if err != nil {
+			return nil, fmt.Errorf("读取属性文件(%s)失败，%s", filename, err.Error())
+		}
+		requests = append(requests, parsed...)
+	}
+	return requests, nil
+}
+
+func parseRequests(r io.Reader, dict *radius.TDictionary) ([][]*radius.TAttribute, error) {
+	var requests [][]*radius.TAttribute
+	var current []*radius.TAttribute
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+		if text == "" {
+			if current != nil {
+				requests = append(requests, current)
+				current = nil
+			}
+			continue
+		}
+		attrs, err := dict.ParseAttrs(text)
+		if err != nil {
+			return nil, fmt.Errorf("第%d行错误，%s", line, err.Error())
+		}
+		current = append(current, attrs...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		requests = append(requests, current)
+	}
+	return requests, nil
+}
+
+// newPacket 按 job 生成请求，每次发送使用新的 Authenticator
+func (j *job) newPacket(secret []byte, dict *radius.TDictionary) (*radius.TDataPacket, error) {
+	packet := radius.NewPacket(j.code, secret)
+	packet.Dictionary = dict
+	for _, attr := range j.attrs {
+		copied := *attr
+		packet.AttrItems = append(packet.AttrItems, &copied)
+	}
+	if attr := packet.FindAttr("CHAP-Password"); attr != nil {
+		password, _ := attr.AttrValue.([]byte)
+		if err := packet.SetCHAPPassword(string(password)); err != nil {
+			return nil, err
+		}
+	}
+	// Access-Request 和 Status-Server（RFC 5997）带 Message-Authenticator
+	if j.code == radius.CodeAccessRequest || j.code == radius.CodeStatusServer {
+		packet.AddMessageAuthenticator()
+	}
+	return packet, nil
+}
+
+// 统计信息
+type statistics struct {
+	mu        sync.Mutex
+	sent      int
+	failed    int // 没有响应或被拒绝
+	errors    int // 没有响应
+	codes     map[radius.Code]int
+	latencies []time.Duration
+	elapsed   time.Duration
+}
+
+func (s *statistics) add(response *radius.TDataPacket, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent++
+	if err != nil {
+		s.errors++
+		s.failed++
+		return
+	}
+	s.codes[response.Code]++
+	s.latencies = append(s.latencies, latency)
+	switch response.Code {
+	case radius.CodeAccessReject, radius.CodeDisconnectNAK, radius.CodeCoANAK:
+		s.failed++
+	}
+}
+
+func (s *statistics) print(w io.Writer) {
+	fmt.Fprintf(w, "发送请求：%d\n", s.sent)
+	codes := make([]radius.Code, 0, len(s.codes))
+	for code := range s.codes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	for _, code := range codes {
+		fmt.Fprintf(w, "  %-20s %d\n", codeName(code), s.codes[code])
+	}
+	fmt.Fprintf(w, "没有响应：%d\n", s.errors)
+	if s.elapsed > 0 {
+		fmt.Fprintf(w, "总耗时：%s，%.1f 请求/秒\n", s.elapsed.Round(time.Millisecond), float64(s.sent)/s.elapsed.Seconds())
+	}
+	if len(s.latencies) == 0 {
+		return
+	}
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	var total time.Duration
+	for _, latency := range s.latencies {
+		total += latency
+	}
+	fmt.Fprintf(w, "响应时间：最小 %s，平均 %s，最大 %s，P50 %s，P90 %s，P99 %s\n",
+		round(s.latencies[0]), round(total/time.Duration(len(s.latencies))), round(s.latencies[len(s.latencies)-1]),
+		round(s.percentile(50)), round(s.percentile(90)), round(s.percentile(99)))
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+// 调用前 latencies 已排序
+func (s *statistics) percentile(p int) time.Duration {
+	return s.latencies[(len(s.latencies)-1)*p/100]
+}
+
+// run 用 parallel 个 goroutine 发送所有请求，每个请求发送 count 次
+func run(client *radius.Client, jobs []*job, secret []byte, dict *radius.TDictionary) *statistics {
+	stats := &statistics{codes: make(map[radius.Code]int)}
+	queue := make(chan *job)
+	go func() {
+		for i := 0; i < count; i++ {
+			for _, j := range jobs {
+				queue <- j
+			}
+		}
+		close(queue)
+	}()
+
+	var output sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				packet, err := j.newPacket(secret, dict)
+				if err != nil {
+					stats.add(nil, 0, err)
+					fmt.Fprintf(os.Stderr, "生成请求失败，%s\n", err.Error())
+					continue
+				}
+				sendTime := time.Now()
+				response, err := client.SendPacket(packet, j.addr)
+				latency := time.Since(sendTime)
+				stats.add(response, latency, err)
+				if quiet {
+					continue
+				}
+
+				output.Lock()
+				fmt.Printf("发送 %s(#%d) 到 %s\n%s\n", codeName(packet.Code), packet.Identifier, j.addr, packet.String())
+				if err != nil {
+					fmt.Printf("没有收到 %s 的响应，%s\n\n", j.addr, err.Error())
+				} else {
+					fmt.Printf("收到 %s(#%d) 来自 %s，耗时 %s\n%s\n\n", codeName(response.Code), response.Identifier, j.addr,
+						round(latency), response.String())
+				}
+				output.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	stats.elapsed = time.Since(start)
+	return stats
+}
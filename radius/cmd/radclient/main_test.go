@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tea4go/gh/radius"
+)
+
+// TestParseRequests tests that blank lines separate requests and comments are skipped
+func TestParseRequests(t *testing.T) {
+	input := `# first request
+User-Name = "bob", User-Password = "hello"
+NAS-Port = 1
+
+
+# second request
+User-Name = "alice"
+Acct-Status-Type = Start
+`
+	requests, err := parseRequests(strings.NewReader(input), radius.Builtin)
+	if err != nil {
+		t.Fatalf("parseRequests failed: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+	if len(requests[0]) != 3 || len(requests[1]) != 2 {
+		t.Errorf("Expected 3 and 2 attributes, got %d and %d", len(requests[0]), len(requests[1]))
+	}
+	if name, _ := radius.Builtin.GetName(requests[0][1].AttrId); name != "User-Password" {
+		t.Errorf("Expected User-Password, got %s", name)
+	}
+
+	requests, err = parseRequests(strings.NewReader("# only a comment\n\n"), radius.Builtin)
+	if err != nil || len(requests) != 0 {
+		t.Errorf("Expected no requests, got %d (%v)", len(requests), err)
+	}
+
+	_, err = parseRequests(strings.NewReader("User-Name = \"bob\"\nNo-Such-Attribute = 1\n"), radius.Builtin)
+	if err == nil || !strings.Contains(err.Error(), "第2行") {
+		t.Errorf("Expected error on line 2, got %v", err)
+	}
+}
+
+// TestReadRequestsStdinTwice tests that standard input can only be given once
+func TestReadRequestsStdinTwice(t *testing.T) {
+	if _, err := readRequests([]string{"-", "-"}, radius.Builtin); err == nil {
+		t.Error("Expected error for -f - given twice")
+	}
+}
+
+// TestServerAddr tests adding the default port of the request type
+func TestServerAddr(t *testing.T) {
+	tests := []struct {
+		server, port, addr string
+	}{
+		{"127.0.0.1", "1812", "127.0.0.1:1812"},
+		{"127.0.0.1:11812", "1812", "127.0.0.1:11812"},
+		{"radius.example.com", "1813", "radius.example.com:1813"},
+		{"::1", "3799", "[::1]:3799"},
+		{"[::1]", "1812", "[::1]:1812"},
+		{"[::1]:11812", "1812", "[::1]:11812"},
+	}
+	for _, tt := range tests {
+		if addr := serverAddr(tt.server, tt.port); addr != tt.addr {
+			t.Errorf("serverAddr(%s, %s): expected %s, got %s", tt.server, tt.port, tt.addr, addr)
+		}
+	}
+}
+
+// TestRequestType tests the auto request type
+func TestRequestType(t *testing.T) {
+	requests, err := parseRequests(strings.NewReader("User-Name = \"bob\"\n\nUser-Name = \"bob\", Acct-Status-Type = Stop\n"), radius.Builtin)
+	if err != nil {
+		t.Fatalf("parseRequests failed: %v", err)
+	}
+	tests := []struct {
+		packetType string
+		attrs      []*radius.TAttribute
+		expected   string
+	}{
+		{"auto", requests[0], "auth"},
+		{"auto", requests[1], "acct"},
+		{"auto", nil, "auth"},
+		{"coa", requests[1], "coa"},
+		{"status", nil, "status"},
+	}
+	for _, tt := range tests {
+		if reqType := requestType(tt.packetType, tt.attrs, radius.Builtin); reqType != tt.expected {
+			t.Errorf("requestType(%s): expected %s, got %s", tt.packetType, tt.expected, reqType)
+		}
+	}
+}
+
+// TestPercentile tests percentiles of sorted latencies
+func TestPercentile(t *testing.T) {
+	s := &statistics{}
+	for i := 1; i <= 100; i++ {
+		s.latencies = append(s.latencies, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		p        int
+		expected time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{90, 90 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if latency := s.percentile(tt.p); latency != tt.expected {
+			t.Errorf("percentile(%d): expected %s, got %s", tt.p, tt.expected, latency)
+		}
+	}
+
+	s.latencies = []time.Duration{time.Second}
+	if latency := s.percentile(99); latency != time.Second {
+		t.Errorf("Expected %s for a single latency, got %s", time.Second, latency)
+	}
+}
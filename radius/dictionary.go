@@ -1,9 +1,15 @@
 package radius
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	logs "github.com/tea4go/gh/log4go"
 )
@@ -15,20 +21,39 @@ var builtinOnce sync.Once
 var Builtin *TDictionary
 
 func initDictionary() {
-	Builtin = &TDictionary{}
-	Builtin.NameItems = make(map[string]*TDictEntry)
+	Builtin = NewDictionary()
 }
 
 // 字典编码
 type TDictEntry struct {
-	Id   byte
-	Name string
-	Func IAttributeCodec
+	Id       byte
+	Name     string
+	Func     IAttributeCodec
+	VendorId uint32            // 厂商属性的厂商号，0为标准属性
+	Encrypt  byte              // 字典文件中的 encrypt=1/2
+	HasTag   bool              // 字典文件中的 has_tag
+	Values   map[string]uint32 // 字典文件中的 VALUE
+}
+
+// 厂商，每个厂商有自己的属性编号空间
+type TDictVendor struct {
+	Id      uint32
+	Name    string
+	IdItems map[byte]*TDictEntry
 }
 
 type TDictionary struct {
 	IdItems   [1069]*TDictEntry
 	NameItems map[string]*TDictEntry
+	Vendors   map[uint32]*TDictVendor
+}
+
+// NewDictionary 返回一个空字典
+func NewDictionary() *TDictionary {
+	return &TDictionary{
+		NameItems: make(map[string]*TDictEntry),
+		Vendors:   make(map[uint32]*TDictVendor),
+	}
 }
 
 func (d *TDictionary) String() string {
@@ -39,9 +64,61 @@ func (d *TDictionary) String() string {
 		}
 		str_text = str_text + fmt.Sprintf("\n[%03d] %s = %s", v.Id, v.Name, v.Func.GetCodeName())
 	}
+
+	vendorIds := make([]int, 0, len(d.Vendors))
+	for id := range d.Vendors {
+		vendorIds = append(vendorIds, int(id))
+	}
+	sort.Ints(vendorIds)
+	for _, id := range vendorIds {
+		vendor := d.Vendors[uint32(id)]
+		str_text = str_text + fmt.Sprintf("\n厂商 %s(%d):", vendor.Name, vendor.Id)
+		for t := 0; t < 256; t++ {
+			if v := vendor.IdItems[byte(t)]; v != nil {
+				str_text = str_text + fmt.Sprintf("\n    [%03d] %s = %s", v.Id, v.Name, v.Func.GetCodeName())
+			}
+		}
+	}
 	return str_text
 }
 
+// Clone 复制字典，用于在内置字典的基础上加载字典文件。
+func (d *TDictionary) Clone() *TDictionary {
+	clone := NewDictionary()
+	entries := make(map[*TDictEntry]*TDictEntry, len(d.NameItems))
+	copyEntry := func(entry *TDictEntry) *TDictEntry {
+		if c, ok := entries[entry]; ok {
+			return c
+		}
+		c := *entry
+		if entry.Values != nil {
+			c.Values = make(map[string]uint32, len(entry.Values))
+			for k, v := range entry.Values {
+				c.Values[k] = v
+			}
+		}
+		entries[entry] = &c
+		return &c
+	}
+
+	for i, entry := range d.IdItems {
+		if entry != nil {
+			clone.IdItems[i] = copyEntry(entry)
+		}
+	}
+	for id, vendor := range d.Vendors {
+		v := &TDictVendor{Id: vendor.Id, Name: vendor.Name, IdItems: make(map[byte]*TDictEntry, len(vendor.IdItems))}
+		for t, entry := range vendor.IdItems {
+			v.IdItems[t] = copyEntry(entry)
+		}
+		clone.Vendors[id] = v
+	}
+	for name, entry := range d.NameItems {
+		clone.NameItems[name] = copyEntry(entry)
+	}
+	return clone
+}
+
 // 注册属性
 func (d *TDictionary) MustRegister(name string, t byte, codec IAttributeCodec) {
 	if d.IdItems[t] != nil {
@@ -59,6 +136,216 @@ func (d *TDictionary) MustRegister(name string, t byte, codec IAttributeCodec) {
 
 }
 
+// 注册厂商
+func (d *TDictionary) MustRegisterVendor(name string, id uint32) {
+	if err := d.registerVendor(name, id); err != nil {
+		panic(err)
+	}
+}
+
+func (d *TDictionary) registerVendor(name string, id uint32) error {
+	if d.Vendors == nil {
+		d.Vendors = make(map[uint32]*TDictVendor)
+	}
+	if vendor := d.Vendors[id]; vendor != nil {
+		if vendor.Name != name {
+			return fmt.Errorf("厂商号(%d)已经注册为%s。", id, vendor.Name)
+		}
+		return nil
+	}
+	if d.GetVendorByName(name) != nil {
+		return fmt.Errorf("厂商(%s)已经注册过。", name)
+	}
+	d.Vendors[id] = &TDictVendor{Id: id, Name: name, IdItems: make(map[byte]*TDictEntry)}
+	return nil
+}
+
+// 注册厂商属性
+func (d *TDictionary) MustRegisterVendorAttr(vendorID uint32, name string, t byte, codec IAttributeCodec) {
+	vendor := d.Vendors[vendorID]
+	if vendor == nil {
+		panic(fmt.Errorf("厂商(%d)没有注册。", vendorID))
+	}
+	if vendor.IdItems[t] != nil || d.NameItems[name] != nil {
+		panic(errors.New("属性已经注册过。"))
+	}
+	entry := &TDictEntry{
+		Id:       t,
+		Name:     name,
+		Func:     codec,
+		VendorId: vendorID,
+	}
+	vendor.IdItems[t] = entry
+	d.NameItems[name] = entry
+
+	logs.Debug("注册属性 ... [%d:%03d] %-40s (%s)\n", vendorID, t, name, codec.GetCodeName())
+}
+
+// 按字典文件注册属性，后面的定义覆盖前面的定义。
+// 名字和编号都相同时保留原来的编码（内置属性的编码更准确），只合并标记。
+func (d *TDictionary) register(entry *TDictEntry) error {
+	var old *TDictEntry
+	if entry.VendorId == 0 {
+		old = d.IdItems[entry.Id]
+	} else {
+		vendor := d.Vendors[entry.VendorId]
+		if vendor == nil {
+			return fmt.Errorf("厂商(%d)没有注册。", entry.VendorId)
+		}
+		old = vendor.IdItems[entry.Id]
+	}
+
+	if old != nil && old.Name == entry.Name {
+		old.Encrypt = entry.Encrypt
+		old.HasTag = entry.HasTag
+		return nil
+	}
+	if old != nil {
+		delete(d.NameItems, old.Name)
+	}
+	if other := d.NameItems[entry.Name]; other != nil {
+		if other.VendorId == 0 {
+			d.IdItems[other.Id] = nil
+		} else {
+			delete(d.Vendors[other.VendorId].IdItems, other.Id)
+		}
+		if entry.Values == nil {
+			entry.Values = other.Values
+		}
+	}
+
+	if entry.VendorId == 0 {
+		d.IdItems[entry.Id] = entry
+	} else {
+		d.Vendors[entry.VendorId].IdItems[entry.Id] = entry
+	}
+	d.NameItems[entry.Name] = entry
+	return nil
+}
+
+// 注册属性的枚举值，同字典文件中的 VALUE
+func (d *TDictionary) MustRegisterValue(attrName, name string, value uint32) {
+	entry := d.NameItems[attrName]
+	if entry == nil {
+		panic(fmt.Errorf("属性(%s)没有注册。", attrName))
+	}
+	entry.addValue(name, value)
+}
+
+// GetValueName 返回属性枚举值的名字，没有定义返回false。
+func (d *TDictionary) GetValueName(attrName string, value uint32) (string, bool) {
+	entry := d.NameItems[attrName]
+	if entry == nil {
+		return "", false
+	}
+	return entry.valueName(value)
+}
+
+// GetValueNumber 返回属性枚举值名字对应的数字，没有定义返回false。
+func (d *TDictionary) GetValueNumber(attrName, name string) (uint32, bool) {
+	entry := d.NameItems[attrName]
+	if entry == nil {
+		return 0, false
+	}
+	value, ok := entry.Values[name]
+	return value, ok
+}
+
+func (e *TDictEntry) addValue(name string, value uint32) {
+	if e.Values == nil {
+		e.Values = make(map[string]uint32)
+	}
+	e.Values[name] = value
+}
+
+// 同一个值有多个名字时返回按字母排序的第一个，保证输出稳定。
+func (e *TDictEntry) valueName(value uint32) (string, bool) {
+	found := ""
+	for name, v := range e.Values {
+		if v == value && (found == "" || name < found) {
+			found = name
+		}
+	}
+	return found, found != ""
+}
+
+// 枚举属性可以用名字赋值，按属性编码转换为对应的整数类型。
+func (e *TDictEntry) resolveValue(value interface{}) (interface{}, error) {
+	name, ok := value.(string)
+	if !ok || len(e.Values) == 0 {
+		return value, nil
+	}
+	number, ok := e.Values[name]
+	if !ok {
+		return nil, fmt.Errorf("属性(%s)没有枚举值(%s)。", e.Name, name)
+	}
+	switch e.Func {
+	case AttributeByte:
+		return uint8(number), nil
+	case AttributeShort:
+		return uint16(number), nil
+	case AttributeSigned:
+		return int32(number), nil
+	case AttributeInteger64:
+		return uint64(number), nil
+	}
+	return number, nil
+}
+
+// 枚举属性的值转换为数字，不是整数返回false。
+func enumNumber(value interface{}) (uint32, bool) {
+	switch v := value.(type) {
+	case uint8:
+		return uint32(v), true
+	case uint16:
+		return uint32(v), true
+	case uint32:
+		return v, true
+	case int32:
+		return uint32(v), true
+	case uint64:
+		return uint32(v), v <= 0xffffffff
+	}
+	return 0, false
+}
+
+// GetEntry 返回属性名对应的字典项，不存在返回nil。
+func (d *TDictionary) GetEntry(name string) *TDictEntry {
+	return d.NameItems[name]
+}
+
+// GetVendor 返回厂商号对应的厂商，不存在返回nil。
+func (d *TDictionary) GetVendor(id uint32) *TDictVendor {
+	return d.Vendors[id]
+}
+
+// GetVendorByName 返回厂商名对应的厂商，不存在返回nil。
+func (d *TDictionary) GetVendorByName(name string) *TDictVendor {
+	for _, vendor := range d.Vendors {
+		if vendor.Name == name {
+			return vendor
+		}
+	}
+	return nil
+}
+
+// GetVendorEntry 返回厂商属性的字典项，不存在返回nil。
+func (d *TDictionary) GetVendorEntry(vendorID uint32, t byte) *TDictEntry {
+	vendor := d.Vendors[vendorID]
+	if vendor == nil {
+		return nil
+	}
+	return vendor.IdItems[t]
+}
+
+// 返回属性对应的字典项，标准属性和厂商属性都可以。
+func (d *TDictionary) entryOf(attr *TAttribute) *TDictEntry {
+	if attr.VendorId != 0 {
+		return d.GetVendorEntry(attr.VendorId, attr.AttrId)
+	}
+	return d.IdItems[attr.AttrId]
+}
+
 func (d *TDictionary) NewAttr(name string, value interface{}) (*TAttribute, error) {
 	entry := d.NameItems[name]
 	if entry == nil {
@@ -67,15 +354,177 @@ func (d *TDictionary) NewAttr(name string, value interface{}) (*TAttribute, erro
 	t := entry.Id
 	codec := entry.Func
 
+	value, err := entry.resolveValue(value)
+	if err != nil {
+		return nil, err
+	}
+
 	if transformer, ok := codec.(IAttributeTransformer); ok {
 		transformed, err := transformer.Transform(value)
 		if err != nil {
 			return nil, errors.New("属性转码出错，" + err.Error())
 		}
-		return &TAttribute{AttrId: t, AttrValue: transformed}, nil
+		return &TAttribute{AttrId: t, AttrValue: transformed, VendorId: entry.VendorId}, nil
 	}
 
-	return &TAttribute{AttrId: t, AttrValue: value}, nil
+	return &TAttribute{AttrId: t, AttrValue: value, VendorId: entry.VendorId}, nil
+}
+
+// ParseValue 把文本转换为属性的值，用于规则文件和命令行：
+// 枚举值可以用名字，整数为十进制或 0x 开头的十六进制，octets 可以用 0x 开头的十六进制，
+// 时间为 Unix 秒数或 RFC 3339 格式，带引号的文本按 Go 字符串解析。
+func (d *TDictionary) ParseValue(name, text string) (interface{}, error) {
+	entry := d.NameItems[name]
+	if entry == nil {
+		return nil, fmt.Errorf("属性(%s)没有注册。", name)
+	}
+	if strings.HasPrefix(text, `"`) {
+		unquoted, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("属性(%s)的值(%s)格式错误。", name, text)
+		}
+		text = unquoted
+	}
+	if _, ok := entry.Values[text]; ok {
+		return text, nil
+	}
+
+	var value interface{}
+	var err error
+	switch entry.Func {
+	case AttributeInteger:
+		var number uint64
+		number, err = parseDictNumber(text, 32)
+		value = uint32(number)
+	case AttributeByte:
+		var number uint64
+		number, err = parseDictNumber(text, 8)
+		value = uint8(number)
+	case AttributeShort:
+		var number uint64
+		number, err = parseDictNumber(text, 16)
+		value = uint16(number)
+	case AttributeInteger64:
+		value, err = parseDictNumber(text, 64)
+	case AttributeSigned:
+		var number int64
+		if number, err = strconv.ParseInt(text, 10, 32); err == nil {
+			value = int32(number)
+		}
+	case AttributeAddress, AttributeIPv6Address:
+		ip := net.ParseIP(text)
+		if ip == nil {
+			err = errors.New("invalid address")
+		} else if entry.Func == AttributeAddress {
+			if ip = ip.To4(); ip == nil {
+				err = errors.New("not an IPv4 address")
+			}
+		}
+		value = ip
+	case AttributeIPv6Prefix:
+		value, err = parseIPv6Prefix(text)
+	case AttributeEther:
+		value, err = net.ParseMAC(text)
+	case AttributeTime:
+		var seconds int64
+		if seconds, err = strconv.ParseInt(text, 10, 64); err == nil {
+			value = time.Unix(seconds, 0)
+		} else {
+			value, err = time.Parse(time.RFC3339, text)
+		}
+	case AttributeString, AttributeUnknown:
+		if strings.HasPrefix(text, "0x") {
+			value, err = hex.DecodeString(text[2:])
+		} else {
+			value = []byte(text)
+		}
+	default:
+		value = text
+	}
+	if err != nil {
+		return nil, fmt.Errorf("属性(%s)的值(%s)格式错误，%s", name, text, err.Error())
+	}
+	return value, nil
+}
+
+func parseIPv6Prefix(text string) (*net.IPNet, error) {
+	_, prefix, err := net.ParseCIDR(text)
+	if err != nil {
+		return nil, err
+	}
+	return prefix, nil
+}
+
+// ParseAttr 解析 "Name = Value" 或带 Tag 的 "Name:Tag = Value" 格式的属性，值的格式同 ParseValue。
+func (d *TDictionary) ParseAttr(expr string) (*TAttribute, error) {
+	i := strings.IndexByte(expr, '=')
+	if i < 0 {
+		return nil, fmt.Errorf("属性(%s)格式错误，应为 Name = Value。", expr)
+	}
+	name, text := strings.TrimSpace(expr[:i]), strings.TrimSpace(expr[i+1:])
+	var tag uint64
+	if j := strings.IndexByte(name, ':'); j >= 0 {
+		var err error
+		if tag, err = strconv.ParseUint(name[j+1:], 10, 8); err != nil || tag > maxAttrTag {
+			return nil, fmt.Errorf("属性(%s)的Tag格式错误。", name)
+		}
+		name = name[:j]
+	}
+	value, err := d.ParseValue(name, text)
+	if err != nil {
+		return nil, err
+	}
+	attr, err := d.NewAttr(name, value)
+	if err != nil {
+		return nil, err
+	}
+	attr.Tag = byte(tag)
+	return attr, nil
+}
+
+// ParseAttrs 解析逗号分隔的属性列表，如 radclient 的输入 User-Name = "bob", User-Password = "hello"，
+// 引号内的逗号不分隔。
+func (d *TDictionary) ParseAttrs(text string) ([]*TAttribute, error) {
+	var attrs []*TAttribute
+	for _, expr := range splitAttrList(text) {
+		attr, err := d.ParseAttr(expr)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, nil
+}
+
+// 按逗号分隔属性，引号内的逗号不分隔
+func splitAttrList(text string) []string {
+	var exprs []string
+	inQuote := false
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		case ',':
+			if !inQuote {
+				exprs = append(exprs, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+	exprs = append(exprs, text[start:])
+
+	result := exprs[:0]
+	for _, expr := range exprs {
+		if expr = strings.TrimSpace(expr); expr != "" {
+			result = append(result, expr)
+		}
+	}
+	return result
 }
 
 func (d *TDictionary) GetName(t byte) (string, bool) {
@@ -88,7 +537,7 @@ func (d *TDictionary) GetName(t byte) (string, bool) {
 
 func (d *TDictionary) GetIndex(name string) (byte, bool) {
 	entry := d.NameItems[name]
-	if entry == nil {
+	if entry == nil || entry.VendorId != 0 {
 		return 0, false
 	}
 	return entry.Id, true
@@ -0,0 +1,320 @@
+package radius
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	logs "github.com/tea4go/gh/log4go"
+)
+
+// 加载 FreeRADIUS 格式的字典文件，支持的关键字：
+//
+//	ATTRIBUTE    <name> <id> <type> [vendor|flags]
+//	VALUE        <attribute> <name> <number>
+//	VENDOR       <name> <id> [format=1,1]
+//	BEGIN-VENDOR <name>
+//	END-VENDOR   <name>
+//	$INCLUDE     <file>
+//
+// flags 支持 encrypt=1、encrypt=2 和 has_tag。扩展属性（241-246）、TLV 以及
+// format 不是 1,1 的厂商属性会被跳过。
+
+// LoadDictionary 在内置字典的基础上加载字典文件，返回新的字典。
+func LoadDictionary(filename string) (*TDictionary, error) {
+	d := Builtin.Clone()
+	if err := d.LoadFile(filename); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// LoadFile 加载字典文件，$INCLUDE 的相对路径相对于当前文件所在目录。
+func (d *TDictionary) LoadFile(filename string) error {
+	loader := newDictLoader(d)
+	if err := loader.loadFile(filename); err != nil {
+		return err
+	}
+	loader.finish()
+	return nil
+}
+
+// Load 从r加载字典，$INCLUDE 的相对路径相对于当前工作目录。
+func (d *TDictionary) Load(r io.Reader) error {
+	loader := newDictLoader(d)
+	if err := loader.load(r, "", "."); err != nil {
+		return err
+	}
+	loader.finish()
+	return nil
+}
+
+type dictPendingValue struct {
+	attr  string
+	name  string
+	value uint32
+}
+
+type dictLoader struct {
+	dict        *TDictionary
+	vendor      *TDictVendor    // BEGIN-VENDOR 中的厂商
+	unsupported map[uint32]bool // format 不支持的厂商
+	pending     []dictPendingValue
+	files       map[string]bool // 正在加载的文件，防止循环包含
+}
+
+func newDictLoader(d *TDictionary) *dictLoader {
+	if d.NameItems == nil {
+		d.NameItems = make(map[string]*TDictEntry)
+	}
+	if d.Vendors == nil {
+		d.Vendors = make(map[uint32]*TDictVendor)
+	}
+	return &dictLoader{
+		dict:        d,
+		unsupported: make(map[uint32]bool),
+		files:       make(map[string]bool),
+	}
+}
+
+func (l *dictLoader) loadFile(filename string) error {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if l.files[path] {
+		return fmt.Errorf("字典文件(%s)循环包含。", filename)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	l.files[path] = true
+	defer delete(l.files, path)
+	return l.load(file, filename, filepath.Dir(path))
+}
+
+func (l *dictLoader) load(r io.Reader, filename, dir string) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := l.parseLine(fields, dir); err != nil {
+			return fmt.Errorf("字典文件%s第%d行：%s", filename, line, err.Error())
+		}
+	}
+	return scanner.Err()
+}
+
+func (l *dictLoader) parseLine(fields []string, dir string) error {
+	switch fields[0] {
+	case "$INCLUDE", "$INCLUDE-":
+		if len(fields) != 2 {
+			return fmt.Errorf("%s 格式错误", fields[0])
+		}
+		path := fields[1]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if fields[0] == "$INCLUDE-" {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				return nil
+			}
+		}
+		return l.loadFile(path)
+
+	case "VENDOR":
+		if len(fields) < 3 || len(fields) > 4 {
+			return fmt.Errorf("VENDOR 格式错误")
+		}
+		id, err := parseDictNumber(fields[2], 32)
+		if err != nil {
+			return err
+		}
+		if err := l.dict.registerVendor(fields[1], uint32(id)); err != nil {
+			return err
+		}
+		if len(fields) == 4 && fields[3] != "format=1,1" {
+			logs.Debug("暂不支持厂商%s的属性格式(%s)，跳过该厂商的属性。", fields[1], fields[3])
+			l.unsupported[uint32(id)] = true
+		}
+		return nil
+
+	case "BEGIN-VENDOR":
+		if len(fields) < 2 {
+			return fmt.Errorf("BEGIN-VENDOR 格式错误")
+		}
+		vendor := l.dict.GetVendorByName(fields[1])
+		if vendor == nil {
+			return fmt.Errorf("厂商(%s)没有定义", fields[1])
+		}
+		l.vendor = vendor
+		return nil
+
+	case "END-VENDOR":
+		l.vendor = nil
+		return nil
+
+	case "ATTRIBUTE":
+		return l.parseAttribute(fields)
+
+	case "VALUE":
+		if len(fields) != 4 {
+			return fmt.Errorf("VALUE 格式错误")
+		}
+		value, err := parseDictNumber(fields[3], 32)
+		if err != nil {
+			return err
+		}
+		if entry := l.dict.NameItems[fields[1]]; entry != nil {
+			entry.addValue(fields[2], uint32(value))
+		} else {
+			l.pending = append(l.pending, dictPendingValue{attr: fields[1], name: fields[2], value: uint32(value)})
+		}
+		return nil
+
+	case "BEGIN-TLV", "END-TLV", "BEGIN-PROTOCOL", "END-PROTOCOL", "PROTOCOL", "FLAGS", "ALIAS", "MEMBER", "STRUCT":
+		return nil
+	}
+	return fmt.Errorf("未知的关键字(%s)", fields[0])
+}
+
+func (l *dictLoader) parseAttribute(fields []string) error {
+	if len(fields) < 4 || len(fields) > 5 {
+		return fmt.Errorf("ATTRIBUTE 格式错误")
+	}
+	name := fields[1]
+
+	vendor := l.vendor
+	var encrypt byte
+	var hasTag bool
+	if len(fields) == 5 {
+		if v := l.dict.GetVendorByName(fields[4]); v != nil {
+			vendor = v
+		} else {
+			for _, flag := range strings.Split(fields[4], ",") {
+				switch {
+				case flag == "has_tag":
+					hasTag = true
+				case strings.HasPrefix(flag, "encrypt="):
+					n, err := strconv.Atoi(flag[len("encrypt="):])
+					if err != nil || n < 1 || n > 3 {
+						return fmt.Errorf("属性(%s)的加密方式(%s)错误", name, flag)
+					}
+					encrypt = byte(n)
+				}
+			}
+		}
+	}
+
+	// 扩展属性、TLV 等带"."的编号
+	if strings.Contains(fields[2], ".") {
+		logs.Debug("暂不支持的属性编号(%s %s)，跳过。", name, fields[2])
+		return nil
+	}
+	var vendorID uint32
+	if vendor != nil {
+		vendorID = vendor.Id
+		if l.unsupported[vendorID] {
+			return nil
+		}
+	}
+	id, err := parseDictNumber(fields[2], 8)
+	if err != nil {
+		return err
+	}
+
+	typeName := fields[3]
+	if i := strings.IndexByte(typeName, '['); i >= 0 {
+		typeName = typeName[:i]
+	}
+	codec := dictTypeCodec(typeName)
+	if vendorID == 0 && id == attrVendorSpecific {
+		codec = AttributeVendor
+	}
+	if encrypt == 1 {
+		codec = rfc2865Encrypted{}
+	}
+
+	return l.dict.register(&TDictEntry{
+		Id:       byte(id),
+		Name:     name,
+		Func:     codec,
+		VendorId: vendorID,
+		Encrypt:  encrypt,
+		HasTag:   hasTag,
+	})
+}
+
+func (l *dictLoader) finish() {
+	for _, value := range l.pending {
+		entry := l.dict.NameItems[value.attr]
+		if entry == nil {
+			logs.Debug("VALUE %s %s 的属性没有定义，跳过。", value.attr, value.name)
+			continue
+		}
+		entry.addValue(value.name, value.value)
+	}
+	l.pending = nil
+}
+
+// 字典文件中的类型对应的编码，FreeRADIUS v3 和 v4 的类型名都支持，
+// 不认识的类型按 octets 处理。
+func dictTypeCodec(typeName string) IAttributeCodec {
+	switch typeName {
+	case "string":
+		return AttributeText
+	case "ipaddr", "ipv4addr":
+		return AttributeAddress
+	case "integer", "uint32":
+		return AttributeInteger
+	case "date":
+		return AttributeTime
+	case "byte", "uint8":
+		return AttributeByte
+	case "short", "uint16":
+		return AttributeShort
+	case "signed", "int32":
+		return AttributeSigned
+	case "integer64", "uint64":
+		return AttributeInteger64
+	case "ipv6addr":
+		return AttributeIPv6Address
+	case "ipv6prefix":
+		return AttributeIPv6Prefix
+	case "ether":
+		return AttributeEther
+	case "vsa":
+		return AttributeVendor
+	}
+	return AttributeString
+}
+
+// 十进制或0x开头的十六进制
+func parseDictNumber(s string, bitSize int) (uint64, error) {
+	var value uint64
+	var err error
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		value, err = strconv.ParseUint(s[2:], 16, bitSize)
+	} else {
+		value, err = strconv.ParseUint(s, 10, bitSize)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("数字(%s)格式错误", s)
+	}
+	return value, nil
+}
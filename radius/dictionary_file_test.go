@@ -0,0 +1,228 @@
+package radius
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDictionary = `# main dictionary
+$INCLUDE dictionary.acme
+$INCLUDE- dictionary.missing
+
+ATTRIBUTE	Acme-Old-Style		9	integer	Acme
+ATTRIBUTE	Test-Standard		200	short
+VALUE	Acme-Level		Gold		3
+VALUE	Service-Type		Custom		99
+
+VENDOR		Wide	5000	format=2,1
+BEGIN-VENDOR	Wide
+ATTRIBUTE	Wide-Attr		300	string
+END-VENDOR	Wide
+
+ATTRIBUTE	Test-Extended		241.1	integer
+`
+
+const testDictionaryAcme = `VENDOR	Acme	0x1234
+BEGIN-VENDOR	Acme
+ATTRIBUTE	Acme-Name		1	string
+ATTRIBUTE	Acme-Level		2	integer
+ATTRIBUTE	Acme-Secret		3	string	encrypt=1
+ATTRIBUTE	Acme-Vlan		4	string	has_tag,encrypt=2
+ATTRIBUTE	Acme-Mac		5	ether
+ATTRIBUTE	Acme-Addr6		6	ipv6addr
+ATTRIBUTE	Acme-Blob		7	octets[16]
+END-VENDOR	Acme
+`
+
+func writeTestDictionary(t *testing.T) string {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "dictionary"), []byte(testDictionary), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "dictionary.acme"), []byte(testDictionaryAcme), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "dictionary")
+}
+
+// TestLoadDictionary tests LoadDictionary with vendors, flags and values
+func TestLoadDictionary(t *testing.T) {
+	dict, err := LoadDictionary(writeTestDictionary(t))
+	if err != nil {
+		t.Fatalf("LoadDictionary failed: %v", err)
+	}
+
+	vendor := dict.GetVendorByName("Acme")
+	if vendor == nil || vendor.Id != 0x1234 {
+		t.Fatalf("Expected vendor Acme(4660), got %v", vendor)
+	}
+	tests := []struct {
+		name     string
+		id       byte
+		vendorID uint32
+		codec    IAttributeCodec
+	}{
+		{"Acme-Name", 1, 0x1234, AttributeText},
+		{"Acme-Level", 2, 0x1234, AttributeInteger},
+		{"Acme-Secret", 3, 0x1234, rfc2865Encrypted{}},
+		{"Acme-Mac", 5, 0x1234, AttributeEther},
+		{"Acme-Addr6", 6, 0x1234, AttributeIPv6Address},
+		{"Acme-Blob", 7, 0x1234, AttributeString},
+		{"Acme-Old-Style", 9, 0x1234, AttributeInteger},
+		{"Test-Standard", 200, 0, AttributeShort},
+		{"User-Name", 1, 0, AttributeText},
+	}
+	for _, tt := range tests {
+		entry := dict.GetEntry(tt.name)
+		if entry == nil {
+			t.Errorf("Expected %s to be registered", tt.name)
+			continue
+		}
+		if entry.Id != tt.id || entry.VendorId != tt.vendorID || entry.Func != tt.codec {
+			t.Errorf("Unexpected entry for %s: %d:%d %s", tt.name, entry.VendorId, entry.Id, entry.Func.GetCodeName())
+		}
+	}
+
+	vlan := dict.GetVendorEntry(0x1234, 4)
+	if vlan == nil || !vlan.HasTag || vlan.Encrypt != 2 {
+		t.Errorf("Expected has_tag and encrypt=2 for Acme-Vlan, got %v", vlan)
+	}
+	if dict.GetEntry("Acme-Level").Values["Gold"] != 3 {
+		t.Error("Expected VALUE Acme-Level Gold = 3")
+	}
+	if dict.GetEntry("Service-Type").Values["Custom"] != 99 {
+		t.Error("Expected VALUE Service-Type Custom = 99")
+	}
+	if dict.GetEntry("Wide-Attr") != nil || dict.GetEntry("Test-Extended") != nil {
+		t.Error("Expected unsupported attributes to be skipped")
+	}
+
+	// the builtin dictionary is not changed
+	if Builtin.GetVendorByName("Acme") != nil || Builtin.GetEntry("Service-Type").Values["Custom"] != 0 {
+		t.Error("LoadDictionary should not change Builtin")
+	}
+}
+
+// TestLoadDictionaryRedefine tests that dictionary files can redefine attributes
+func TestLoadDictionaryRedefine(t *testing.T) {
+	dict := Builtin.Clone()
+	err := dict.Load(strings.NewReader(`
+ATTRIBUTE	User-Password		2	string	encrypt=1
+ATTRIBUTE	Prompt			76	integer
+`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if entry := dict.GetEntry("User-Password"); entry.Func != (rfc2865UserPassword{}) || entry.Encrypt != 1 {
+		t.Errorf("Expected builtin User-Password codec to be kept, got %s", entry.Func.GetCodeName())
+	}
+	if name, _ := dict.GetName(76); name != "Prompt" || dict.GetEntry("Authenticator-Type") != nil {
+		t.Errorf("Expected attribute 76 to be renamed to Prompt, got %s", name)
+	}
+}
+
+// TestLoadDictionaryErrors tests Load with invalid dictionaries
+func TestLoadDictionaryErrors(t *testing.T) {
+	tests := []string{
+		"UNKNOWN Foo 1",
+		"ATTRIBUTE Foo",
+		"ATTRIBUTE Foo 256 integer",
+		"ATTRIBUTE Foo abc integer",
+		"ATTRIBUTE Foo 1 string encrypt=9",
+		"VENDOR Foo",
+		"VALUE Foo Bar",
+		"BEGIN-VENDOR Nobody",
+		"$INCLUDE /nonexistent/dictionary",
+	}
+	for _, text := range tests {
+		if err := NewDictionary().Load(strings.NewReader(text)); err == nil {
+			t.Errorf("Expected error for %q", text)
+		}
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dictionary")
+	os.WriteFile(path, []byte("$INCLUDE dictionary\n"), 0644)
+	if err := NewDictionary().LoadFile(path); err == nil || !strings.Contains(err.Error(), "循环") {
+		t.Errorf("Expected include loop error, got %v", err)
+	}
+}
+
+// TestVendorAttributePacket tests encoding and decoding vendor attributes from a loaded dictionary
+func TestVendorAttributePacket(t *testing.T) {
+	dict, err := LoadDictionary(writeTestDictionary(t))
+	if err != nil {
+		t.Fatalf("LoadDictionary failed: %v", err)
+	}
+	secret := []byte("secret")
+	packet := NewPacket(CodeAccessRequest, secret)
+	packet.Dictionary = dict
+	packet.AddAttr("User-Name", "user")
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	values := map[string]interface{}{
+		"Acme-Name":   "name",
+		"Acme-Level":  uint32(3),
+		"Acme-Secret": "a very long secret value over 16 bytes",
+		"Acme-Mac":    mac,
+		"Acme-Addr6":  net.ParseIP("2001:db8::1"),
+	}
+	for name, value := range values {
+		if err := packet.AddAttr(name, value); err != nil {
+			t.Fatalf("AddAttr(%s) failed: %v", name, err)
+		}
+	}
+
+	data, err := packet.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	received, err := ParsePacket(data, secret, dict)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if received.GetString("User-Name") != "user" {
+		t.Errorf("Expected User-Name user, got %s", received.GetString("User-Name"))
+	}
+	for name, value := range values {
+		got := received.GetValue(name)
+		if received.GetString(name) == "" && got == nil {
+			t.Errorf("Expected %s in the parsed packet", name)
+			continue
+		}
+		switch v := value.(type) {
+		case net.IP:
+			if !v.Equal(got.(net.IP)) {
+				t.Errorf("Expected %s = %v, got %v", name, value, got)
+			}
+		case net.HardwareAddr:
+			if v.String() != got.(net.HardwareAddr).String() {
+				t.Errorf("Expected %s = %v, got %v", name, value, got)
+			}
+		default:
+			if got != value {
+				t.Errorf("Expected %s = %v, got %v", name, value, got)
+			}
+		}
+	}
+	if !strings.Contains(received.String(), "[4660:002] Acme-Level = Gold") {
+		t.Errorf("Expected vendor attribute in %s", received.String())
+	}
+
+	// one Vendor-Specific carrying two vendor attributes
+	vsa := append(EncodeAVPairByte(0x1234, 1, []byte("a")), 2, 6, 0, 0, 0, 7)
+	wire := []byte{byte(CodeAccessRequest), 1, 0, 0}
+	wire = append(wire, make([]byte, 16)...)
+	wire = append(wire, attrVendorSpecific, byte(len(vsa)+2))
+	wire = append(wire, vsa...)
+	wire[3] = byte(len(wire))
+	received, err = ParsePacket(wire, secret, dict)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if len(received.AttrItems) != 2 || received.GetValue("Acme-Name") != "a" || received.GetValue("Acme-Level") != uint32(7) {
+		t.Errorf("Unexpected attributes %s", received.String())
+	}
+}
@@ -1,6 +1,8 @@
 package radius
 
 import (
+	"bytes"
+	"net"
 	"testing"
 )
 
@@ -317,3 +319,125 @@ func TestDictionaryGetIndexMultiple(t *testing.T) {
 		}
 	}
 }
+
+// TestDictionaryValues tests the builtin enumerated values
+func TestDictionaryValues(t *testing.T) {
+	tests := []struct {
+		attr  string
+		name  string
+		value uint32
+	}{
+		{"Service-Type", "Framed-User", 2},
+		{"NAS-Port-Type", "Wireless-802.11", 19},
+		{"Tunnel-Type", "VLAN", 13},
+		{"Tunnel-Medium-Type", "IEEE-802", 6},
+		{"Acct-Status-Type", "Interim-Update", 3},
+		{"Acct-Authentic", "RADIUS", 1},
+		{"Acct-Terminate-Cause", "Host-Request", 18},
+	}
+	for _, tt := range tests {
+		if value, ok := Builtin.GetValueNumber(tt.attr, tt.name); !ok || value != tt.value {
+			t.Errorf("Expected %s %s = %d, got %d", tt.attr, tt.name, tt.value, value)
+		}
+		if name, ok := Builtin.GetValueName(tt.attr, tt.value); !ok || name != tt.name {
+			t.Errorf("Expected %s %d = %s, got %s", tt.attr, tt.value, tt.name, name)
+		}
+	}
+
+	if _, ok := Builtin.GetValueName("Acct-Status-Type", 100); ok {
+		t.Error("Expected no name for undefined value")
+	}
+	if _, ok := Builtin.GetValueNumber("User-Name", "Start"); ok {
+		t.Error("Expected no value for attribute without enumeration")
+	}
+
+	attr, err := Builtin.NewAttr("Acct-Status-Type", "Stop")
+	if err != nil {
+		t.Fatalf("NewAttr failed: %v", err)
+	}
+	if attr.AttrValue != uint32(2) {
+		t.Errorf("Expected uint32(2), got %v", attr.AttrValue)
+	}
+	if _, err := Builtin.NewAttr("Acct-Status-Type", "Unknown"); err == nil {
+		t.Error("Expected error for undefined value name")
+	}
+}
+
+// TestDictionaryParseValue tests ParseValue with the value formats of each type
+func TestDictionaryParseValue(t *testing.T) {
+	tests := []struct {
+		attr, text string
+		expected   interface{}
+	}{
+		{"Session-Timeout", "3600", uint32(3600)},
+		{"Session-Timeout", "0x10", uint32(16)},
+		{"Service-Type", "Framed-User", "Framed-User"},
+		{"Filter-Id", `"vpn users"`, "vpn users"},
+		{"Filter-Id", "vpn", "vpn"},
+	}
+	for _, tt := range tests {
+		value, err := Builtin.ParseValue(tt.attr, tt.text)
+		if err != nil || value != tt.expected {
+			t.Errorf("Expected %s = %v, got %v (%v)", tt.attr, tt.expected, value, err)
+		}
+	}
+
+	if value, err := Builtin.ParseValue("Class", "0x0102"); err != nil || !bytes.Equal(value.([]byte), []byte{1, 2}) {
+		t.Errorf("Expected hex octets, got %v (%v)", value, err)
+	}
+	if value, err := Builtin.ParseValue("NAS-IP-Address", "10.0.0.1"); err != nil || !value.(net.IP).Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Expected address, got %v (%v)", value, err)
+	}
+	for _, tt := range []struct{ attr, text string }{
+		{"Session-Timeout", "abc"},
+		{"Session-Timeout", "4294967296"},
+		{"NAS-IP-Address", "::1"},
+		{"Class", "0xzz"},
+		{"No-Such-Attr", "1"},
+		{"Filter-Id", `"unterminated`},
+	} {
+		if _, err := Builtin.ParseValue(tt.attr, tt.text); err == nil {
+			t.Errorf("Expected error for %s = %s", tt.attr, tt.text)
+		}
+	}
+}
+
+// TestDictionaryParseAttr tests ParseAttr with and without tags
+func TestDictionaryParseAttr(t *testing.T) {
+	attr, err := Builtin.ParseAttr("Acct-Status-Type = Stop")
+	if err != nil {
+		t.Fatalf("ParseAttr failed: %v", err)
+	}
+	if attr.AttrValue != uint32(2) || attr.Tag != 0 {
+		t.Errorf("Expected Acct-Status-Type = 2, got %v:%d", attr.AttrValue, attr.Tag)
+	}
+	attr, err = Builtin.ParseAttr("Tunnel-Private-Group-Id:3 = 100")
+	if err != nil {
+		t.Fatalf("ParseAttr failed: %v", err)
+	}
+	if attr.AttrValue != "100" || attr.Tag != 3 {
+		t.Errorf("Expected Tunnel-Private-Group-Id:3 = 100, got %v:%d", attr.AttrValue, attr.Tag)
+	}
+	for _, expr := range []string{"User-Name", "Tunnel-Type:32 = VLAN", "Tunnel-Type:x = VLAN"} {
+		if _, err := Builtin.ParseAttr(expr); err == nil {
+			t.Errorf("Expected error for %q", expr)
+		}
+	}
+}
+
+// TestDictionaryParseAttrs tests ParseAttrs with commas inside quotes
+func TestDictionaryParseAttrs(t *testing.T) {
+	attrs, err := Builtin.ParseAttrs(`User-Name = "bob, jr", User-Password = hello,, NAS-Port = 1`)
+	if err != nil {
+		t.Fatalf("ParseAttrs failed: %v", err)
+	}
+	if len(attrs) != 3 {
+		t.Fatalf("Expected 3 attributes, got %d", len(attrs))
+	}
+	if attrs[0].AttrValue != "bob, jr" || attrs[1].AttrValue != "hello" || attrs[2].AttrValue != uint32(1) {
+		t.Errorf("Unexpected values %v %v %v", attrs[0].AttrValue, attrs[1].AttrValue, attrs[2].AttrValue)
+	}
+	if _, err := Builtin.ParseAttrs("User-Name = bob, NAS-Port"); err == nil {
+		t.Error("Expected error for attribute without value")
+	}
+}
@@ -56,4 +56,37 @@
 //	Acct-Terminate-Cause   49  uint32
 //	Acct-Multi-Session-Id  50  string
 //	Acct-Link-Count        51  uint32
+//
+// The following attributes are defined by RFC 2869:
+//
+//	Acct-Input-Gigawords   52  uint32
+//	Acct-Output-Gigawords  53  uint32
+//	Event-Timestamp        55  time.Time
+//	Acct-Interim-Interval  85  uint32
+//
+// The following attributes are defined by RFC 2868 (tagged, see TAttribute.Tag):
+//
+//	Tunnel-Type               64  uint32
+//	Tunnel-Medium-Type        65  uint32
+//	Tunnel-Client-Endpoint    66  []byte
+//	Tunnel-Server-Endpoint    67  []byte
+//	Tunnel-Password           69  string (salt encrypted)
+//	Tunnel-Private-Group-Id   81  string
+//	Tunnel-Assignment-Id      82  []byte
+//	Tunnel-Preference         83  uint32
+//	Tunnel-Client-Auth-Id     90  string
+//	Tunnel-Server-Auth-Id     91  string
+//
+// The following attributes are defined by RFC 5176:
+//
+//	Error-Cause            101 uint32
+//
+// The following FreeRADIUS vendor attributes (Vendor-Id 11344) are used by
+// Status-Server (RFC 5997), see Server.StatusAttrs:
+//
+//	FreeRADIUS-Statistics-Type               127      uint32
+//	FreeRADIUS-Total-Access-Requests ...     128-137  uint32
+//	FreeRADIUS-Total-Accounting-Requests ... 148-154  uint32
+//	FreeRADIUS-Stats-Client-IP-Address       167      net.IP
+//	FreeRADIUS-Stats-Start-Time              176      time.Time
 package radius
@@ -0,0 +1,309 @@
+package radius
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	logs "github.com/tea4go/gh/log4go"
+)
+
+// 默认的 EAP 会话超时时间
+const defaultEAPTimeout = 30 * time.Second
+
+// IEAPMethod 是一次 EAP 会话中使用的认证方法。
+// 需要释放资源的方法同时实现 io.Closer，会话结束或超时时调用。
+type IEAPMethod interface {
+	// Start 返回第一个 EAP-Request 的 Type-Data
+	Start() ([]byte, error)
+	// Process 处理客户端的 EAP-Response，返回下一个 EAP-Request 的 Type-Data。
+	// done 为 true 时认证结束，err 为nil表示认证成功。
+	Process(response *TEAPPacket) (reply []byte, done bool, err error)
+	// MSK 返回认证成功后导出的主会话密钥（RFC 5216 2.3），没有时返回nil
+	MSK() []byte
+}
+
+// IEAPInnerIdentity 由隧道认证方法（如 PEAP）实现，返回隧道内认证的用户名，
+// 外层的 Identity 通常是匿名的。
+type IEAPInnerIdentity interface {
+	InnerIdentity() string
+}
+
+// TEAPMethod 是 EAPHandler 支持的认证方法，New 为每个会话创建 IEAPMethod，
+// 返回错误（如用户不存在）时拒绝认证。
+type TEAPMethod struct {
+	Type byte
+	New  func(identity string) (IEAPMethod, error)
+}
+
+// EAPHandler 处理带有 EAP-Message 的 Access-Request（RFC 3579）：
+// 拼接和拆分 EAP-Message，用 State 属性跟踪会话，按 Methods 进行认证。
+// 认证成功时回复 Access-Accept，带有 EAP-Success、User-Name 以及 MSK 生成的
+// MS-MPPE-Recv-Key/MS-MPPE-Send-Key。
+//
+//	server.Handler = &radius.EAPHandler{
+//		Methods: []radius.TEAPMethod{radius.EAPTLS(tlsConfig), radius.EAPMD5(getPassword)},
+//	}
+type EAPHandler struct {
+	// 支持的认证方法，第一个为默认方法，客户端 Nak 时按它期望的类型选择
+	Methods []TEAPMethod
+	// 认证成功后调用，返回 Access-Accept 中的授权属性，返回错误时拒绝认证
+	Authorize func(identity string, p *TDataPacket) ([]*TAttribute, error)
+	// 处理不带 EAP-Message 的请求，为nil时忽略
+	Next Handler
+	// 会话超过该时间没有收到下一个请求即删除，默认30秒
+	Timeout time.Duration
+
+	mu        sync.Mutex
+	sessions  map[string]*eapSession // State->会话
+	lastSweep time.Time
+}
+
+type eapSession struct {
+	identity   string
+	eapType    byte // 当前认证方法，0 表示还在等待 Identity
+	method     IEAPMethod
+	identifier byte // 最后一个 EAP-Request 的 Identifier
+	expires    time.Time
+}
+
+func (s *eapSession) close() {
+	if closer, ok := s.method.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+func (h *EAPHandler) ServeRadius(w ResponseWriter, p *TDataPacket) {
+	if p.Code != CodeAccessRequest || p.FindAttr("EAP-Message") == nil {
+		if h.Next != nil {
+			h.Next.ServeRadius(w, p)
+		}
+		return
+	}
+	// RFC 3579 3.3：带 EAP-Message 的请求必须有 Message-Authenticator
+	if !p.HasMessageAuthenticator() {
+		logs.Warning("[%s]==>EAP请求包(#%d)缺少Message-Authenticator，已丢弃。", w.RemoteAddr(), p.Identifier)
+		return
+	}
+
+	session, err := h.takeSession(p)
+	if err != nil {
+		logs.Warning("[%s]==>EAP请求包(#%d)无效，%s", w.RemoteAddr(), p.Identifier, err.Error())
+		h.reject(w, nil, 0)
+		return
+	}
+
+	msg := p.GetEAPMessage()
+	if len(msg) == 0 {
+		// EAP-Start（RFC 3579 2.1），要求客户端发送 Identity
+		h.challenge(w, p, session, EAPTypeIdentity, nil)
+		return
+	}
+	response, err := ParseEAPPacket(msg)
+	if err != nil || response.Code != EAPCodeResponse {
+		logs.Warning("[%s]==>EAP请求包(#%d)无效，%v", w.RemoteAddr(), p.Identifier, err)
+		h.reject(w, session, 0)
+		return
+	}
+	if session.eapType != 0 && response.Identifier != session.identifier {
+		logs.Warning("[%s]==>EAP响应(#%d)和请求(#%d)不匹配，已丢弃。", w.RemoteAddr(), response.Identifier, session.identifier)
+		h.keepSession(p, session)
+		return
+	}
+	logs.Debug("[%s]==>接收到%s", w.RemoteAddr(), response.String())
+
+	switch {
+	case session.eapType == 0:
+		if response.Type != EAPTypeIdentity || len(h.Methods) == 0 {
+			h.reject(w, session, response.Identifier)
+			return
+		}
+		session.identity = string(response.Data)
+		h.startMethod(w, p, session, h.Methods[0], response.Identifier)
+
+	case response.Type == EAPTypeNak:
+		// 客户端不支持当前方法，按它期望的类型选择
+		session.close()
+		for _, eapType := range response.Data {
+			for _, method := range h.Methods {
+				if method.Type == eapType && eapType != session.eapType {
+					h.startMethod(w, p, session, method, response.Identifier)
+					return
+				}
+			}
+		}
+		logs.Warning("[%s]==>用户(%s)没有可用的EAP认证方法%v", w.RemoteAddr(), session.identity, response.Data)
+		h.reject(w, nil, response.Identifier)
+
+	case response.Type != session.eapType:
+		h.reject(w, session, response.Identifier)
+
+	default:
+		reply, done, err := session.method.Process(response)
+		if !done {
+			if err != nil {
+				logs.Warning("[%s]==>用户(%s)EAP认证出错，%s", w.RemoteAddr(), session.identity, err.Error())
+				h.reject(w, session, response.Identifier)
+				return
+			}
+			h.challenge(w, p, session, session.eapType, reply)
+			return
+		}
+		session.close()
+		if err != nil {
+			logs.Info("[%s]==>用户(%s)EAP认证失败，%s", w.RemoteAddr(), session.identity, err.Error())
+			h.reject(w, nil, response.Identifier)
+			return
+		}
+		h.accept(w, p, session, response.Identifier)
+	}
+}
+
+// 取出 State 对应的会话，没有 State 时创建新会话
+func (h *EAPHandler) takeSession(p *TDataPacket) (*eapSession, error) {
+	state, ok := p.GetValue("State").([]byte)
+	if !ok {
+		return &eapSession{}, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	session := h.sessions[string(state)]
+	if session == nil {
+		return nil, errors.New("会话不存在或已经超时")
+	}
+	delete(h.sessions, string(state))
+	return session, nil
+}
+
+// 丢弃请求时放回会话，客户端可以重发
+func (h *EAPHandler) keepSession(p *TDataPacket, session *eapSession) {
+	if state, ok := p.GetValue("State").([]byte); ok {
+		h.mu.Lock()
+		h.sessions[string(state)] = session
+		h.mu.Unlock()
+	}
+}
+
+// 保存会话并返回新的 State
+func (h *EAPHandler) saveSession(session *eapSession) ([]byte, error) {
+	state := make([]byte, 16)
+	if _, err := rand.Read(state); err != nil {
+		return nil, err
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultEAPTimeout
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if h.sessions == nil {
+		h.sessions = make(map[string]*eapSession)
+	}
+	if now.Sub(h.lastSweep) >= timeout {
+		for key, s := range h.sessions {
+			if now.After(s.expires) {
+				s.close()
+				delete(h.sessions, key)
+			}
+		}
+		h.lastSweep = now
+	}
+	session.expires = now.Add(timeout)
+	h.sessions[string(state)] = session
+	return state, nil
+}
+
+func (h *EAPHandler) startMethod(w ResponseWriter, p *TDataPacket, session *eapSession, method TEAPMethod, identifier byte) {
+	instance, err := method.New(session.identity)
+	if err != nil {
+		logs.Info("[%s]==>用户(%s)不能使用EAP认证方法(%d)，%s", w.RemoteAddr(), session.identity, method.Type, err.Error())
+		h.reject(w, nil, identifier)
+		return
+	}
+	data, err := instance.Start()
+	if err != nil {
+		logs.Warning("[%s]==>EAP认证方法(%d)启动失败，%s", w.RemoteAddr(), method.Type, err.Error())
+		session.method = instance
+		h.reject(w, session, identifier)
+		return
+	}
+	session.method = instance
+	session.eapType = method.Type
+	session.identifier = identifier
+	h.challenge(w, p, session, method.Type, data)
+}
+
+// 发送 Access-Challenge，带有下一个 EAP-Request 和新的 State
+func (h *EAPHandler) challenge(w ResponseWriter, p *TDataPacket, session *eapSession, eapType byte, data []byte) {
+	if session.eapType == 0 && eapType == EAPTypeIdentity {
+		var id [1]byte
+		rand.Read(id[:])
+		session.identifier = id[0]
+	} else {
+		session.identifier++
+	}
+	state, err := h.saveSession(session)
+	if err != nil {
+		h.reject(w, session, 0)
+		return
+	}
+	request := &TEAPPacket{Code: EAPCodeRequest, Identifier: session.identifier, Type: eapType, Data: data}
+	attrs := eapMessageAttrs(request.Encode())
+	attrs = append(attrs, &TAttribute{AttrId: p.Dictionary.GetEntry("State").Id, AttrValue: state})
+	if err := w.AccessChallenge(attrs...); err != nil {
+		logs.Warning("[%s]==>发送EAP请求失败，%s", w.RemoteAddr(), err.Error())
+	}
+}
+
+// 发送带有 EAP-Failure 的 Access-Reject，session 不为nil时关闭
+func (h *EAPHandler) reject(w ResponseWriter, session *eapSession, identifier byte) {
+	if session != nil {
+		session.close()
+	}
+	failure := &TEAPPacket{Code: EAPCodeFailure, Identifier: identifier}
+	w.AccessReject(eapMessageAttrs(failure.Encode())...)
+}
+
+func (h *EAPHandler) accept(w ResponseWriter, p *TDataPacket, session *eapSession, identifier byte) {
+	if inner, ok := session.method.(IEAPInnerIdentity); ok && inner.InnerIdentity() != "" {
+		session.identity = inner.InnerIdentity()
+	}
+	success := &TEAPPacket{Code: EAPCodeSuccess, Identifier: identifier}
+	attrs := eapMessageAttrs(success.Encode())
+	if name, err := p.Dictionary.NewAttr("User-Name", session.identity); err == nil {
+		attrs = append(attrs, name)
+	}
+
+	// RFC 2548 / RFC 5216：MSK 前32字节为 Recv-Key，后32字节为 Send-Key
+	if msk := session.method.MSK(); len(msk) >= 64 {
+		recvKey, err := encryptMPPEKey(msk[:32], p.Secret, p.Authenticator, 0)
+		if err != nil {
+			h.reject(w, nil, identifier)
+			return
+		}
+		sendKey, err := encryptMPPEKey(msk[32:64], p.Secret, p.Authenticator, 1)
+		if err != nil {
+			h.reject(w, nil, identifier)
+			return
+		}
+		attrs = append(attrs,
+			NewVendorAttr(VendorMicrosoft, MSMPPERecvKey, recvKey),
+			NewVendorAttr(VendorMicrosoft, MSMPPESendKey, sendKey))
+	}
+
+	if h.Authorize != nil {
+		authz, err := h.Authorize(session.identity, p)
+		if err != nil {
+			logs.Info("[%s]==>用户(%s)授权失败，%s", w.RemoteAddr(), session.identity, err.Error())
+			h.reject(w, nil, identifier)
+			return
+		}
+		attrs = append(attrs, authz...)
+	}
+	logs.Info("[%s]==>用户(%s)EAP认证成功", w.RemoteAddr(), session.identity)
+	w.AccessAccept(attrs...)
+}
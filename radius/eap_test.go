@@ -0,0 +1,228 @@
+package radius
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServer starts a server with handler and the secret of 127.0.0.1, and returns its address
+func testServer(t *testing.T, handler Handler, secret string) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	server := &Server{
+		Dictionary: Builtin,
+		Handler:    handler,
+		ClientsMap: map[string]string{"127.0.0.1": secret},
+	}
+	go server.Serve(conn)
+	t.Cleanup(func() { server.Close() })
+	return conn.LocalAddr().String()
+}
+
+// testEAPServer starts a server with handler and the secret "secret", and returns its address and a client
+func testEAPServer(t *testing.T, handler Handler) (string, *Client) {
+	t.Helper()
+	addr := testServer(t, handler, "secret")
+	client := &Client{ReadTimeout: 2 * time.Second}
+	t.Cleanup(func() { client.Close() })
+	return addr, client
+}
+
+// testEAPConversation sends EAP responses to the server, keeping the State attribute
+type testEAPConversation struct {
+	t       *testing.T
+	addr    string
+	client  *Client
+	state   []byte
+	request *TEAPPacket // the last EAP request from the server
+	packet  *TDataPacket
+	// Request Authenticator of the last Access-Request
+	authenticator [16]byte
+}
+
+func newTestEAPConversation(t *testing.T, handler Handler) *testEAPConversation {
+	addr, client := testEAPServer(t, handler)
+	return &testEAPConversation{t: t, addr: addr, client: client}
+}
+
+// send sends an EAP message and returns the RADIUS response
+func (c *testEAPConversation) send(msg []byte) *TDataPacket {
+	c.t.Helper()
+	request := NewPacket(CodeAccessRequest, []byte("secret"))
+	request.AddAttr("User-Name", "testuser")
+	request.SetEAPMessage(msg)
+	if c.state != nil {
+		request.AddAttr("State", c.state)
+	}
+	request.AddMessageAuthenticator()
+	c.authenticator = request.Authenticator
+	response, err := c.client.SendPacket(request, c.addr)
+	if err != nil {
+		c.t.Fatalf("SendPacket failed: %v", err)
+	}
+	c.packet = response
+	c.state, _ = response.GetValue("State").([]byte)
+	if c.request, err = ParseEAPPacket(response.GetEAPMessage()); err != nil {
+		c.t.Fatalf("Invalid EAP message in response: %v", err)
+	}
+	return response
+}
+
+// respond sends an EAP-Response to the last request
+func (c *testEAPConversation) respond(eapType byte, data []byte) *TDataPacket {
+	c.t.Helper()
+	var id byte
+	if c.request != nil {
+		id = c.request.Identifier
+	}
+	response := &TEAPPacket{Code: EAPCodeResponse, Identifier: id, Type: eapType, Data: data}
+	return c.send(response.Encode())
+}
+
+// TestEAPHandlerStart tests EAP-Start and identity handling
+func TestEAPHandlerStart(t *testing.T) {
+	c := newTestEAPConversation(t, &EAPHandler{
+		Methods: []TEAPMethod{EAPMD5(func(identity string) (string, error) { return "password", nil })},
+	})
+
+	response := c.send(nil)
+	if response.Code != CodeAccessChallenge || c.request.Type != EAPTypeIdentity || c.state == nil {
+		t.Fatalf("Expected EAP-Request/Identity, got %s", c.request)
+	}
+	if !response.HasMessageAuthenticator() {
+		t.Error("Expected Message-Authenticator in Access-Challenge")
+	}
+
+	c.respond(EAPTypeIdentity, []byte("alice"))
+	if c.request.Code != EAPCodeRequest || c.request.Type != EAPTypeMD5 {
+		t.Fatalf("Expected EAP-MD5 request, got %s", c.request)
+	}
+}
+
+// TestEAPHandlerInvalidRequests tests requests the handler drops or rejects
+func TestEAPHandlerInvalidRequests(t *testing.T) {
+	var nextCalled int32
+	handler := &EAPHandler{
+		Methods: []TEAPMethod{EAPMD5(func(identity string) (string, error) { return "password", nil })},
+		Next: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			atomic.StoreInt32(&nextCalled, 1)
+			w.AccessReject()
+		}),
+	}
+	c := newTestEAPConversation(t, handler)
+
+	// without EAP-Message
+	request := NewPacket(CodeAccessRequest, []byte("secret"))
+	request.AddAttr("User-Name", "testuser")
+	if _, err := c.client.SendPacket(request, c.addr); err != nil || atomic.LoadInt32(&nextCalled) == 0 {
+		t.Errorf("Expected request without EAP-Message to reach Next, got %v", err)
+	}
+
+	// without Message-Authenticator
+	request = NewPacket(CodeAccessRequest, []byte("secret"))
+	request.SetEAPMessage((&TEAPPacket{Code: EAPCodeResponse, Type: EAPTypeIdentity, Data: []byte("alice")}).Encode())
+	quick := &Client{ReadTimeout: 200 * time.Millisecond}
+	defer quick.Close()
+	if _, err := quick.SendPacket(request, c.addr); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected request without Message-Authenticator to be dropped, got %v", err)
+	}
+
+	// unknown State
+	c.state = []byte("unknown")
+	if response := c.respond(EAPTypeIdentity, []byte("alice")); response.Code != CodeAccessReject || c.request.Code != EAPCodeFailure {
+		t.Errorf("Expected reject for unknown State, got %d", response.Code)
+	}
+
+	// first response is not an identity
+	c.state = nil
+	if response := c.respond(EAPTypeMD5, []byte{16}); response.Code != CodeAccessReject {
+		t.Errorf("Expected reject without identity, got %d", response.Code)
+	}
+}
+
+// TestEAPHandlerNak tests switching method when the peer sends a Nak
+func TestEAPHandlerNak(t *testing.T) {
+	ca := testCertificate(t, "ca", nil, true)
+	c := newTestEAPConversation(t, &EAPHandler{
+		Methods: []TEAPMethod{
+			EAPTLS(&tls.Config{Certificates: []tls.Certificate{testCertificate(t, "server", &ca, false)}}),
+			EAPMD5(func(identity string) (string, error) { return "password", nil }),
+		},
+	})
+
+	c.respond(EAPTypeIdentity, []byte("alice"))
+	if c.request.Type != EAPTypeTLS {
+		t.Fatalf("Expected EAP-TLS request, got %s", c.request)
+	}
+	c.respond(EAPTypeNak, []byte{EAPTypeMD5})
+	if c.request.Type != EAPTypeMD5 {
+		t.Fatalf("Expected EAP-MD5 request after Nak, got %s", c.request)
+	}
+	if response := c.respond(EAPTypeNak, []byte{EAPTypePEAP}); response.Code != CodeAccessReject {
+		t.Errorf("Expected reject when no method is acceptable, got %d", response.Code)
+	}
+}
+
+// TestEAPHandlerAuthorize tests Authorize attributes and rejection
+func TestEAPHandlerAuthorize(t *testing.T) {
+	handler := &EAPHandler{
+		Methods: []TEAPMethod{EAPMD5(func(identity string) (string, error) { return "password", nil })},
+		Authorize: func(identity string, p *TDataPacket) ([]*TAttribute, error) {
+			if identity != "alice" {
+				return nil, fmt.Errorf("user %s is disabled", identity)
+			}
+			reply, _ := p.Dictionary.NewAttr("Reply-Message", "welcome")
+			return []*TAttribute{reply}, nil
+		},
+	}
+
+	for _, tt := range []struct {
+		identity string
+		code     Code
+	}{
+		{"alice", CodeAccessAccept},
+		{"bob", CodeAccessReject},
+	} {
+		c := newTestEAPConversation(t, handler)
+		c.respond(EAPTypeIdentity, []byte(tt.identity))
+		response := c.respond(EAPTypeMD5, testEAPMD5Response(c.request, "password"))
+		if response.Code != tt.code {
+			t.Errorf("Expected %d for %s, got %d", tt.code, tt.identity, response.Code)
+		}
+		if tt.code == CodeAccessAccept && response.GetString("Reply-Message") != "welcome" {
+			t.Errorf("Expected Reply-Message from Authorize, got %q", response.GetString("Reply-Message"))
+		}
+	}
+}
+
+// TestEAPHandlerTimeout tests that expired sessions are removed
+func TestEAPHandlerTimeout(t *testing.T) {
+	handler := &EAPHandler{
+		Methods: []TEAPMethod{EAPMD5(func(identity string) (string, error) { return "password", nil })},
+		Timeout: 20 * time.Millisecond,
+	}
+	c := newTestEAPConversation(t, handler)
+	c.respond(EAPTypeIdentity, []byte("alice"))
+	time.Sleep(30 * time.Millisecond)
+
+	// a new conversation sweeps the expired session
+	other := &testEAPConversation{t: t, addr: c.addr, client: c.client}
+	other.respond(EAPTypeIdentity, []byte("bob"))
+	handler.mu.Lock()
+	sessions := len(handler.sessions)
+	handler.mu.Unlock()
+	if sessions != 1 {
+		t.Errorf("Expected 1 session after sweep, got %d", sessions)
+	}
+	if response := c.respond(EAPTypeMD5, testEAPMD5Response(c.request, "password")); response.Code != CodeAccessReject {
+		t.Errorf("Expected reject for expired session, got %d", response.Code)
+	}
+}
@@ -0,0 +1,251 @@
+package radius
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/tea4go/gh/ldapclient"
+	logs "github.com/tea4go/gh/log4go"
+)
+
+// 默认的用户组属性
+const defaultGroupAttr = "memberOf"
+
+// 默认的 LDAP 连接数和请求超时
+const (
+	defaultLDAPConns   = 4
+	defaultLDAPTimeout = 5 * time.Second
+)
+
+// errLDAPUnavailable 表示 LDAP 服务器不可用，请求不回复
+var errLDAPUnavailable = errors.New("radius: LDAP server unavailable")
+
+// LDAPHandler 用 LDAP 目录认证 Access-Request，按授权策略回复属性：
+//
+//   - PAP：用 User-Password 绑定用户（TLdapClient.Auth）。
+//   - CHAP、MS-CHAP、MS-CHAPv2：需要设置 PasswordAttr，从目录中读取明文密码校验。
+//
+// 认证成功后读取用户的 GroupAttr，按客户端地址和所属的组匹配 Policies 中的规则，
+// 规则的属性加入 Access-Accept。没有匹配的规则或规则为 reject 时拒绝认证。
+// LDAP 服务器不可用时不回复，客户端会重试或切换到备用服务器。
+//
+// Client 的 AuthFilter 用 %s 代替用户名（已按 RFC 4515 转义），
+// Attributes 需要包含 GroupAttr 和 PasswordAttr（为空时返回所有属性）。
+//
+// Client 只作为连接配置，认证使用按它复制的 MaxConns 个连接，同时最多处理
+// MaxConns 个 Access-Request，其余的请求等待空闲的连接。Client.Timeout 为0时
+// 每个 LDAP 请求最多等待 5 秒，超时按 LDAP 服务器不可用处理。
+//
+//	policies, _ := radius.LoadPolicyFile("policy.conf", nil)
+//	server.Handler = &radius.LDAPHandler{
+//		Client: &ldapclient.TLdapClient{
+//			Addr: "ldap.example.com:389", BaseDn: "dc=example,dc=com",
+//			BindDn: "cn=radius,dc=example,dc=com", BindPass: "secret",
+//			AuthFilter: "(uid=%s)",
+//		},
+//		Policies: policies,
+//	}
+type LDAPHandler struct {
+	Client *ldapclient.TLdapClient
+	// 授权策略，为nil时接受所有认证成功的用户，不回复属性
+	Policies *TPolicySet
+	// 用户组属性，默认 memberOf，值为组的 DN 或名字
+	GroupAttr string
+	// 明文密码属性，为空时只支持 PAP
+	PasswordAttr string
+	// 处理 Access-Request 以外的请求以及带 EAP-Message 的请求，为nil时忽略
+	Next Handler
+	// 同时使用的 LDAP 连接数，默认 4
+	MaxConns int
+
+	once  sync.Once
+	conns chan *ldapclient.TLdapClient // 空闲的连接，TLdapClient 不能并发使用
+}
+
+// 认证方式
+type ldapAuthMethod int
+
+const (
+	ldapAuthNone ldapAuthMethod = iota
+	ldapAuthPAP
+	ldapAuthCHAP
+	ldapAuthMSCHAP
+	ldapAuthMSCHAPv2
+)
+
+func (h *LDAPHandler) ServeRadius(w ResponseWriter, p *TDataPacket) {
+	if p.Code != CodeAccessRequest || p.FindAttr("EAP-Message") != nil {
+		if h.Next != nil {
+			h.Next.ServeRadius(w, p)
+		}
+		return
+	}
+
+	username, _ := p.GetValue("User-Name").(string)
+	method := getLDAPAuthMethod(p)
+	if username == "" || method == ldapAuthNone {
+		logs.Warning("[%s]==>认证请求包(#%d)缺少用户名或密码，拒绝认证。", w.RemoteAddr(), p.Identifier)
+		w.AccessReject()
+		return
+	}
+	if method != ldapAuthPAP && h.PasswordAttr == "" {
+		logs.Warning("[%s]==>用户(%s)使用CHAP认证，没有设置明文密码属性，拒绝认证。", w.RemoteAddr(), username)
+		w.AccessReject()
+		return
+	}
+
+	groups, attrs, err := h.authenticate(p, username, method)
+	if errors.Is(err, errLDAPUnavailable) {
+		logs.Error("[%s]==>用户(%s)认证失败，%s", w.RemoteAddr(), username, err.Error())
+		return
+	}
+	if err != nil {
+		logs.Info("[%s]==>用户(%s)认证失败，%s", w.RemoteAddr(), username, err.Error())
+		h.reject(w, p, method)
+		return
+	}
+
+	if h.Policies != nil {
+		var rule *TPolicyRule
+		if policy := h.Policies.Policy(addrIP(w.RemoteAddr())); policy != nil {
+			rule = policy.Match(groups)
+		}
+		if rule == nil || rule.Reject {
+			logs.Info("[%s]==>用户(%s)没有授权，所属的组%v", w.RemoteAddr(), username, groups)
+			h.reject(w, p, method)
+			return
+		}
+		attrs = append(attrs, rule.Attrs...)
+	}
+	logs.Info("[%s]==>用户(%s)认证成功。", w.RemoteAddr(), username)
+	w.AccessAccept(attrs...)
+}
+
+func (h *LDAPHandler) reject(w ResponseWriter, p *TDataPacket, method ldapAuthMethod) {
+	if method == ldapAuthMSCHAP || method == ldapAuthMSCHAPv2 {
+		w.AccessReject(p.MSCHAPError(691))
+		return
+	}
+	w.AccessReject()
+}
+
+func getLDAPAuthMethod(p *TDataPacket) ldapAuthMethod {
+	switch {
+	case p.FindAttr("User-Password") != nil:
+		return ldapAuthPAP
+	case p.FindAttr("CHAP-Password") != nil:
+		return ldapAuthCHAP
+	case p.GetVendorAttr(VendorMicrosoft, MSCHAP2Response) != nil:
+		return ldapAuthMSCHAPv2
+	case p.GetVendorAttr(VendorMicrosoft, MSCHAPResponse) != nil:
+		return ldapAuthMSCHAP
+	}
+	return ldapAuthNone
+}
+
+// authenticate 校验用户的密码，返回用户所属的组和 MS-CHAPv2 需要回复的属性
+func (h *LDAPHandler) authenticate(p *TDataPacket, username string, method ldapAuthMethod) ([]string, []*TAttribute, error) {
+	client := h.acquire()
+	defer h.release(client)
+
+	if client.IsClosing() {
+		if err := client.Connect(); err != nil {
+			return nil, nil, fmt.Errorf("%w，%s", errLDAPUnavailable, err.Error())
+		}
+	}
+	// 用户名放入过滤器前需要转义，防止 LDAP 注入
+	name := ldap.EscapeFilter(username)
+
+	if method == ldapAuthPAP {
+		_, password, err := p.PAP()
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := client.Auth(name, password); err != nil {
+			return nil, nil, checkLDAPError(client, err)
+		}
+	}
+	user, err := client.SearchUser(name)
+	if err != nil {
+		return nil, nil, checkLDAPError(client, err)
+	}
+
+	var attrs []*TAttribute
+	if method != ldapAuthPAP {
+		password := user.GetAttr(h.PasswordAttr)
+		if password == "" {
+			return nil, nil, fmt.Errorf("目录中没有用户的明文密码属性(%s)", h.PasswordAttr)
+		}
+		switch method {
+		case ldapAuthCHAP:
+			err = p.VerifyCHAP(password)
+		case ldapAuthMSCHAP:
+			err = p.VerifyMSCHAP(NTPasswordHash(password))
+		case ldapAuthMSCHAPv2:
+			attrs, err = p.VerifyMSCHAPv2(NTPasswordHash(password))
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	groupAttr := h.GroupAttr
+	if groupAttr == "" {
+		groupAttr = defaultGroupAttr
+	}
+	return user.Attrs[groupAttr], attrs, nil
+}
+
+// acquire 取出一个空闲的连接，没有时等待其他请求释放
+func (h *LDAPHandler) acquire() *ldapclient.TLdapClient {
+	h.once.Do(func() {
+		size := h.MaxConns
+		if size <= 0 {
+			size = defaultLDAPConns
+		}
+		h.conns = make(chan *ldapclient.TLdapClient, size)
+		for i := 0; i < size; i++ {
+			client := *h.Client
+			client.Conn = nil
+			if client.Timeout <= 0 {
+				client.Timeout = defaultLDAPTimeout
+			}
+			h.conns <- &client
+		}
+	})
+	return <-h.conns
+}
+
+func (h *LDAPHandler) release(client *ldapclient.TLdapClient) {
+	h.conns <- client
+}
+
+// Close 等待正在进行的认证结束后关闭所有 LDAP 连接，之后的请求会重新连接
+func (h *LDAPHandler) Close() {
+	clients := make([]*ldapclient.TLdapClient, 0, cap(h.conns))
+	for i := 0; i < cap(h.conns); i++ {
+		client := h.acquire()
+		client.Close()
+		clients = append(clients, client)
+	}
+	for _, client := range clients {
+		h.release(client)
+	}
+}
+
+// checkLDAPError 在认证失败后恢复连接的绑定用户（Auth 失败时连接可能处于匿名状态），
+// 连接断开或超时时返回 errLDAPUnavailable
+func checkLDAPError(client *ldapclient.TLdapClient, err error) error {
+	if client.IsClosing() || ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+		client.Close()
+		return fmt.Errorf("%w，%s", errLDAPUnavailable, err.Error())
+	}
+	if bindErr := client.Conn.Bind(client.BindDn, client.BindPass); bindErr != nil {
+		client.Close()
+		return fmt.Errorf("%w，%s", errLDAPUnavailable, bindErr.Error())
+	}
+	return err
+}
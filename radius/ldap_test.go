@@ -0,0 +1,279 @@
+package radius
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	goldap "github.com/openstandia/goldap/message"
+	"github.com/tea4go/gh/ldapclient"
+	"github.com/tea4go/gh/ldapserver"
+)
+
+// testLDAPUser is a directory entry of testLDAPServer
+type testLDAPUser struct {
+	dn       string
+	password string
+	groups   []string
+}
+
+var testLDAPUsers = map[string]testLDAPUser{
+	"alice": {"uid=alice,ou=people,dc=example,dc=com", "alice-pw", []string{"cn=vpn,ou=groups,dc=example,dc=com"}},
+	"bob":   {"uid=bob,ou=people,dc=example,dc=com", "bob-pw", []string{"cn=guests,ou=groups,dc=example,dc=com"}},
+	"carol": {"uid=carol,ou=people,dc=example,dc=com", "carol-pw", nil},
+}
+
+// testLDAPServer starts an ldapserver with testLDAPUsers and returns its address,
+// searches for uid=slow never answer until the test ends
+func testLDAPServer(t *testing.T) string {
+	t.Helper()
+	stalled := make(chan struct{})
+	routes := ldapserver.NewRouteMux()
+	routes.Bind(func(w ldapserver.ResponseWriter, m *ldapserver.Message) {
+		r := m.GetBindRequest()
+		dn, password := string(r.Name()), string(r.AuthenticationSimple())
+		if dn == "cn=radius,dc=example,dc=com" && password == "radius-pw" {
+			w.Write(ldapserver.NewBindResponse(ldapserver.LDAPResultSuccess))
+			return
+		}
+		for _, user := range testLDAPUsers {
+			if user.dn == dn && user.password == password {
+				w.Write(ldapserver.NewBindResponse(ldapserver.LDAPResultSuccess))
+				return
+			}
+		}
+		w.Write(ldapserver.NewBindResponse(ldapserver.LDAPResultInvalidCredentials))
+	})
+	routes.Search(func(w ldapserver.ResponseWriter, m *ldapserver.Message) {
+		r := m.GetSearchRequest()
+		if filter, ok := r.Filter().(goldap.FilterEqualityMatch); ok {
+			assertion := goldap.AttributeValueAssertion(filter)
+			if assertion.AssertionValue() == "slow" {
+				<-stalled
+				return
+			}
+			if user, ok := testLDAPUsers[string(assertion.AssertionValue())]; ok && assertion.AttributeDesc() == "uid" {
+				entry := ldapserver.NewSearchResultEntry(user.dn)
+				entry.AddAttribute("userPassword", goldap.AttributeValue(user.password))
+				for _, group := range user.groups {
+					entry.AddAttribute("memberOf", goldap.AttributeValue(group))
+				}
+				w.Write(entry)
+			}
+		}
+		w.Write(ldapserver.NewSearchResultDoneResponse(ldapserver.LDAPResultSuccess))
+	})
+
+	server := ldapserver.NewServer()
+	server.Handle(routes)
+	server.SetClients("127.0.0.1")
+	ch := make(chan error)
+	go server.ListenAndServe("127.0.0.1:0", ch)
+	if err := <-ch; err != nil {
+		t.Fatalf("ListenAndServe failed: %v", err)
+	}
+	addr := server.Listener.Addr().String()
+	t.Cleanup(func() {
+		server.Listener.Close()
+		server.Stop()
+	})
+	t.Cleanup(func() { close(stalled) })
+	return addr
+}
+
+// testLDAPHandler returns an LDAPHandler for testLDAPServer with testPolicy
+func testLDAPHandler(t *testing.T, addr string) *LDAPHandler {
+	t.Helper()
+	policies, err := ParsePolicy(strings.NewReader(testPolicy), nil)
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+	client := &ldapclient.TLdapClient{
+		Addr:       addr,
+		BaseDn:     "dc=example,dc=com",
+		BindDn:     "cn=radius,dc=example,dc=com",
+		BindPass:   "radius-pw",
+		AuthFilter: "(uid=%s)",
+	}
+	handler := &LDAPHandler{Client: client, Policies: policies, PasswordAttr: "userPassword"}
+	t.Cleanup(handler.Close)
+	return handler
+}
+
+// TestLDAPHandlerPAP tests PAP authentication and group policies
+func TestLDAPHandlerPAP(t *testing.T) {
+	handler := testLDAPHandler(t, testLDAPServer(t))
+	addr, client := testEAPServer(t, handler)
+
+	tests := []struct {
+		username, password string
+		code               Code
+	}{
+		{"alice", "alice-pw", CodeAccessAccept},
+		{"alice", "wrong", CodeAccessReject},
+		{"bob", "bob-pw", CodeAccessReject},     // guests are rejected
+		{"carol", "carol-pw", CodeAccessAccept}, // group *
+		{"dave", "dave-pw", CodeAccessReject},
+		{"*", "alice-pw", CodeAccessReject}, // filter injection
+		{"alice", "alice-pw", CodeAccessAccept},
+	}
+	for _, tt := range tests {
+		request := NewPacket(CodeAccessRequest, []byte("secret"))
+		request.Set("User-Name", tt.username)
+		request.Set("User-Password", tt.password)
+		response, err := client.SendPacket(request, addr)
+		if err != nil {
+			t.Fatalf("SendPacket(%s) failed: %v", tt.username, err)
+		}
+		if response.Code != tt.code {
+			t.Errorf("Expected %v for %s/%s, got %v", tt.code, tt.username, tt.password, response.Code)
+		}
+	}
+}
+
+// TestLDAPHandlerPolicy tests the reply attributes selected by client address
+func TestLDAPHandlerPolicy(t *testing.T) {
+	handler := testLDAPHandler(t, testLDAPServer(t))
+	handler.Policies.Policies[1].Networks = append(handler.Policies.Policies[1].Networks,
+		&net.IPNet{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)})
+	addr, client := testEAPServer(t, handler)
+
+	request := NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "alice")
+	request.Set("User-Password", "alice-pw")
+	response, err := client.SendPacket(request, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessAccept {
+		t.Fatalf("Expected Access-Accept, got %v", response.Code)
+	}
+	if v := response.GetValue("Filter-Id"); v != "vpn" {
+		t.Errorf("Expected Filter-Id = vpn, got %v", v)
+	}
+	if v := response.GetValue("Session-Timeout"); v != uint32(3600) {
+		t.Errorf("Expected Session-Timeout = 3600, got %v", v)
+	}
+
+	// the nas policy has no rule for users without groups
+	request = NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "carol")
+	request.Set("User-Password", "carol-pw")
+	response, err = client.SendPacket(request, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessReject {
+		t.Errorf("Expected Access-Reject for carol, got %v", response.Code)
+	}
+}
+
+// TestLDAPHandlerCHAP tests CHAP and MS-CHAPv2 with the cleartext password from the directory
+func TestLDAPHandlerCHAP(t *testing.T) {
+	ldapAddr := testLDAPServer(t)
+	addr, client := testEAPServer(t, testLDAPHandler(t, ldapAddr))
+
+	request := NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "alice")
+	request.SetCHAPPassword("alice-pw")
+	response, err := client.SendPacket(request, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessAccept {
+		t.Errorf("Expected Access-Accept for CHAP, got %v", response.Code)
+	}
+
+	request = NewPacket(CodeAccessRequest, []byte("secret"))
+	request.SetMSCHAPv2("alice", "alice-pw")
+	response, err = client.SendPacket(request, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessAccept || response.GetVendorAttr(VendorMicrosoft, MSCHAP2Success) == nil {
+		t.Errorf("Expected Access-Accept with MS-CHAP2-Success, got %v", response.Code)
+	}
+
+	request = NewPacket(CodeAccessRequest, []byte("secret"))
+	request.SetMSCHAPv2("alice", "wrong")
+	response, err = client.SendPacket(request, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessReject || response.GetVendorAttr(VendorMicrosoft, MSCHAPError) == nil {
+		t.Errorf("Expected Access-Reject with MS-CHAP-Error, got %v", response.Code)
+	}
+
+	// without PasswordAttr only PAP is supported
+	handler := testLDAPHandler(t, ldapAddr)
+	handler.PasswordAttr = ""
+	addr, client = testEAPServer(t, handler)
+	request = NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "alice")
+	request.SetCHAPPassword("alice-pw")
+	response, err = client.SendPacket(request, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessReject {
+		t.Errorf("Expected Access-Reject without PasswordAttr, got %v", response.Code)
+	}
+}
+
+// TestLDAPHandlerUnavailable tests that an unreachable LDAP server is not treated as a reject
+func TestLDAPHandlerUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	handler := testLDAPHandler(t, addr)
+	request := NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "alice")
+	request.Set("User-Password", "alice-pw")
+	if _, _, err := handler.authenticate(request, "alice", ldapAuthPAP); !errors.Is(err, errLDAPUnavailable) {
+		t.Errorf("Expected errLDAPUnavailable, got %v", err)
+	}
+}
+
+// TestLDAPHandlerStalled tests that a stalled LDAP request times out without blocking other requests
+func TestLDAPHandlerStalled(t *testing.T) {
+	handler := testLDAPHandler(t, testLDAPServer(t))
+	handler.Client.Timeout = 500 * time.Millisecond
+	handler.PasswordAttr = "userPassword"
+
+	slow := make(chan error, 1)
+	go func() {
+		request := NewPacket(CodeAccessRequest, []byte("secret"))
+		request.SetCHAPPassword("slow-pw")
+		_, _, err := handler.authenticate(request, "slow", ldapAuthCHAP)
+		slow <- err
+	}()
+	time.Sleep(100 * time.Millisecond) // the slow search reaches the server
+
+	request := NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "alice")
+	request.Set("User-Password", "alice-pw")
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		if _, _, err := handler.authenticate(request, "alice", ldapAuthPAP); err != nil {
+			t.Fatalf("authenticate failed: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+			t.Errorf("Expected alice not to wait for the stalled request, took %v", elapsed)
+		}
+	}
+
+	select {
+	case err := <-slow:
+		if !errors.Is(err, errLDAPUnavailable) {
+			t.Errorf("Expected errLDAPUnavailable, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stalled request to time out")
+	}
+}
@@ -0,0 +1,127 @@
+package radius
+
+import (
+	"crypto/des"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// MS-CHAPv1 (RFC 2433)、MS-CHAPv2 (RFC 2759) 以及 MPPE 密钥 (RFC 3079) 的算法实现。
+
+var (
+	// RFC 2759 8.7
+	mschapMagic1 = []byte("Magic server to client signing constant")
+	mschapMagic2 = []byte("Pad to make it do more than one iteration")
+
+	// RFC 3079 3.4
+	mppeMagic1 = []byte("This is the MPPE Master Key")
+	mppeMagic2 = []byte("On the client side, this is the send key; on the server side, it is the receive key.")
+	mppeMagic3 = []byte("On the client side, this is the receive key; on the server side, it is the send key.")
+	mppePad1   = make([]byte, 40)
+	mppePad2   = []byte(strings.Repeat("\xf2", 40))
+)
+
+// NTPasswordHash 返回密码的 NT hash，即 MD4(UTF-16LE(password))。
+func NTPasswordHash(password string) []byte {
+	chars := utf16.Encode([]rune(password))
+	buff := make([]byte, 2*len(chars))
+	for i, c := range chars {
+		buff[2*i] = byte(c)
+		buff[2*i+1] = byte(c >> 8)
+	}
+	hash := md4.New()
+	hash.Write(buff)
+	return hash.Sum(nil)
+}
+
+func hashNTPasswordHash(passwordHash []byte) []byte {
+	hash := md4.New()
+	hash.Write(passwordHash)
+	return hash.Sum(nil)
+}
+
+// ChallengeResponse，RFC 2759 8.5
+func mschapChallengeResponse(challenge, passwordHash []byte) []byte {
+	zPasswordHash := make([]byte, 21)
+	copy(zPasswordHash, passwordHash)
+
+	response := make([]byte, 24)
+	for i := 0; i < 3; i++ {
+		block, _ := des.NewCipher(desKey(zPasswordHash[7*i : 7*i+7]))
+		block.Encrypt(response[8*i:8*i+8], challenge)
+	}
+	return response
+}
+
+// 把 7 字节扩展为 8 字节的 DES 密钥（校验位不使用）
+func desKey(key []byte) []byte {
+	return []byte{
+		key[0],
+		key[0]<<7 | key[1]>>1,
+		key[1]<<6 | key[2]>>2,
+		key[2]<<5 | key[3]>>3,
+		key[3]<<4 | key[4]>>4,
+		key[4]<<3 | key[5]>>5,
+		key[5]<<2 | key[6]>>6,
+		key[6] << 1,
+	}
+}
+
+// ChallengeHash，RFC 2759 8.2，用户名不包含 Windows 域名
+func mschapChallengeHash(peerChallenge, authenticatorChallenge []byte, username string) []byte {
+	if i := strings.LastIndexByte(username, '\\'); i >= 0 {
+		username = username[i+1:]
+	}
+	hash := sha1.New()
+	hash.Write(peerChallenge)
+	hash.Write(authenticatorChallenge)
+	hash.Write([]byte(username))
+	return hash.Sum(nil)[:8]
+}
+
+// GenerateNTResponse，RFC 2759 8.1
+func mschapv2NTResponse(authenticatorChallenge, peerChallenge []byte, username string, passwordHash []byte) []byte {
+	challenge := mschapChallengeHash(peerChallenge, authenticatorChallenge, username)
+	return mschapChallengeResponse(challenge, passwordHash)
+}
+
+// GenerateAuthenticatorResponse，RFC 2759 8.7，返回 "S=" 加 40 个十六进制字符
+func mschapv2AuthenticatorResponse(passwordHash, ntResponse, peerChallenge, authenticatorChallenge []byte, username string) string {
+	hash := sha1.New()
+	hash.Write(hashNTPasswordHash(passwordHash))
+	hash.Write(ntResponse)
+	hash.Write(mschapMagic1)
+	digest := hash.Sum(nil)
+
+	hash.Reset()
+	hash.Write(digest)
+	hash.Write(mschapChallengeHash(peerChallenge, authenticatorChallenge, username))
+	hash.Write(mschapMagic2)
+	digest = hash.Sum(nil)
+
+	return "S=" + strings.ToUpper(hex.EncodeToString(digest))
+}
+
+// GetMasterKey，RFC 3079 3.4
+func mppeMasterKey(passwordHash, ntResponse []byte) []byte {
+	hash := sha1.New()
+	hash.Write(hashNTPasswordHash(passwordHash))
+	hash.Write(ntResponse)
+	hash.Write(mppeMagic1)
+	return hash.Sum(nil)[:16]
+}
+
+// GetAsymmetricStartKey，RFC 3079 3.4，返回 128 位密钥。
+// 服务端的发送密钥使用 mppeMagic3，接收密钥使用 mppeMagic2。
+func mppeSessionKey(masterKey, magic []byte) []byte {
+	hash := sha1.New()
+	hash.Write(masterKey)
+	hash.Write(mppePad1)
+	hash.Write(magic)
+	hash.Write(mppePad2)
+	return hash.Sum(nil)[:16]
+}
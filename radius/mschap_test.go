@@ -0,0 +1,72 @@
+package radius
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// TestNTPasswordHash tests NTPasswordHash with the RFC 2759 test vector
+func TestNTPasswordHash(t *testing.T) {
+	hash := NTPasswordHash("clientPass")
+	if !bytes.Equal(hash, mustHex("44EBBA8D5312B8D611474411F56989AE")) {
+		t.Errorf("Expected NT hash 44EBBA8D5312B8D611474411F56989AE, got %X", hash)
+	}
+	if hashHash := hashNTPasswordHash(hash); !bytes.Equal(hashHash, mustHex("41C00C584BD2D91C4017A2A12FA59F3F")) {
+		t.Errorf("Expected hash hash 41C00C584BD2D91C4017A2A12FA59F3F, got %X", hashHash)
+	}
+}
+
+// TestMSCHAPv2Vectors tests MS-CHAPv2 with the RFC 2759 and RFC 3079 test vectors
+func TestMSCHAPv2Vectors(t *testing.T) {
+	username := "User"
+	passwordHash := NTPasswordHash("clientPass")
+	authenticatorChallenge := mustHex("5B5D7C7D7B3F2F3E3C2C602132262628")
+	peerChallenge := mustHex("21402324255E262A28295F2B3A337C7E")
+
+	if challenge := mschapChallengeHash(peerChallenge, authenticatorChallenge, username); !bytes.Equal(challenge, mustHex("D02E4386BCE91226")) {
+		t.Errorf("Expected challenge D02E4386BCE91226, got %X", challenge)
+	}
+	if challenge := mschapChallengeHash(peerChallenge, authenticatorChallenge, `DOMAIN\User`); !bytes.Equal(challenge, mustHex("D02E4386BCE91226")) {
+		t.Errorf("Expected domain to be ignored, got %X", challenge)
+	}
+
+	ntResponse := mschapv2NTResponse(authenticatorChallenge, peerChallenge, username, passwordHash)
+	if !bytes.Equal(ntResponse, mustHex("82309ECD8D708B5EA08FAA3981CD83544233114A3D85D6DF")) {
+		t.Errorf("Expected NT-Response 82309ECD8D708B5EA08FAA3981CD83544233114A3D85D6DF, got %X", ntResponse)
+	}
+
+	response := mschapv2AuthenticatorResponse(passwordHash, ntResponse, peerChallenge, authenticatorChallenge, username)
+	if response != "S=407A5589115FD0D6209F510FE9C04566932CDA56" {
+		t.Errorf("Expected S=407A5589115FD0D6209F510FE9C04566932CDA56, got %s", response)
+	}
+
+	masterKey := mppeMasterKey(passwordHash, ntResponse)
+	if !bytes.Equal(masterKey, mustHex("FDECE3717A8C838CB388E527AE3CDD31")) {
+		t.Errorf("Expected master key FDECE3717A8C838CB388E527AE3CDD31, got %X", masterKey)
+	}
+	// server send key
+	if key := mppeSessionKey(masterKey, mppeMagic3); !bytes.Equal(key, mustHex("8B7CDC149B993A1BA118CB153F56DCCB")) {
+		t.Errorf("Expected send key 8B7CDC149B993A1BA118CB153F56DCCB, got %X", key)
+	}
+}
+
+// TestMSCHAPv1Response tests the MS-CHAPv1 NT-Response with the RFC 2433 test vector
+func TestMSCHAPv1Response(t *testing.T) {
+	passwordHash := NTPasswordHash("MyPw")
+	if !bytes.Equal(passwordHash, mustHex("FC156AF7EDCD6C0EDDE3337D427F4EAC")) {
+		t.Errorf("Expected NT hash FC156AF7EDCD6C0EDDE3337D427F4EAC, got %X", passwordHash)
+	}
+	response := mschapChallengeResponse(mustHex("102DB5DF085D3041"), passwordHash)
+	if !bytes.Equal(response, mustHex("4E9D3C8F9CFD385D5BF4D3246791956CA4C351AB409A3D61")) {
+		t.Errorf("Expected NT-Response 4E9D3C8F9CFD385D5BF4D3246791956CA4C351AB409A3D61, got %X", response)
+	}
+}
@@ -32,6 +32,26 @@ const (
 	CodeReserved           Code = 255
 )
 
+// Codes which are defined in RFC 5176.
+const (
+	CodeDisconnectRequest Code = 40
+	CodeDisconnectACK     Code = 41
+	CodeDisconnectNAK     Code = 42
+	CodeCoARequest        Code = 43
+	CodeCoAACK            Code = 44
+	CodeCoANAK            Code = 45
+)
+
+// 请求的 Authenticator 由包内容计算（RFC 2866 3、RFC 5176 2.3），
+// 计算时 Authenticator 字段按 16 个 0 处理。
+func isComputedRequest(code Code) bool {
+	switch code {
+	case CodeAccountingRequest, CodeDisconnectRequest, CodeCoARequest:
+		return true
+	}
+	return false
+}
+
 var (
 	VerdorID     uint32
 	VerdorTag    uint8
@@ -56,6 +76,7 @@ type TDataPacket struct {
 	Secret        []byte
 	Dictionary    *TDictionary
 	AttrItems     []*TAttribute
+	raw           []byte // ParsePacket 解析的原始数据，用于校验响应
 }
 
 // New returns a new packet with the given code and secret. The identifier and
@@ -82,27 +103,44 @@ func (p *TDataPacket) String() string {
 	temp_text := fmt.Sprintf("数据包[Code=%d,Identifier=%d,Secret=%s]", p.Code, p.Identifier, utils.GetShowPassword(string(p.Secret)))
 	packet_text = packet_text + temp_text
 	for k, v := range p.AttrItems {
-		dict := p.Dictionary.IdItems[v.AttrId]
+		if v == nil {
+			continue
+		}
+		dict := p.Dictionary.entryOf(v)
 
 		if dict != nil {
-			if dict.Func == AttributeInteger {
-				value := p.GetValue(dict.Name)
-				temp_text = fmt.Sprintf("\n    [%03d] %s = %d", dict.Id, dict.Name, value.(uint32))
+			id := fmt.Sprintf("%03d", dict.Id)
+			if dict.VendorId != 0 {
+				id = fmt.Sprintf("%d:%03d", dict.VendorId, dict.Id)
+			}
+			name := dict.Name
+			if v.Tag != 0 {
+				name = fmt.Sprintf("%s:%d", dict.Name, v.Tag)
+			}
+			number, isNumber := enumNumber(v.AttrValue)
+			if valueName, ok := dict.valueName(number); isNumber && ok {
+				temp_text = fmt.Sprintf("\n    [%s] %s = %s", id, name, valueName)
+			} else if dict.Func == AttributeInteger {
+				value, _ := v.AttrValue.(uint32)
+				temp_text = fmt.Sprintf("\n    [%s] %s = %d", id, name, value)
 			} else {
-				value := p.GetString(dict.Name)
-				if dict.Name == "User-Password" {
+				value := p.attrString(v)
+				if dict.Name == "User-Password" || dict.Encrypt != 0 {
 					if len(value) > 0 {
-						temp_text = fmt.Sprintf("\n    [%03d] %s = %c***%s", dict.Id, dict.Name, value[0], value[len(value)-1:])
+						temp_text = fmt.Sprintf("\n    [%s] %s = %c***%s", id, name, value[0], value[len(value)-1:])
 					} else {
-						temp_text = fmt.Sprintf("\n    [%03d] %s = ***", dict.Id, dict.Name)
+						temp_text = fmt.Sprintf("\n    [%s] %s = ***", id, name)
 					}
-				} else if dict.Name == "Message-Authenticator" {
-					temp_text = fmt.Sprintf("\n    [%03d] %s = 0x%x", dict.Id, dict.Name, value)
+				} else if dict.Name == "Message-Authenticator" || (dict.VendorId != 0 && dict.Func == AttributeString) {
+					temp_text = fmt.Sprintf("\n    [%s] %s = 0x%x", id, name, value)
 				} else {
-					temp_text = fmt.Sprintf("\n    [%03d] %s = %s", dict.Id, dict.Name, value)
+					temp_text = fmt.Sprintf("\n    [%s] %s = %s", id, name, value)
 				}
 			}
 			packet_text = packet_text + temp_text
+		} else if v.VendorId != 0 {
+			temp_text = fmt.Sprintf("\n    Not found %d attribe(%d:%d)", k+1, v.VendorId, v.AttrId)
+			packet_text = packet_text + temp_text
 		} else {
 			temp_text = fmt.Sprintf("\n    Not found %d attribe(%d)", k+1, v.AttrId)
 			packet_text = packet_text + temp_text
@@ -118,7 +156,9 @@ func (p *TDataPacket) String() string {
 //
 // Note: this function does not validate the authenticity of a packet.
 // Ensuring a packet's authenticity should be done using the IsAuthentic
-// method.
+// method. The Message-Authenticator of requests (Access-Request,
+// Status-Server, Accounting-Request) is verified here, the one of responses
+// needs the request and is verified by IsAuthentic.
 func ParsePacket(data, secret []byte, dictionary *TDictionary) (*TDataPacket, error) {
 	if len(data) < 20 {
 		return nil, fmt.Errorf("有效包必须大于20字节。 目前包大小[%d]", len(data))
@@ -145,12 +185,22 @@ func ParsePacket(data, secret []byte, dictionary *TDictionary) (*TDataPacket, er
 		}
 
 		attrLength := attributes[1]
-		if attrLength < 2 || attrLength > 253 || len(attributes) < int(attrLength) {
-			return nil, fmt.Errorf("无效属性长度%d(2-%d)", attrLength, 253)
+		// Length 包括类型和长度字段，值最长253字节（RFC 2865 5）
+		if attrLength < 2 || len(attributes) < int(attrLength) {
+			return nil, fmt.Errorf("无效属性长度%d(2-%d)", attrLength, 255)
 		}
 		attrType := attributes[0]
 		attrValue := attributes[2:attrLength]
 
+		// 字典里有的厂商按厂商属性解码
+		if attrType == attrVendorSpecific {
+			if vendorAttrs, ok := decodeVendorAttrs(packet, attrValue); ok {
+				packet.AttrItems = append(packet.AttrItems, vendorAttrs...)
+				attributes = attributes[attrLength:]
+				continue
+			}
+		}
+
 		codec := dictionary.GetFunc(attrType)
 		if codec == AttributeUnknown {
 			logs.Info("未知的属性，请先注册属性编码(%d)。", attrType)
@@ -160,7 +210,14 @@ func ParsePacket(data, secret []byte, dictionary *TDictionary) (*TDataPacket, er
 		// 	fmt.Println(DecodeAVPair(attrValue))
 		// }
 
-		decoded, err := codec.Decode(packet, attrValue)
+		var tag byte
+		var decoded interface{}
+		var err error
+		if entry := dictionary.IdItems[attrType]; entry.isTagged() {
+			decoded, tag, err = decodeTaggedAttr(packet, entry, attrValue)
+		} else {
+			decoded, err = codec.Decode(packet, attrValue)
+		}
 		if err != nil {
 			if attrType == 2 { //User-Password,如果密码解析不了，则使用默认密码123123
 				attr := &TAttribute{
@@ -177,11 +234,26 @@ func ParsePacket(data, secret []byte, dictionary *TDictionary) (*TDataPacket, er
 			attr := &TAttribute{
 				AttrId:    attrType,
 				AttrValue: decoded,
+				Tag:       tag,
 			}
 			packet.AttrItems = append(packet.AttrItems, attr)
 		}
 		attributes = attributes[attrLength:]
 	}
+
+	raw := data
+	if int(length) <= len(data) {
+		raw = data[:length]
+	}
+	packet.raw = make([]byte, len(raw))
+	copy(packet.raw, raw)
+
+	switch packet.Code {
+	case CodeAccessRequest, CodeStatusServer, CodeAccountingRequest, CodeDisconnectRequest, CodeCoARequest:
+		if !verifyMessageAuthenticator(packet.raw, messageAuthenticatorBase(packet.Code, packet.Authenticator), secret) {
+			return nil, ErrMessageAuthenticator
+		}
+	}
 	return packet, nil
 }
 
@@ -193,18 +265,28 @@ func ParsePacket(data, secret []byte, dictionary *TDictionary) (*TDataPacket, er
 //     CodeAccountingRequest
 //     CodeAccountingResponse
 //     CodeAccessChallenge
+//     CodeDisconnectRequest, CodeDisconnectACK, CodeDisconnectNAK
+//     CodeCoARequest, CodeCoAACK, CodeCoANAK
 //   - p.Authenticator contains the calculated authenticator
+//
+// A Message-Authenticator contained in a parsed response is verified too.
 func (p *TDataPacket) IsAuthentic(request *TDataPacket) bool {
 	switch p.Code {
-	case CodeAccessAccept, CodeAccessReject, CodeAccountingRequest, CodeAccessChallenge:
-		wire, err := p.Encode()
-		if err != nil {
+	case CodeAccessAccept, CodeAccessReject, CodeAccountingRequest, CodeAccountingResponse, CodeAccessChallenge,
+		CodeDisconnectRequest, CodeDisconnectACK, CodeDisconnectNAK, CodeCoARequest, CodeCoAACK, CodeCoANAK:
+		wire := p.raw
+		if wire == nil {
+			var err error
+			if wire, err = p.Encode(); err != nil {
+				return false
+			}
+		} else if !isComputedRequest(p.Code) && !verifyMessageAuthenticator(wire, request.Authenticator, request.Secret) {
 			return false
 		}
 
 		hash := md5.New()
 		hash.Write(wire[0:4])
-		if p.Code == CodeAccountingRequest {
+		if isComputedRequest(p.Code) {
 			var nul [16]byte
 			hash.Write(nul[:])
 		} else {
@@ -236,9 +318,28 @@ func (p *TDataPacket) GetValue(name string) interface{} {
 	return nil
 }
 
+// GetValueName 返回枚举属性值的名字，如 Acct-Status-Type 返回 "Start"。
+// 字典中没有定义该值的名字时返回数字，属性不存在时返回""。
+func (p *TDataPacket) GetValueName(name string) string {
+	attr := p.FindAttr(name)
+	if attr == nil {
+		return ""
+	}
+	if number, ok := enumNumber(attr.AttrValue); ok {
+		if valueName, ok := p.Dictionary.entryOf(attr).valueName(number); ok {
+			return valueName
+		}
+	}
+	return p.attrString(attr)
+}
+
 func (p *TDataPacket) FindAttr(name string) *TAttribute {
+	entry := p.Dictionary.GetEntry(name)
+	if entry == nil {
+		return nil
+	}
 	for _, attr := range p.AttrItems {
-		if attrName, ok := p.Dictionary.GetName(attr.AttrId); ok && attrName == name {
+		if attr != nil && attr.AttrId == entry.Id && attr.VendorId == entry.VendorId {
 			return attr
 		}
 	}
@@ -262,10 +363,14 @@ func (p *TDataPacket) GetString(name string) string {
 	if attr == nil {
 		return ""
 	}
+	return p.attrString(attr)
+}
+
+func (p *TDataPacket) attrString(attr *TAttribute) string {
 	value := attr.AttrValue
 
-	if codec := p.Dictionary.GetFunc(attr.AttrId); codec != nil {
-		if stringer, ok := codec.(IAttributeStringer); ok {
+	if entry := p.Dictionary.entryOf(attr); entry != nil {
+		if stringer, ok := entry.Func.(IAttributeStringer); ok {
 			return stringer.String(value)
 		}
 	}
@@ -303,24 +408,110 @@ func (p *TDataPacket) AddAttr(name string, value interface{}) error {
 // Set sets the value of the first attribute whose dictionary name matches the
 // given name. If no such attribute exists, a new attribute is added
 func (p *TDataPacket) Set(name string, value interface{}) error {
-	for _, attr := range p.AttrItems {
-		if attrName, ok := p.Dictionary.GetName(attr.AttrId); ok && attrName == name {
-			codec := p.Dictionary.GetFunc(attr.AttrId)
-			if transformer, ok := codec.(IAttributeTransformer); ok {
-				transformed, err := transformer.Transform(value)
-				if err != nil {
-					return err
-				}
-				attr.AttrValue = transformed
-				return nil
+	if attr := p.FindAttr(name); attr != nil {
+		entry := p.Dictionary.entryOf(attr)
+		value, err := entry.resolveValue(value)
+		if err != nil {
+			return err
+		}
+		codec := entry.Func
+		if transformer, ok := codec.(IAttributeTransformer); ok {
+			transformed, err := transformer.Transform(value)
+			if err != nil {
+				return err
 			}
-			attr.AttrValue = value
+			attr.AttrValue = transformed
 			return nil
 		}
+		attr.AttrValue = value
+		return nil
 	}
 	return p.AddAttr(name, value)
 }
 
+// GetVendorAttr 返回第一个匹配的厂商属性值（[]byte），不存在时返回nil。
+func (p *TDataPacket) GetVendorAttr(vendorID uint32, typeID byte) []byte {
+	for _, attr := range p.AttrItems {
+		if attr == nil {
+			continue
+		}
+		if attr.VendorId == vendorID && attr.AttrId == typeID {
+			if value, ok := attr.AttrValue.([]byte); ok {
+				return value
+			}
+		}
+		if vsa, ok := attr.AttrValue.(TVendorAttr); ok && attr.VendorId == 0 && vsa.VendorId == vendorID && vsa.TypeId == typeID {
+			return vsa.Value
+		}
+	}
+	return nil
+}
+
+// AddVendorAttr 添加一个厂商属性，同一个厂商属性可以出现多次。
+func (p *TDataPacket) AddVendorAttr(vendorID uint32, typeID byte, value interface{}) {
+	p.AttrItems = append(p.AttrItems, NewVendorAttr(vendorID, typeID, value))
+}
+
+// NewVendorAttr 创建一个厂商属性，编码时使用字典中的厂商属性编码，
+// 字典中没有时值必须是[]byte。
+func NewVendorAttr(vendorID uint32, typeID byte, value interface{}) *TAttribute {
+	return &TAttribute{AttrId: typeID, AttrValue: value, VendorId: vendorID}
+}
+
+// 按字典中的厂商解码 Vendor-Specific，一个 Vendor-Specific 可以包含多个厂商属性。
+func decodeVendorAttrs(p *TDataPacket, wire []byte) ([]*TAttribute, bool) {
+	if len(wire) < 4 || p.Dictionary == nil {
+		return nil, false
+	}
+	vendorID := binary.BigEndian.Uint32(wire[0:4])
+	vendor := p.Dictionary.GetVendor(vendorID)
+	if vendor == nil {
+		return nil, false
+	}
+
+	var attrs []*TAttribute
+	for wire = wire[4:]; len(wire) > 0; {
+		if len(wire) < 2 || wire[1] < 2 || int(wire[1]) > len(wire) {
+			return nil, false
+		}
+		var tag byte
+		var decoded interface{}
+		var err error
+		if entry := vendor.IdItems[wire[0]]; entry.isTagged() {
+			decoded, tag, err = decodeTaggedAttr(p, entry, wire[2:wire[1]])
+		} else if entry != nil {
+			decoded, err = entry.Func.Decode(p, wire[2:wire[1]])
+		} else {
+			decoded, err = AttributeString.Decode(p, wire[2:wire[1]])
+		}
+		if err != nil {
+			return nil, false
+		}
+		attrs = append(attrs, &TAttribute{AttrId: wire[0], AttrValue: decoded, VendorId: vendorID, Tag: tag})
+		wire = wire[wire[1]:]
+	}
+	return attrs, len(attrs) > 0
+}
+
+func (p *TDataPacket) encodeVendorAttr(attr *TAttribute) ([]byte, error) {
+	var wire []byte
+	var err error
+	if entry := p.Dictionary.GetVendorEntry(attr.VendorId, attr.AttrId); entry.isTagged() {
+		wire, err = encodeTaggedAttr(p, entry, attr)
+	} else if entry != nil {
+		wire, err = entry.Func.Encode(p, attr.AttrValue)
+	} else {
+		wire, err = AttributeString.Encode(p, attr.AttrValue)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(wire) > 247 {
+		return nil, errors.New("radius: encoded vendor attribute is too long")
+	}
+	return EncodeAVPairByte(attr.VendorId, attr.AttrId, wire), nil
+}
+
 // PAP returns the User-Name and User-Password attributes of an Access-Request
 // packet.
 //
@@ -362,19 +553,35 @@ func (p *TDataPacket) PAP() (username, password string, err error) {
 // packet, nil and an error is returned.
 func (p *TDataPacket) Encode() ([]byte, error) {
 	var bufferAttrs bytes.Buffer
+	maOffset := -1
 	for _, attr := range p.AttrItems {
 		if attr == nil {
 			continue
 		}
-		codec := p.Dictionary.GetFunc(attr.AttrId)
-		wire, err := codec.Encode(p, attr.AttrValue)
+		attrId := attr.AttrId
+		var wire []byte
+		var err error
+		if attr.VendorId != 0 {
+			attrId = attrVendorSpecific
+			wire, err = p.encodeVendorAttr(attr)
+		} else if entry := p.Dictionary.IdItems[attr.AttrId]; entry.isTagged() {
+			wire, err = encodeTaggedAttr(p, entry, attr)
+		} else {
+			wire, err = p.Dictionary.GetFunc(attr.AttrId).Encode(p, attr.AttrValue)
+		}
 		if err != nil {
 			return nil, err
 		}
 		if len(wire) > 253 {
 			return nil, errors.New("radius: encoded attribute is too long")
 		}
-		bufferAttrs.WriteByte(attr.AttrId)
+		if attrId == attrMessageAuthenticator && maOffset < 0 {
+			if len(wire) != md5.Size {
+				return nil, errors.New("radius: invalid Message-Authenticator attribute length")
+			}
+			maOffset = 20 + bufferAttrs.Len() + 2
+		}
+		bufferAttrs.WriteByte(attrId)
 		bufferAttrs.WriteByte(byte(len(wire) + 2))
 		bufferAttrs.Write(wire)
 	}
@@ -390,19 +597,31 @@ func (p *TDataPacket) Encode() ([]byte, error) {
 	buffer.WriteByte(p.Identifier)
 	binary.Write(&buffer, binary.BigEndian, uint16(length))
 
+	// Message-Authenticator 必须在 Response Authenticator 之前计算
+	attrs := bufferAttrs.Bytes()
+	if maOffset >= 0 {
+		wire := make([]byte, 0, length)
+		wire = append(wire, buffer.Bytes()...)
+		wire = append(wire, p.Authenticator[:]...)
+		wire = append(wire, attrs...)
+		mac := messageAuthenticator(wire, maOffset, messageAuthenticatorBase(p.Code, p.Authenticator), p.Secret)
+		copy(attrs[maOffset-20:], mac)
+	}
+
 	switch p.Code {
 	case CodeAccessRequest, CodeStatusServer:
 		buffer.Write(p.Authenticator[:])
-	case CodeAccessAccept, CodeAccessReject, CodeAccountingRequest, CodeAccountingResponse, CodeAccessChallenge:
+	case CodeAccessAccept, CodeAccessReject, CodeAccountingRequest, CodeAccountingResponse, CodeAccessChallenge,
+		CodeDisconnectRequest, CodeDisconnectACK, CodeDisconnectNAK, CodeCoARequest, CodeCoAACK, CodeCoANAK:
 		hash := md5.New()
 		hash.Write(buffer.Bytes())
-		if p.Code == CodeAccountingRequest {
+		if isComputedRequest(p.Code) {
 			var nul [16]byte
 			hash.Write(nul[:])
 		} else {
 			hash.Write(p.Authenticator[:])
 		}
-		hash.Write(bufferAttrs.Bytes())
+		hash.Write(attrs)
 		hash.Write(p.Secret)
 
 		var sum [md5.Size]byte
@@ -411,7 +630,7 @@ func (p *TDataPacket) Encode() ([]byte, error) {
 		return nil, errors.New("radius: unknown Packet code")
 	}
 
-	buffer.ReadFrom(&bufferAttrs)
+	buffer.Write(attrs)
 
 	return buffer.Bytes(), nil
 }
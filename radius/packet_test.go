@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net"
+	"strings"
 	"testing"
 	"time"
 )
@@ -2218,3 +2219,51 @@ func (testTransformerCodec) Transform(value interface{}) (interface{}, error) {
 	}
 	return "transformed:" + str, nil
 }
+
+// TestPacketEnumeratedValues tests AddAttr, Set, GetValueName and String with value names
+func TestPacketEnumeratedValues(t *testing.T) {
+	secret := []byte("secret")
+	packet := NewPacket(CodeAccountingRequest, secret)
+	if err := packet.AddAttr("Acct-Status-Type", "Start"); err != nil {
+		t.Fatalf("AddAttr failed: %v", err)
+	}
+	packet.AddAttr("Acct-Session-Id", "abc")
+	packet.AddAttr("NAS-Port", uint32(100))
+	if err := packet.Set("Acct-Status-Type", "Interim-Update"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := packet.Set("Acct-Status-Type", "Unknown"); err == nil {
+		t.Error("Expected error for undefined value name")
+	}
+	if err := packet.Set("Acct-Terminate-Cause", "Idle-Timeout"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	data, err := packet.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	received, err := ParsePacket(data, secret, Builtin)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if received.GetValue("Acct-Status-Type") != uint32(3) {
+		t.Errorf("Expected uint32(3), got %v", received.GetValue("Acct-Status-Type"))
+	}
+	if name := received.GetValueName("Acct-Status-Type"); name != "Interim-Update" {
+		t.Errorf("Expected Interim-Update, got %s", name)
+	}
+	if name := received.GetValueName("NAS-Port"); name != "100" {
+		t.Errorf("Expected 100, got %s", name)
+	}
+	if name := received.GetValueName("Service-Type"); name != "" {
+		t.Errorf("Expected empty string for missing attribute, got %s", name)
+	}
+
+	text := received.String()
+	for _, expected := range []string{"Acct-Status-Type = Interim-Update", "Acct-Terminate-Cause = Idle-Timeout", "NAS-Port = 100"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected %q in %s", expected, text)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package radius
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// PEAPv0 + EAP-MSCHAPv2（draft-kamath-pppext-peapv0、draft-kamath-pppext-eap-mschapv2）。
+//
+// TLS 握手后隧道内的 EAP 数据包省略 Code、Identifier 和 Length，只有 Type 和 Type-Data，
+// 最后的 Result TLV（EAP-Extensions）为完整的 EAP 数据包。
+
+// EAP-MSCHAPv2 的 OpCode
+const (
+	mschapv2OpChallenge byte = 1
+	mschapv2OpResponse  byte = 2
+	mschapv2OpSuccess   byte = 3
+)
+
+// PEAP 隧道内 MSCHAPv2 Challenge 带的服务器名
+const peapServerName = "radius"
+
+// Result TLV（PEAP Extensions），Mandatory + Type 3，Status 1 为成功、2 为失败
+var peapResultSuccess = []byte{0x80, 0x03, 0x00, 0x02, 0x00, 0x01}
+
+// PEAPMSCHAPv2 返回 PEAPv0 认证方法，隧道内使用 EAP-MSCHAPv2，config 必须带有服务器证书。
+// ntHash 按隧道内的用户名返回 NT hash（NTPasswordHash），认证成功后
+// Access-Accept 中的 User-Name 为隧道内的用户名。
+func PEAPMSCHAPv2(config *tls.Config, ntHash func(identity string) ([]byte, error)) TEAPMethod {
+	return TEAPMethod{
+		Type: EAPTypePEAP,
+		New: func(identity string) (IEAPMethod, error) {
+			c, err := eapTLSConfig(config)
+			if err != nil {
+				return nil, err
+			}
+			m := &peapMethod{ntHash: ntHash}
+			m.eapTLSMethod = newEAPTLSMethod(c, 0, m.tunnel)
+			return m, nil
+		},
+	}
+}
+
+type peapMethod struct {
+	*eapTLSMethod
+	ntHash   func(identity string) ([]byte, error)
+	identity string // 隧道内的用户名，协程中设置，认证结束后读取
+}
+
+func (m *peapMethod) InnerIdentity() string {
+	return m.identity
+}
+
+// 在 TLS 协程中执行隧道内的认证
+func (m *peapMethod) tunnel(conn *tls.Conn) error {
+	buff := make([]byte, 4096)
+	exchange := func(request []byte) ([]byte, error) {
+		if _, err := conn.Write(request); err != nil {
+			return nil, err
+		}
+		n, err := conn.Read(buff)
+		if err != nil {
+			return nil, err
+		}
+		return buff[:n], nil
+	}
+
+	// EAP-Request/Identity
+	response, err := exchange([]byte{EAPTypeIdentity})
+	if err != nil {
+		return err
+	}
+	if len(response) < 1 || response[0] != EAPTypeIdentity {
+		return errors.New("radius: PEAP expects inner EAP-Response/Identity")
+	}
+	identity := string(response[1:])
+	hash, err := m.ntHash(identity)
+	if err != nil {
+		return err
+	}
+
+	// EAP-MSCHAPv2 Challenge: OpCode MS-CHAPv2-ID MS-Length Value-Size Challenge Name
+	var msid [1]byte
+	challenge := make([]byte, 16)
+	if _, err := rand.Read(msid[:]); err != nil {
+		return err
+	}
+	if _, err := rand.Read(challenge); err != nil {
+		return err
+	}
+	request := mschapv2Packet(mschapv2OpChallenge, msid[0], append(append([]byte{16}, challenge...), peapServerName...))
+	if response, err = exchange(request); err != nil {
+		return err
+	}
+
+	// Response: Value-Size(49) Peer-Challenge(16) Reserved(8) NT-Response(24) Flags(1) Name
+	if len(response) < 6+49 || response[0] != EAPTypeMSCHAPv2 || response[1] != mschapv2OpResponse || response[5] != 49 {
+		return errors.New("radius: invalid EAP-MSCHAPv2 response")
+	}
+	peerChallenge := response[6:22]
+	ntResponse := response[30:54]
+	username := string(response[55:])
+	expected := mschapv2NTResponse(challenge, peerChallenge, username, hash)
+	if subtle.ConstantTimeCompare(expected, ntResponse) != 1 {
+		return ErrAuthFailed
+	}
+
+	success := mschapv2AuthenticatorResponse(hash, ntResponse, peerChallenge, challenge, username) + " M=OK"
+	if response, err = exchange(mschapv2Packet(mschapv2OpSuccess, msid[0], []byte(success))); err != nil {
+		return err
+	}
+	if len(response) < 2 || response[0] != EAPTypeMSCHAPv2 || response[1] != mschapv2OpSuccess {
+		return errors.New("radius: invalid EAP-MSCHAPv2 success response")
+	}
+
+	// Result TLV
+	result := &TEAPPacket{Code: EAPCodeRequest, Identifier: msid[0] + 1, Type: EAPTypeExtensions, Data: peapResultSuccess}
+	if response, err = exchange(result.Encode()); err != nil {
+		return err
+	}
+	ack, err := ParseEAPPacket(response)
+	if err != nil || ack.Type != EAPTypeExtensions || len(ack.Data) < 6 || binary.BigEndian.Uint16(ack.Data[4:6]) != 1 {
+		return fmt.Errorf("radius: PEAP result is not success: %x", response)
+	}
+	m.identity = identity
+	return nil
+}
+
+// 隧道内的 EAP-MSCHAPv2 数据包（省略 EAP 头），MS-Length 从 OpCode 开始计算
+func mschapv2Packet(opcode, msid byte, data []byte) []byte {
+	b := make([]byte, 5, 5+len(data))
+	b[0] = EAPTypeMSCHAPv2
+	b[1] = opcode
+	b[2] = msid
+	binary.BigEndian.PutUint16(b[3:5], uint16(4+len(data)))
+	return append(b, data...)
+}
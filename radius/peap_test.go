@@ -0,0 +1,102 @@
+package radius
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testPEAPPeer returns the supplicant side of the PEAPv0 tunnel with EAP-MSCHAPv2
+func testPEAPPeer(identity, password string) func(conn *tls.Conn) error {
+	return func(conn *tls.Conn) error {
+		buff := make([]byte, 4096)
+		read := func() ([]byte, error) {
+			n, err := conn.Read(buff)
+			return buff[:n], err
+		}
+
+		request, err := read()
+		if err != nil || !bytes.Equal(request, []byte{EAPTypeIdentity}) {
+			return errors.New("expected inner identity request")
+		}
+		conn.Write(append([]byte{EAPTypeIdentity}, identity...))
+
+		request, err = read()
+		if err != nil || len(request) < 22 || request[0] != EAPTypeMSCHAPv2 || request[1] != mschapv2OpChallenge {
+			return errors.New("expected MSCHAPv2 challenge")
+		}
+		msid := request[2]
+		challenge := append([]byte(nil), request[6:22]...)
+		peerChallenge := bytes.Repeat([]byte{0x11}, 16)
+		ntResponse := mschapv2NTResponse(challenge, peerChallenge, identity, NTPasswordHash(password))
+		value := append(append(append([]byte{49}, peerChallenge...), make([]byte, 8)...), ntResponse...)
+		value = append(append(value, 0), identity...)
+		conn.Write(mschapv2Packet(mschapv2OpResponse, msid, value))
+
+		request, err = read()
+		if err != nil || len(request) < 5 || request[1] != mschapv2OpSuccess {
+			return errors.New("expected MSCHAPv2 success")
+		}
+		expected := mschapv2AuthenticatorResponse(NTPasswordHash(password), ntResponse, peerChallenge, challenge, identity)
+		if !strings.HasPrefix(string(request[5:]), expected) {
+			return errors.New("invalid authenticator response")
+		}
+		conn.Write([]byte{EAPTypeMSCHAPv2, mschapv2OpSuccess})
+
+		request, err = read()
+		if err != nil {
+			return err
+		}
+		result, err := ParseEAPPacket(request)
+		if err != nil || result.Type != EAPTypeExtensions {
+			return errors.New("expected result TLV")
+		}
+		ack := &TEAPPacket{Code: EAPCodeResponse, Identifier: result.Identifier, Type: EAPTypeExtensions, Data: result.Data}
+		_, err = conn.Write(ack.Encode())
+		return err
+	}
+}
+
+// TestPEAPMSCHAPv2 tests PEAPv0 with EAP-MSCHAPv2
+func TestPEAPMSCHAPv2(t *testing.T) {
+	serverConfig, clientConfig := testEAPTLSConfigs(t)
+	clientConfig.Certificates = nil
+	handler := &EAPHandler{
+		Methods: []TEAPMethod{PEAPMSCHAPv2(serverConfig, func(identity string) ([]byte, error) {
+			if identity != "alice" {
+				return nil, ErrAuthFailed
+			}
+			return NTPasswordHash("password"), nil
+		})},
+	}
+
+	for _, tt := range []struct {
+		identity, password string
+		code               Code
+	}{
+		{"alice", "password", CodeAccessAccept},
+		{"alice", "wrong", CodeAccessReject},
+		{"bob", "password", CodeAccessReject},
+	} {
+		c := newTestEAPConversation(t, handler)
+		c.respond(EAPTypeIdentity, []byte("anonymous"))
+		peer := newTestEAPTLSPeer(clientConfig, testPEAPPeer(tt.identity, tt.password))
+		response, _ := peer.run(c, EAPTypePEAP)
+		if response.Code != tt.code {
+			t.Errorf("Expected %d for %s/%s, got %d", tt.code, tt.identity, tt.password, response.Code)
+			continue
+		}
+		if tt.code != CodeAccessAccept {
+			continue
+		}
+		if response.GetString("User-Name") != "alice" {
+			t.Errorf("Expected inner identity as User-Name, got %q", response.GetString("User-Name"))
+		}
+		key, err := decryptMPPEKey(response.GetVendorAttr(VendorMicrosoft, MSMPPERecvKey), []byte("secret"), c.authenticator)
+		if err != nil || !bytes.Equal(key, peer.msk[:32]) {
+			t.Errorf("Expected MS-MPPE-Recv-Key from the PEAP MSK, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package radius
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 授权策略文件，按客户端网络（NAS）选择策略，按用户所属的组选择回复属性：
+//
+//	# 注释
+//	nas 10.1.0.0/16 192.168.1.10        # 以下规则用于这些客户端，nas * 为默认策略
+//	group vpn-users   Filter-Id = "vpn", Session-Timeout = 3600
+//	group "Wi-Fi Staff"  VLAN:1 = 100, Class = "staff"
+//	group guests      reject
+//	group *           Session-Timeout = 600
+//
+// 第一个 nas 之前的规则属于默认策略。客户端地址按文件顺序匹配第一个包含它的策略，
+// 没有时使用默认策略；策略内按顺序匹配第一条规则，组为 LDAP 组的 CN 或完整 DN（不区分大小写），
+// "*" 匹配所有用户。没有匹配的规则时拒绝认证。
+// 属性的格式同 TDictionary.ParseAttr，VLAN[:Tag] = ID 展开为 TunnelVLAN 的三个属性。
+
+// TPolicyRule 是一条授权规则
+type TPolicyRule struct {
+	Group  string // 组的 CN 或 DN，"*" 匹配所有用户
+	Reject bool   // 匹配时拒绝认证
+	Attrs  []*TAttribute
+}
+
+// TPolicy 是一组客户端网络的授权规则，Networks 为空时是默认策略
+type TPolicy struct {
+	Networks []*net.IPNet
+	Rules    []*TPolicyRule
+}
+
+// TPolicySet 是授权策略文件的内容
+type TPolicySet struct {
+	Policies []*TPolicy
+}
+
+// LoadPolicyFile 读取授权策略文件，属性按 dict 解析（nil 为 Builtin）。
+func LoadPolicyFile(filename string, dict *TDictionary) (*TPolicySet, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParsePolicy(f, dict)
+}
+
+// ParsePolicy 从 r 解析授权策略
+func ParsePolicy(r io.Reader, dict *TDictionary) (*TPolicySet, error) {
+	if dict == nil {
+		dict = Builtin
+	}
+	set := &TPolicySet{}
+	var current *TPolicy
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(stripPolicyComment(scanner.Text()))
+		if text == "" {
+			continue
+		}
+		keyword, rest := splitPolicyField(text)
+		switch keyword {
+		case "nas":
+			policy, err := parsePolicyNetworks(rest)
+			if err != nil {
+				return nil, fmt.Errorf("策略文件第%d行错误，%s", line, err.Error())
+			}
+			set.Policies = append(set.Policies, policy)
+			current = policy
+		case "group":
+			rule, err := parsePolicyRule(rest, dict)
+			if err != nil {
+				return nil, fmt.Errorf("策略文件第%d行错误，%s", line, err.Error())
+			}
+			if current == nil {
+				current = &TPolicy{}
+				set.Policies = append(set.Policies, current)
+			}
+			current.Rules = append(current.Rules, rule)
+		default:
+			return nil, fmt.Errorf("策略文件第%d行错误，未知的关键字(%s)", line, keyword)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Policy 返回客户端地址使用的策略，没有匹配的策略也没有默认策略时返回nil
+func (s *TPolicySet) Policy(ip net.IP) *TPolicy {
+	var fallback *TPolicy
+	for _, policy := range s.Policies {
+		if len(policy.Networks) == 0 {
+			if fallback == nil {
+				fallback = policy
+			}
+			continue
+		}
+		for _, network := range policy.Networks {
+			if ip != nil && network.Contains(ip) {
+				return policy
+			}
+		}
+	}
+	return fallback
+}
+
+// Match 返回第一条匹配用户组的规则，groups 为 LDAP 组的 DN 或名字，没有匹配时返回nil
+func (p *TPolicy) Match(groups []string) *TPolicyRule {
+	for _, rule := range p.Rules {
+		if rule.Group == "*" {
+			return rule
+		}
+		for _, group := range groups {
+			if strings.EqualFold(rule.Group, group) || strings.EqualFold(rule.Group, groupName(group)) {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+// 返回组 DN 第一个 RDN 的值，如 CN=vpn,OU=Groups,DC=example,DC=com 返回 vpn
+func groupName(dn string) string {
+	rdn := dn
+	if i := strings.IndexByte(dn, ','); i >= 0 {
+		rdn = dn[:i]
+	}
+	if i := strings.IndexByte(rdn, '='); i >= 0 {
+		return strings.TrimSpace(rdn[i+1:])
+	}
+	return dn
+}
+
+func parsePolicyNetworks(text string) (*TPolicy, error) {
+	policy := &TPolicy{}
+	for _, field := range strings.Fields(text) {
+		if field == "*" {
+			continue
+		}
+		if !strings.Contains(field, "/") {
+			if ip := net.ParseIP(field); ip != nil && ip.To4() != nil {
+				field += "/32"
+			} else {
+				field += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(field)
+		if err != nil {
+			return nil, fmt.Errorf("客户端网络(%s)格式错误", field)
+		}
+		policy.Networks = append(policy.Networks, network)
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("nas 需要客户端网络或 *")
+	}
+	return policy, nil
+}
+
+func parsePolicyRule(text string, dict *TDictionary) (*TPolicyRule, error) {
+	group, rest := splitPolicyField(text)
+	if group == "" {
+		return nil, fmt.Errorf("group 需要组名")
+	}
+	if strings.HasPrefix(group, `"`) {
+		unquoted, err := strconv.Unquote(group)
+		if err != nil {
+			return nil, fmt.Errorf("组名(%s)格式错误", group)
+		}
+		group = unquoted
+	}
+
+	rule := &TPolicyRule{Group: group}
+	if rest == "reject" {
+		rule.Reject = true
+		return rule, nil
+	}
+	for _, expr := range splitAttrList(rest) {
+		attrs, err := parsePolicyAttr(expr, dict)
+		if err != nil {
+			return nil, err
+		}
+		rule.Attrs = append(rule.Attrs, attrs...)
+	}
+	return rule, nil
+}
+
+func parsePolicyAttr(expr string, dict *TDictionary) ([]*TAttribute, error) {
+	name := strings.TrimSpace(expr[:max(strings.IndexByte(expr, '='), 0)])
+	if name == "VLAN" || strings.HasPrefix(name, "VLAN:") {
+		var tag uint64
+		if name != "VLAN" {
+			var err error
+			if tag, err = strconv.ParseUint(name[len("VLAN:"):], 10, 8); err != nil || tag > maxAttrTag {
+				return nil, fmt.Errorf("属性(%s)的Tag格式错误", name)
+			}
+		}
+		vlan := strings.Trim(strings.TrimSpace(expr[strings.IndexByte(expr, '=')+1:]), `"`)
+		if vlan == "" {
+			return nil, fmt.Errorf("VLAN 不能为空")
+		}
+		return TunnelVLAN(byte(tag), vlan), nil
+	}
+	attr, err := dict.ParseAttr(expr)
+	if err != nil {
+		return nil, err
+	}
+	return []*TAttribute{attr}, nil
+}
+
+// 分出第一个字段（可以带引号）和剩下的部分
+func splitPolicyField(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	end := strings.IndexAny(text, " \t")
+	if strings.HasPrefix(text, `"`) {
+		end = -1
+		for i := 1; i < len(text); i++ {
+			if text[i] == '\\' {
+				i++
+			} else if text[i] == '"' {
+				end = i + 1
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return text, ""
+	}
+	return text[:end], strings.TrimSpace(text[end:])
+}
+
+// 去掉引号外 # 开始的注释
+func stripPolicyComment(line string) string {
+	inQuote := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		case '#':
+			if !inQuote {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
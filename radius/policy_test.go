@@ -0,0 +1,104 @@
+package radius
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `
+# default policy
+group "Wi-Fi Staff"   VLAN:1 = 100, Class = "staff, wifi"   # comma inside quotes
+group guests          reject
+group *               Session-Timeout = 600
+
+nas 10.1.0.0/16 192.168.1.10
+group vpn             Filter-Id = "vpn", Session-Timeout = 3600, Service-Type = Framed-User
+`
+
+// TestParsePolicy tests parsing a policy file and selecting rules
+func TestParsePolicy(t *testing.T) {
+	set, err := ParsePolicy(strings.NewReader(testPolicy), nil)
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+	if len(set.Policies) != 2 {
+		t.Fatalf("Expected 2 policies, got %d", len(set.Policies))
+	}
+
+	nas := set.Policy(net.ParseIP("10.1.2.3"))
+	if nas != set.Policies[1] || set.Policy(net.ParseIP("192.168.1.10")) != nas {
+		t.Fatal("Expected the nas policy for 10.1.2.3 and 192.168.1.10")
+	}
+	if set.Policy(net.ParseIP("192.168.1.11")) != set.Policies[0] {
+		t.Fatal("Expected the default policy for 192.168.1.11")
+	}
+
+	rule := nas.Match([]string{"CN=VPN,OU=Groups,DC=example,DC=com"})
+	if rule == nil || len(rule.Attrs) != 3 {
+		t.Fatalf("Expected vpn rule with 3 attributes, got %+v", rule)
+	}
+	if rule.Attrs[0].AttrValue != "vpn" || rule.Attrs[1].AttrValue != uint32(3600) || rule.Attrs[2].AttrValue != uint32(2) {
+		t.Errorf("Unexpected vpn attributes %v %v %v", rule.Attrs[0].AttrValue, rule.Attrs[1].AttrValue, rule.Attrs[2].AttrValue)
+	}
+	if nas.Match([]string{"cn=staff,dc=example,dc=com"}) != nil {
+		t.Error("Expected no rule for staff in the nas policy")
+	}
+
+	def := set.Policies[0]
+	rule = def.Match([]string{"cn=Wi-Fi Staff,dc=example,dc=com"})
+	if rule == nil || len(rule.Attrs) != 4 {
+		t.Fatalf("Expected staff rule with VLAN and Class, got %+v", rule)
+	}
+	if rule.Attrs[0].Tag != 1 || rule.Attrs[2].AttrValue != "100" {
+		t.Errorf("Expected tagged VLAN attributes, got %+v", rule.Attrs[:3])
+	}
+	if v, _ := rule.Attrs[3].AttrValue.([]byte); string(v) != "staff, wifi" {
+		t.Errorf("Expected Class = staff, wifi, got %q", v)
+	}
+	if rule = def.Match([]string{"guests"}); rule == nil || !rule.Reject {
+		t.Error("Expected reject rule for guests")
+	}
+	if rule = def.Match(nil); rule == nil || rule.Group != "*" {
+		t.Error("Expected the * rule for users without groups")
+	}
+}
+
+// TestParsePolicyErrors tests errors in policy files
+func TestParsePolicyErrors(t *testing.T) {
+	for _, text := range []string{
+		"user alice",
+		"nas",
+		"nas 10.1.0.0/33",
+		"group",
+		"group vpn Filter-Id",
+		"group vpn No-Such-Attr = 1",
+		"group vpn Session-Timeout = abc",
+		"group vpn VLAN:40 = 100",
+		`group "vpn Filter-Id = 1`,
+	} {
+		if _, err := ParsePolicy(strings.NewReader(text), nil); err == nil {
+			t.Errorf("Expected error for %q", text)
+		}
+	}
+}
+
+// TestLoadPolicyFile tests loading a policy file
+func TestLoadPolicyFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "policy.conf")
+	if err := os.WriteFile(filename, []byte(testPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := LoadPolicyFile(filename, nil)
+	if err != nil {
+		t.Fatalf("LoadPolicyFile failed: %v", err)
+	}
+	if len(set.Policies) != 2 {
+		t.Errorf("Expected 2 policies, got %d", len(set.Policies))
+	}
+	if _, err := LoadPolicyFile(filename+".missing", nil); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
@@ -0,0 +1,204 @@
+package radius
+
+import (
+	"strings"
+
+	logs "github.com/tea4go/gh/log4go"
+)
+
+// Proxy-State（RFC 2865 5.33）
+const attrProxyState = 33
+
+// TRealm 是代理的一个 realm（User-Name 中最后一个 @ 后面的部分）及其上游服务器。
+type TRealm struct {
+	// realm 名，不区分大小写。"*" 匹配其它带 realm 的用户名，"" 匹配不带 realm 的用户名。
+	Name string
+	// 转发前去掉 User-Name 中的 realm
+	Strip bool
+	// 和上游服务器的共享密钥
+	Secret []byte
+	// Access-Request 和 Accounting-Request 的上游服务器，按 Client 的 Servers、Balance、
+	// Retries 和 DeadTime 选择服务器，没有响应时切换到下一个。为nil时交给 ProxyHandler.Next。
+	Auth *Client
+	Acct *Client
+}
+
+// ProxyHandler 按 User-Name 的 realm 把 Access-Request 和 Accounting-Request 转发到上游服务器，
+// 再用客户端的共享密钥把响应发回客户端：
+//
+//   - User-Password 等加密属性用上游的共享密钥重新加密，响应中的 Tunnel-Password 等
+//     加密属性用客户端的共享密钥重新加密。
+//   - 响应中的 MS-MPPE-Send-Key 和 MS-MPPE-Recv-Key（RFC 2548）用上游的共享密钥和
+//     转发请求的 Authenticator 解密，再用客户端的共享密钥和原请求的 Authenticator 加密。
+//   - CHAP 请求没有 CHAP-Challenge 时，加入原请求的 Request Authenticator。
+//   - 请求中的 Proxy-State 原样转发，按原来的顺序放回响应（RFC 2865 5.33）。
+//   - 转发的 Access-Request 总是带有 Message-Authenticator。
+//
+// 没有匹配的 realm 或 realm 没有对应的上游服务器时交给 Next 本地处理。
+// 所有上游服务器都没有响应时不回复，客户端会重试。
+//
+//	server.Handler = &radius.ProxyHandler{
+//		Realms: []*radius.TRealm{{
+//			Name:   "example.com",
+//			Strip:  true,
+//			Secret: []byte("upstream"),
+//			Auth:   &radius.Client{Servers: []string{"10.0.0.1:1812", "10.0.0.2:1812"}, ReadTimeout: 5 * time.Second},
+//			Acct:   &radius.Client{Servers: []string{"10.0.0.1:1813", "10.0.0.2:1813"}, ReadTimeout: 5 * time.Second},
+//		}},
+//		Next: localHandler,
+//	}
+type ProxyHandler struct {
+	Realms []*TRealm
+	// 本地处理的请求，为nil时忽略
+	Next Handler
+}
+
+// SplitRealm 把 user@realm 格式的用户名分为用户名和 realm，没有 realm 时 realm 为""。
+func SplitRealm(username string) (user, realm string) {
+	if i := strings.LastIndexByte(username, '@'); i >= 0 {
+		return username[:i], username[i+1:]
+	}
+	return username, ""
+}
+
+// Realm 返回用户名匹配的 realm，没有匹配时返回nil。
+func (h *ProxyHandler) Realm(username string) *TRealm {
+	_, name := SplitRealm(username)
+	var other *TRealm
+	for _, realm := range h.Realms {
+		if strings.EqualFold(realm.Name, name) {
+			return realm
+		}
+		if realm.Name == "*" && name != "" && other == nil {
+			other = realm
+		}
+	}
+	return other
+}
+
+func (h *ProxyHandler) ServeRadius(w ResponseWriter, p *TDataPacket) {
+	username, _ := p.GetValue("User-Name").(string)
+	realm := h.Realm(username)
+	var client *Client
+	if realm != nil {
+		switch p.Code {
+		case CodeAccessRequest:
+			client = realm.Auth
+		case CodeAccountingRequest:
+			client = realm.Acct
+		}
+	}
+	if client == nil {
+		if h.Next != nil {
+			h.Next.ServeRadius(w, p)
+		}
+		return
+	}
+
+	request := proxyRequest(p, realm, username)
+	response, err := client.Exchange(request)
+	if err != nil {
+		logs.Error("[%s]==>用户(%s)的请求包(#%d)转发到realm(%s)失败，%s", w.RemoteAddr(), username, p.Identifier, realm.Name, err.Error())
+		return
+	}
+	logs.Info("[%s]==>用户(%s)的请求包(#%d)已由realm(%s)处理，响应(Code=%d)", w.RemoteAddr(), username, p.Identifier, realm.Name, response.Code)
+	reply, err := proxyResponse(p, request, response)
+	if err != nil {
+		logs.Error("[%s]==>realm(%s)对请求包(#%d)的响应错误，%s", w.RemoteAddr(), realm.Name, p.Identifier, err.Error())
+		return
+	}
+	if err := w.Write(reply); err != nil {
+		logs.Warning("[%s]==>发送响应包(#%d)出错，%s", w.RemoteAddr(), p.Identifier, err.Error())
+	}
+}
+
+// 转发给上游服务器的请求，Identifier 和 Authenticator 由 Client 重新生成
+func proxyRequest(p *TDataPacket, realm *TRealm, username string) *TDataPacket {
+	request := NewPacket(p.Code, realm.Secret)
+	request.Dictionary = p.Dictionary
+	for _, attr := range p.AttrItems {
+		if attr == nil {
+			continue
+		}
+		item := *attr
+		request.AttrItems = append(request.AttrItems, &item)
+	}
+	if realm.Strip {
+		user, _ := SplitRealm(username)
+		request.Set("User-Name", user)
+	}
+	if p.Code == CodeAccessRequest {
+		// CHAP 默认用 Request Authenticator 作为 Challenge，转发后 Authenticator 会改变
+		if p.FindAttr("CHAP-Password") != nil && p.FindAttr("CHAP-Challenge") == nil {
+			request.AddAttr("CHAP-Challenge", append([]byte(nil), p.Authenticator[:]...))
+		}
+		request.AddMessageAuthenticator()
+	}
+	return request
+}
+
+// 发回客户端的响应：去掉上游的 Message-Authenticator 和 Proxy-State，放回原请求的 Proxy-State，
+// request 为转发给上游服务器的请求
+func proxyResponse(p, request, response *TDataPacket) (*TDataPacket, error) {
+	reply := &TDataPacket{
+		Code:          response.Code,
+		Identifier:    p.Identifier,
+		Authenticator: p.Authenticator,
+		Secret:        p.Secret,
+		Dictionary:    p.Dictionary,
+	}
+	var keys byte
+	for _, attr := range response.AttrItems {
+		if attr == nil || attr.VendorId == 0 && (attr.AttrId == attrMessageAuthenticator || attr.AttrId == attrProxyState) {
+			continue
+		}
+		if value, ok := mppeKeyValue(attr); ok {
+			key, err := decryptMPPEKey(value, request.Secret, request.Authenticator)
+			if err != nil {
+				return nil, err
+			}
+			// 同一个数据包内的 salt 必须不同
+			if value, err = encryptMPPEKey(key, p.Secret, p.Authenticator, keys); err != nil {
+				return nil, err
+			}
+			keys++
+			attr = withMPPEKeyValue(attr, value)
+		}
+		reply.AttrItems = append(reply.AttrItems, attr)
+	}
+	for _, attr := range p.AttrItems {
+		if attr != nil && attr.VendorId == 0 && attr.AttrId == attrProxyState {
+			reply.AttrItems = append(reply.AttrItems, attr)
+		}
+	}
+	if reply.Code != CodeAccountingResponse && p.HasMessageAuthenticator() {
+		reply.AddMessageAuthenticator()
+	}
+	return reply, nil
+}
+
+// mppeKeyValue 返回 MS-MPPE-Send-Key/Recv-Key 加密后的值，
+// 字典中没有 Microsoft 厂商时属性为 Vendor-Specific
+func mppeKeyValue(attr *TAttribute) ([]byte, bool) {
+	vendorID, typeID, value := attr.VendorId, attr.AttrId, attr.AttrValue
+	if vsa, ok := value.(TVendorAttr); ok && attr.VendorId == 0 {
+		vendorID, typeID, value = vsa.VendorId, vsa.TypeId, vsa.Value
+	}
+	if vendorID != VendorMicrosoft || typeID != MSMPPESendKey && typeID != MSMPPERecvKey {
+		return nil, false
+	}
+	b, ok := value.([]byte)
+	return b, ok
+}
+
+// withMPPEKeyValue 返回值替换为 value 的 MS-MPPE-Send-Key/Recv-Key 属性
+func withMPPEKeyValue(attr *TAttribute, value []byte) *TAttribute {
+	item := *attr
+	if vsa, ok := item.AttrValue.(TVendorAttr); ok {
+		vsa.Value = value
+		item.AttrValue = vsa
+	} else {
+		item.AttrValue = value
+	}
+	return &item
+}
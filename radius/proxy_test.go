@@ -0,0 +1,233 @@
+package radius
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testProxyHome is the handler of the home server, alice-pw is the password of alice
+func testProxyHome(t *testing.T) HandlerFunc {
+	return func(w ResponseWriter, p *TDataPacket) {
+		var attrs []*TAttribute
+		for _, attr := range p.AttrItems {
+			if attr.AttrId == attrProxyState {
+				attrs = append(attrs, attr)
+			}
+		}
+		if p.Code == CodeAccountingRequest {
+			w.AccountingResponse(attrs...)
+			return
+		}
+		if !p.HasMessageAuthenticator() {
+			t.Error("Expected Message-Authenticator in the proxied request")
+		}
+		username, _ := p.GetValue("User-Name").(string)
+		password, _ := p.GetValue("User-Password").(string)
+		if username != "alice" || (password != "alice-pw" && p.VerifyCHAP("alice-pw") != nil) {
+			w.AccessReject(attrs...)
+			return
+		}
+		tunnel := &TAttribute{AttrId: 69, Tag: 1, AttrValue: "tunnel-secret"}
+		reply, _ := Builtin.NewAttr("Reply-Message", "home")
+		w.AccessAccept(append(attrs, reply, tunnel)...)
+	}
+}
+
+// TestSplitRealm tests SplitRealm and ProxyHandler.Realm
+func TestSplitRealm(t *testing.T) {
+	if user, realm := SplitRealm("alice@a@example.com"); user != "alice@a" || realm != "example.com" {
+		t.Errorf("Expected alice@a and example.com, got %s and %s", user, realm)
+	}
+	if user, realm := SplitRealm("alice"); user != "alice" || realm != "" {
+		t.Errorf("Expected alice without realm, got %s and %s", user, realm)
+	}
+
+	handler := &ProxyHandler{Realms: []*TRealm{{Name: "example.com"}, {Name: "*"}, {Name: ""}}}
+	tests := map[string]string{
+		"alice@Example.COM": "example.com",
+		"alice@other.org":   "*",
+		"alice":             "",
+	}
+	for username, expected := range tests {
+		if realm := handler.Realm(username); realm == nil || realm.Name != expected {
+			t.Errorf("Expected realm %q for %s, got %v", expected, username, realm)
+		}
+	}
+	handler.Realms = handler.Realms[:1]
+	if realm := handler.Realm("alice"); realm != nil {
+		t.Errorf("Expected no realm for alice, got %v", realm)
+	}
+}
+
+// TestProxyHandler tests forwarding by realm and local handling
+func TestProxyHandler(t *testing.T) {
+	home := testServer(t, testProxyHome(t), "upstream")
+	var local int32
+	proxy := &ProxyHandler{
+		Realms: []*TRealm{{
+			Name:   "example.com",
+			Strip:  true,
+			Secret: []byte("upstream"),
+			Auth:   &Client{Servers: []string{home}, ReadTimeout: time.Second},
+			Acct:   &Client{Servers: []string{home}, ReadTimeout: time.Second},
+		}},
+		Next: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			atomic.StoreInt32(&local, 1)
+			w.AccessReject()
+		}),
+	}
+	t.Cleanup(func() {
+		proxy.Realms[0].Auth.Close()
+		proxy.Realms[0].Acct.Close()
+	})
+	addr, client := testEAPServer(t, proxy)
+
+	request := NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "alice@example.com")
+	request.Set("User-Password", "alice-pw")
+	for _, state := range []string{"state-1", "state-2"} {
+		attr, _ := Builtin.NewAttr("Proxy-State", []byte(state))
+		request.AttrItems = append(request.AttrItems, attr)
+	}
+	response, err := client.SendPacket(request, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessAccept {
+		t.Fatalf("Expected Access-Accept, got %v", response.Code)
+	}
+	if v := response.GetValue("Reply-Message"); v != "home" {
+		t.Errorf("Expected Reply-Message = home, got %v", v)
+	}
+	if v := response.GetTaggedValue("Tunnel-Password", 1); v != "tunnel-secret" {
+		t.Errorf("Expected Tunnel-Password re-encrypted with the client secret, got %v", v)
+	}
+	var states [][]byte
+	for _, attr := range response.AttrItems {
+		if attr.AttrId == attrProxyState {
+			states = append(states, attr.AttrValue.([]byte))
+		}
+	}
+	if len(states) != 2 || !bytes.Equal(states[0], []byte("state-1")) || !bytes.Equal(states[1], []byte("state-2")) {
+		t.Errorf("Expected Proxy-State state-1 and state-2, got %q", states)
+	}
+
+	request = NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "alice@example.com")
+	request.SetCHAPPassword("alice-pw")
+	if response, err = client.SendPacket(request, addr); err != nil || response.Code != CodeAccessAccept {
+		t.Errorf("Expected Access-Accept for CHAP, got %v, %v", response, err)
+	}
+
+	request = NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "alice@example.com")
+	request.Set("User-Password", "wrong")
+	if response, err = client.SendPacket(request, addr); err != nil || response.Code != CodeAccessReject {
+		t.Errorf("Expected Access-Reject, got %v, %v", response, err)
+	}
+	if atomic.LoadInt32(&local) != 0 {
+		t.Error("Expected requests of example.com not to be handled locally")
+	}
+
+	request = NewPacket(CodeAccountingRequest, []byte("secret"))
+	request.Set("User-Name", "alice@example.com")
+	request.Set("Acct-Status-Type", "Start")
+	if response, err = client.SendPacket(request, addr); err != nil || response.Code != CodeAccountingResponse {
+		t.Errorf("Expected Accounting-Response, got %v, %v", response, err)
+	}
+
+	request = NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "alice")
+	request.Set("User-Password", "alice-pw")
+	if response, err = client.SendPacket(request, addr); err != nil || response.Code != CodeAccessReject || atomic.LoadInt32(&local) == 0 {
+		t.Errorf("Expected Access-Reject from the local handler, got %v, %v", response, err)
+	}
+}
+
+// TestProxyHandlerFailover tests failover to the next home server and upstream timeouts
+func TestProxyHandlerFailover(t *testing.T) {
+	home := testServer(t, testProxyHome(t), "upstream")
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	defer silent.Close()
+
+	upstream := &Client{
+		Servers:     []string{silent.LocalAddr().String(), home},
+		ReadTimeout: 200 * time.Millisecond,
+	}
+	defer upstream.Close()
+	proxy := &ProxyHandler{Realms: []*TRealm{{Name: "*", Secret: []byte("upstream"), Auth: upstream}}}
+	addr, client := testEAPServer(t, proxy)
+
+	request := NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "alice@example.com")
+	request.Set("User-Password", "alice-pw")
+	response, err := client.SendPacket(request, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessReject {
+		t.Errorf("Expected Access-Reject for alice@example.com without Strip, got %v", response.Code)
+	}
+	if upstream.IsServerAlive(silent.LocalAddr().String()) {
+		t.Error("Expected the silent home server to be marked dead")
+	}
+
+	// no home server answers
+	silentOnly := &Client{Servers: []string{silent.LocalAddr().String()}, ReadTimeout: 200 * time.Millisecond}
+	defer silentOnly.Close()
+	proxy = &ProxyHandler{Realms: []*TRealm{{Name: "*", Secret: []byte("upstream"), Auth: silentOnly}}}
+	addr, client = testEAPServer(t, proxy)
+	client.ReadTimeout = 500 * time.Millisecond
+	request = NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "alice@example.com")
+	request.Set("User-Password", "alice-pw")
+	if _, err := client.SendPacket(request, addr); err == nil {
+		t.Error("Expected no response when all home servers time out")
+	}
+}
+
+// TestProxyHandlerMPPEKeys tests that MPPE keys from the home server are re-encrypted for the client
+func TestProxyHandlerMPPEKeys(t *testing.T) {
+	recvKey, sendKey := bytes.Repeat([]byte{0x11}, 32), bytes.Repeat([]byte{0x22}, 32)
+	home := testServer(t, HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+		recv, err := encryptMPPEKey(recvKey, p.Secret, p.Authenticator, 0)
+		if err != nil {
+			t.Errorf("encryptMPPEKey failed: %v", err)
+		}
+		send, err := encryptMPPEKey(sendKey, p.Secret, p.Authenticator, 1)
+		if err != nil {
+			t.Errorf("encryptMPPEKey failed: %v", err)
+		}
+		w.AccessAccept(NewVendorAttr(VendorMicrosoft, MSMPPERecvKey, recv), NewVendorAttr(VendorMicrosoft, MSMPPESendKey, send))
+	}), "upstream")
+	upstream := &Client{Servers: []string{home}, ReadTimeout: time.Second}
+	defer upstream.Close()
+	proxy := &ProxyHandler{Realms: []*TRealm{{Name: "*", Secret: []byte("upstream"), Auth: upstream}}}
+	addr, client := testEAPServer(t, proxy)
+
+	request := NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Set("User-Name", "alice@example.com")
+	request.Set("User-Password", "alice-pw")
+	response, err := client.SendPacket(request, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessAccept {
+		t.Fatalf("Expected Access-Accept, got %v", response.Code)
+	}
+	for typeID, expected := range map[byte][]byte{MSMPPERecvKey: recvKey, MSMPPESendKey: sendKey} {
+		key, err := decryptMPPEKey(response.GetVendorAttr(VendorMicrosoft, typeID), []byte("secret"), request.Authenticator)
+		if err != nil {
+			t.Fatalf("decryptMPPEKey failed: %v", err)
+		}
+		if !bytes.Equal(key, expected) {
+			t.Errorf("MPPE key %d was not re-encrypted with the client secret", typeID)
+		}
+	}
+}
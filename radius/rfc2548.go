@@ -0,0 +1,177 @@
+package radius
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+// Microsoft 厂商号（RFC 2548）
+const VendorMicrosoft = 311
+
+// Microsoft 厂商属性（RFC 2548）
+const (
+	MSCHAPResponse         byte = 1
+	MSCHAPError            byte = 2
+	MSMPPEEncryptionPolicy byte = 7
+	MSMPPEEncryptionTypes  byte = 8
+	MSCHAPChallenge        byte = 11
+	MSMPPESendKey          byte = 16
+	MSMPPERecvKey          byte = 17
+	MSCHAP2Response        byte = 25
+	MSCHAP2Success         byte = 26
+)
+
+func init() {
+	builtinOnce.Do(initDictionary)
+	Builtin.MustRegisterVendor("Microsoft", VendorMicrosoft)
+	Builtin.MustRegisterVendorAttr(VendorMicrosoft, "MS-CHAP-Response", MSCHAPResponse, AttributeString)
+	Builtin.MustRegisterVendorAttr(VendorMicrosoft, "MS-CHAP-Error", MSCHAPError, AttributeString)
+	Builtin.MustRegisterVendorAttr(VendorMicrosoft, "MS-MPPE-Encryption-Policy", MSMPPEEncryptionPolicy, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorMicrosoft, "MS-MPPE-Encryption-Types", MSMPPEEncryptionTypes, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorMicrosoft, "MS-CHAP-Challenge", MSCHAPChallenge, AttributeString)
+	Builtin.MustRegisterVendorAttr(VendorMicrosoft, "MS-MPPE-Send-Key", MSMPPESendKey, AttributeString)
+	Builtin.MustRegisterVendorAttr(VendorMicrosoft, "MS-MPPE-Recv-Key", MSMPPERecvKey, AttributeString)
+	Builtin.MustRegisterVendorAttr(VendorMicrosoft, "MS-CHAP2-Response", MSCHAP2Response, AttributeString)
+	Builtin.MustRegisterVendorAttr(VendorMicrosoft, "MS-CHAP2-Success", MSCHAP2Success, AttributeString)
+}
+
+// VerifyMSCHAP 用 NT hash 校验 Access-Request 中的 MS-CHAPv1 应答（RFC 2433），
+// 需要 MS-CHAP-Challenge 和 MS-CHAP-Response。密码不匹配返回 ErrAuthFailed。
+func (p *TDataPacket) VerifyMSCHAP(ntHash []byte) error {
+	challenge, response, err := p.mschapAttrs(MSCHAPResponse, 8)
+	if err != nil {
+		return err
+	}
+	// Ident(1) Flags(1) LM-Response(24) NT-Response(24)
+	if response[1] != 1 {
+		return errors.New("radius: LM-Response is not supported")
+	}
+	expected := mschapChallengeResponse(challenge, ntHash)
+	if subtle.ConstantTimeCompare(expected, response[26:50]) != 1 {
+		return ErrAuthFailed
+	}
+	return nil
+}
+
+// VerifyMSCHAPv2 用 NT hash 校验 Access-Request 中的 MS-CHAPv2 应答（RFC 2759），
+// 需要 User-Name、MS-CHAP-Challenge 和 MS-CHAP2-Response。
+//
+// 成功时返回 Access-Accept 需要带的属性：MS-CHAP2-Success、MS-MPPE-Recv-Key、
+// MS-MPPE-Send-Key、MS-MPPE-Encryption-Policy 和 MS-MPPE-Encryption-Types。
+// 密码不匹配返回 ErrAuthFailed。
+//
+//	attrs, err := p.VerifyMSCHAPv2(radius.NTPasswordHash(password))
+//	if err != nil {
+//		w.AccessReject(p.MSCHAPError(691))
+//		return
+//	}
+//	w.AccessAccept(attrs...)
+func (p *TDataPacket) VerifyMSCHAPv2(ntHash []byte) ([]*TAttribute, error) {
+	challenge, response, err := p.mschapAttrs(MSCHAP2Response, 16)
+	if err != nil {
+		return nil, err
+	}
+	username, ok := p.GetValue("User-Name").(string)
+	if !ok {
+		return nil, errors.New("取属性(User-Name)失败。")
+	}
+
+	// Ident(1) Flags(1) Peer-Challenge(16) Reserved(8) NT-Response(24)
+	ident := response[0]
+	peerChallenge := response[2:18]
+	ntResponse := response[26:50]
+	expected := mschapv2NTResponse(challenge, peerChallenge, username, ntHash)
+	if subtle.ConstantTimeCompare(expected, ntResponse) != 1 {
+		return nil, ErrAuthFailed
+	}
+
+	success := mschapv2AuthenticatorResponse(ntHash, ntResponse, peerChallenge, challenge, username)
+	masterKey := mppeMasterKey(ntHash, ntResponse)
+	sendKey, err := encryptMPPEKey(mppeSessionKey(masterKey, mppeMagic3), p.Secret, p.Authenticator, 0)
+	if err != nil {
+		return nil, err
+	}
+	recvKey, err := encryptMPPEKey(mppeSessionKey(masterKey, mppeMagic2), p.Secret, p.Authenticator, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*TAttribute{
+		NewVendorAttr(VendorMicrosoft, MSCHAP2Success, append([]byte{ident}, success...)),
+		NewVendorAttr(VendorMicrosoft, MSMPPERecvKey, recvKey),
+		NewVendorAttr(VendorMicrosoft, MSMPPESendKey, sendKey),
+		NewVendorAttr(VendorMicrosoft, MSMPPEEncryptionPolicy, uint32(1)), // Encryption-Allowed
+		NewVendorAttr(VendorMicrosoft, MSMPPEEncryptionTypes, uint32(6)),  // RC4-40or128-bit-Allowed
+	}, nil
+}
+
+// MSCHAPError 返回 MS-CHAP 校验失败时 Access-Reject 带的 MS-CHAP-Error，
+// code 为错误码，如 691（密码错误）、647（账号禁用）。
+func (p *TDataPacket) MSCHAPError(code int) *TAttribute {
+	var ident byte
+	if response := p.GetVendorAttr(VendorMicrosoft, MSCHAP2Response); len(response) > 0 {
+		ident = response[0]
+	} else if response := p.GetVendorAttr(VendorMicrosoft, MSCHAPResponse); len(response) > 0 {
+		ident = response[0]
+	}
+	return NewVendorAttr(VendorMicrosoft, MSCHAPError, append([]byte{ident}, fmt.Sprintf("E=%d R=0 V=3", code)...))
+}
+
+// SetMSCHAPv2 生成 MS-CHAPv2 请求属性：User-Name、MS-CHAP-Challenge 和 MS-CHAP2-Response。
+func (p *TDataPacket) SetMSCHAPv2(username, password string) error {
+	var buff [33]byte
+	if _, err := rand.Read(buff[:]); err != nil {
+		return err
+	}
+	challenge := buff[0:16]
+	peerChallenge := buff[16:32]
+
+	response := make([]byte, 50)
+	response[0] = buff[32]
+	copy(response[2:18], peerChallenge)
+	copy(response[26:50], mschapv2NTResponse(challenge, peerChallenge, username, NTPasswordHash(password)))
+
+	if err := p.Set("User-Name", username); err != nil {
+		return err
+	}
+	p.AddVendorAttr(VendorMicrosoft, MSCHAPChallenge, challenge)
+	p.AddVendorAttr(VendorMicrosoft, MSCHAP2Response, response)
+	return nil
+}
+
+func (p *TDataPacket) mschapAttrs(responseType byte, challengeLength int) (challenge, response []byte, err error) {
+	if p.Code != CodeAccessRequest {
+		err = fmt.Errorf("只接收AccessRequest(Code=%d)请求包，当前为(Code=%d)", CodeAccessRequest, p.Code)
+		return
+	}
+	challenge = p.GetVendorAttr(VendorMicrosoft, MSCHAPChallenge)
+	if len(challenge) != challengeLength {
+		err = errors.New("取属性(MS-CHAP-Challenge)失败。")
+		return
+	}
+	response = p.GetVendorAttr(VendorMicrosoft, responseType)
+	if len(response) != 50 {
+		err = fmt.Errorf("取属性(%s)失败。", Builtin.GetVendorEntry(VendorMicrosoft, responseType).Name)
+		return
+	}
+	return
+}
+
+// encryptMPPEKey 按 RFC 2548 2.4.2 加密 MS-MPPE-Send-Key/Recv-Key，
+// 同一个数据包内的 salt 必须不同，由 index 区分。
+func encryptMPPEKey(key, secret []byte, authenticator [16]byte, index byte) ([]byte, error) {
+	var salt [2]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return nil, err
+	}
+	salt[0] |= 0x80
+	salt[1] = salt[1]&^1 | index&1
+	return encryptSalted(key, secret, authenticator, salt)
+}
+
+// decryptMPPEKey 解密 MS-MPPE-Send-Key/Recv-Key，authenticator 为请求的 Request Authenticator。
+func decryptMPPEKey(value, secret []byte, authenticator [16]byte) ([]byte, error) {
+	return decryptSalted(value, secret, authenticator)
+}
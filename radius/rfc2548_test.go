@@ -0,0 +1,126 @@
+package radius
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestVerifyMSCHAPv2 tests an MS-CHAPv2 exchange through Encode and ParsePacket
+func TestVerifyMSCHAPv2(t *testing.T) {
+	secret := []byte("secret")
+	request := NewPacket(CodeAccessRequest, secret)
+	if err := request.SetMSCHAPv2(`DOMAIN\user`, "password"); err != nil {
+		t.Fatalf("SetMSCHAPv2 failed: %v", err)
+	}
+	data, err := request.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	received, err := ParsePacket(data, secret, Builtin)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if !strings.Contains(received.String(), "MS-CHAP2-Response") {
+		t.Errorf("Expected MS-CHAP2-Response in %s", received.String())
+	}
+
+	if _, err := received.VerifyMSCHAPv2(NTPasswordHash("wrong")); err != ErrAuthFailed {
+		t.Errorf("Expected ErrAuthFailed, got %v", err)
+	}
+	attrs, err := received.VerifyMSCHAPv2(NTPasswordHash("password"))
+	if err != nil {
+		t.Fatalf("VerifyMSCHAPv2 failed: %v", err)
+	}
+
+	response := &TDataPacket{
+		Code:          CodeAccessAccept,
+		Identifier:    received.Identifier,
+		Authenticator: received.Authenticator,
+		Secret:        secret,
+		Dictionary:    Builtin,
+		AttrItems:     attrs,
+	}
+	data, err = response.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	accept, err := ParsePacket(data, secret, Builtin)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if !accept.IsAuthentic(request) {
+		t.Error("Expected authentic response")
+	}
+
+	// MS-CHAP2-Success = Ident + "S=<authenticator response>"
+	mschap2Response := request.GetVendorAttr(VendorMicrosoft, MSCHAP2Response)
+	challenge := request.GetVendorAttr(VendorMicrosoft, MSCHAPChallenge)
+	passwordHash := NTPasswordHash("password")
+	expected := mschapv2AuthenticatorResponse(passwordHash, mschap2Response[26:50], mschap2Response[2:18], challenge, "user")
+	success := accept.GetVendorAttr(VendorMicrosoft, MSCHAP2Success)
+	if len(success) != 43 || success[0] != mschap2Response[0] || string(success[1:]) != expected {
+		t.Errorf("Expected MS-CHAP2-Success %s, got %q", expected, success)
+	}
+
+	masterKey := mppeMasterKey(passwordHash, mschap2Response[26:50])
+	sendKey, err := decryptMPPEKey(accept.GetVendorAttr(VendorMicrosoft, MSMPPESendKey), secret, request.Authenticator)
+	if err != nil || !bytes.Equal(sendKey, mppeSessionKey(masterKey, mppeMagic3)) {
+		t.Errorf("Unexpected MS-MPPE-Send-Key %x, %v", sendKey, err)
+	}
+	recvKey, err := decryptMPPEKey(accept.GetVendorAttr(VendorMicrosoft, MSMPPERecvKey), secret, request.Authenticator)
+	if err != nil || !bytes.Equal(recvKey, mppeSessionKey(masterKey, mppeMagic2)) {
+		t.Errorf("Unexpected MS-MPPE-Recv-Key %x, %v", recvKey, err)
+	}
+}
+
+// TestVerifyMSCHAP tests VerifyMSCHAP with an MS-CHAPv1 response
+func TestVerifyMSCHAP(t *testing.T) {
+	packet := NewPacket(CodeAccessRequest, []byte("secret"))
+	packet.AddAttr("User-Name", "user")
+	challenge := mustHex("102DB5DF085D3041")
+	response := make([]byte, 50)
+	response[0] = 7
+	response[1] = 1
+	copy(response[26:], mschapChallengeResponse(challenge, NTPasswordHash("MyPw")))
+	packet.AddVendorAttr(VendorMicrosoft, MSCHAPChallenge, challenge)
+	packet.AddVendorAttr(VendorMicrosoft, MSCHAPResponse, response)
+
+	if err := packet.VerifyMSCHAP(NTPasswordHash("MyPw")); err != nil {
+		t.Errorf("Expected valid MS-CHAP-Response, got %v", err)
+	}
+	if err := packet.VerifyMSCHAP(NTPasswordHash("other")); err != ErrAuthFailed {
+		t.Errorf("Expected ErrAuthFailed, got %v", err)
+	}
+
+	attr := packet.MSCHAPError(691)
+	if attr.VendorId != VendorMicrosoft || attr.AttrId != MSCHAPError || string(attr.AttrValue.([]byte)) != "\x07E=691 R=0 V=3" {
+		t.Errorf("Unexpected MS-CHAP-Error %v", attr)
+	}
+
+	if _, err := packet.VerifyMSCHAPv2(NTPasswordHash("MyPw")); err == nil {
+		t.Error("Expected error without MS-CHAP2-Response")
+	}
+}
+
+// TestMPPEKeyEncryption tests encryptMPPEKey and decryptMPPEKey
+func TestMPPEKeyEncryption(t *testing.T) {
+	var authenticator [16]byte
+	copy(authenticator[:], "0123456789abcdef")
+	key := []byte("0123456789ABCDEF")
+
+	encrypted, err := encryptMPPEKey(key, []byte("secret"), authenticator, 1)
+	if err != nil {
+		t.Fatalf("encryptMPPEKey failed: %v", err)
+	}
+	if len(encrypted) != 34 || encrypted[0]&0x80 == 0 || encrypted[1]&1 != 1 {
+		t.Errorf("Unexpected encrypted key %x", encrypted)
+	}
+	decrypted, err := decryptMPPEKey(encrypted, []byte("secret"), authenticator)
+	if err != nil || !bytes.Equal(decrypted, key) {
+		t.Errorf("Expected %x, got %x, %v", key, decrypted, err)
+	}
+	if _, err := decryptMPPEKey(encrypted[:20], []byte("secret"), authenticator); err == nil {
+		t.Error("Expected error for invalid length")
+	}
+}
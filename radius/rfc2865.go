@@ -52,30 +52,69 @@ func init() {
 	Builtin.MustRegister("Port-Limit", 62, AttributeInteger)
 	Builtin.MustRegister("Login-LAT-Port", 63, AttributeString)
 
-	Builtin.MustRegister("Tunnel-Type", 64, AttributeInteger)
-	Builtin.MustRegister("Tunnel-Medium-Type", 65, AttributeInteger)
-	Builtin.MustRegister("Tunnel-Client-Endpoint", 66, AttributeString)
-	Builtin.MustRegister("Tunnel-Server-Endpoint", 67, AttributeString)
-	Builtin.MustRegister("Tunnel-Password", 69, AttributeString)
-
 	// FreeRADIUS specific
 	Builtin.MustRegister("Authenticator-Type", 76, AttributeString)
 	Builtin.MustRegister("Connect-Info", 77, AttributeString)
 	Builtin.MustRegister("EAP-Message", 79, AttributeString)
-	Builtin.MustRegister("Message-Authenticator", 80, AttributeString)
+	Builtin.MustRegister("Message-Authenticator", 80, rfc3579MessageAuthenticator{})
 	Builtin.MustRegister("NAS-Port-Id", 87, AttributeString)
-	Builtin.MustRegister("FreeRADIUS-Statistics-Type", 127, AttributeInteger)
-
-	Builtin.MustRegister("FreeRADIUS-Total-Access-Requests", 128, AttributeString)
-	Builtin.MustRegister("FreeRADIUS-Total-Access-Accepts", 129, AttributeString)
-	Builtin.MustRegister("FreeRADIUS-Total-Access-Rejects", 130, AttributeString)
-	Builtin.MustRegister("FreeRADIUS-Total-Access-Challenges", 131, AttributeString)
-	Builtin.MustRegister("FreeRADIUS-Total-Auth-Responses", 132, AttributeString)
-	Builtin.MustRegister("FreeRADIUS-Total-Auth-Duplicate-Requests", 133, AttributeString)
-	Builtin.MustRegister("FreeRADIUS-Total-Auth-Malformed-Requests", 134, AttributeString)
-	Builtin.MustRegister("FreeRADIUS-Total-Auth-Invalid-Requests", 135, AttributeString)
-	Builtin.MustRegister("FreeRADIUS-Total-Auth-Dropped-Requests", 136, AttributeString)
-	Builtin.MustRegister("FreeRADIUS-Total-Auth-Unknown-Types", 137, AttributeString)
+
+	// RFC 2865 5 枚举值
+	Builtin.MustRegisterValue("Service-Type", "Login-User", 1)
+	Builtin.MustRegisterValue("Service-Type", "Framed-User", 2)
+	Builtin.MustRegisterValue("Service-Type", "Callback-Login-User", 3)
+	Builtin.MustRegisterValue("Service-Type", "Callback-Framed-User", 4)
+	Builtin.MustRegisterValue("Service-Type", "Outbound-User", 5)
+	Builtin.MustRegisterValue("Service-Type", "Administrative-User", 6)
+	Builtin.MustRegisterValue("Service-Type", "NAS-Prompt-User", 7)
+	Builtin.MustRegisterValue("Service-Type", "Authenticate-Only", 8)
+	Builtin.MustRegisterValue("Service-Type", "Callback-NAS-Prompt", 9)
+	Builtin.MustRegisterValue("Service-Type", "Call-Check", 10)
+	Builtin.MustRegisterValue("Service-Type", "Callback-Administrative", 11)
+	Builtin.MustRegisterValue("Framed-Protocol", "PPP", 1)
+	Builtin.MustRegisterValue("Framed-Protocol", "SLIP", 2)
+	Builtin.MustRegisterValue("Framed-Protocol", "ARAP", 3)
+	Builtin.MustRegisterValue("Framed-Protocol", "Gandalf-SLML", 4)
+	Builtin.MustRegisterValue("Framed-Protocol", "Xylogics-IPX-SLIP", 5)
+	Builtin.MustRegisterValue("Framed-Protocol", "X.75-Synchronous", 6)
+	Builtin.MustRegisterValue("Framed-Routing", "None", 0)
+	Builtin.MustRegisterValue("Framed-Routing", "Broadcast", 1)
+	Builtin.MustRegisterValue("Framed-Routing", "Listen", 2)
+	Builtin.MustRegisterValue("Framed-Routing", "Broadcast-Listen", 3)
+	Builtin.MustRegisterValue("Framed-Compression", "None", 0)
+	Builtin.MustRegisterValue("Framed-Compression", "Van-Jacobson-TCP-IP", 1)
+	Builtin.MustRegisterValue("Framed-Compression", "IPX-Header-Compression", 2)
+	Builtin.MustRegisterValue("Framed-Compression", "Stac-LZS", 3)
+	Builtin.MustRegisterValue("Login-Service", "Telnet", 0)
+	Builtin.MustRegisterValue("Login-Service", "Rlogin", 1)
+	Builtin.MustRegisterValue("Login-Service", "TCP-Clear", 2)
+	Builtin.MustRegisterValue("Login-Service", "PortMaster", 3)
+	Builtin.MustRegisterValue("Login-Service", "LAT", 4)
+	Builtin.MustRegisterValue("Login-Service", "X25-PAD", 5)
+	Builtin.MustRegisterValue("Login-Service", "X25-T3POS", 6)
+	Builtin.MustRegisterValue("Login-Service", "TCP-Clear-Quiet", 8)
+	Builtin.MustRegisterValue("Termination-Action", "Default", 0)
+	Builtin.MustRegisterValue("Termination-Action", "RADIUS-Request", 1)
+	Builtin.MustRegisterValue("NAS-Port-Type", "Async", 0)
+	Builtin.MustRegisterValue("NAS-Port-Type", "Sync", 1)
+	Builtin.MustRegisterValue("NAS-Port-Type", "ISDN", 2)
+	Builtin.MustRegisterValue("NAS-Port-Type", "ISDN-V120", 3)
+	Builtin.MustRegisterValue("NAS-Port-Type", "ISDN-V110", 4)
+	Builtin.MustRegisterValue("NAS-Port-Type", "Virtual", 5)
+	Builtin.MustRegisterValue("NAS-Port-Type", "PIAFS", 6)
+	Builtin.MustRegisterValue("NAS-Port-Type", "HDLC-Clear-Channel", 7)
+	Builtin.MustRegisterValue("NAS-Port-Type", "X.25", 8)
+	Builtin.MustRegisterValue("NAS-Port-Type", "X.75", 9)
+	Builtin.MustRegisterValue("NAS-Port-Type", "G.3-Fax", 10)
+	Builtin.MustRegisterValue("NAS-Port-Type", "SDSL", 11)
+	Builtin.MustRegisterValue("NAS-Port-Type", "ADSL-CAP", 12)
+	Builtin.MustRegisterValue("NAS-Port-Type", "ADSL-DMT", 13)
+	Builtin.MustRegisterValue("NAS-Port-Type", "IDSL", 14)
+	Builtin.MustRegisterValue("NAS-Port-Type", "Ethernet", 15)
+	Builtin.MustRegisterValue("NAS-Port-Type", "xDSL", 16)
+	Builtin.MustRegisterValue("NAS-Port-Type", "Cable", 17)
+	Builtin.MustRegisterValue("NAS-Port-Type", "Wireless-Other", 18)
+	Builtin.MustRegisterValue("NAS-Port-Type", "Wireless-802.11", 19)
 }
 
 type rfc2865UserPassword struct{}
@@ -140,3 +179,70 @@ func (rfc2865UserPassword) Encode(p *TDataPacket, value interface{}) ([]byte, er
 func (rfc2865UserPassword) GetCodeName() string {
 	return "RFC2865UserPassword"
 }
+
+// 字典文件中 encrypt=1 的属性，按 RFC 2865 5.2 的 User-Password 方式加密，
+// 支持 16 字节以上（最多 128 字节）的值。
+type rfc2865Encrypted struct{}
+
+func (rfc2865Encrypted) Decode(p *TDataPacket, value []byte) (interface{}, error) {
+	if p.Secret == nil {
+		return nil, errors.New("radius: encrypted attribute requires Packet.Secret")
+	}
+	if len(value) < 16 || len(value) > 128 || len(value)%16 != 0 {
+		return nil, errors.New("radius: invalid encrypted attribute length")
+	}
+	v := make([]byte, len(value))
+	last := p.Authenticator[:]
+	for i := 0; i < len(value); i += 16 {
+		hash := md5.New()
+		hash.Write(p.Secret)
+		hash.Write(last)
+		mask := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			v[i+j] = value[i+j] ^ mask[j]
+		}
+		last = value[i : i+16]
+	}
+	return string(bytes.TrimRight(v, "\x00")), nil
+}
+
+func (rfc2865Encrypted) Encode(p *TDataPacket, value interface{}) ([]byte, error) {
+	if p.Secret == nil {
+		return nil, errors.New("radius: encrypted attribute requires Packet.Secret")
+	}
+	var plain []byte
+	switch v := value.(type) {
+	case string:
+		plain = []byte(v)
+	case []byte:
+		plain = v
+	default:
+		return nil, errors.New("radius: encrypted attribute must be string or []byte")
+	}
+	if len(plain) > 128 {
+		return nil, errors.New("radius: encrypted attribute is too long")
+	}
+
+	length := (len(plain) + 15) / 16 * 16
+	if length == 0 {
+		length = 16
+	}
+	v := make([]byte, length)
+	copy(v, plain)
+	last := p.Authenticator[:]
+	for i := 0; i < length; i += 16 {
+		hash := md5.New()
+		hash.Write(p.Secret)
+		hash.Write(last)
+		mask := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			v[i+j] ^= mask[j]
+		}
+		last = v[i : i+16]
+	}
+	return v, nil
+}
+
+func (rfc2865Encrypted) GetCodeName() string {
+	return "RFC2865Encrypted"
+}
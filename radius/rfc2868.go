@@ -0,0 +1,304 @@
+package radius
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// 隧道属性（RFC 2868）。
+//
+// 字典项带 has_tag 的属性第一个字节为 Tag（0x01-0x1F），同一隧道的属性使用相同的 Tag，
+// 解码后保存在 TAttribute.Tag 中：整数属性的 Tag 占用最高字节，值只有低24位；
+// 字符串属性的第一个字节大于 0x1F 时表示没有 Tag。
+// 带 encrypt=2 的属性（Tunnel-Password）按 RFC 2868 3.5 加盐加密，
+// 使用的 Request Authenticator 为数据包的 Authenticator（响应中即请求的值）。
+
+// Tag 的最大值，超过时字符串属性的第一个字节不是 Tag
+const maxAttrTag = 0x1f
+
+// 加盐加密的 salt 序号，保证同一个数据包中的 salt 不同
+var saltSequence uint32
+
+func init() {
+	builtinOnce.Do(initDictionary)
+	var seed [4]byte
+	rand.Read(seed[:])
+	saltSequence = binary.BigEndian.Uint32(seed[:])
+
+	mustRegisterTunnelAttr("Tunnel-Type", 64, AttributeInteger, 0)
+	mustRegisterTunnelAttr("Tunnel-Medium-Type", 65, AttributeInteger, 0)
+	mustRegisterTunnelAttr("Tunnel-Client-Endpoint", 66, AttributeString, 0)
+	mustRegisterTunnelAttr("Tunnel-Server-Endpoint", 67, AttributeString, 0)
+	mustRegisterTunnelAttr("Tunnel-Password", 69, AttributeText, 2)
+	mustRegisterTunnelAttr("Tunnel-Private-Group-Id", 81, AttributeText, 0)
+	mustRegisterTunnelAttr("Tunnel-Assignment-Id", 82, AttributeString, 0)
+	mustRegisterTunnelAttr("Tunnel-Preference", 83, AttributeInteger, 0)
+	mustRegisterTunnelAttr("Tunnel-Client-Auth-Id", 90, AttributeText, 0)
+	mustRegisterTunnelAttr("Tunnel-Server-Auth-Id", 91, AttributeText, 0)
+
+	// RFC 2868 3.1、3.2 枚举值
+	Builtin.MustRegisterValue("Tunnel-Type", "PPTP", 1)
+	Builtin.MustRegisterValue("Tunnel-Type", "L2F", 2)
+	Builtin.MustRegisterValue("Tunnel-Type", "L2TP", 3)
+	Builtin.MustRegisterValue("Tunnel-Type", "ATMP", 4)
+	Builtin.MustRegisterValue("Tunnel-Type", "VTP", 5)
+	Builtin.MustRegisterValue("Tunnel-Type", "AH", 6)
+	Builtin.MustRegisterValue("Tunnel-Type", "IP-IP", 7)
+	Builtin.MustRegisterValue("Tunnel-Type", "MIN-IP-IP", 8)
+	Builtin.MustRegisterValue("Tunnel-Type", "ESP", 9)
+	Builtin.MustRegisterValue("Tunnel-Type", "GRE", 10)
+	Builtin.MustRegisterValue("Tunnel-Type", "DVS", 11)
+	Builtin.MustRegisterValue("Tunnel-Type", "IP-in-IP", 12)
+	Builtin.MustRegisterValue("Tunnel-Type", "VLAN", 13)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "IPv4", 1)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "IPv6", 2)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "NSAP", 3)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "HDLC", 4)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "BBN-1822", 5)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "IEEE-802", 6)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "E.163", 7)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "E.164", 8)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "F.69", 9)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "X.121", 10)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "IPX", 11)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "Appletalk", 12)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "DecNet-IV", 13)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "Banyan-Vines", 14)
+	Builtin.MustRegisterValue("Tunnel-Medium-Type", "E.164-NSAP", 15)
+}
+
+// 注册带 Tag 的隧道属性，同字典文件中的 has_tag[,encrypt=2]
+func mustRegisterTunnelAttr(name string, t byte, codec IAttributeCodec, encrypt byte) {
+	Builtin.MustRegister(name, t, codec)
+	entry := Builtin.NameItems[name]
+	entry.HasTag = true
+	entry.Encrypt = encrypt
+}
+
+// TunnelVLAN 返回动态 VLAN 授权使用的 Tunnel-Type=VLAN、Tunnel-Medium-Type=IEEE-802
+// 和 Tunnel-Private-Group-Id，tag 为0时不带 Tag。
+func TunnelVLAN(tag byte, vlanID string) []*TAttribute {
+	attrs := make([]*TAttribute, 0, 3)
+	for _, v := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"Tunnel-Type", "VLAN"},
+		{"Tunnel-Medium-Type", "IEEE-802"},
+		{"Tunnel-Private-Group-Id", vlanID},
+	} {
+		attr, err := Builtin.NewAttr(v.name, v.value)
+		if err != nil {
+			panic(err)
+		}
+		attr.Tag = tag
+		attrs = append(attrs, attr)
+	}
+	return attrs
+}
+
+// AddTaggedAttr 添加一个带 Tag 的属性，同一个属性可以按不同的 Tag 出现多次。
+func (p *TDataPacket) AddTaggedAttr(name string, tag byte, value interface{}) error {
+	if tag > maxAttrTag {
+		return fmt.Errorf("属性(%s)的Tag(%d)超出范围(0-%d)。", name, tag, maxAttrTag)
+	}
+	attr, err := p.Dictionary.NewAttr(name, value)
+	if err != nil {
+		return err
+	}
+	attr.Tag = tag
+	p.AttrItems = append(p.AttrItems, attr)
+	return nil
+}
+
+// GetTaggedValue 返回第一个属性名和 Tag 都匹配的属性值，不存在时返回nil。
+func (p *TDataPacket) GetTaggedValue(name string, tag byte) interface{} {
+	entry := p.Dictionary.GetEntry(name)
+	if entry == nil {
+		return nil
+	}
+	for _, attr := range p.AttrItems {
+		if attr != nil && attr.AttrId == entry.Id && attr.VendorId == entry.VendorId && attr.Tag == tag {
+			return attr.AttrValue
+		}
+	}
+	return nil
+}
+
+// 带 Tag 或加盐加密的字典项，编解码时需要额外处理
+func (e *TDictEntry) isTagged() bool {
+	return e != nil && (e.HasTag || e.Encrypt == 2)
+}
+
+// saltEncrypted 是还没有解密的加盐加密属性值。
+// 响应中的属性需要请求的 Request Authenticator，由 DecryptAttrs 解密。
+type saltEncrypted []byte
+
+func (v saltEncrypted) String() string {
+	return ""
+}
+
+// 解码带 Tag 或加盐加密的属性值，返回值和 Tag
+func decodeTaggedAttr(p *TDataPacket, entry *TDictEntry, wire []byte) (interface{}, byte, error) {
+	var tag byte
+	if entry.Encrypt == 2 {
+		if entry.HasTag {
+			if len(wire) < 1 {
+				return nil, 0, errors.New("radius: invalid tagged attribute length")
+			}
+			tag, wire = wire[0], wire[1:]
+		}
+		// 只有 Access-Request 的 Authenticator 就是加密使用的 Request Authenticator
+		if p.Code != CodeAccessRequest {
+			return saltEncrypted(append([]byte(nil), wire...)), tag, nil
+		}
+		value, err := decodeSaltEncrypted(p, entry, wire, p.Authenticator)
+		return value, tag, err
+	}
+
+	if len(wire) > 0 {
+		if entry.Func == AttributeInteger {
+			tag = wire[0]
+			wire = append([]byte{0}, wire[1:]...)
+		} else if wire[0] <= maxAttrTag {
+			tag, wire = wire[0], wire[1:]
+		}
+	}
+	value, err := entry.Func.Decode(p, wire)
+	return value, tag, err
+}
+
+func decodeSaltEncrypted(p *TDataPacket, entry *TDictEntry, wire []byte, authenticator [16]byte) (interface{}, error) {
+	if p.Secret == nil {
+		return nil, errors.New("radius: encrypted attribute requires Packet.Secret")
+	}
+	plain, err := decryptSalted(wire, p.Secret, authenticator)
+	if err != nil {
+		return nil, err
+	}
+	return entry.Func.Decode(p, plain)
+}
+
+// 编码带 Tag 或加盐加密的属性值
+func encodeTaggedAttr(p *TDataPacket, entry *TDictEntry, attr *TAttribute) ([]byte, error) {
+	if attr.Tag > maxAttrTag {
+		return nil, fmt.Errorf("radius: invalid tag %d for attribute %s", attr.Tag, entry.Name)
+	}
+	if _, ok := attr.AttrValue.(saltEncrypted); ok {
+		return nil, fmt.Errorf("radius: attribute %s is not decrypted", entry.Name)
+	}
+	wire, err := entry.Func.Encode(p, attr.AttrValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Encrypt == 2 {
+		if p.Secret == nil {
+			return nil, errors.New("radius: encrypted attribute requires Packet.Secret")
+		}
+		seq := atomic.AddUint32(&saltSequence, 1)
+		salt := [2]byte{byte(seq>>8) | 0x80, byte(seq)}
+		if wire, err = encryptSalted(wire, p.Secret, p.Authenticator, salt); err != nil {
+			return nil, err
+		}
+		if entry.HasTag {
+			wire = append([]byte{attr.Tag}, wire...)
+		}
+		return wire, nil
+	}
+
+	if !entry.HasTag {
+		return wire, nil
+	}
+	if entry.Func == AttributeInteger {
+		if len(wire) != 4 || wire[0] != 0 {
+			return nil, fmt.Errorf("radius: value of tagged attribute %s is too large", entry.Name)
+		}
+		return append([]byte{attr.Tag}, wire[1:]...), nil
+	}
+	// 没有 Tag 的值以 0x01-0x1F 开头时，补一个为0的 Tag 避免误解析
+	if attr.Tag != 0 || (len(wire) > 0 && wire[0] <= maxAttrTag) {
+		wire = append([]byte{attr.Tag}, wire...)
+	}
+	return wire, nil
+}
+
+// DecryptAttrs 用请求的 Request Authenticator 解密响应中加盐加密的属性（如 Tunnel-Password）。
+// Client 收到响应后会自动调用，直接用 ParsePacket 解析响应时需要自己调用。
+func (p *TDataPacket) DecryptAttrs(request *TDataPacket) error {
+	for _, attr := range p.AttrItems {
+		if attr == nil {
+			continue
+		}
+		wire, ok := attr.AttrValue.(saltEncrypted)
+		if !ok {
+			continue
+		}
+		entry := p.Dictionary.entryOf(attr)
+		if entry == nil {
+			return fmt.Errorf("radius: unknown encrypted attribute %d", attr.AttrId)
+		}
+		value, err := decodeSaltEncrypted(p, entry, wire, request.Authenticator)
+		if err != nil {
+			return fmt.Errorf("radius: decrypt attribute %s: %s", entry.Name, err.Error())
+		}
+		attr.AttrValue = value
+	}
+	return nil
+}
+
+// encryptSalted 按 RFC 2868 3.5（同 RFC 2548 2.4.2）加盐加密：
+// Length(1) + 明文补0到16的整数倍，第一个块的密钥为 MD5(secret + Request Authenticator + salt)，
+// 以后每块为 MD5(secret + 上一个密文块)。
+func encryptSalted(value, secret []byte, authenticator [16]byte, salt [2]byte) ([]byte, error) {
+	if len(value) > 239 {
+		return nil, errors.New("radius: encrypted attribute is too long")
+	}
+	plain := make([]byte, (1+len(value)+15)/16*16)
+	plain[0] = byte(len(value))
+	copy(plain[1:], value)
+
+	result := make([]byte, 2, 2+len(plain))
+	copy(result, salt[:])
+	last := append(authenticator[:], salt[:]...)
+	for i := 0; i < len(plain); i += 16 {
+		hash := md5.New()
+		hash.Write(secret)
+		hash.Write(last)
+		b := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			b[j] ^= plain[i+j]
+		}
+		result = append(result, b...)
+		last = b
+	}
+	return result, nil
+}
+
+// decryptSalted 解密 encryptSalted 的结果，authenticator 为请求的 Request Authenticator
+func decryptSalted(value, secret []byte, authenticator [16]byte) ([]byte, error) {
+	if len(value) < 18 || (len(value)-2)%16 != 0 {
+		return nil, errors.New("radius: invalid encrypted attribute length")
+	}
+	plain := make([]byte, 0, len(value)-2)
+	last := append(authenticator[:], value[:2]...)
+	for i := 2; i < len(value); i += 16 {
+		hash := md5.New()
+		hash.Write(secret)
+		hash.Write(last)
+		b := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			b[j] ^= value[i+j]
+		}
+		plain = append(plain, b...)
+		last = value[i : i+16]
+	}
+	if int(plain[0]) > len(plain)-1 {
+		return nil, errors.New("radius: invalid encrypted attribute value length")
+	}
+	return plain[1 : 1+plain[0]], nil
+}
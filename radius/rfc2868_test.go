@@ -0,0 +1,211 @@
+package radius
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// testAccessAccept returns an Access-Accept answering request with attrs
+func testAccessAccept(request *TDataPacket, attrs ...*TAttribute) *TDataPacket {
+	return &TDataPacket{
+		Code:          CodeAccessAccept,
+		Identifier:    request.Identifier,
+		Authenticator: request.Authenticator,
+		Secret:        request.Secret,
+		Dictionary:    request.Dictionary,
+		AttrItems:     attrs,
+	}
+}
+
+// TestTaggedAttributes tests encoding and decoding of RFC 2868 tags
+func TestTaggedAttributes(t *testing.T) {
+	request := NewPacket(CodeAccessRequest, []byte("secret"))
+	accept := testAccessAccept(request, TunnelVLAN(1, "100")...)
+	if err := accept.AddTaggedAttr("Tunnel-Private-Group-Id", 2, "200"); err != nil {
+		t.Fatalf("AddTaggedAttr failed: %v", err)
+	}
+	// a value starting with 0x01-0x1F gets a zero tag
+	if err := accept.AddAttr("Tunnel-Client-Auth-Id", "\x05name"); err != nil {
+		t.Fatalf("AddAttr failed: %v", err)
+	}
+	if err := accept.AddTaggedAttr("Tunnel-Type", 32, "VLAN"); err == nil {
+		t.Error("Expected error for tag out of range")
+	}
+
+	data, err := accept.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if !bytes.Contains(data, []byte{64, 6, 1, 0, 0, 13}) {
+		t.Errorf("Expected tagged Tunnel-Type in %x", data)
+	}
+	if !bytes.Contains(data, []byte{81, 6, 1, '1', '0', '0'}) {
+		t.Errorf("Expected tagged Tunnel-Private-Group-Id in %x", data)
+	}
+	if !bytes.Contains(data, []byte{90, 8, 0, 5}) {
+		t.Errorf("Expected zero tag before Tunnel-Client-Auth-Id in %x", data)
+	}
+
+	received, err := ParsePacket(data, []byte("secret"), Builtin)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if v := received.GetTaggedValue("Tunnel-Type", 1); v != uint32(13) {
+		t.Errorf("Expected Tunnel-Type:1 = 13, got %v", v)
+	}
+	if received.GetValueName("Tunnel-Medium-Type") != "IEEE-802" {
+		t.Errorf("Expected Tunnel-Medium-Type IEEE-802, got %s", received.GetValueName("Tunnel-Medium-Type"))
+	}
+	if v := received.GetTaggedValue("Tunnel-Private-Group-Id", 2); v != "200" {
+		t.Errorf("Expected Tunnel-Private-Group-Id:2 = 200, got %v", v)
+	}
+	if v := received.GetTaggedValue("Tunnel-Client-Auth-Id", 0); v != "\x05name" {
+		t.Errorf("Expected untagged Tunnel-Client-Auth-Id, got %q", v)
+	}
+	if !strings.Contains(received.String(), "Tunnel-Type:1 = VLAN") {
+		t.Errorf("Expected tag in %s", received.String())
+	}
+
+	accept = testAccessAccept(request)
+	accept.AddTaggedAttr("Tunnel-Preference", 1, uint32(0x1000000))
+	if _, err := accept.Encode(); err == nil {
+		t.Error("Expected error for tagged integer larger than 24 bits")
+	}
+}
+
+// TestTunnelPassword tests RFC 2868 salt encryption of Tunnel-Password
+func TestTunnelPassword(t *testing.T) {
+	secret := []byte("secret")
+	request := NewPacket(CodeAccessRequest, secret)
+	accept := testAccessAccept(request)
+	accept.AddTaggedAttr("Tunnel-Password", 1, "tunnel-secret")
+	accept.AddTaggedAttr("Tunnel-Password", 2, strings.Repeat("x", 40))
+
+	data, err := accept.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	// Type Length Tag Salt(2) 16*n
+	i := bytes.IndexByte(data[20:], 69) + 20
+	if data[i+1] != 2+1+2+16 || data[i+2] != 1 || data[i+3]&0x80 == 0 {
+		t.Errorf("Unexpected Tunnel-Password encoding %x", data[i:i+int(data[i+1])])
+	}
+	if bytes.Contains(data, []byte("tunnel-secret")) {
+		t.Error("Expected Tunnel-Password to be encrypted")
+	}
+
+	received, err := ParsePacket(data, secret, Builtin)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if _, ok := received.GetTaggedValue("Tunnel-Password", 1).(saltEncrypted); !ok {
+		t.Fatalf("Expected Tunnel-Password to wait for the request, got %v", received.GetTaggedValue("Tunnel-Password", 1))
+	}
+	if strings.Contains(received.String(), "tunnel-secret") {
+		t.Error("Expected Tunnel-Password to be hidden")
+	}
+	if _, err := received.Encode(); err == nil {
+		t.Error("Expected error encoding an undecrypted attribute")
+	}
+	if err := received.DecryptAttrs(request); err != nil {
+		t.Fatalf("DecryptAttrs failed: %v", err)
+	}
+	if v := received.GetTaggedValue("Tunnel-Password", 1); v != "tunnel-secret" {
+		t.Errorf("Expected Tunnel-Password:1 = tunnel-secret, got %v", v)
+	}
+	if v := received.GetTaggedValue("Tunnel-Password", 2); v != strings.Repeat("x", 40) {
+		t.Errorf("Expected Tunnel-Password:2 of 40 bytes, got %v", v)
+	}
+
+	// Access-Request uses its own authenticator
+	request.AddTaggedAttr("Tunnel-Password", 0, "in-request")
+	data, err = request.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	received, err = ParsePacket(data, secret, Builtin)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if v := received.GetValue("Tunnel-Password"); v != "in-request" {
+		t.Errorf("Expected Tunnel-Password in Access-Request, got %v", v)
+	}
+}
+
+// TestEncryptSalted tests encryptSalted and decryptSalted
+func TestEncryptSalted(t *testing.T) {
+	var authenticator [16]byte
+	copy(authenticator[:], "0123456789abcdef")
+	for _, size := range []int{0, 15, 16, 239} {
+		value := bytes.Repeat([]byte{0xa5}, size)
+		encrypted, err := encryptSalted(value, []byte("secret"), authenticator, [2]byte{0x80, 1})
+		if err != nil {
+			t.Fatalf("encryptSalted(%d) failed: %v", size, err)
+		}
+		if (len(encrypted)-2)%16 != 0 {
+			t.Errorf("Expected encrypted length multiple of 16, got %d", len(encrypted)-2)
+		}
+		decrypted, err := decryptSalted(encrypted, []byte("secret"), authenticator)
+		if err != nil || !bytes.Equal(decrypted, value) {
+			t.Errorf("Expected %d bytes decrypted, got %d (%v)", size, len(decrypted), err)
+		}
+	}
+	if _, err := encryptSalted(make([]byte, 240), []byte("secret"), authenticator, [2]byte{0x80, 1}); err == nil {
+		t.Error("Expected error for too long value")
+	}
+	if _, err := decryptSalted(make([]byte, 17), []byte("secret"), authenticator); err == nil {
+		t.Error("Expected error for invalid length")
+	}
+}
+
+// TestTaggedVendorAttribute tests has_tag,encrypt=2 vendor attributes from a dictionary file
+func TestTaggedVendorAttribute(t *testing.T) {
+	dict, err := LoadDictionary(writeTestDictionary(t))
+	if err != nil {
+		t.Fatalf("LoadDictionary failed: %v", err)
+	}
+	request := NewPacket(CodeAccessRequest, []byte("secret"))
+	request.Dictionary = dict
+	accept := testAccessAccept(request)
+	if err := accept.AddTaggedAttr("Acme-Vlan", 3, "vlan-300"); err != nil {
+		t.Fatalf("AddTaggedAttr failed: %v", err)
+	}
+	data, err := accept.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if bytes.Contains(data, []byte("vlan-300")) {
+		t.Error("Expected Acme-Vlan to be encrypted")
+	}
+	received, err := ParsePacket(data, []byte("secret"), dict)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if err := received.DecryptAttrs(request); err != nil {
+		t.Fatalf("DecryptAttrs failed: %v", err)
+	}
+	if v := received.GetTaggedValue("Acme-Vlan", 3); v != "vlan-300" {
+		t.Errorf("Expected Acme-Vlan:3 = vlan-300, got %v", v)
+	}
+}
+
+// TestClientDecryptsTunnelPassword tests that Client decrypts Tunnel-Password in responses
+func TestClientDecryptsTunnelPassword(t *testing.T) {
+	addr, client := testEAPServer(t, HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+		password, _ := Builtin.NewAttr("Tunnel-Password", "tunnel-secret")
+		password.Tag = 1
+		w.AccessAccept(append(TunnelVLAN(1, "100"), password)...)
+	}))
+
+	response, err := client.SendPacket(NewPacket(CodeAccessRequest, []byte("secret")), addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if v := response.GetTaggedValue("Tunnel-Password", 1); v != "tunnel-secret" {
+		t.Errorf("Expected decrypted Tunnel-Password, got %v", v)
+	}
+	if v := response.GetTaggedValue("Tunnel-Private-Group-Id", 1); v != "100" {
+		t.Errorf("Expected Tunnel-Private-Group-Id:1 = 100, got %v", v)
+	}
+}
@@ -0,0 +1,9 @@
+package radius
+
+func init() {
+	builtinOnce.Do(initDictionary)
+	Builtin.MustRegister("Acct-Input-Gigawords", 52, AttributeInteger)
+	Builtin.MustRegister("Acct-Output-Gigawords", 53, AttributeInteger)
+	Builtin.MustRegister("Event-Timestamp", 55, AttributeTime)
+	Builtin.MustRegister("Acct-Interim-Interval", 85, AttributeInteger)
+}
@@ -0,0 +1,145 @@
+package radius
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"errors"
+)
+
+// Message-Authenticator 属性号（RFC 3579 3.2）
+const attrMessageAuthenticator = 80
+
+// ErrMessageAuthenticator 表示 Message-Authenticator 校验失败。
+var ErrMessageAuthenticator = errors.New("radius: invalid Message-Authenticator")
+
+// Message-Authenticator 的值在 Encode 时计算（HMAC-MD5），属性值本身不参与编码。
+type rfc3579MessageAuthenticator struct{}
+
+func (rfc3579MessageAuthenticator) Decode(p *TDataPacket, value []byte) (interface{}, error) {
+	if len(value) != md5.Size {
+		return nil, errors.New("radius: invalid Message-Authenticator attribute length")
+	}
+	v := make([]byte, len(value))
+	copy(v, value)
+	return v, nil
+}
+
+func (rfc3579MessageAuthenticator) Encode(p *TDataPacket, value interface{}) ([]byte, error) {
+	return make([]byte, md5.Size), nil
+}
+
+func (rfc3579MessageAuthenticator) GetCodeName() string {
+	return "RFC3579MessageAuthenticator"
+}
+
+// HasMessageAuthenticator 返回数据包是否带有 Message-Authenticator 属性。
+func (p *TDataPacket) HasMessageAuthenticator() bool {
+	for _, attr := range p.AttrItems {
+		if attr != nil && attr.AttrId == attrMessageAuthenticator && attr.VendorId == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// AddMessageAuthenticator 在属性列表最前面加入 Message-Authenticator，
+// 值由 Encode 计算。已存在时不重复添加。
+//
+// BlastRADIUS 之后建议 Access-Request 及其响应都携带该属性，且放在第一个。
+func (p *TDataPacket) AddMessageAuthenticator() {
+	if p.HasMessageAuthenticator() {
+		return
+	}
+	attr := &TAttribute{AttrId: attrMessageAuthenticator, AttrValue: make([]byte, md5.Size)}
+	p.AttrItems = append([]*TAttribute{attr}, p.AttrItems...)
+}
+
+// 计算 Message-Authenticator 时 Authenticator 字段使用的值：
+//   - Access-Request / Status-Server：请求自身的 Request Authenticator
+//   - Accounting-Request / Disconnect-Request / CoA-Request：16 个 0
+//   - 响应：对应请求的 Request Authenticator
+func messageAuthenticatorBase(code Code, authenticator [16]byte) [16]byte {
+	if isComputedRequest(code) {
+		return [16]byte{}
+	}
+	return authenticator
+}
+
+// 对 wire 计算 HMAC-MD5，offset 为 Message-Authenticator 值在 wire 中的位置，
+// 计算时该位置按 0 处理，Authenticator 字段替换为 authenticator。
+func messageAuthenticator(wire []byte, offset int, authenticator [16]byte, secret []byte) []byte {
+	buff := make([]byte, len(wire))
+	copy(buff, wire)
+	copy(buff[4:20], authenticator[:])
+	for i := offset; i < offset+md5.Size; i++ {
+		buff[i] = 0
+	}
+	mac := hmac.New(md5.New, secret)
+	mac.Write(buff)
+	return mac.Sum(nil)
+}
+
+// 返回第一个 Message-Authenticator 值在 wire 中的位置，没有返回 -1。
+func findMessageAuthenticator(wire []byte) int {
+	offset := 20
+	for offset+2 <= len(wire) {
+		attrLength := int(wire[offset+1])
+		if attrLength < 2 || offset+attrLength > len(wire) {
+			return -1
+		}
+		if wire[offset] == attrMessageAuthenticator && attrLength == md5.Size+2 {
+			return offset + 2
+		}
+		offset += attrLength
+	}
+	return -1
+}
+
+// 校验 wire 中的 Message-Authenticator，没有该属性时返回 true。
+func verifyMessageAuthenticator(wire []byte, authenticator [16]byte, secret []byte) bool {
+	offset := findMessageAuthenticator(wire)
+	if offset < 0 {
+		return true
+	}
+	expected := messageAuthenticator(wire, offset, authenticator, secret)
+	return hmac.Equal(expected, wire[offset:offset+md5.Size])
+}
+
+// EAP-Message 属性号（RFC 3579 3.1）
+const attrEAPMessage = 79
+
+// GetEAPMessage 返回所有 EAP-Message 属性按顺序拼接后的 EAP 数据包，没有时返回nil。
+func (p *TDataPacket) GetEAPMessage() []byte {
+	var msg []byte
+	for _, attr := range p.AttrItems {
+		if attr == nil || attr.AttrId != attrEAPMessage || attr.VendorId != 0 {
+			continue
+		}
+		if value, ok := attr.AttrValue.([]byte); ok {
+			msg = append(msg, value...)
+		}
+	}
+	return msg
+}
+
+// SetEAPMessage 删除已有的 EAP-Message 属性，把 msg 按 253 字节分成多个 EAP-Message 加入数据包。
+func (p *TDataPacket) SetEAPMessage(msg []byte) {
+	items := p.AttrItems[:0]
+	for _, attr := range p.AttrItems {
+		if attr != nil && attr.AttrId == attrEAPMessage && attr.VendorId == 0 {
+			continue
+		}
+		items = append(items, attr)
+	}
+	p.AttrItems = append(items, eapMessageAttrs(msg)...)
+}
+
+// 把 EAP 数据包分成多个 EAP-Message 属性，空数据包（EAP-Start）为一个空属性
+func eapMessageAttrs(msg []byte) []*TAttribute {
+	attrs := make([]*TAttribute, 0, len(msg)/253+1)
+	for len(msg) > 253 {
+		attrs = append(attrs, &TAttribute{AttrId: attrEAPMessage, AttrValue: msg[:253]})
+		msg = msg[253:]
+	}
+	return append(attrs, &TAttribute{AttrId: attrEAPMessage, AttrValue: msg})
+}
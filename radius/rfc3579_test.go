@@ -0,0 +1,284 @@
+package radius
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestMessageAuthenticatorRequest tests Encode and ParsePacket of an Access-Request with Message-Authenticator
+func TestMessageAuthenticatorRequest(t *testing.T) {
+	secret := []byte("secret")
+	packet := NewPacket(CodeAccessRequest, secret)
+	packet.AddAttr("User-Name", "testuser")
+	packet.AddMessageAuthenticator()
+	packet.AddMessageAuthenticator()
+
+	if len(packet.AttrItems) != 2 || packet.AttrItems[0].AttrId != attrMessageAuthenticator {
+		t.Fatalf("Expected Message-Authenticator as the only first attribute, got %v", packet.AttrItems)
+	}
+
+	data, err := packet.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	// HMAC-MD5 over the packet with the value zeroed
+	zeroed := make([]byte, len(data))
+	copy(zeroed, data)
+	copy(zeroed[22:38], make([]byte, 16))
+	mac := hmac.New(md5.New, secret)
+	mac.Write(zeroed)
+	if !bytes.Equal(mac.Sum(nil), data[22:38]) {
+		t.Errorf("Expected HMAC-MD5 %x, got %x", mac.Sum(nil), data[22:38])
+	}
+
+	received, err := ParsePacket(data, secret, Builtin)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if !received.HasMessageAuthenticator() {
+		t.Error("Expected Message-Authenticator in the parsed packet")
+	}
+
+	data[25] ^= 0xff
+	if _, err := ParsePacket(data, secret, Builtin); err != ErrMessageAuthenticator {
+		t.Errorf("Expected ErrMessageAuthenticator, got %v", err)
+	}
+	data[25] ^= 0xff
+	if _, err := ParsePacket(data, []byte("other"), Builtin); err != ErrMessageAuthenticator {
+		t.Errorf("Expected ErrMessageAuthenticator with wrong secret, got %v", err)
+	}
+}
+
+// TestMessageAuthenticatorAccountingRequest tests Message-Authenticator of an Accounting-Request
+func TestMessageAuthenticatorAccountingRequest(t *testing.T) {
+	secret := []byte("secret")
+	packet := NewPacket(CodeAccountingRequest, secret)
+	packet.AddAttr("Acct-Session-Id", "abc")
+	packet.AddMessageAuthenticator()
+
+	data, err := packet.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	received, err := ParsePacket(data, secret, Builtin)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if !received.IsAuthentic(received) {
+		t.Error("Expected authentic Accounting-Request")
+	}
+}
+
+// TestMessageAuthenticatorResponse tests Message-Authenticator of a response
+func TestMessageAuthenticatorResponse(t *testing.T) {
+	secret := []byte("secret")
+	request := NewPacket(CodeAccessRequest, secret)
+	request.AddMessageAuthenticator()
+
+	response := &TDataPacket{
+		Code:          CodeAccessAccept,
+		Identifier:    request.Identifier,
+		Authenticator: request.Authenticator,
+		Secret:        secret,
+		Dictionary:    Builtin,
+	}
+	response.AddAttr("Reply-Message", "welcome")
+	response.AddMessageAuthenticator()
+	data, err := response.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	received, err := ParsePacket(data, secret, Builtin)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if !received.IsAuthentic(request) {
+		t.Error("Expected authentic response")
+	}
+
+	other := NewPacket(CodeAccessRequest, secret)
+	if received.IsAuthentic(other) {
+		t.Error("Expected response to another request not to be authentic")
+	}
+
+	// a Message-Authenticator computed with the wrong request authenticator
+	forged := *response
+	forged.Authenticator = other.Authenticator
+	forgedData, _ := forged.Encode()
+	copy(data[22:38], forgedData[22:38])
+	hash := md5.New()
+	hash.Write(data[:4])
+	hash.Write(request.Authenticator[:])
+	hash.Write(data[20:])
+	hash.Write(secret)
+	copy(data[4:20], hash.Sum(nil))
+	received, err = ParsePacket(data, secret, Builtin)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if received.IsAuthentic(request) {
+		t.Error("Expected response with invalid Message-Authenticator not to be authentic")
+	}
+}
+
+// TestServerRequireMessageAuthenticator tests RequireMessageAuthenticator of Server
+func TestServerRequireMessageAuthenticator(t *testing.T) {
+	server := &Server{
+		ClientsMap: map[string]string{
+			"127.0.0.0/8": "secret",
+		},
+		RequireMessageAuthenticator: []string{"127.0.0.1", "10.0.0.0/8"},
+	}
+	if err := server.ResetClientNets(); err != nil {
+		t.Fatalf("ResetClientNets failed: %v", err)
+	}
+	tests := map[string]bool{
+		"127.0.0.1": true,
+		"127.0.0.2": false,
+		"10.1.2.3":  true,
+	}
+	for ip, expected := range tests {
+		if got := server.IsMessageAuthenticatorRequired(net.ParseIP(ip)); got != expected {
+			t.Errorf("Expected %v for %s, got %v", expected, ip, got)
+		}
+	}
+
+	server.RequireMessageAuthenticator = []string{"invalid"}
+	if err := server.ResetClientNets(); err == nil {
+		t.Error("Expected error for invalid network")
+	}
+}
+
+// TestServerRequireMessageAuthenticatorIntegration tests that requests without Message-Authenticator are dropped
+func TestServerRequireMessageAuthenticatorIntegration(t *testing.T) {
+	secret := []byte("testsecret")
+	server := &Server{
+		Dictionary: Builtin,
+		Handler: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			w.AccessAccept()
+		}),
+		ClientsMap: map[string]string{
+			"127.0.0.1": string(secret),
+		},
+		RequireMessageAuthenticator: []string{"127.0.0.1"},
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	go server.Serve(pc)
+	defer server.Close()
+
+	addr := pc.LocalAddr().String()
+	client := &Client{ReadTimeout: 300 * time.Millisecond}
+	defer client.Close()
+
+	packet := NewPacket(CodeAccessRequest, secret)
+	packet.AddAttr("User-Name", "testuser")
+	if _, err := client.SendPacket(packet, addr); err == nil {
+		t.Error("Expected request without Message-Authenticator to be dropped")
+	}
+
+	packet = NewPacket(CodeAccessRequest, secret)
+	packet.AddAttr("User-Name", "testuser")
+	packet.AddMessageAuthenticator()
+	response, err := client.SendPacket(packet, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessAccept {
+		t.Errorf("Expected Access-Accept, got %d", response.Code)
+	}
+	if !response.HasMessageAuthenticator() || response.AttrItems[0].AttrId != attrMessageAuthenticator {
+		t.Error("Expected Message-Authenticator as first attribute of the response")
+	}
+	if !response.IsAuthentic(packet) {
+		t.Error("Expected authentic response")
+	}
+}
+
+// TestServerRequireMessageAuthenticatorClientNets tests RequireMessageAuthenticator of a server without ClientsMap
+func TestServerRequireMessageAuthenticatorClientNets(t *testing.T) {
+	secret := []byte("testsecret")
+	_, subnet, _ := net.ParseCIDR("127.0.0.0/8")
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	server := &Server{
+		Dictionary: Builtin,
+		Handler: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			w.AccessAccept()
+		}),
+		ClientNets:                  []net.IPNet{*subnet},
+		ClientSecrets:               [][]byte{secret},
+		RequireMessageAuthenticator: []string{"127.0.0.1"},
+	}
+	go server.Serve(conn)
+	defer server.Close()
+
+	client := &Client{ReadTimeout: 300 * time.Millisecond}
+	defer client.Close()
+	packet := NewPacket(CodeAccessRequest, secret)
+	packet.AddAttr("User-Name", "testuser")
+	if _, err := client.SendPacket(packet, conn.LocalAddr().String()); err == nil {
+		t.Error("Expected request without Message-Authenticator to be dropped")
+	}
+
+	packet = NewPacket(CodeAccessRequest, secret)
+	packet.AddAttr("User-Name", "testuser")
+	packet.AddMessageAuthenticator()
+	if response, err := client.SendPacket(packet, conn.LocalAddr().String()); err != nil || response.Code != CodeAccessAccept {
+		t.Errorf("Expected Access-Accept, got %v, %v", response, err)
+	}
+}
+
+// TestEAPMessage tests splitting and joining EAP-Message attributes
+func TestEAPMessage(t *testing.T) {
+	msg := make([]byte, 600)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	packet := NewPacket(CodeAccessRequest, []byte("secret"))
+	packet.AddAttr("User-Name", "testuser")
+	packet.SetEAPMessage([]byte("old"))
+	packet.SetEAPMessage(msg)
+	packet.AddMessageAuthenticator()
+
+	var count int
+	for _, attr := range packet.AttrItems {
+		if attr.AttrId == attrEAPMessage {
+			count++
+		}
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 EAP-Message attributes, got %d", count)
+	}
+
+	data, err := packet.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	parsed, err := ParsePacket(data, []byte("secret"), Builtin)
+	if err != nil {
+		t.Fatalf("ParsePacket failed: %v", err)
+	}
+	if !bytes.Equal(parsed.GetEAPMessage(), msg) {
+		t.Error("Expected EAP message to be reassembled")
+	}
+	if parsed.GetString("User-Name") != "testuser" {
+		t.Error("Expected other attributes to be kept")
+	}
+
+	// EAP-Start is a single empty EAP-Message
+	packet.SetEAPMessage(nil)
+	if packet.FindAttr("EAP-Message") == nil || len(packet.GetEAPMessage()) != 0 {
+		t.Error("Expected empty EAP-Message for EAP-Start")
+	}
+}
@@ -0,0 +1,132 @@
+package radius
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// EAP（RFC 3748）数据包和 EAP-MD5 认证方法。
+
+// EAP 数据包的 Code
+type EAPCode byte
+
+const (
+	EAPCodeRequest  EAPCode = 1
+	EAPCodeResponse EAPCode = 2
+	EAPCodeSuccess  EAPCode = 3
+	EAPCodeFailure  EAPCode = 4
+)
+
+// EAP 类型
+const (
+	EAPTypeIdentity     byte = 1
+	EAPTypeNotification byte = 2
+	EAPTypeNak          byte = 3
+	EAPTypeMD5          byte = 4
+	EAPTypeTLS          byte = 13
+	EAPTypePEAP         byte = 25
+	EAPTypeMSCHAPv2     byte = 26
+	EAPTypeExtensions   byte = 33
+)
+
+// TEAPPacket 是一个 EAP 数据包，Success/Failure 没有 Type 和 Data。
+type TEAPPacket struct {
+	Code       EAPCode
+	Identifier byte
+	Type       byte
+	Data       []byte // Type-Data
+}
+
+// ParseEAPPacket 解析 EAP 数据包
+func ParseEAPPacket(b []byte) (*TEAPPacket, error) {
+	if len(b) < 4 {
+		return nil, errors.New("radius: EAP packet is too short")
+	}
+	length := int(binary.BigEndian.Uint16(b[2:4]))
+	if length < 4 || length > len(b) {
+		return nil, fmt.Errorf("radius: invalid EAP packet length %d", length)
+	}
+	e := &TEAPPacket{
+		Code:       EAPCode(b[0]),
+		Identifier: b[1],
+	}
+	switch e.Code {
+	case EAPCodeRequest, EAPCodeResponse:
+		if length < 5 {
+			return nil, errors.New("radius: EAP packet has no type")
+		}
+		e.Type = b[4]
+		e.Data = append([]byte(nil), b[5:length]...)
+	case EAPCodeSuccess, EAPCodeFailure:
+	default:
+		return nil, fmt.Errorf("radius: unknown EAP code %d", e.Code)
+	}
+	return e, nil
+}
+
+// Encode 返回 EAP 数据包的二进制格式
+func (e *TEAPPacket) Encode() []byte {
+	if e.Code == EAPCodeSuccess || e.Code == EAPCodeFailure {
+		return []byte{byte(e.Code), e.Identifier, 0, 4}
+	}
+	b := make([]byte, 5+len(e.Data))
+	b[0] = byte(e.Code)
+	b[1] = e.Identifier
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(b)))
+	b[4] = e.Type
+	copy(b[5:], e.Data)
+	return b
+}
+
+func (e *TEAPPacket) String() string {
+	return fmt.Sprintf("EAP(Code=%d, Id=%d, Type=%d, Len=%d)", e.Code, e.Identifier, e.Type, len(e.Data))
+}
+
+// EAPMD5 返回 EAP-MD5（RFC 3748 5.4）认证方法，password 返回用户的明文密码。
+// EAP-MD5 不导出密钥，不能用于 WPA 企业级无线认证。
+func EAPMD5(password func(identity string) (string, error)) TEAPMethod {
+	return TEAPMethod{
+		Type: EAPTypeMD5,
+		New: func(identity string) (IEAPMethod, error) {
+			secret, err := password(identity)
+			if err != nil {
+				return nil, err
+			}
+			return &eapMD5{password: secret}, nil
+		},
+	}
+}
+
+type eapMD5 struct {
+	password  string
+	challenge []byte
+}
+
+func (m *eapMD5) Start() ([]byte, error) {
+	m.challenge = make([]byte, md5.Size)
+	if _, err := rand.Read(m.challenge); err != nil {
+		return nil, err
+	}
+	// Value-Size(1) Value(16)
+	return append([]byte{md5.Size}, m.challenge...), nil
+}
+
+func (m *eapMD5) Process(response *TEAPPacket) ([]byte, bool, error) {
+	if len(response.Data) < 1+md5.Size || response.Data[0] != md5.Size {
+		return nil, true, errors.New("radius: invalid EAP-MD5 response")
+	}
+	// CHAP 算法，Ident 为 EAP 请求的 Identifier
+	expected := chapResponse(response.Identifier, m.password, m.challenge)
+	if subtle.ConstantTimeCompare(expected, response.Data[1:1+md5.Size]) != 1 {
+		return nil, true, ErrAuthFailed
+	}
+	return nil, true, nil
+}
+
+func (m *eapMD5) MSK() []byte {
+	return nil
+}
@@ -0,0 +1,84 @@
+package radius
+
+import (
+	"bytes"
+	"crypto/md5"
+	"testing"
+)
+
+// testEAPMD5Response returns the EAP-MD5 Type-Data answering request
+func testEAPMD5Response(request *TEAPPacket, password string) []byte {
+	return append([]byte{md5.Size}, chapResponse(request.Identifier, password, request.Data[1:1+md5.Size])...)
+}
+
+// TestEAPPacket tests ParseEAPPacket and Encode
+func TestEAPPacket(t *testing.T) {
+	packet := &TEAPPacket{Code: EAPCodeResponse, Identifier: 7, Type: EAPTypeIdentity, Data: []byte("alice")}
+	data := packet.Encode()
+	if !bytes.Equal(data, []byte{2, 7, 0, 10, 1, 'a', 'l', 'i', 'c', 'e'}) {
+		t.Errorf("Unexpected encoding %x", data)
+	}
+	parsed, err := ParseEAPPacket(append(data, 0, 0)) // padding after Length is ignored
+	if err != nil {
+		t.Fatalf("ParseEAPPacket failed: %v", err)
+	}
+	if parsed.Code != EAPCodeResponse || parsed.Identifier != 7 || parsed.Type != EAPTypeIdentity || string(parsed.Data) != "alice" {
+		t.Errorf("Unexpected packet %s", parsed)
+	}
+
+	success := (&TEAPPacket{Code: EAPCodeSuccess, Identifier: 3}).Encode()
+	if !bytes.Equal(success, []byte{3, 3, 0, 4}) {
+		t.Errorf("Unexpected EAP-Success %x", success)
+	}
+
+	for _, invalid := range [][]byte{
+		{1, 1, 0},
+		{1, 1, 0, 9, 1},
+		{1, 1, 0, 4},
+		{9, 1, 0, 4},
+	} {
+		if _, err := ParseEAPPacket(invalid); err == nil {
+			t.Errorf("Expected error for %x", invalid)
+		}
+	}
+}
+
+// TestEAPMD5 tests EAP-MD5 authentication through EAPHandler
+func TestEAPMD5(t *testing.T) {
+	handler := &EAPHandler{
+		Methods: []TEAPMethod{EAPMD5(func(identity string) (string, error) {
+			if identity != "alice" {
+				return "", ErrAuthFailed
+			}
+			return "password", nil
+		})},
+	}
+
+	c := newTestEAPConversation(t, handler)
+	c.respond(EAPTypeIdentity, []byte("alice"))
+	if c.request.Type != EAPTypeMD5 || len(c.request.Data) != 1+md5.Size {
+		t.Fatalf("Expected EAP-MD5 challenge, got %s", c.request)
+	}
+	identifier := c.request.Identifier
+	response := c.respond(EAPTypeMD5, testEAPMD5Response(c.request, "password"))
+	if response.Code != CodeAccessAccept || c.request.Code != EAPCodeSuccess || c.request.Identifier != identifier {
+		t.Fatalf("Expected Access-Accept with EAP-Success, got %d %s", response.Code, c.request)
+	}
+	if response.GetString("User-Name") != "alice" {
+		t.Errorf("Expected User-Name alice, got %q", response.GetString("User-Name"))
+	}
+	if response.GetVendorAttr(VendorMicrosoft, MSMPPERecvKey) != nil {
+		t.Error("Expected no MPPE keys for EAP-MD5")
+	}
+
+	c = newTestEAPConversation(t, handler)
+	c.respond(EAPTypeIdentity, []byte("alice"))
+	if response := c.respond(EAPTypeMD5, testEAPMD5Response(c.request, "wrong")); response.Code != CodeAccessReject || c.request.Code != EAPCodeFailure {
+		t.Errorf("Expected Access-Reject with EAP-Failure, got %d", response.Code)
+	}
+
+	c = newTestEAPConversation(t, handler)
+	if response := c.respond(EAPTypeIdentity, []byte("bob")); response.Code != CodeAccessReject {
+		t.Errorf("Expected Access-Reject for unknown user, got %d", response.Code)
+	}
+}
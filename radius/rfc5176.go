@@ -0,0 +1,100 @@
+package radius
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Dynamic Authorization（RFC 5176）的默认端口
+const CoAPort = 3799
+
+func init() {
+	builtinOnce.Do(initDictionary)
+	Builtin.MustRegister("Error-Cause", 101, AttributeInteger)
+
+	// RFC 5176 3.5 枚举值
+	Builtin.MustRegisterValue("Error-Cause", "Residual-Session-Context-Removed", 201)
+	Builtin.MustRegisterValue("Error-Cause", "Invalid-EAP-Packet", 202)
+	Builtin.MustRegisterValue("Error-Cause", "Unsupported-Attribute", 401)
+	Builtin.MustRegisterValue("Error-Cause", "Missing-Attribute", 402)
+	Builtin.MustRegisterValue("Error-Cause", "NAS-Identification-Mismatch", 403)
+	Builtin.MustRegisterValue("Error-Cause", "Invalid-Request", 404)
+	Builtin.MustRegisterValue("Error-Cause", "Unsupported-Service", 405)
+	Builtin.MustRegisterValue("Error-Cause", "Unsupported-Extension", 406)
+	Builtin.MustRegisterValue("Error-Cause", "Invalid-Attribute-Value", 407)
+	Builtin.MustRegisterValue("Error-Cause", "Administratively-Prohibited", 501)
+	Builtin.MustRegisterValue("Error-Cause", "Request-Not-Routable", 502)
+	Builtin.MustRegisterValue("Error-Cause", "Session-Context-Not-Found", 503)
+	Builtin.MustRegisterValue("Error-Cause", "Session-Context-Not-Removable", 504)
+	Builtin.MustRegisterValue("Error-Cause", "Other-Proxy-Processing-Error", 505)
+	Builtin.MustRegisterValue("Error-Cause", "Resources-Unavailable", 506)
+	Builtin.MustRegisterValue("Error-Cause", "Request-Initiated", 507)
+	Builtin.MustRegisterValue("Error-Cause", "Multiple-Session-Selection-Unsupported", 508)
+
+	Builtin.MustRegisterValue("Service-Type", "Authorize-Only", 17)
+}
+
+// TNakError 表示 NAS 返回了 Disconnect-NAK 或 CoA-NAK。
+type TNakError struct {
+	Code       Code
+	ErrorCause uint32 // 响应中的 Error-Cause，没有时为0
+}
+
+func (e *TNakError) Error() string {
+	name := "CoA-NAK"
+	if e.Code == CodeDisconnectNAK {
+		name = "Disconnect-NAK"
+	}
+	if e.ErrorCause == 0 {
+		return fmt.Sprintf("radius: %s", name)
+	}
+	cause, ok := Builtin.GetValueName("Error-Cause", e.ErrorCause)
+	if !ok {
+		cause = strconv.Itoa(int(e.ErrorCause))
+	}
+	return fmt.Sprintf("radius: %s, Error-Cause = %s", name, cause)
+}
+
+// Disconnect 向 NAS 发送 Disconnect-Request，让 NAS 断开指定的会话。
+// attributes 用于标识会话，如 User-Name、Acct-Session-Id、Framed-IP-Address，
+// addr 没有端口时使用 3799。
+//
+// NAS 返回 Disconnect-NAK 时同时返回响应和 *TNakError。
+//
+//	attr, _ := radius.Builtin.NewAttr("Acct-Session-Id", sessionID)
+//	_, err := client.Disconnect("10.0.0.1", secret, attr)
+func (c *Client) Disconnect(addr string, secret []byte, attributes ...*TAttribute) (*TDataPacket, error) {
+	return c.dynamicAuthorization(CodeDisconnectRequest, addr, secret, attributes)
+}
+
+// CoA 向 NAS 发送 CoA-Request，修改指定会话的授权属性（如 Session-Timeout、Filter-Id）。
+// addr 没有端口时使用 3799，NAS 返回 CoA-NAK 时同时返回响应和 *TNakError。
+func (c *Client) CoA(addr string, secret []byte, attributes ...*TAttribute) (*TDataPacket, error) {
+	return c.dynamicAuthorization(CodeCoARequest, addr, secret, attributes)
+}
+
+func (c *Client) dynamicAuthorization(code Code, addr string, secret []byte, attributes []*TAttribute) (*TDataPacket, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, strconv.Itoa(CoAPort))
+	}
+
+	packet := NewPacket(code, secret)
+	if packet == nil {
+		return nil, fmt.Errorf("radius: generate packet failed")
+	}
+	packet.AttrItems = attributes
+
+	response, err := c.SendPacket(packet, addr)
+	if err != nil {
+		return nil, err
+	}
+	switch response.Code {
+	case CodeDisconnectACK, CodeCoAACK:
+		return response, nil
+	case CodeDisconnectNAK, CodeCoANAK:
+		cause, _ := response.GetValue("Error-Cause").(uint32)
+		return response, &TNakError{Code: response.Code, ErrorCause: cause}
+	}
+	return response, fmt.Errorf("radius: unexpected response code %d", response.Code)
+}
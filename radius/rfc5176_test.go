@@ -0,0 +1,177 @@
+package radius
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDisconnectRequestEncode tests the Request Authenticator of Disconnect-Request and CoA-Request
+func TestDisconnectRequestEncode(t *testing.T) {
+	secret := []byte("secret")
+	for _, code := range []Code{CodeDisconnectRequest, CodeCoARequest} {
+		packet := NewPacket(code, secret)
+		packet.AddAttr("Acct-Session-Id", "abc")
+		packet.AddMessageAuthenticator()
+		data, err := packet.Encode()
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+
+		hash := md5.New()
+		hash.Write(data[:4])
+		hash.Write(make([]byte, 16))
+		hash.Write(data[20:])
+		hash.Write(secret)
+		if !bytes.Equal(hash.Sum(nil), data[4:20]) {
+			t.Errorf("Expected Request Authenticator %x, got %x", hash.Sum(nil), data[4:20])
+		}
+
+		received, err := ParsePacket(data, secret, Builtin)
+		if err != nil {
+			t.Fatalf("ParsePacket failed: %v", err)
+		}
+		if received.Code != code || !received.IsAuthentic(received) {
+			t.Errorf("Expected authentic request with code %d", code)
+		}
+		if _, err := ParsePacket(data, []byte("other"), Builtin); err != ErrMessageAuthenticator {
+			t.Errorf("Expected ErrMessageAuthenticator, got %v", err)
+		}
+	}
+}
+
+// TestNakError tests the message of TNakError
+func TestNakError(t *testing.T) {
+	tests := []struct {
+		err      *TNakError
+		expected string
+	}{
+		{&TNakError{Code: CodeDisconnectNAK, ErrorCause: 503}, "radius: Disconnect-NAK, Error-Cause = Session-Context-Not-Found"},
+		{&TNakError{Code: CodeCoANAK, ErrorCause: 999}, "radius: CoA-NAK, Error-Cause = 999"},
+		{&TNakError{Code: CodeCoANAK}, "radius: CoA-NAK"},
+	}
+	for _, tt := range tests {
+		if tt.err.Error() != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, tt.err.Error())
+		}
+	}
+}
+
+// TestDynamicAuthorization tests Client.Disconnect and Client.CoA against a server emulating a NAS
+func TestDynamicAuthorization(t *testing.T) {
+	secret := []byte("testsecret")
+	server := &Server{
+		Dictionary: Builtin,
+		Handler: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			if !p.IsAuthentic(p) {
+				return
+			}
+			cause, _ := Builtin.NewAttr("Error-Cause", "Session-Context-Not-Found")
+			found := p.GetString("Acct-Session-Id") == "abc"
+			switch {
+			case p.Code == CodeDisconnectRequest && found:
+				w.DisconnectACK()
+			case p.Code == CodeDisconnectRequest:
+				w.DisconnectNAK(cause)
+			case p.Code == CodeCoARequest && found:
+				w.CoAACK()
+			case p.Code == CodeCoARequest:
+				w.CoANAK(cause)
+			}
+		}),
+		ClientsMap: map[string]string{
+			"127.0.0.1": string(secret),
+		},
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	go server.Serve(pc)
+	defer server.Close()
+
+	addr := pc.LocalAddr().String()
+	client := &Client{ReadTimeout: time.Second}
+	defer client.Close()
+
+	session, _ := Builtin.NewAttr("Acct-Session-Id", "abc")
+	response, err := client.Disconnect(addr, secret, session)
+	if err != nil {
+		t.Fatalf("Disconnect failed: %v", err)
+	}
+	if response.Code != CodeDisconnectACK {
+		t.Errorf("Expected Disconnect-ACK, got %d", response.Code)
+	}
+
+	timeout, _ := Builtin.NewAttr("Session-Timeout", uint32(60))
+	response, err = client.CoA(addr, secret, session, timeout)
+	if err != nil {
+		t.Fatalf("CoA failed: %v", err)
+	}
+	if response.Code != CodeCoAACK {
+		t.Errorf("Expected CoA-ACK, got %d", response.Code)
+	}
+
+	other, _ := Builtin.NewAttr("Acct-Session-Id", "other")
+	response, err = client.Disconnect(addr, secret, other)
+	var nak *TNakError
+	if !errors.As(err, &nak) || nak.Code != CodeDisconnectNAK || nak.ErrorCause != 503 {
+		t.Fatalf("Expected Disconnect-NAK with Error-Cause 503, got %v", err)
+	}
+	if response == nil || response.GetValueName("Error-Cause") != "Session-Context-Not-Found" {
+		t.Error("Expected the Disconnect-NAK response")
+	}
+
+	_, err = client.CoA(addr, secret, other)
+	if !errors.As(err, &nak) || nak.Code != CodeCoANAK {
+		t.Errorf("Expected CoA-NAK, got %v", err)
+	}
+}
+
+// TestDynamicAuthorizationForged tests that Disconnect-Request and CoA-Request with a forged authenticator are dropped
+func TestDynamicAuthorizationForged(t *testing.T) {
+	secret := []byte("secret")
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	var handled int32
+	server := &Server{
+		Dictionary: Builtin,
+		Handler: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			atomic.AddInt32(&handled, 1)
+			w.DisconnectACK()
+		}),
+		ClientsMap: map[string]string{"127.0.0.1": string(secret)},
+	}
+	go server.Serve(conn)
+	defer server.Close()
+	addr := conn.LocalAddr().String()
+
+	client := &Client{ReadTimeout: 300 * time.Millisecond}
+	defer client.Close()
+	session, _ := Builtin.NewAttr("Acct-Session-Id", "abc")
+	if _, err := client.Disconnect(addr, []byte("forged"), session); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected forged Disconnect-Request to be dropped, got %v", err)
+	}
+	if _, err := client.CoA(addr, []byte("forged"), session); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected forged CoA-Request to be dropped, got %v", err)
+	}
+	if n := atomic.LoadInt32(&handled); n != 0 {
+		t.Errorf("Expected forged requests not to reach the handler, got %d", n)
+	}
+	if stats := server.Stats(); stats.AuthInvalid != 2 {
+		t.Errorf("Expected 2 invalid requests, got %d", stats.AuthInvalid)
+	}
+
+	if _, err := client.Disconnect(addr, secret, session); err != nil {
+		t.Errorf("Disconnect failed: %v", err)
+	}
+	if n := atomic.LoadInt32(&handled); n != 1 {
+		t.Errorf("Expected 1 request handled, got %d", n)
+	}
+}
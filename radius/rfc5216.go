@@ -0,0 +1,340 @@
+package radius
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EAP-TLS（RFC 5216）。
+//
+// TLS 握手由 crypto/tls 在单独的协程中完成，tlsPipe 把它的读写转为 EAP 消息：
+// TLS 读取时协程等待下一个 EAP-Response，写入的数据在回复 EAP-Request 时发出，
+// 超过 eapTLSFragmentSize 的数据按 RFC 5216 2.1.5 分片。只支持 TLS 1.2 及以下版本。
+
+// EAP-TLS 标志（RFC 5216 3.1），PEAP 在低3位带版本号
+const (
+	eapTLSFlagLength byte = 0x80
+	eapTLSFlagMore   byte = 0x40
+	eapTLSFlagStart  byte = 0x20
+)
+
+const (
+	// 每个 EAP-TLS 分片的最大长度，EAP-Message 拆分后仍在 RADIUS 包长度内
+	eapTLSFragmentSize = 1000
+	// 重组后的 TLS 消息最大长度
+	eapTLSMaxMessage = 64 * 1024
+)
+
+// RFC 5216 2.3 导出 MSK 使用的标签，PEAPv0 相同
+const eapTLSKeyLabel = "client EAP encryption"
+
+// tlsPipe 是 crypto/tls 使用的 net.Conn，读取时通知调用方并等待 feed 的数据，
+// 写入的数据缓存到 takeOutput 取走。
+type tlsPipe struct {
+	in        chan []byte
+	wait      chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	done      chan error
+	pending   []byte
+
+	mu  sync.Mutex
+	out []byte
+
+	finished bool  // 协程已经结束
+	result   error // 协程的返回值
+}
+
+func newTLSPipe() *tlsPipe {
+	return &tlsPipe{
+		in:     make(chan []byte),
+		wait:   make(chan struct{}),
+		closed: make(chan struct{}),
+		done:   make(chan error, 1),
+	}
+}
+
+// start 在协程中执行 run，返回时 run 已经在等待数据或者已经结束
+func (p *tlsPipe) start(run func(conn net.Conn) error) {
+	go func() {
+		p.done <- run(p)
+	}()
+	p.step()
+}
+
+// feed 把收到的数据交给协程，返回时协程已经在等待下一个数据或者已经结束
+func (p *tlsPipe) feed(data []byte) {
+	if p.finished {
+		return
+	}
+	select {
+	case p.in <- data:
+		p.step()
+	case err := <-p.done:
+		p.finished, p.result = true, err
+	}
+}
+
+func (p *tlsPipe) step() {
+	select {
+	case <-p.wait:
+	case err := <-p.done:
+		p.finished, p.result = true, err
+	}
+}
+
+func (p *tlsPipe) takeOutput() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := p.out
+	p.out = nil
+	return out
+}
+
+func (p *tlsPipe) Read(b []byte) (int, error) {
+	if len(p.pending) == 0 {
+		select {
+		case p.wait <- struct{}{}:
+		case <-p.closed:
+			return 0, io.EOF
+		}
+		select {
+		case p.pending = <-p.in:
+		case <-p.closed:
+			return 0, io.EOF
+		}
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+func (p *tlsPipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.out = append(p.out, b...)
+	return len(b), nil
+}
+
+// Close 结束协程中的读取
+func (p *tlsPipe) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+	return nil
+}
+
+func (p *tlsPipe) LocalAddr() net.Addr                { return eapAddr{} }
+func (p *tlsPipe) RemoteAddr() net.Addr               { return eapAddr{} }
+func (p *tlsPipe) SetDeadline(t time.Time) error      { return nil }
+func (p *tlsPipe) SetReadDeadline(t time.Time) error  { return nil }
+func (p *tlsPipe) SetWriteDeadline(t time.Time) error { return nil }
+
+type eapAddr struct{}
+
+func (eapAddr) Network() string { return "eap" }
+func (eapAddr) String() string  { return "eap" }
+
+// eapTLSEndpoint 是 EAP-TLS 会话的一端，负责分片、重组以及和 tlsPipe 的数据交换，
+// 服务端和客户端（测试中）共用。
+type eapTLSEndpoint struct {
+	version byte // PEAP 版本号，EAP-TLS 为0
+	pipe    *tlsPipe
+
+	in       []byte // 正在重组的消息
+	out      []byte // 还没有发送的数据
+	outFirst bool   // out 的第一个分片需要带 L 标志
+}
+
+// process 处理对端的 Type-Data，返回回复的 Type-Data
+func (e *eapTLSEndpoint) process(data []byte) ([]byte, error) {
+	if len(data) < 1 {
+		return nil, errors.New("radius: invalid EAP-TLS message")
+	}
+	flags := data[0]
+	data = data[1:]
+	if flags&eapTLSFlagLength != 0 {
+		if len(data) < 4 {
+			return nil, errors.New("radius: invalid EAP-TLS message length")
+		}
+		if binary.BigEndian.Uint32(data) > eapTLSMaxMessage {
+			return nil, errors.New("radius: EAP-TLS message is too long")
+		}
+		data = data[4:]
+	}
+	if len(e.in)+len(data) > eapTLSMaxMessage {
+		return nil, errors.New("radius: EAP-TLS message is too long")
+	}
+	e.in = append(e.in, data...)
+	if flags&eapTLSFlagMore != 0 {
+		// 确认收到分片
+		return []byte{e.version}, nil
+	}
+
+	message := e.in
+	e.in = nil
+	if len(message) > 0 {
+		e.pipe.feed(message)
+	}
+	return e.next(), nil
+}
+
+// next 返回下一个分片，没有数据时返回确认
+func (e *eapTLSEndpoint) next() []byte {
+	if len(e.out) == 0 {
+		if e.out = e.pipe.takeOutput(); len(e.out) == 0 {
+			return []byte{e.version}
+		}
+		e.outFirst = len(e.out) > eapTLSFragmentSize
+	}
+
+	flags := e.version
+	var header []byte
+	if e.outFirst {
+		flags |= eapTLSFlagLength
+		header = binary.BigEndian.AppendUint32(nil, uint32(len(e.out)))
+		e.outFirst = false
+	}
+	chunk := e.out
+	if len(chunk) > eapTLSFragmentSize {
+		chunk = chunk[:eapTLSFragmentSize]
+		flags |= eapTLSFlagMore
+	}
+	e.out = e.out[len(chunk):]
+
+	reply := append([]byte{flags}, header...)
+	return append(reply, chunk...)
+}
+
+// pending 返回是否还有数据没有发送
+func (e *eapTLSEndpoint) pending() bool {
+	return len(e.out) > 0
+}
+
+// EAPTLS 返回 EAP-TLS 认证方法，config 必须带有服务器证书。
+// config 没有设置 ClientAuth 时要求并校验客户端证书（ClientCAs 为空时使用系统根证书）。
+// EAP-Response/Identity 必须是校验过的客户端证书的 CN、DNS SAN 或 Email SAN（不区分大小写），
+// 否则握手失败；config.VerifyConnection 在这之前调用，可以做其它检查。
+func EAPTLS(config *tls.Config) TEAPMethod {
+	return TEAPMethod{
+		Type: EAPTypeTLS,
+		New: func(identity string) (IEAPMethod, error) {
+			c, err := eapTLSConfig(config)
+			if err != nil {
+				return nil, err
+			}
+			if c.ClientAuth == tls.NoClientCert {
+				c.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			verify := c.VerifyConnection
+			c.VerifyConnection = func(state tls.ConnectionState) error {
+				if verify != nil {
+					if err := verify(state); err != nil {
+						return err
+					}
+				}
+				return verifyEAPTLSIdentity(state, identity)
+			}
+			return newEAPTLSMethod(c, 0, nil), nil
+		},
+	}
+}
+
+// 身份由客户端选择，必须与校验过的证书一致，否则持有任意有效证书的客户端都可以冒充其它用户
+func verifyEAPTLSIdentity(state tls.ConnectionState, identity string) error {
+	if len(state.VerifiedChains) == 0 {
+		return errors.New("radius: EAP-TLS client certificate is not verified")
+	}
+	cert := state.VerifiedChains[0][0]
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, name := range append(names, cert.EmailAddresses...) {
+		if name != "" && strings.EqualFold(name, identity) {
+			return nil
+		}
+	}
+	return fmt.Errorf("radius: EAP-TLS identity %s does not match the client certificate", identity)
+}
+
+// 复制服务端配置，限制为 TLS 1.2（EAP-TLS 1.3 见 RFC 9190，尚不支持）并禁用会话票据
+func eapTLSConfig(config *tls.Config) (*tls.Config, error) {
+	if config == nil || (len(config.Certificates) == 0 && config.GetCertificate == nil) {
+		return nil, errors.New("EAP-TLS/PEAP 需要配置服务器证书(tls.Config)。")
+	}
+	c := config.Clone()
+	c.MaxVersion = tls.VersionTLS12
+	c.SessionTicketsDisabled = true
+	return c, nil
+}
+
+// eapTLSMethod 是服务端的 EAP-TLS 会话，tunnel 不为nil时握手后在隧道内继续认证（PEAP）
+type eapTLSMethod struct {
+	eapTLSEndpoint
+	config *tls.Config
+	tunnel func(conn *tls.Conn) error
+	msk    []byte
+}
+
+func newEAPTLSMethod(config *tls.Config, version byte, tunnel func(conn *tls.Conn) error) *eapTLSMethod {
+	return &eapTLSMethod{
+		eapTLSEndpoint: eapTLSEndpoint{version: version, pipe: newTLSPipe()},
+		config:         config,
+		tunnel:         tunnel,
+	}
+}
+
+func (m *eapTLSMethod) Start() ([]byte, error) {
+	m.pipe.start(m.run)
+	if m.pipe.finished {
+		return nil, m.pipe.result
+	}
+	return []byte{eapTLSFlagStart | m.version}, nil
+}
+
+// 在协程中执行：TLS 握手、导出 MSK、隧道内认证
+func (m *eapTLSMethod) run(conn net.Conn) error {
+	tlsConn := tls.Server(conn, m.config)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	state := tlsConn.ConnectionState()
+	keys, err := state.ExportKeyingMaterial(eapTLSKeyLabel, nil, 128)
+	if err != nil {
+		return err
+	}
+	m.msk = keys[:64]
+	if m.tunnel != nil {
+		return m.tunnel(tlsConn)
+	}
+	return nil
+}
+
+func (m *eapTLSMethod) Process(response *TEAPPacket) ([]byte, bool, error) {
+	reply, err := m.process(response.Data)
+	if err != nil {
+		return nil, true, err
+	}
+	// 对端只在收到分片或最后的消息后确认，协程还在等待数据时说明对端已经放弃
+	if len(response.Data) == 1 && len(reply) == 1 && !m.pipe.finished {
+		return nil, true, errors.New("radius: unexpected EAP-TLS acknowledgement")
+	}
+	// 所有数据都已经发送并得到确认后才结束
+	if m.pipe.finished && !m.pending() && len(reply) == 1 {
+		return nil, true, m.pipe.result
+	}
+	return reply, false, nil
+}
+
+func (m *eapTLSMethod) MSK() []byte {
+	return m.msk
+}
+
+func (m *eapTLSMethod) Close() error {
+	return m.pipe.Close()
+}
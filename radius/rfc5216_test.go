@@ -0,0 +1,206 @@
+package radius
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// testEAPTLSPeer is the supplicant side of EAP-TLS/PEAP, tunnel runs after the handshake
+type testEAPTLSPeer struct {
+	eapTLSEndpoint
+	config *tls.Config
+	tunnel func(conn *tls.Conn) error
+	msk    []byte
+}
+
+func newTestEAPTLSPeer(config *tls.Config, tunnel func(conn *tls.Conn) error) *testEAPTLSPeer {
+	return &testEAPTLSPeer{eapTLSEndpoint: eapTLSEndpoint{pipe: newTLSPipe()}, config: config, tunnel: tunnel}
+}
+
+// process returns the Type-Data answering the server's request
+func (p *testEAPTLSPeer) process(data []byte) []byte {
+	if data[0]&eapTLSFlagStart != 0 {
+		p.pipe.start(func(conn net.Conn) error {
+			tlsConn := tls.Client(conn, p.config)
+			if err := tlsConn.Handshake(); err != nil {
+				return err
+			}
+			state := tlsConn.ConnectionState()
+			keys, err := state.ExportKeyingMaterial(eapTLSKeyLabel, nil, 64)
+			if err != nil {
+				return err
+			}
+			p.msk = keys
+			if p.tunnel != nil {
+				return p.tunnel(tlsConn)
+			}
+			return nil
+		})
+		return p.next()
+	}
+	reply, _ := p.eapTLSEndpoint.process(data)
+	return reply
+}
+
+// run answers requests of eapType until the server accepts or rejects
+func (p *testEAPTLSPeer) run(c *testEAPConversation, eapType byte) (*TDataPacket, int) {
+	c.t.Helper()
+	defer p.pipe.Close()
+	rounds := 0
+	for {
+		if c.request.Code != EAPCodeRequest {
+			return c.packet, rounds
+		}
+		if c.request.Type != eapType {
+			c.t.Fatalf("Expected EAP type %d, got %s", eapType, c.request)
+		}
+		c.respond(eapType, p.process(c.request.Data))
+		rounds++
+		if rounds > 50 {
+			c.t.Fatal("Too many EAP rounds")
+		}
+	}
+}
+
+// testEAPTLSConfigs returns server and client TLS configs signed by a common CA
+func testEAPTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	ca := testCertificate(t, "ca", nil, true)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	// the CA in the chain makes the server flight larger than one fragment
+	serverCert := testCertificate(t, "server", &ca, false)
+	serverCert.Certificate = append(serverCert.Certificate, ca.Certificate[0])
+	server := &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientCAs: pool}
+	client := &tls.Config{
+		RootCAs:      pool,
+		ServerName:   "127.0.0.1",
+		Certificates: []tls.Certificate{testCertificate(t, "alice", &ca, false)},
+	}
+	return server, client
+}
+
+// TestEAPTLSEndpointFragments tests fragmentation and reassembly of EAP-TLS messages
+func TestEAPTLSEndpointFragments(t *testing.T) {
+	sender := &eapTLSEndpoint{pipe: newTLSPipe()}
+	message := bytes.Repeat([]byte{0xab}, 2*eapTLSFragmentSize+10)
+	sender.pipe.Write(message)
+
+	receiver := &eapTLSEndpoint{pipe: newTLSPipe()}
+	var received []byte
+	receiver.pipe.start(func(conn net.Conn) error {
+		buff := make([]byte, len(message))
+		n, err := conn.Read(buff)
+		received = buff[:n]
+		return err
+	})
+
+	first := sender.next()
+	if first[0] != eapTLSFlagLength|eapTLSFlagMore || len(first) != 1+4+eapTLSFragmentSize {
+		t.Fatalf("Unexpected first fragment flags %x, length %d", first[0], len(first))
+	}
+	fragment := first
+	for i := 0; i < 3; i++ {
+		ack, err := receiver.process(fragment)
+		if err != nil {
+			t.Fatalf("process failed: %v", err)
+		}
+		if i < 2 && (len(ack) != 1 || ack[0] != 0) {
+			t.Fatalf("Expected ACK for fragment %d, got %x", i, ack)
+		}
+		if i < 2 {
+			fragment = sender.next()
+		}
+	}
+	if fragment[0] != 0 || sender.pending() {
+		t.Errorf("Expected last fragment without flags, got %x", fragment[0])
+	}
+	if !receiver.pipe.finished || !bytes.Equal(received, message) {
+		t.Errorf("Expected reassembled message, got %d bytes", len(received))
+	}
+
+	if _, err := receiver.process([]byte{eapTLSFlagLength, 0, 0}); err == nil {
+		t.Error("Expected error for truncated length")
+	}
+	if _, err := receiver.process([]byte{eapTLSFlagLength, 0xff, 0, 0, 0}); err == nil {
+		t.Error("Expected error for oversized message")
+	}
+}
+
+// TestEAPTLS tests EAP-TLS authentication and MPPE keys
+func TestEAPTLS(t *testing.T) {
+	serverConfig, clientConfig := testEAPTLSConfigs(t)
+	c := newTestEAPConversation(t, &EAPHandler{Methods: []TEAPMethod{EAPTLS(serverConfig)}})
+	c.respond(EAPTypeIdentity, []byte("alice"))
+
+	peer := newTestEAPTLSPeer(clientConfig, nil)
+	response, rounds := peer.run(c, EAPTypeTLS)
+	if response.Code != CodeAccessAccept || c.request.Code != EAPCodeSuccess {
+		t.Fatalf("Expected Access-Accept with EAP-Success, got %d (%d rounds, %v)", response.Code, rounds, peer.pipe.result)
+	}
+	if rounds < 4 {
+		t.Errorf("Expected fragmented handshake, got %d rounds", rounds)
+	}
+
+	// MS-MPPE-Recv-Key is MSK[0:32], MS-MPPE-Send-Key is MSK[32:64]
+	for i, typeID := range []byte{MSMPPERecvKey, MSMPPESendKey} {
+		key, err := decryptMPPEKey(response.GetVendorAttr(VendorMicrosoft, typeID), []byte("secret"), c.authenticator)
+		if err != nil {
+			t.Fatalf("decryptMPPEKey failed: %v", err)
+		}
+		if !bytes.Equal(key, peer.msk[32*i:32*i+32]) {
+			t.Errorf("MPPE key %d does not match the peer's MSK", typeID)
+		}
+	}
+}
+
+// TestEAPTLSIdentityMismatch tests that the EAP identity must match the client certificate
+func TestEAPTLSIdentityMismatch(t *testing.T) {
+	serverConfig, clientConfig := testEAPTLSConfigs(t)
+	var authorized atomic.Value
+	authorized.Store("")
+	handler := &EAPHandler{
+		Methods: []TEAPMethod{EAPTLS(serverConfig)},
+		Authorize: func(identity string, p *TDataPacket) ([]*TAttribute, error) {
+			authorized.Store(identity)
+			return nil, nil
+		},
+	}
+	c := newTestEAPConversation(t, handler)
+	c.respond(EAPTypeIdentity, []byte("bob"))
+
+	response, _ := newTestEAPTLSPeer(clientConfig, nil).run(c, EAPTypeTLS)
+	if response.Code != CodeAccessReject || c.request.Code != EAPCodeFailure {
+		t.Errorf("Expected Access-Reject with EAP-Failure, got %d", response.Code)
+	}
+	if name := authorized.Load(); name != "" {
+		t.Errorf("Expected no authorization, got %s", name)
+	}
+
+	// the certificate name is compared case-insensitively
+	c = newTestEAPConversation(t, handler)
+	c.respond(EAPTypeIdentity, []byte("Alice"))
+	if response, _ := newTestEAPTLSPeer(clientConfig, nil).run(c, EAPTypeTLS); response.Code != CodeAccessAccept {
+		t.Errorf("Expected Access-Accept, got %d", response.Code)
+	}
+	if name := authorized.Load(); name != "Alice" {
+		t.Errorf("Expected Alice to be authorized, got %s", name)
+	}
+}
+
+// TestEAPTLSWithoutClientCertificate tests that EAP-TLS requires a client certificate
+func TestEAPTLSWithoutClientCertificate(t *testing.T) {
+	serverConfig, clientConfig := testEAPTLSConfigs(t)
+	clientConfig.Certificates = nil
+	c := newTestEAPConversation(t, &EAPHandler{Methods: []TEAPMethod{EAPTLS(serverConfig)}})
+	c.respond(EAPTypeIdentity, []byte("alice"))
+
+	response, _ := newTestEAPTLSPeer(clientConfig, nil).run(c, EAPTypeTLS)
+	if response.Code != CodeAccessReject || c.request.Code != EAPCodeFailure {
+		t.Errorf("Expected Access-Reject with EAP-Failure, got %d", response.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package radius
+
+import (
+	"net"
+	"time"
+
+	logs "github.com/tea4go/gh/log4go"
+)
+
+// Status-Server（RFC 5997）和 FreeRADIUS 统计属性。
+//
+// 服务器自动回复带有 Message-Authenticator 的 Status-Server，不交给 Handler。
+// 请求带有 FreeRADIUS-Statistics-Type 时，Access-Accept 中带有对应的统计属性；
+// 同时带有 FreeRADIUS-Stats-Client-IP-Address 时返回该客户端的统计。
+
+// FreeRADIUS 厂商号
+const VendorFreeRADIUS = 11344
+
+// FreeRADIUS-Statistics-Type 的取值（按位组合）
+const (
+	StatisticsAuthentication = 0x01
+	StatisticsAccounting     = 0x02
+	StatisticsInternal       = 0x10
+	StatisticsClient         = 0x20
+)
+
+func init() {
+	builtinOnce.Do(initDictionary)
+	Builtin.MustRegisterVendor("FreeRADIUS", VendorFreeRADIUS)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Statistics-Type", 127, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Access-Requests", 128, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Access-Accepts", 129, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Access-Rejects", 130, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Access-Challenges", 131, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Auth-Responses", 132, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Auth-Duplicate-Requests", 133, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Auth-Malformed-Requests", 134, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Auth-Invalid-Requests", 135, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Auth-Dropped-Requests", 136, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Auth-Unknown-Types", 137, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Accounting-Requests", 148, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Accounting-Responses", 149, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Acct-Duplicate-Requests", 150, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Acct-Malformed-Requests", 151, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Acct-Invalid-Requests", 152, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Acct-Dropped-Requests", 153, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Total-Acct-Unknown-Types", 154, AttributeInteger)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Stats-Client-IP-Address", 167, AttributeAddress)
+	Builtin.MustRegisterVendorAttr(VendorFreeRADIUS, "FreeRADIUS-Stats-Start-Time", 176, AttributeTime)
+
+	Builtin.MustRegisterValue("FreeRADIUS-Statistics-Type", "None", 0)
+	Builtin.MustRegisterValue("FreeRADIUS-Statistics-Type", "Authentication", StatisticsAuthentication)
+	Builtin.MustRegisterValue("FreeRADIUS-Statistics-Type", "Accounting", StatisticsAccounting)
+	Builtin.MustRegisterValue("FreeRADIUS-Statistics-Type", "Auth-Acct", StatisticsAuthentication|StatisticsAccounting)
+	Builtin.MustRegisterValue("FreeRADIUS-Statistics-Type", "Internal", StatisticsInternal)
+	Builtin.MustRegisterValue("FreeRADIUS-Statistics-Type", "Client", StatisticsClient)
+	Builtin.MustRegisterValue("FreeRADIUS-Statistics-Type", "All", 0x1f)
+}
+
+// serveStatus 回复 Status-Server，没有 Message-Authenticator 的请求丢弃（RFC 5997 3）
+func (s *Server) serveStatus(w *responseWriter, p *TDataPacket) {
+	ip := addrIP(w.addr)
+	if !p.HasMessageAuthenticator() {
+		logs.Warning("[%s]==>Status-Server(#%d)缺少Message-Authenticator，已丢弃。", w.addr, p.Identifier)
+		s.stats.add(ip, p.Code, statInvalid)
+		return
+	}
+	logs.Debug("[%s]==>接收到Status-Server(#%d)", w.addr, p.Identifier)
+	// 回复的 Access-Accept 不计入认证统计
+	w.stats = nil
+	w.AccessAccept(s.StatusAttrs(p)...)
+}
+
+// StatusAttrs 按 Status-Server 请求中的 FreeRADIUS-Statistics-Type 返回统计属性，
+// 没有该属性时返回nil。
+func (s *Server) StatusAttrs(p *TDataPacket) []*TAttribute {
+	statsType, _ := p.GetValue("FreeRADIUS-Statistics-Type").(uint32)
+	if statsType == 0 {
+		return nil
+	}
+
+	stats := s.Stats()
+	var attrs []*TAttribute
+	if statsType&StatisticsClient != 0 {
+		clientIP, _ := p.GetValue("FreeRADIUS-Stats-Client-IP-Address").(net.IP)
+		if clientIP == nil {
+			return nil
+		}
+		var ok bool
+		if stats, ok = s.ClientStats(clientIP); !ok {
+			return nil
+		}
+		if ip4 := clientIP.To4(); ip4 != nil {
+			attrs = append(attrs, NewVendorAttr(VendorFreeRADIUS, 167, ip4))
+		}
+	}
+	if statsType&StatisticsInternal != 0 {
+		attrs = append(attrs, NewVendorAttr(VendorFreeRADIUS, 176, s.statsStart()))
+	}
+	if statsType&StatisticsAuthentication != 0 {
+		attrs = append(attrs, statsAttrs(128,
+			stats.AccessRequests, stats.AccessAccepts, stats.AccessRejects, stats.AccessChallenges, stats.AuthResponses,
+			stats.AuthDuplicates, stats.AuthMalformed, stats.AuthInvalid, stats.AuthDropped, stats.AuthUnknownTypes)...)
+	}
+	if statsType&StatisticsAccounting != 0 {
+		attrs = append(attrs, statsAttrs(148,
+			stats.AccountingRequests, stats.AccountingResponses,
+			stats.AcctDuplicates, stats.AcctMalformed, stats.AcctInvalid, stats.AcctDropped, stats.AcctUnknownTypes)...)
+	}
+	return attrs
+}
+
+// 从 first 开始连续编号的计数属性，计数为 32 位，超过时回绕
+func statsAttrs(first byte, counters ...uint64) []*TAttribute {
+	attrs := make([]*TAttribute, len(counters))
+	for i, counter := range counters {
+		attrs[i] = NewVendorAttr(VendorFreeRADIUS, first+byte(i), uint32(counter))
+	}
+	return attrs
+}
+
+// 统计开始时间，没有开始服务时为当前时间
+func (s *Server) statsStart() time.Time {
+	if start := s.StartTime(); !start.IsZero() {
+		return start
+	}
+	return time.Now()
+}
@@ -0,0 +1,126 @@
+package radius
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestServerStatusServer tests that Status-Server is answered without calling the handler
+func TestServerStatusServer(t *testing.T) {
+	called := false
+	addr, client := testEAPServer(t, HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+		called = true
+		w.AccessAccept()
+	}))
+
+	request := NewPacket(CodeStatusServer, []byte("secret"))
+	request.AddMessageAuthenticator()
+	response, err := client.SendPacket(request, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessAccept {
+		t.Errorf("Expected Access-Accept, got %v", response.Code)
+	}
+	if !response.HasMessageAuthenticator() {
+		t.Error("Expected Message-Authenticator in the response")
+	}
+	if len(response.AttrItems) != 1 {
+		t.Errorf("Expected no statistics without FreeRADIUS-Statistics-Type, got %d attributes", len(response.AttrItems))
+	}
+	if called {
+		t.Error("Expected Status-Server not to be passed to the handler")
+	}
+
+	// RFC 5997 3: Status-Server without Message-Authenticator is silently discarded
+	client.ReadTimeout = 300 * time.Millisecond
+	request = NewPacket(CodeStatusServer, []byte("secret"))
+	if _, err := client.SendPacket(request, addr); err == nil {
+		t.Error("Expected Status-Server without Message-Authenticator to be dropped")
+	}
+}
+
+// TestServerStatusServerStatistics tests the FreeRADIUS statistics attributes
+func TestServerStatusServerStatistics(t *testing.T) {
+	addr, client := testEAPServer(t, HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+		if p.Code == CodeAccountingRequest {
+			w.AccountingResponse()
+			return
+		}
+		if p.GetValue("User-Name") == "alice" {
+			w.AccessAccept()
+			return
+		}
+		w.AccessReject()
+	}))
+	for _, username := range []string{"alice", "alice", "bob"} {
+		request := NewPacket(CodeAccessRequest, []byte("secret"))
+		request.Set("User-Name", username)
+		if _, err := client.SendPacket(request, addr); err != nil {
+			t.Fatalf("SendPacket failed: %v", err)
+		}
+	}
+	request := NewPacket(CodeAccountingRequest, []byte("secret"))
+	request.Set("Acct-Status-Type", "Start")
+	if _, err := client.SendPacket(request, addr); err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+
+	status := func(statsType interface{}, clientIP net.IP) *TDataPacket {
+		t.Helper()
+		request := NewPacket(CodeStatusServer, []byte("secret"))
+		request.Set("FreeRADIUS-Statistics-Type", statsType)
+		if clientIP != nil {
+			request.Set("FreeRADIUS-Stats-Client-IP-Address", clientIP)
+		}
+		request.AddMessageAuthenticator()
+		response, err := client.SendPacket(request, addr)
+		if err != nil {
+			t.Fatalf("SendPacket failed: %v", err)
+		}
+		if response.Code != CodeAccessAccept {
+			t.Fatalf("Expected Access-Accept, got %v", response.Code)
+		}
+		return response
+	}
+
+	response := status("Auth-Acct", nil)
+	expected := map[string]uint32{
+		"FreeRADIUS-Total-Access-Requests":      3,
+		"FreeRADIUS-Total-Access-Accepts":       2,
+		"FreeRADIUS-Total-Access-Rejects":       1,
+		"FreeRADIUS-Total-Auth-Responses":       3,
+		"FreeRADIUS-Total-Accounting-Requests":  1,
+		"FreeRADIUS-Total-Accounting-Responses": 1,
+	}
+	for name, value := range expected {
+		if v := response.GetValue(name); v != value {
+			t.Errorf("Expected %s = %d, got %v", name, value, v)
+		}
+	}
+
+	response = status("Authentication", nil)
+	if v := response.GetValue("FreeRADIUS-Total-Accounting-Requests"); v != nil {
+		t.Errorf("Expected no accounting statistics, got %v", v)
+	}
+
+	response = status("Internal", nil)
+	if v := response.GetValue("FreeRADIUS-Stats-Start-Time"); v == nil {
+		t.Error("Expected FreeRADIUS-Stats-Start-Time")
+	}
+
+	response = status(uint32(StatisticsClient|StatisticsAuthentication), net.IPv4(127, 0, 0, 1))
+	if v := response.GetValue("FreeRADIUS-Stats-Client-IP-Address"); !net.IPv4(127, 0, 0, 1).Equal(v.(net.IP)) {
+		t.Errorf("Expected FreeRADIUS-Stats-Client-IP-Address = 127.0.0.1, got %v", v)
+	}
+	if v := response.GetValue("FreeRADIUS-Total-Access-Accepts"); v != uint32(2) {
+		t.Errorf("Expected client FreeRADIUS-Total-Access-Accepts = 2, got %v", v)
+	}
+
+	// unknown client
+	response = status(uint32(StatisticsClient|StatisticsAuthentication), net.IPv4(10, 0, 0, 1))
+	if len(response.AttrItems) != 1 {
+		t.Errorf("Expected no statistics for an unknown client, got %d attributes", len(response.AttrItems))
+	}
+}
@@ -0,0 +1,286 @@
+package radius
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logs "github.com/tea4go/gh/log4go"
+)
+
+// RADIUS over TCP（RFC 6613）和 RadSec（RFC 6614，RADIUS over TLS）。
+//
+// TCP 上的数据包按包头的长度字段分帧，同一个连接可以同时处理多个请求，
+// 请求不重发。RadSec 的共享密钥固定为 "radsec"。
+
+// RadSec 使用的共享密钥（RFC 6614 2.3）
+const RadSecSecret = "radsec"
+
+// 从流中读取一个数据包
+func readStreamPacket(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	if length < 20 || length > maxPacketSize {
+		return nil, fmt.Errorf("无效包长度%d(20-%d)", length, maxPacketSize)
+	}
+	buff := make([]byte, length)
+	copy(buff, header[:])
+	if _, err := io.ReadFull(r, buff[4:]); err != nil {
+		return nil, err
+	}
+	return buff, nil
+}
+
+// 服务端的 TCP/TLS 连接，多个 Handler 的响应串行写入。
+type streamConn struct {
+	conn net.Conn
+	wmu  sync.Mutex
+}
+
+func (sc *streamConn) write(raw []byte) error {
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+	_, err := sc.conn.Write(raw)
+	return err
+}
+
+// ListenAndServeTCP 在 Addr:Port 上提供 RADIUS over TCP 服务（RFC 6613），
+// 客户端和共享密钥同 UDP 一样由 ClientsMap 决定。
+func (s *Server) ListenAndServeTCP() error {
+	ln, err := s.listenStream()
+	if err != nil {
+		return err
+	}
+	logs.Notice("==>RADIUS over TCP 监听地址： %s", ln.Addr())
+	return s.serveStream(ln)
+}
+
+// ListenAndServeTLS 在 Addr:Port 上提供 RadSec 服务（RFC 6614），TLSConfig 必须带有服务器证书。
+// 客户端证书必须通过 TLSConfig.ClientCAs 的校验（见 TLSInsecureSkipClientVerify），
+// 再按 TLSClientsMap 授权。
+func (s *Server) ListenAndServeTLS() error {
+	if s.TLSConfig == nil || (len(s.TLSConfig.Certificates) == 0 && s.TLSConfig.GetCertificate == nil) {
+		return errors.New("RadSec 需要配置服务器证书(TLSConfig)。")
+	}
+	ln, err := s.listenStream()
+	if err != nil {
+		return err
+	}
+	config := s.TLSConfig.Clone()
+	if !s.TLSInsecureSkipClientVerify {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	logs.Notice("==>RadSec 监听地址： %s", ln.Addr())
+	return s.serveStream(tls.NewListener(ln, config))
+}
+
+func (s *Server) listenStream() (net.Listener, error) {
+	if s.Handler == nil {
+		return nil, errors.New("Radius Server Handler is null.")
+	}
+	if err := s.initClientNets(); err != nil {
+		return nil, err
+	}
+
+	addrStr := fmt.Sprintf("0.0.0.0:%d", s.Port)
+	if s.Addr != "" {
+		addrStr = fmt.Sprintf("%s:%d", s.Addr, s.Port)
+	}
+	network := "tcp"
+	if s.Network == "tcp4" || s.Network == "tcp6" {
+		network = s.Network
+	}
+
+	s.streamLock.Lock()
+	defer s.streamLock.Unlock()
+	if s.streamListener != nil {
+		return nil, errors.New("Radius Server 已经运行。")
+	}
+	ln, err := net.Listen(network, addrStr)
+	if err != nil {
+		return nil, errors.New("监听连接错误，" + err.Error())
+	}
+	s.streamListener = ln
+	return ln, nil
+}
+
+func (s *Server) serveStream(ln net.Listener) error {
+	s.startStats()
+	defer func() {
+		s.streamLock.Lock()
+		s.streamListener = nil
+		s.streamLock.Unlock()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				logs.Notice("Radius服务器(TCP) ...... 正在关闭")
+				return nil
+			}
+			logs.Emergency("服务器接受连接错误，" + err.Error())
+			return err
+		}
+
+		s.streamLock.Lock()
+		if s.streamConns == nil {
+			s.streamConns = make(map[net.Conn]struct{})
+		}
+		s.streamConns[conn] = struct{}{}
+		s.streamLock.Unlock()
+
+		atomic.AddInt32(&s.active, 1)
+		go func() {
+			defer atomic.AddInt32(&s.active, -1)
+			s.serveStreamConn(conn)
+			s.streamLock.Lock()
+			delete(s.streamConns, conn)
+			s.streamLock.Unlock()
+		}()
+	}
+}
+
+func (s *Server) serveStreamConn(conn net.Conn) {
+	defer conn.Close()
+	remoteAddr := conn.RemoteAddr()
+
+	var secret []byte
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			logs.Warning("[%s]==>TLS握手失败，%s", remoteAddr, err.Error())
+			return
+		}
+		// 只有校验过的证书链可以用来授权
+		var certs []*x509.Certificate
+		if chains := tlsConn.ConnectionState().VerifiedChains; len(chains) > 0 {
+			certs = chains[0][:1]
+		}
+		secret = s.GetSecretByCertificate(certs)
+	} else {
+		secret = s.GetSecretByIP(addrIP(remoteAddr))
+	}
+	if secret == nil {
+		logs.Warning("[%s]==>未授权客户端连接", remoteAddr)
+		return
+	}
+
+	// 连接上的请求都处理完后才关闭连接
+	var handlers sync.WaitGroup
+	defer handlers.Wait()
+
+	sc := &streamConn{conn: conn}
+	for {
+		buff, err := readStreamPacket(conn)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) && !s.shuttingDown() {
+				logs.Warning("[%s]==>读取数据包出错，%s", remoteAddr, err.Error())
+			}
+			return
+		}
+
+		// RFC 6613 2.6.1：无法解析的数据包需要关闭连接
+		packet, err := ParsePacket(buff, secret, s.Dictionary)
+		if err != nil {
+			logs.Warning("[%s]==>解析数据包出错，错误：%s", remoteAddr, err.Error())
+			s.stats.add(addrIP(remoteAddr), rawCode(buff), parseErrorStat(err))
+			return
+		}
+		if !s.acceptPacket(packet, remoteAddr) {
+			continue
+		}
+		logs.Debug(packet.String())
+
+		handlers.Add(1)
+		s.startWorker(func() {
+			defer handlers.Done()
+			logs.Begin()
+			defer logs.End()
+			response := responseWriter{
+				stream: sc,
+				addr:   remoteAddr,
+				packet: packet,
+				stats:  &s.stats,
+			}
+			if packet.Code == CodeStatusServer {
+				s.serveStatus(&response, packet)
+				return
+			}
+			s.stats.add(addrIP(remoteAddr), packet.Code, statRequest)
+			s.Handler.ServeRadius(&response, packet)
+			if !response.written {
+				s.stats.add(addrIP(remoteAddr), packet.Code, statDropped)
+			}
+		})
+	}
+}
+
+// GetSecretByCertificate 返回 RadSec 客户端证书对应的共享密钥，未授权返回nil。
+// certs 必须是校验过的证书链（VerifiedChains），按第一个证书的 CN 和 DNS SAN 授权。
+// TLSClientsMap 为nil时所有带证书的客户端使用 "radsec"，没有证书的客户端只在
+// TLSInsecureSkipClientVerify 时被接受。
+func (s *Server) GetSecretByCertificate(certs []*x509.Certificate) []byte {
+	if len(certs) == 0 {
+		if s.TLSClientsMap == nil && s.TLSInsecureSkipClientVerify {
+			return []byte(RadSecSecret)
+		}
+		return nil
+	}
+	if s.TLSClientsMap == nil {
+		return []byte(RadSecSecret)
+	}
+	names := append([]string{certs[0].Subject.CommonName}, certs[0].DNSNames...)
+	for _, name := range names {
+		if secret, ok := s.TLSClientsMap[name]; ok {
+			if secret == "" {
+				secret = RadSecSecret
+			}
+			return []byte(secret)
+		}
+	}
+	return nil
+}
+
+// 关闭 TCP/TLS 监听，停止读取连接上的新请求
+func (s *Server) shutdownStreams() {
+	s.streamLock.Lock()
+	defer s.streamLock.Unlock()
+	if s.streamListener != nil {
+		s.streamListener.Close()
+	}
+	for conn := range s.streamConns {
+		conn.SetReadDeadline(time.Unix(1, 0))
+	}
+}
+
+func (s *Server) closeStreams() {
+	s.streamLock.Lock()
+	defer s.streamLock.Unlock()
+	if s.streamListener != nil {
+		s.streamListener.Close()
+	}
+	for conn := range s.streamConns {
+		conn.Close()
+	}
+}
+
+// 返回地址中的IP
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	}
+	return nil
+}
@@ -0,0 +1,406 @@
+package radius
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestReadStreamPacket tests framing of packets in a stream
+func TestReadStreamPacket(t *testing.T) {
+	first, _ := NewPacket(CodeAccessRequest, []byte("secret")).Encode()
+	packet := NewPacket(CodeAccessRequest, []byte("secret"))
+	packet.AddAttr("User-Name", "testuser")
+	second, _ := packet.Encode()
+
+	r := bytes.NewReader(append(append([]byte{}, first...), second...))
+	for _, expected := range [][]byte{first, second} {
+		data, err := readStreamPacket(r)
+		if err != nil {
+			t.Fatalf("readStreamPacket failed: %v", err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("Expected %x, got %x", expected, data)
+		}
+	}
+	if _, err := readStreamPacket(r); err == nil {
+		t.Error("Expected error at end of stream")
+	}
+
+	if _, err := readStreamPacket(bytes.NewReader([]byte{1, 1, 0, 10})); err == nil {
+		t.Error("Expected error for invalid length")
+	}
+	if _, err := readStreamPacket(bytes.NewReader(second[:len(second)-1])); err == nil {
+		t.Error("Expected error for truncated packet")
+	}
+}
+
+// waitStreamListener waits until the TCP/TLS listener of the server is ready
+func waitStreamListener(t *testing.T, server *Server) string {
+	for i := 0; i < 100; i++ {
+		server.streamLock.Lock()
+		ln := server.streamListener
+		server.streamLock.Unlock()
+		if ln != nil {
+			return ln.Addr().String()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server not listening")
+	return ""
+}
+
+func testStreamHandler() Handler {
+	return HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+		reply, _ := p.Dictionary.NewAttr("Reply-Message", p.GetString("User-Name"))
+		w.AccessAccept(reply)
+	})
+}
+
+// TestServerTCPShutdown tests that Shutdown answers in-flight TCP requests before closing
+func TestServerTCPShutdown(t *testing.T) {
+	secret := []byte("secret")
+	started := make(chan struct{})
+	server := &Server{
+		Addr:       "127.0.0.1",
+		Dictionary: Builtin,
+		Handler: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			close(started)
+			time.Sleep(100 * time.Millisecond)
+			w.AccessAccept()
+		}),
+		ClientsMap: map[string]string{"127.0.0.1": string(secret)},
+	}
+	go server.ListenAndServeTCP()
+	addr := waitStreamListener(t, server)
+
+	client := &Client{Net: "tcp", ReadTimeout: 2 * time.Second}
+	defer client.Close()
+	result := make(chan error, 1)
+	go func() {
+		packet := NewPacket(CodeAccessRequest, secret)
+		packet.AddAttr("User-Name", "testuser")
+		_, err := client.SendPacket(packet, addr)
+		result <- err
+	}()
+
+	<-started
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("Expected in-flight request to be answered, got %v", err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("Expected listener to be closed")
+	}
+}
+
+// TestServerTCP tests RADIUS over TCP with concurrent requests on one connection
+func TestServerTCP(t *testing.T) {
+	secret := []byte("secret")
+	server := &Server{
+		Addr:       "127.0.0.1",
+		Dictionary: Builtin,
+		Handler:    testStreamHandler(),
+		ClientsMap: map[string]string{"127.0.0.1": string(secret)},
+	}
+	go server.ListenAndServeTCP()
+	defer server.Close()
+	addr := waitStreamListener(t, server)
+
+	client := &Client{Net: "tcp", ReadTimeout: 2 * time.Second, Retries: 3}
+	defer client.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := string(rune('a' + i))
+			packet := NewPacket(CodeAccessRequest, secret)
+			packet.AddAttr("User-Name", name)
+			packet.AddMessageAuthenticator()
+			response, err := client.SendPacket(packet, addr)
+			if err != nil {
+				t.Errorf("SendPacket failed: %v", err)
+				return
+			}
+			if response.Code != CodeAccessAccept || response.GetString("Reply-Message") != name {
+				t.Errorf("Unexpected response for %s: %s", name, response.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	client.mu.Lock()
+	conns := len(client.conns[addr])
+	client.mu.Unlock()
+	if conns != 1 {
+		t.Errorf("Expected 1 reused connection, got %d", conns)
+	}
+
+	// unknown client is disconnected
+	restricted := &Server{
+		Addr:       "127.0.0.1",
+		Dictionary: Builtin,
+		Handler:    testStreamHandler(),
+		ClientsMap: map[string]string{"10.0.0.1": string(secret)},
+	}
+	go restricted.ListenAndServeTCP()
+	defer restricted.Close()
+	restrictedAddr := waitStreamListener(t, restricted)
+	other := &Client{Net: "tcp", ReadTimeout: time.Second}
+	defer other.Close()
+	if _, err := other.SendPacket(NewPacket(CodeAccessRequest, secret), restrictedAddr); err == nil {
+		t.Error("Expected error for unauthorized client")
+	}
+}
+
+// testCertificate creates a certificate signed by parent (self-signed when parent is nil)
+func testCertificate(t *testing.T, name string, parent *tls.Certificate, isCA bool) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		IsCA:         isCA,
+
+		BasicConstraintsValid: true,
+	}
+
+	parentCert, parentKey := template, interface{}(key)
+	if parent != nil {
+		parentCert = parent.Leaf
+		parentKey = parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// TestServerTLS tests RadSec with client certificate authorization
+func TestServerTLS(t *testing.T) {
+	ca := testCertificate(t, "ca", nil, true)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	server := &Server{
+		Addr:       "127.0.0.1",
+		Dictionary: Builtin,
+		Handler:    testStreamHandler(),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{testCertificate(t, "server", &ca, false)},
+			ClientCAs:    pool,
+		},
+		TLSClientsMap: map[string]string{"nas1": ""},
+	}
+	go server.ListenAndServeTLS()
+	defer server.Close()
+	addr := waitStreamListener(t, server)
+
+	client := &Client{
+		Net:         "tcp",
+		ReadTimeout: 2 * time.Second,
+		TLSConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{testCertificate(t, "nas1", &ca, false)},
+		},
+	}
+	defer client.Close()
+	packet := NewPacket(CodeAccessRequest, []byte(RadSecSecret))
+	packet.AddAttr("User-Name", "testuser")
+	response, err := client.SendPacket(packet, addr)
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.GetString("Reply-Message") != "testuser" {
+		t.Errorf("Unexpected response %s", response.String())
+	}
+
+	other := &Client{
+		Net:         "tcp",
+		ReadTimeout: time.Second,
+		TLSConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{testCertificate(t, "nas2", &ca, false)},
+		},
+	}
+	defer other.Close()
+	if _, err := other.SendPacket(NewPacket(CodeAccessRequest, []byte(RadSecSecret)), addr); err == nil {
+		t.Error("Expected error for client certificate not in TLSClientsMap")
+	}
+
+	// RFC 6614: clients without a certificate signed by ClientCAs are refused
+	for name, config := range map[string]*tls.Config{
+		"no certificate":          {RootCAs: pool},
+		"self-signed certificate": {RootCAs: pool, Certificates: []tls.Certificate{testCertificate(t, "nas1", nil, false)}},
+	} {
+		other := &Client{Net: "tcp", ReadTimeout: time.Second, TLSConfig: config}
+		if _, err := other.SendPacket(NewPacket(CodeAccessRequest, []byte(RadSecSecret)), addr); err == nil {
+			t.Errorf("Expected error for client with %s", name)
+		}
+		other.Close()
+	}
+
+	// without TLSClientsMap a verified certificate is still required
+	open := &Server{
+		Addr:       "127.0.0.1",
+		Dictionary: Builtin,
+		Handler:    testStreamHandler(),
+		TLSConfig:  &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "server", &ca, false)}, ClientCAs: pool},
+	}
+	go open.ListenAndServeTLS()
+	defer open.Close()
+	anonymous := &Client{Net: "tcp", ReadTimeout: time.Second, TLSConfig: &tls.Config{RootCAs: pool}}
+	defer anonymous.Close()
+	if _, err := anonymous.SendPacket(NewPacket(CodeAccessRequest, []byte(RadSecSecret)), waitStreamListener(t, open)); err == nil {
+		t.Error("Expected error for client without certificate")
+	}
+
+	if err := (&Server{Handler: testStreamHandler()}).ListenAndServeTLS(); err == nil {
+		t.Error("Expected error without server certificate")
+	}
+}
+
+// TestClientStalledDial tests that a server stalling the TLS handshake does not block requests to other servers
+func TestClientStalledDial(t *testing.T) {
+	ca := testCertificate(t, "ca", nil, true)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	server := &Server{
+		Addr:       "127.0.0.1",
+		Dictionary: Builtin,
+		Handler:    testStreamHandler(),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{testCertificate(t, "server", &ca, false)},
+			ClientCAs:    pool,
+		},
+	}
+	go server.ListenAndServeTLS()
+	defer server.Close()
+	addr := waitStreamListener(t, server)
+
+	// accepts connections and never answers the handshake
+	stalled, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer stalled.Close()
+	go func() {
+		for {
+			conn, err := stalled.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	client := &Client{
+		Net:         "tcp",
+		DialTimeout: 3 * time.Second,
+		ReadTimeout: time.Second,
+		TLSConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{testCertificate(t, "nas1", &ca, false)},
+		},
+	}
+	defer client.Close()
+	go client.SendPacket(NewPacket(CodeAccessRequest, []byte(RadSecSecret)), stalled.Addr().String())
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	packet := NewPacket(CodeAccessRequest, []byte(RadSecSecret))
+	packet.AddAttr("User-Name", "testuser")
+	if _, err := client.SendPacket(packet, addr); err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the request not to wait for the stalled dial, took %v", elapsed)
+	}
+}
+
+// TestServerTLSInsecureSkipClientVerify tests RadSec without client certificate verification
+func TestServerTLSInsecureSkipClientVerify(t *testing.T) {
+	ca := testCertificate(t, "ca", nil, true)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	server := &Server{
+		Addr:       "127.0.0.1",
+		Dictionary: Builtin,
+		Handler:    testStreamHandler(),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{testCertificate(t, "server", &ca, false)},
+			ClientAuth:   tls.RequireAnyClientCert,
+		},
+		TLSClientsMap:               map[string]string{"nas1": ""},
+		TLSInsecureSkipClientVerify: true,
+	}
+	go server.ListenAndServeTLS()
+	defer server.Close()
+	addr := waitStreamListener(t, server)
+
+	// the names of an unverified certificate are not trusted
+	client := &Client{
+		Net:         "tcp",
+		ReadTimeout: time.Second,
+		TLSConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{testCertificate(t, "nas1", nil, false)},
+		},
+	}
+	defer client.Close()
+	if _, err := client.SendPacket(NewPacket(CodeAccessRequest, []byte(RadSecSecret)), addr); err == nil {
+		t.Error("Expected error for unverified client certificate")
+	}
+}
+
+// TestServerGetSecretByCertificate tests GetSecretByCertificate
+func TestServerGetSecretByCertificate(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "nas1"}, DNSNames: []string{"nas1.example.com"}}
+
+	server := &Server{}
+	if string(server.GetSecretByCertificate([]*x509.Certificate{cert})) != RadSecSecret {
+		t.Error("Expected radsec secret without TLSClientsMap")
+	}
+	if server.GetSecretByCertificate(nil) != nil {
+		t.Error("Expected nil without verified certificate")
+	}
+	server.TLSInsecureSkipClientVerify = true
+	if string(server.GetSecretByCertificate(nil)) != RadSecSecret {
+		t.Error("Expected radsec secret with TLSInsecureSkipClientVerify")
+	}
+
+	server.TLSClientsMap = map[string]string{"nas1.example.com": "custom"}
+	if string(server.GetSecretByCertificate([]*x509.Certificate{cert})) != "custom" {
+		t.Error("Expected secret matched by DNS name")
+	}
+	if server.GetSecretByCertificate(nil) != nil {
+		t.Error("Expected nil without certificate")
+	}
+	server.TLSClientsMap = map[string]string{"other": ""}
+	if server.GetSecretByCertificate([]*x509.Certificate{cert}) != nil {
+		t.Error("Expected nil for unknown certificate")
+	}
+}
@@ -1,11 +1,14 @@
 package radius
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	logs "github.com/tea4go/gh/log4go"
@@ -29,19 +32,33 @@ type ResponseWriter interface {
 	AccessReject(attributes ...*TAttribute) error
 	AccessChallenge(attributes ...*TAttribute) error
 	AccountingResponse(attributes ...*TAttribute) error
+	DisconnectACK(attributes ...*TAttribute) error
+	DisconnectNAK(attributes ...*TAttribute) error
+	CoAACK(attributes ...*TAttribute) error
+	CoANAK(attributes ...*TAttribute) error
 }
 
 // 响应
 type responseWriter struct {
 	// listener that received the packet
-	conn *net.UDPConn
+	conn net.PacketConn
+	// TCP/TLS 连接，UDP 时为nil
+	stream *streamConn
 	// where the packet came from
-	addr *net.UDPAddr
+	addr net.Addr
 	// original packet
 	packet *TDataPacket
+	// 发送的响应，用于回复重复请求
+	response []byte
+	// 请求统计，已经发送响应时 written 为 true
+	stats   *serverStats
+	written bool
 }
 
 func (r *responseWriter) LocalAddr() net.Addr {
+	if r.stream != nil {
+		return r.stream.conn.LocalAddr()
+	}
 	return r.conn.LocalAddr()
 }
 
@@ -58,6 +75,10 @@ func (r *responseWriter) accessRespond(code Code, attributes ...*TAttribute) err
 		Dictionary:    r.packet.Dictionary,
 		AttrItems:     attributes,
 	}
+	// 请求带有 Message-Authenticator 时，响应也必须带上
+	if code != CodeAccountingResponse && r.packet.HasMessageAuthenticator() {
+		packet.AddMessageAuthenticator()
+	}
 	return r.Write(&packet)
 }
 
@@ -77,17 +98,47 @@ func (r *responseWriter) AccountingResponse(attributes ...*TAttribute) error {
 	return r.accessRespond(CodeAccountingResponse, attributes...)
 }
 
+func (r *responseWriter) DisconnectACK(attributes ...*TAttribute) error {
+	return r.accessRespond(CodeDisconnectACK, attributes...)
+}
+
+func (r *responseWriter) DisconnectNAK(attributes ...*TAttribute) error {
+	return r.accessRespond(CodeDisconnectNAK, attributes...)
+}
+
+func (r *responseWriter) CoAACK(attributes ...*TAttribute) error {
+	return r.accessRespond(CodeCoAACK, attributes...)
+}
+
+func (r *responseWriter) CoANAK(attributes ...*TAttribute) error {
+	return r.accessRespond(CodeCoANAK, attributes...)
+}
+
 func (r *responseWriter) Write(packet *TDataPacket) error {
 	raw, err := packet.Encode()
 	if err != nil {
 		return err
 	}
-	if _, err := r.conn.WriteToUDP(raw, r.addr); err != nil {
+	if r.stream != nil {
+		err = r.stream.write(raw)
+	} else if _, err = r.conn.WriteTo(raw, r.addr); err == nil {
+		r.response = raw
+	}
+	if err != nil {
 		return err
 	}
+	r.written = true
+	if r.stats != nil {
+		r.stats.response(addrIP(r.addr), packet.Code)
+	}
 	return nil
 }
 
+const (
+	defaultMaxWorkers    = 1024
+	shutdownPollInterval = 10 * time.Millisecond
+)
+
 // Server is a server that listens for and handles RADIUS packets.
 type Server struct {
 	Addr          string
@@ -99,7 +150,41 @@ type Server struct {
 	ClientSecrets [][]byte
 	Dictionary    *TDictionary // Dictionary used when decoding incoming packets.
 	Handler       Handler      // The packet handler that handles incoming, valid packets.
-	listener      *net.UDPConn // Listener
+
+	// 同时处理的请求数（UDP 和 TCP/TLS 合计），默认1024，达到后暂停接收。
+	MaxWorkers int
+
+	mu         sync.Mutex
+	listener   net.PacketConn // Listener
+	workers    chan struct{}
+	active     int32 // 正在运行的接收循环、连接和请求
+	inShutdown int32
+
+	// RadSec（RFC 6614）的 TLS 配置，ListenAndServeTLS 使用。
+	TLSConfig *tls.Config
+	// RadSec 按客户端证书授权：证书名（CN 或 DNS SAN）->共享密钥，共享密钥为空时使用 "radsec"。
+	// 为nil时接受所有证书通过 TLSConfig.ClientCAs 校验的客户端。
+	TLSClientsMap map[string]string
+	// RadSec 默认要求客户端证书并校验（RFC 6614 2.3），TLSConfig.ClientAuth 被忽略。
+	// 为 true 时按 TLSConfig.ClientAuth 处理，没有证书的客户端只在 TLSClientsMap 为nil时被接受，
+	// 不符合 RFC 6614，只用于测试。
+	TLSInsecureSkipClientVerify bool
+
+	// 重复请求的响应缓存时间，默认5秒。
+	DuplicateTTL time.Duration
+	cache        *responseCache
+
+	// 请求统计（Stats、ClientStats），Status-Server 的统计属性也来自这里
+	stats serverStats
+
+	streamLock     sync.Mutex
+	streamListener net.Listener          // TCP/TLS Listener
+	streamConns    map[net.Conn]struct{} // 正在服务的 TCP/TLS 连接
+
+	// 要求 Access-Request 必须带有 Message-Authenticator 的客户端网络
+	// (CIDR或IP地址，"0.0.0.0/0"表示全部)，不带的请求直接丢弃。
+	RequireMessageAuthenticator []string
+	requireNets                 []net.IPNet
 }
 
 func (s *Server) ResetClientNets() error {
@@ -108,28 +193,68 @@ func (s *Server) ResetClientNets() error {
 
 	if s.ClientsMap != nil {
 		for k, v := range s.ClientsMap {
-
-			_, subnet, err := net.ParseCIDR(k)
+			subnet, err := parseClientNet(k)
 			if err != nil {
-				ip := net.ParseIP(k)
-				if ip == nil {
-					return errors.New("不合法的CIDR格式或IP地址(" + k + ")")
-				} else {
-					k = k + "/32"
-				}
-				_, subnet, err = net.ParseCIDR(k)
-				if err != nil {
-					return errors.New("不能解析CIDR格式或IP地址(" + k + ")")
-				}
+				return err
 			}
 			s.ClientNets = append(s.ClientNets, *subnet)
 			s.ClientSecrets = append(s.ClientSecrets, []byte(v))
 		}
 	}
 
+	return s.resetRequireNets()
+}
+
+// 解析 RequireMessageAuthenticator，不论客户端来自 ClientsMap 还是 ClientNets
+func (s *Server) resetRequireNets() error {
+	s.requireNets = nil
+	for _, k := range s.RequireMessageAuthenticator {
+		subnet, err := parseClientNet(k)
+		if err != nil {
+			return err
+		}
+		s.requireNets = append(s.requireNets, *subnet)
+	}
 	return nil
 }
 
+// 启动时解析客户端网络：有 ClientsMap 时重新生成 ClientNets 和 ClientSecrets
+func (s *Server) initClientNets() error {
+	if s.ClientsMap != nil {
+		// 双重检查，IP或IPNet范围
+		return s.ResetClientNets()
+	}
+	return s.resetRequireNets()
+}
+
+// 解析CIDR格式或IP地址
+func parseClientNet(k string) (*net.IPNet, error) {
+	_, subnet, err := net.ParseCIDR(k)
+	if err != nil {
+		ip := net.ParseIP(k)
+		if ip == nil {
+			return nil, errors.New("不合法的CIDR格式或IP地址(" + k + ")")
+		} else {
+			k = k + "/32"
+		}
+		_, subnet, err = net.ParseCIDR(k)
+		if err != nil {
+			return nil, errors.New("不能解析CIDR格式或IP地址(" + k + ")")
+		}
+	}
+	return subnet, nil
+}
+
+// IsMessageAuthenticatorRequired 返回该客户端的 Access-Request 是否必须带有 Message-Authenticator。
+func (s *Server) IsMessageAuthenticatorRequired(ip net.IP) bool {
+	for _, k := range s.requireNets {
+		if k.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Server) GetSecretByIPString(ipaddress string) []byte {
 
 	ip := net.ParseIP(ipaddress)
@@ -157,25 +282,12 @@ func (s *Server) AddClientsMap(m map[string]string) {
 	}
 }
 
+// ListenAndServe 在 Addr:Port 上监听 UDP 并调用 Serve。
 func (s *Server) ListenAndServe() error {
-	if s.listener != nil {
-		return errors.New("Radius Server 已经运行。")
-	}
-
 	if s.Handler == nil {
 		return errors.New("Radius Server Handler is null.")
 	}
 
-	if s.ClientsMap != nil {
-		// 双重检查，IP或IPNet范围
-		err := s.ResetClientNets()
-		if err != nil {
-			return err
-		}
-	}
-
-	logs.Notice("Radius服务器 ...... 正在启动")
-
 	addrStr := fmt.Sprintf("0.0.0.0:%d", s.Port)
 	if s.Addr != "" {
 		addrStr = fmt.Sprintf("%s:%d", s.Addr, s.Port)
@@ -187,32 +299,69 @@ func (s *Server) ListenAndServe() error {
 	}
 	logs.Notice("==>监听地址： %s", addrStr)
 	logs.Notice("==>网络协议： %s", network)
-	logs.Notice("==>客户端IP： %v", s.ClientsMap)
 	addr, err := net.ResolveUDPAddr(network, addrStr)
 	if err != nil {
 		return errors.New("监听地址错误，" + err.Error())
 	}
-	s.listener, err = net.ListenUDP(network, addr)
+	conn, err := net.ListenUDP(network, addr)
 	if err != nil {
 		return errors.New("监听连接错误，" + err.Error())
 	}
+	return s.Serve(conn)
+}
 
-	type activeKey struct {
-		IP         string
-		Identifier byte
+// Serve 在 conn 上接收请求并交给 Handler 处理，直到 Close 或 Shutdown，
+// 同时处理的请求数不超过 MaxWorkers。Serve 返回时 conn 已经关闭（Shutdown 时
+// 等处理中的请求完成后关闭）。
+func (s *Server) Serve(conn net.PacketConn) error {
+	if s.Handler == nil {
+		conn.Close()
+		return errors.New("Radius Server Handler is null.")
 	}
 
-	var (
-		activeLock sync.RWMutex
-		active     = map[activeKey]bool{}
-	)
+	s.mu.Lock()
+	if s.listener != nil {
+		s.mu.Unlock()
+		conn.Close()
+		return errors.New("Radius Server 已经运行。")
+	}
+	s.listener = conn
+	s.cache = newResponseCache(s.DuplicateTTL)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.listener == conn {
+			s.listener = nil
+		}
+		s.mu.Unlock()
+	}()
+
+	if err := s.initClientNets(); err != nil {
+		conn.Close()
+		return err
+	}
+
+	atomic.AddInt32(&s.active, 1)
+	defer atomic.AddInt32(&s.active, -1)
+	s.startStats()
 
+	logs.Notice("Radius服务器 ...... 正在启动")
+	logs.Notice("==>客户端IP： %v", s.ClientsMap)
 	for {
 		buff := make([]byte, 4096)
-		n, remoteAddr, err := s.listener.ReadFromUDP(buff)
-		if err != nil && !err.(*net.OpError).Temporary() {
+		n, remoteAddr, err := conn.ReadFrom(buff)
+		if err != nil {
+			if s.shuttingDown() || errors.Is(err, net.ErrClosed) {
+				break
+			}
+			if ne, ok := err.(interface{ Temporary() bool }); ok && ne.Temporary() {
+				logs.Warning("服务器读取网络数据错误，%s", err.Error())
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
 			logs.Emergency("服务器读取网络数据错误，" + err.Error())
-			break
+			conn.Close()
+			return err
 		}
 
 		if n == 0 {
@@ -220,81 +369,179 @@ func (s *Server) ListenAndServe() error {
 		}
 
 		buff = buff[:n]
-		hexbuff := make([]byte, n*2)
-		b := hex.Encode(hexbuff, buff)
-
-		go func(conn *net.UDPConn, buff []byte, remoteAddr *net.UDPAddr) {
-			logs.Begin()
-			defer logs.End()
-			logs.Debug("[%s]==>接收到%d个字符, 内容：%s", remoteAddr, n, hexbuff[:b])
-
-			secret := s.GetSecretByIP(remoteAddr.IP)
-			if secret == nil {
-				logs.Warning("[%s]==>未授权客户端请求[%s]", remoteAddr, remoteAddr.IP)
-				return
-			}
+		s.startWorker(func() {
+			s.servePacket(conn, buff, remoteAddr)
+		})
+	}
 
-			packet, err := ParsePacket(buff, secret, s.Dictionary)
-			if err != nil {
-				logs.Warning("[%s]==>解析数据包出错，错误：%s", remoteAddr, err.Error())
-				return
-			}
-			logs.Debug(packet.String())
-			key := activeKey{
-				IP:         remoteAddr.String(),
-				Identifier: packet.Identifier,
-			}
+	logs.Notice("Radius服务器 ...... 正在关闭")
+	return nil
+}
 
-			// 标记当前请求为"处理中"。active 的读改写必须在同一把写锁内完成，
-			// 否则并发 map 写会触发 fatal error: concurrent map writes。
-			tryAcquire := func() (bool, int) {
-				activeLock.Lock()
-				defer activeLock.Unlock()
-				if _, ok := active[key]; ok {
-					return false, len(active)
-				}
-				active[key] = true
-				return true, len(active)
-			}
+// 处理一个 UDP 请求
+func (s *Server) servePacket(conn net.PacketConn, buff []byte, remoteAddr net.Addr) {
+	logs.Begin()
+	defer logs.End()
+	logs.Debug("[%s]==>接收到%d个字符, 内容：%s", remoteAddr, len(buff), hex.EncodeToString(buff))
+
+	ip := addrIP(remoteAddr)
+	secret := s.GetSecretByIP(ip)
+	if secret == nil {
+		logs.Warning("[%s]==>未授权客户端请求[%s]", remoteAddr, ip)
+		return
+	}
 
-			if ok, n := tryAcquire(); !ok {
-				logs.Warning("[%s]==>接收到的重复请求包(#%d)，当前%d个正在处理。", remoteAddr, packet.Identifier, n)
-				t := time.NewTicker(5000 * time.Millisecond)
-				for {
-					<-t.C
-					if acquired, m := tryAcquire(); acquired {
-						logs.Warning("[%s]==>接收到的重复请求包(#%d)已经处理完成，目前%d个正在处理。", remoteAddr, packet.Identifier, m)
-						break
-					} else {
-						logs.Warning("[%s]==>接收到的重复请求包(#%d)，当前%d个正在处理。", remoteAddr, packet.Identifier, m)
-					}
-				}
-				t.Stop()
-			}
+	packet, err := ParsePacket(buff, secret, s.Dictionary)
+	if err != nil {
+		logs.Warning("[%s]==>解析数据包出错，错误：%s", remoteAddr, err.Error())
+		s.stats.add(ip, rawCode(buff), parseErrorStat(err))
+		return
+	}
+	if !s.acceptPacket(packet, remoteAddr) {
+		return
+	}
+	logs.Debug(packet.String())
 
-			response := responseWriter{
-				conn:   conn,
-				addr:   remoteAddr,
-				packet: packet,
-			}
-			s.Handler.ServeRadius(&response, packet)
+	response := responseWriter{
+		conn:   conn,
+		addr:   remoteAddr,
+		packet: packet,
+		stats:  &s.stats,
+	}
+	if packet.Code == CodeStatusServer {
+		s.serveStatus(&response, packet)
+		return
+	}
 
-			activeLock.Lock()
-			delete(active, key)
-			activeLock.Unlock()
+	// 重复请求（RFC 5080 2.2.2）：处理完的直接发送缓存的响应，正在处理的丢弃
+	key := requestKey{
+		addr:          remoteAddr.String(),
+		identifier:    packet.Identifier,
+		authenticator: packet.Authenticator,
+	}
+	if cached, isNew := s.cache.begin(key); !isNew {
+		s.stats.add(ip, packet.Code, statDuplicate)
+		if cached == nil {
+			logs.Warning("[%s]==>接收到的重复请求包(#%d)正在处理，已丢弃。", remoteAddr, packet.Identifier)
+		} else {
+			logs.Warning("[%s]==>接收到的重复请求包(#%d)，发送缓存的响应。", remoteAddr, packet.Identifier)
+			conn.WriteTo(cached, remoteAddr)
+		}
+		return
+	}
 
-		}(s.listener, buff, remoteAddr)
+	s.stats.add(ip, packet.Code, statRequest)
+	s.Handler.ServeRadius(&response, packet)
+	if !response.written {
+		s.stats.add(ip, packet.Code, statDropped)
 	}
+	s.cache.finish(key, response.response)
+}
 
-	logs.Notice("Radius服务器 ...... 正在关闭")
-	s.listener = nil
-	return nil
+// acceptPacket 检查请求的 Code、Message-Authenticator 和 Authenticator，不接受的请求计入统计并丢弃
+func (s *Server) acceptPacket(packet *TDataPacket, remoteAddr net.Addr) bool {
+	ip := addrIP(remoteAddr)
+	if !isRequestCode(packet.Code) {
+		logs.Warning("[%s]==>不支持的请求包(Code=%d)，已丢弃。", remoteAddr, packet.Code)
+		s.stats.add(ip, packet.Code, statUnknownType)
+		return false
+	}
+	if packet.Code == CodeAccessRequest && !packet.HasMessageAuthenticator() && s.IsMessageAuthenticatorRequired(ip) {
+		logs.Warning("[%s]==>请求包(#%d)缺少Message-Authenticator，已丢弃。", remoteAddr, packet.Identifier)
+		s.stats.add(ip, packet.Code, statInvalid)
+		return false
+	}
+	// Accounting-Request、CoA-Request 和 Disconnect-Request 的 Authenticator 由共享密钥计算，
+	// 校验失败说明请求是伪造的（RFC 2866 3、RFC 5176 3.5）
+	if isComputedRequest(packet.Code) && !packet.IsAuthentic(packet) {
+		logs.Warning("[%s]==>请求包(#%d)的Authenticator校验失败，已丢弃。", remoteAddr, packet.Identifier)
+		s.stats.add(ip, packet.Code, statInvalid)
+		return false
+	}
+	return true
 }
 
+// 解析失败的请求：Message-Authenticator 校验失败为无效请求，其它为格式错误
+func parseErrorStat(err error) int {
+	if errors.Is(err, ErrMessageAuthenticator) {
+		return statInvalid
+	}
+	return statMalformed
+}
+
+// 在工作协程中执行 f，正在处理的请求达到 MaxWorkers 时等待。
+func (s *Server) startWorker(f func()) {
+	s.mu.Lock()
+	if s.workers == nil {
+		n := s.MaxWorkers
+		if n <= 0 {
+			n = defaultMaxWorkers
+		}
+		s.workers = make(chan struct{}, n)
+	}
+	workers := s.workers
+	s.mu.Unlock()
+
+	workers <- struct{}{}
+	atomic.AddInt32(&s.active, 1)
+	go func() {
+		defer func() {
+			atomic.AddInt32(&s.active, -1)
+			<-workers
+		}()
+		f()
+	}()
+}
+
+func (s *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&s.inShutdown) != 0
+}
+
+// Close 立即关闭所有监听和连接，不等待正在处理的请求。
 func (s *Server) Close() error {
 	logs.Notice("Radius服务器 ...... 正在停止")
-	if s.listener == nil {
+	s.closeStreams()
+	s.mu.Lock()
+	listener := s.listener
+	s.listener = nil
+	s.mu.Unlock()
+	if listener == nil {
 		return nil
 	}
-	return s.listener.Close()
+	return listener.Close()
+}
+
+// Shutdown 停止接收新的请求，等待正在处理的请求完成后关闭监听和连接。
+// ctx 结束时强制关闭并返回 ctx.Err()。
+func (s *Server) Shutdown(ctx context.Context) error {
+	logs.Notice("Radius服务器 ...... 正在停止")
+	atomic.StoreInt32(&s.inShutdown, 1)
+	defer atomic.StoreInt32(&s.inShutdown, 0)
+
+	// 只停止读取，处理中的请求还要用连接发送响应
+	s.mu.Lock()
+	listener := s.listener
+	s.mu.Unlock()
+	if listener != nil {
+		listener.SetReadDeadline(time.Unix(1, 0))
+	}
+	s.shutdownStreams()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for atomic.LoadInt32(&s.active) > 0 {
+		select {
+		case <-ctx.Done():
+			s.closeStreams()
+			if listener != nil {
+				listener.Close()
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	if listener != nil {
+		listener.Close()
+	}
+	return nil
 }
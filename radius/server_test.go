@@ -1,8 +1,11 @@
 package radius
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -726,10 +729,8 @@ func TestClientServerIntegration(t *testing.T) {
 	})
 
 	server := &Server{
-		Addr:    "127.0.0.1",
-		Port:    0,
-		Handler: handler,
-		Secret:  secret,
+		Handler:    handler,
+		Secret:     secret,
 		Dictionary: Builtin,
 		ClientsMap: map[string]string{
 			"127.0.0.1": string(secret),
@@ -737,16 +738,11 @@ func TestClientServerIntegration(t *testing.T) {
 	}
 
 	// Start server in background
-	go func() {
-		server.ListenAndServe()
-	}()
-
-	// Give server time to start
-	time.Sleep(100 * time.Millisecond)
-
-	// Get the actual server port
-	localAddr := server.listener.LocalAddr().(*net.UDPAddr)
-	serverPort := localAddr.Port
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	go server.Serve(conn)
 
 	// Create client and send packet
 	client := &Client{
@@ -755,18 +751,19 @@ func TestClientServerIntegration(t *testing.T) {
 		ReadTimeout: 2 * time.Second,
 		WriteTimeout: 2 * time.Second,
 	}
+	defer client.Close()
 
 	packet := NewPacket(CodeAccessRequest, secret)
 	if packet == nil {
 		t.Fatal("NewPacket returned nil")
 	}
-	err := packet.AddAttr("User-Name", "testuser")
+	err = packet.AddAttr("User-Name", "testuser")
 	if err != nil {
 		t.Fatalf("AddAttr failed: %v", err)
 	}
 
 	// Send packet to server
-	addr := fmt.Sprintf("127.0.0.1:%d", serverPort)
+	addr := conn.LocalAddr().String()
 	response, err := client.SendPacket(packet, addr)
 	if err != nil {
 		t.Logf("SendPacket failed (expected in test environment): %v", err)
@@ -834,3 +831,194 @@ func TestServerCloseWithListener(t *testing.T) {
 		t.Fatalf("Second close failed: %v", err)
 	}
 }
+
+// TestServerServePacketConn tests Serve on an existing PacketConn
+func TestServerServePacketConn(t *testing.T) {
+	secret := []byte("secret")
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	server := &Server{
+		Dictionary: Builtin,
+		Handler: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			w.AccessAccept()
+		}),
+		ClientsMap: map[string]string{"127.0.0.1": string(secret)},
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(conn) }()
+
+	client := &Client{ReadTimeout: time.Second}
+	defer client.Close()
+	request := NewPacket(CodeAccessRequest, secret)
+	request.AddAttr("User-Name", "testuser")
+	response, err := client.SendPacket(request, conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("SendPacket failed: %v", err)
+	}
+	if response.Code != CodeAccessAccept {
+		t.Errorf("Expected Access-Accept, got %d", response.Code)
+	}
+
+	if err := server.Serve(conn); err == nil {
+		t.Error("Expected error when server is already running")
+	}
+	server.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Expected Serve to return nil after Close, got %v", err)
+	}
+}
+
+// errPacketConn is a PacketConn whose reads fail with a plain error
+type errPacketConn struct {
+	net.PacketConn
+}
+
+func (c *errPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return 0, nil, errors.New("read failed")
+}
+
+// TestServerServeReadError tests that Serve returns errors other than *net.OpError
+func TestServerServeReadError(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	server := &Server{Handler: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {})}
+	if err := server.Serve(&errPacketConn{conn}); err == nil || err.Error() != "read failed" {
+		t.Errorf("Expected read error, got %v", err)
+	}
+}
+
+// TestServerShutdown tests that Shutdown waits for in-flight handlers
+func TestServerShutdown(t *testing.T) {
+	secret := []byte("secret")
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	started := make(chan struct{})
+	server := &Server{
+		Dictionary: Builtin,
+		Handler: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			w.AccessAccept()
+		}),
+		ClientsMap: map[string]string{"127.0.0.1": string(secret)},
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(conn) }()
+
+	client := &Client{ReadTimeout: 2 * time.Second}
+	defer client.Close()
+	request := NewPacket(CodeAccessRequest, secret)
+	request.AddAttr("User-Name", "testuser")
+	result := make(chan error, 1)
+	go func() {
+		_, err := client.SendPacket(request, conn.LocalAddr().String())
+		result <- err
+	}()
+
+	<-started
+	begin := time.Now()
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if time.Since(begin) < 150*time.Millisecond {
+		t.Error("Expected Shutdown to wait for the handler")
+	}
+	if err := <-result; err != nil {
+		t.Errorf("Expected in-flight request to be answered, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected Serve to return nil, got %v", err)
+	}
+	if _, _, err := conn.ReadFrom(make([]byte, 10)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected conn to be closed, got %v", err)
+	}
+}
+
+// TestServerShutdownTimeout tests Shutdown with an expired context
+func TestServerShutdownTimeout(t *testing.T) {
+	secret := []byte("secret")
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	server := &Server{
+		Dictionary: Builtin,
+		Handler: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			close(started)
+			<-release
+		}),
+		ClientsMap: map[string]string{"127.0.0.1": string(secret)},
+	}
+	go server.Serve(conn)
+	defer close(release)
+
+	request := NewPacket(CodeAccessRequest, secret)
+	request.AddAttr("User-Name", "testuser")
+	data, _ := request.Encode()
+	sender, _ := net.Dial("udp", conn.LocalAddr().String())
+	defer sender.Close()
+	sender.Write(data)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+// TestServerMaxWorkers tests that concurrent handlers are bounded by MaxWorkers
+func TestServerMaxWorkers(t *testing.T) {
+	secret := []byte("secret")
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	var running, peak int32
+	server := &Server{
+		Dictionary: Builtin,
+		MaxWorkers: 2,
+		Handler: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			w.AccessAccept()
+		}),
+		ClientsMap: map[string]string{"127.0.0.1": string(secret)},
+	}
+	go server.Serve(conn)
+	defer server.Close()
+
+	client := &Client{ReadTimeout: 2 * time.Second}
+	defer client.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request := NewPacket(CodeAccessRequest, secret)
+			request.AddAttr("User-Name", "testuser")
+			if _, err := client.SendPacket(request, conn.LocalAddr().String()); err != nil {
+				t.Errorf("SendPacket failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak > 2 {
+		t.Errorf("Expected at most 2 concurrent handlers, got %d", peak)
+	}
+}
@@ -0,0 +1,197 @@
+package radius
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// TServerStats 是服务器或一个客户端的请求统计，对应 FreeRADIUS 的统计属性
+type TServerStats struct {
+	AccessRequests   uint64 // 收到的 Access-Request
+	AccessAccepts    uint64
+	AccessRejects    uint64
+	AccessChallenges uint64
+	AuthResponses    uint64 // 发送的认证响应
+	AuthDuplicates   uint64 // 重复的 Access-Request
+	AuthMalformed    uint64 // 无法解析的认证请求
+	AuthInvalid      uint64 // 校验失败的认证请求（Message-Authenticator 错误等）
+	AuthDropped      uint64 // 丢弃或没有回复的认证请求
+	AuthUnknownTypes uint64 // 不支持的 Code
+
+	AccountingRequests  uint64 // 收到的 Accounting-Request
+	AccountingResponses uint64
+	AcctDuplicates      uint64
+	AcctMalformed       uint64
+	AcctInvalid         uint64
+	AcctDropped         uint64
+	AcctUnknownTypes    uint64
+}
+
+// 统计事件
+const (
+	statRequest = iota
+	statDuplicate
+	statMalformed
+	statInvalid
+	statDropped
+	statUnknownType
+)
+
+// 服务器的统计，零值可用
+type serverStats struct {
+	mu      sync.Mutex
+	start   time.Time
+	total   TServerStats
+	clients map[string]*TServerStats // 客户端IP->统计
+}
+
+// add 按请求的 Code 记录统计事件，ip 为nil时只记录到总计
+func (s *serverStats) add(ip net.IP, code Code, event int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total.add(code, event)
+	if client := s.client(ip); client != nil {
+		client.add(code, event)
+	}
+}
+
+// response 记录发送的响应
+func (s *serverStats) response(ip net.IP, code Code) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total.addResponse(code)
+	if client := s.client(ip); client != nil {
+		client.addResponse(code)
+	}
+}
+
+func (s *serverStats) client(ip net.IP) *TServerStats {
+	if ip == nil {
+		return nil
+	}
+	if s.clients == nil {
+		s.clients = make(map[string]*TServerStats)
+	}
+	key := ip.String()
+	client := s.clients[key]
+	if client == nil {
+		client = &TServerStats{}
+		s.clients[key] = client
+	}
+	return client
+}
+
+func (t *TServerStats) add(code Code, event int) {
+	if code == CodeAccountingRequest {
+		switch event {
+		case statRequest:
+			t.AccountingRequests++
+		case statDuplicate:
+			t.AcctDuplicates++
+		case statMalformed:
+			t.AcctMalformed++
+		case statInvalid:
+			t.AcctInvalid++
+		case statDropped:
+			t.AcctDropped++
+		}
+		return
+	}
+	// 其它请求（包括无法识别的 Code）按认证统计，同 FreeRADIUS
+	switch event {
+	case statRequest:
+		if code == CodeAccessRequest {
+			t.AccessRequests++
+		}
+	case statDuplicate:
+		t.AuthDuplicates++
+	case statMalformed:
+		t.AuthMalformed++
+	case statInvalid:
+		t.AuthInvalid++
+	case statDropped:
+		t.AuthDropped++
+	case statUnknownType:
+		t.AuthUnknownTypes++
+	}
+}
+
+func (t *TServerStats) addResponse(code Code) {
+	switch code {
+	case CodeAccessAccept:
+		t.AccessAccepts++
+	case CodeAccessReject:
+		t.AccessRejects++
+	case CodeAccessChallenge:
+		t.AccessChallenges++
+	case CodeAccountingResponse:
+		t.AccountingResponses++
+		return
+	default:
+		return
+	}
+	t.AuthResponses++
+}
+
+// 服务器能处理的请求
+func isRequestCode(code Code) bool {
+	switch code {
+	case CodeAccessRequest, CodeAccountingRequest, CodeStatusServer, CodeDisconnectRequest, CodeCoARequest:
+		return true
+	}
+	return false
+}
+
+// 无法解析的数据包的 Code，数据包为空时为0
+func rawCode(buff []byte) Code {
+	if len(buff) == 0 {
+		return 0
+	}
+	return Code(buff[0])
+}
+
+// 记录开始时间，Serve 和 ServeTCP 调用
+func (s *Server) startStats() {
+	s.stats.mu.Lock()
+	if s.stats.start.IsZero() {
+		s.stats.start = time.Now()
+	}
+	s.stats.mu.Unlock()
+}
+
+// Stats 返回服务器所有客户端的请求统计
+func (s *Server) Stats() TServerStats {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	return s.stats.total
+}
+
+// ClientStats 返回一个客户端的请求统计，没有收到过该客户端的请求时返回false
+func (s *Server) ClientStats(ip net.IP) (TServerStats, bool) {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	client := s.stats.clients[ip.String()]
+	if client == nil {
+		return TServerStats{}, false
+	}
+	return *client, true
+}
+
+// AllClientStats 返回所有客户端的请求统计，键为客户端IP
+func (s *Server) AllClientStats() map[string]TServerStats {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	result := make(map[string]TServerStats, len(s.stats.clients))
+	for ip, client := range s.stats.clients {
+		result[ip] = *client
+	}
+	return result
+}
+
+// StartTime 返回服务器开始服务的时间
+func (s *Server) StartTime() time.Time {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	return s.stats.start
+}
@@ -0,0 +1,123 @@
+package radius
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestServerStatsAdd tests the counters of TServerStats
+func TestServerStatsAdd(t *testing.T) {
+	var stats TServerStats
+	stats.add(CodeAccessRequest, statRequest)
+	stats.add(CodeAccessRequest, statDuplicate)
+	stats.add(CodeAccountingRequest, statRequest)
+	stats.add(CodeAccountingRequest, statMalformed)
+	stats.add(CodeCoARequest, statRequest)
+	stats.add(Code(99), statUnknownType)
+	stats.addResponse(CodeAccessAccept)
+	stats.addResponse(CodeAccessChallenge)
+	stats.addResponse(CodeAccountingResponse)
+	stats.addResponse(CodeCoAACK)
+
+	expected := TServerStats{
+		AccessRequests:      1,
+		AccessAccepts:       1,
+		AccessChallenges:    1,
+		AuthResponses:       2,
+		AuthDuplicates:      1,
+		AuthUnknownTypes:    1,
+		AccountingRequests:  1,
+		AccountingResponses: 1,
+		AcctMalformed:       1,
+	}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+}
+
+// TestServerStats tests the statistics collected by the server
+func TestServerStats(t *testing.T) {
+	secret := []byte("secret")
+	server := &Server{
+		Dictionary: Builtin,
+		Handler: HandlerFunc(func(w ResponseWriter, p *TDataPacket) {
+			switch p.GetValue("User-Name") {
+			case "alice":
+				w.AccessAccept()
+			case "bob":
+				w.AccessReject()
+			}
+		}),
+		ClientsMap: map[string]string{"127.0.0.1": string(secret)},
+	}
+	if !server.StartTime().IsZero() {
+		t.Error("Expected zero StartTime before Serve")
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	go server.Serve(conn)
+	defer server.Close()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+	send := func(data []byte) {
+		t.Helper()
+		if _, err := client.Write(data); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	request := func(username string) []byte {
+		t.Helper()
+		packet := NewPacket(CodeAccessRequest, secret)
+		packet.Set("User-Name", username)
+		data, err := packet.Encode()
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		return data
+	}
+
+	alice := request("alice")
+	send(alice)
+	send(request("bob"))
+	send(request("carol")) // no response
+	send([]byte{byte(CodeAccessRequest), 1, 0, 30})
+	unknown := request("dave")
+	unknown[0] = byte(CodeAccessAccept)
+	send(unknown)
+	time.Sleep(100 * time.Millisecond)
+	send(alice) // answered from the duplicate cache
+	time.Sleep(100 * time.Millisecond)
+
+	expected := TServerStats{
+		AccessRequests:   3,
+		AccessAccepts:    1,
+		AccessRejects:    1,
+		AuthResponses:    2,
+		AuthDuplicates:   1,
+		AuthMalformed:    1,
+		AuthDropped:      1,
+		AuthUnknownTypes: 1,
+	}
+	if stats := server.Stats(); stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+	if stats, ok := server.ClientStats(net.IPv4(127, 0, 0, 1)); !ok || stats != expected {
+		t.Errorf("Expected client statistics %+v, got %+v", expected, stats)
+	}
+	if _, ok := server.ClientStats(net.IPv4(10, 0, 0, 1)); ok {
+		t.Error("Expected no statistics for an unknown client")
+	}
+	if all := server.AllClientStats(); len(all) != 1 || all["127.0.0.1"] != expected {
+		t.Errorf("Expected statistics of 127.0.0.1, got %v", all)
+	}
+	if server.StartTime().IsZero() {
+		t.Error("Expected StartTime after Serve")
+	}
+}
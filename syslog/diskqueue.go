@@ -0,0 +1,810 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tea4go/gh/syslog/format"
+)
+
+const (
+	defaultQueueSegmentSize   = 16 * 1024 * 1024
+	defaultQueueMaxBytes      = 1024 * 1024 * 1024
+	defaultQueueMaxInflight   = 64
+	defaultQueueRetryInterval = time.Second
+
+	queueSegmentExt     = ".seg"
+	queueCheckpointFile = "checkpoint"
+	queueRecordHeader   = 8 // 4 byte length + 4 byte CRC32
+)
+
+var (
+	ErrQueueFull    = errors.New("disk queue is full")
+	ErrQueueClosed  = errors.New("disk queue is closed")
+	ErrQueueCorrupt = errors.New("disk queue segment is corrupt")
+)
+
+// Acknowledges an entry. With a non-nil err the entry is delivered again after
+// RetryInterval. It may be called after HandleAck returned, from another
+// goroutine, only the first successful call counts
+type AckFunc func(err error)
+
+// Receives the entries of a DiskQueue and calls ack once they are handled
+type AckHandler interface {
+	HandleAck(logParts format.LogParts, messageLength int64, err error, ack AckFunc)
+}
+
+type autoAckHandler struct {
+	handler Handler
+}
+
+func (h autoAckHandler) HandleAck(logParts format.LogParts, messageLength int64, err error, ack AckFunc) {
+	h.handler.Handle(logParts, messageLength, err)
+	ack(nil)
+}
+
+// Makes a Handler an AckHandler, an entry is acknowledged when Handle returns
+func AutoAck(handler Handler) AckHandler {
+	return autoAckHandler{handler}
+}
+
+// Configuration of a DiskQueue
+type DiskQueueConfig struct {
+	Dir           string        // directory of the segment files and the checkpoint
+	SegmentSize   int64         // size of a segment file, 16MB by default
+	MaxBytes      int64         // disk space limit, 1GB by default, new entries are dropped above it
+	SyncInterval  time.Duration // fsync interval, 0 syncs every entry (safest, slowest)
+	MaxInflight   int           // max entries delivered and not acknowledged, 64 by default
+	RetryInterval time.Duration // delay before delivering again after ack(err), 1 second by default
+}
+
+type queuePosition struct {
+	segment int64
+	offset  int64
+}
+
+type queueEntry struct {
+	next  queuePosition // position after the entry
+	acked bool
+}
+
+// A persistent queue between the receiver and a Handler. Every entry is
+// appended to a segment file, then delivered in order to an AckHandler, and
+// the checkpoint only moves once it is acknowledged (at-least-once). After a
+// restart the entries after the checkpoint are delivered again, segment files
+// with all entries acknowledged are removed
+//
+//	queue, err := syslog.NewDiskQueue(syslog.DiskQueueConfig{Dir: "/var/spool/syslog"}, syslog.AutoAck(handler))
+//	server.SetHandler(queue)
+//	...
+//	server.Shutdown(ctx)
+//	queue.Close()
+type DiskQueue struct {
+	config  DiskQueueConfig
+	handler AckHandler
+
+	lock    sync.Mutex
+	cond    *sync.Cond // new entries, acks and close
+	closed  bool       // no more entries are accepted or delivered
+	stopped bool       // files are closed, acks are ignored
+
+	segments   []int64 // segments on disk, ascending
+	sizes      map[int64]int64
+	totalBytes int64
+
+	writer    *os.File
+	writeID   int64
+	writeSize int64
+	dirty     bool // written since the last sync
+
+	reader     *os.File
+	readID     int64
+	readOffset int64
+
+	inflight        []*queueEntry
+	checkpoint      queuePosition
+	checkpointDirty bool
+
+	dropped   uint64
+	lastError error
+
+	handlers sync.WaitGroup // running HandleAck calls
+	workers  sync.WaitGroup // delivery and sync goroutines
+	done     chan struct{}
+}
+
+// Opens (or creates) a DiskQueue and delivers the entries not acknowledged before
+func NewDiskQueue(config DiskQueueConfig, handler AckHandler) (*DiskQueue, error) {
+	if config.Dir == "" {
+		return nil, errors.New("please set a valid directory")
+	}
+	if handler == nil {
+		return nil, errors.New("please set a valid handler")
+	}
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = defaultQueueSegmentSize
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultQueueMaxBytes
+	}
+	if config.MaxInflight <= 0 {
+		config.MaxInflight = defaultQueueMaxInflight
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = defaultQueueRetryInterval
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	q := &DiskQueue{
+		config:  config,
+		handler: handler,
+		sizes:   make(map[int64]int64),
+		done:    make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.lock)
+	if err := q.recover(); err != nil {
+		q.closeFiles()
+		return nil, err
+	}
+
+	q.workers.Add(1)
+	go q.deliver()
+	if config.SyncInterval > 0 {
+		q.workers.Add(1)
+		go q.syncLoop()
+	}
+	return q, nil
+}
+
+// Reads the checkpoint and the segments, a partly written entry at the end of
+// the last segment is truncated
+func (q *DiskQueue) recover() error {
+	checkpoint, err := q.readCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(q.config.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, queueSegmentExt) {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSuffix(name, queueSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		if id < checkpoint.segment {
+			// all acknowledged, the process exited while removing it
+			os.Remove(q.segmentPath(id))
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		q.segments = append(q.segments, id)
+		q.sizes[id] = info.Size()
+		q.totalBytes += info.Size()
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+
+	if len(q.segments) == 0 {
+		if checkpoint.segment == 0 {
+			checkpoint.segment = 1
+		}
+		checkpoint.offset = 0
+		q.segments = []int64{checkpoint.segment}
+		q.sizes[checkpoint.segment] = 0
+	}
+	if checkpoint.segment < q.segments[0] {
+		checkpoint = queuePosition{q.segments[0], 0}
+	}
+
+	q.writeID = q.segments[len(q.segments)-1]
+	q.writer, err = os.OpenFile(q.segmentPath(q.writeID), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	valid := validLength(q.writer, q.sizes[q.writeID])
+	if valid < q.sizes[q.writeID] {
+		if err := q.writer.Truncate(valid); err != nil {
+			return err
+		}
+		q.totalBytes -= q.sizes[q.writeID] - valid
+		q.sizes[q.writeID] = valid
+	}
+	if _, err := q.writer.Seek(valid, io.SeekStart); err != nil {
+		return err
+	}
+	q.writeSize = valid
+
+	q.checkpoint = checkpoint
+	q.readID = checkpoint.segment
+	q.readOffset = checkpoint.offset
+	if q.readID == q.writeID && q.readOffset > q.writeSize {
+		q.readOffset = q.writeSize
+	}
+	return nil
+}
+
+// Returns the length of the complete entries from the start
+func validLength(file *os.File, size int64) int64 {
+	var offset int64
+	header := make([]byte, queueRecordHeader)
+	for {
+		if _, err := file.ReadAt(header, offset); err != nil {
+			return offset
+		}
+		length := int64(binary.BigEndian.Uint32(header))
+		if offset+queueRecordHeader+length > size {
+			return offset
+		}
+		payload := make([]byte, length)
+		if _, err := file.ReadAt(payload, offset+queueRecordHeader); err != nil {
+			return offset
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			return offset
+		}
+		offset += queueRecordHeader + length
+	}
+}
+
+// Appends the entry to the current segment
+func (q *DiskQueue) Handle(logParts format.LogParts, messageLength int64, err error) {
+	payload, encodeErr := encodeQueueRecord(logParts, messageLength, err)
+	if encodeErr != nil {
+		q.setLastError(encodeErr)
+		return
+	}
+	record := make([]byte, queueRecordHeader+len(payload))
+	binary.BigEndian.PutUint32(record, uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(payload))
+	copy(record[queueRecordHeader:], payload)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		q.dropped++
+		q.lastError = ErrQueueClosed
+		return
+	}
+	if q.totalBytes+int64(len(record)) > q.config.MaxBytes {
+		q.dropped++
+		q.lastError = ErrQueueFull
+		return
+	}
+	if q.writeSize > 0 && q.writeSize+int64(len(record)) > q.config.SegmentSize {
+		if err := q.rollLocked(); err != nil {
+			q.dropped++
+			q.lastError = err
+			return
+		}
+	}
+
+	if _, err := q.writer.Write(record); err != nil {
+		// a partly written entry is truncated on the next start, go back to the
+		// position before it
+		q.writer.Truncate(q.writeSize)
+		q.writer.Seek(q.writeSize, io.SeekStart)
+		q.dropped++
+		q.lastError = err
+		return
+	}
+	q.writeSize += int64(len(record))
+	q.sizes[q.writeID] = q.writeSize
+	q.totalBytes += int64(len(record))
+	if q.config.SyncInterval == 0 {
+		if err := q.writer.Sync(); err != nil {
+			q.lastError = err
+		}
+	} else {
+		q.dirty = true
+	}
+	q.cond.Broadcast()
+}
+
+// Starts a new segment when the current one is full
+func (q *DiskQueue) rollLocked() error {
+	if err := q.writer.Sync(); err != nil {
+		return err
+	}
+	id := q.writeID + 1
+	writer, err := os.OpenFile(q.segmentPath(id), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	q.writer.Close()
+	q.writer = writer
+	q.writeID = id
+	q.writeSize = 0
+	q.dirty = false
+	q.segments = append(q.segments, id)
+	q.sizes[id] = 0
+	return nil
+}
+
+// Reads and delivers the entries in order
+func (q *DiskQueue) deliver() {
+	defer q.workers.Done()
+	for {
+		q.lock.Lock()
+		for !q.closed && (len(q.inflight) >= q.config.MaxInflight || !q.hasDataLocked()) {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.lock.Unlock()
+			return
+		}
+		payload, next, err := q.readLocked()
+		if err != nil {
+			q.lastError = err
+			q.lock.Unlock()
+			continue
+		}
+		entry := &queueEntry{next: next}
+		q.inflight = append(q.inflight, entry)
+		q.handlers.Add(1)
+		q.lock.Unlock()
+
+		logParts, messageLength, handleErr, err := decodeQueueRecord(payload)
+		if err != nil {
+			// an entry which can not be decoded will not get better, acknowledge it
+			q.setLastError(err)
+			q.acknowledge(entry)
+			q.handlers.Done()
+			continue
+		}
+		q.handle(entry, logParts, messageLength, handleErr)
+	}
+}
+
+// Calls the handler, the caller did q.handlers.Add(1)
+func (q *DiskQueue) handle(entry *queueEntry, logParts format.LogParts, messageLength int64, handleErr error) {
+	defer q.handlers.Done()
+
+	var once sync.Once
+	var ack AckFunc
+	ack = func(err error) {
+		if err == nil {
+			once.Do(func() { q.acknowledge(entry) })
+			return
+		}
+		time.AfterFunc(q.config.RetryInterval, func() {
+			q.lock.Lock()
+			if q.closed || entry.acked {
+				q.lock.Unlock()
+				return
+			}
+			q.handlers.Add(1)
+			q.lock.Unlock()
+			// a retry gets another copy, the previous call may still hold the
+			// LogParts
+			q.handle(entry, copyLogParts(logParts), messageLength, handleErr)
+		})
+	}
+	q.handler.HandleAck(logParts, messageLength, handleErr, ack)
+}
+
+// Acknowledges an entry, moves the checkpoint and removes the segments with
+// all entries acknowledged
+func (q *DiskQueue) acknowledge(entry *queueEntry) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.stopped {
+		return
+	}
+	entry.acked = true
+
+	advanced := false
+	for len(q.inflight) > 0 && q.inflight[0].acked {
+		q.checkpoint = q.inflight[0].next
+		q.inflight[0] = nil
+		q.inflight = q.inflight[1:]
+		advanced = true
+	}
+	if !advanced {
+		return
+	}
+
+	for len(q.segments) > 0 && q.segments[0] < q.checkpoint.segment {
+		id := q.segments[0]
+		if err := os.Remove(q.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+			q.lastError = err
+		}
+		q.totalBytes -= q.sizes[id]
+		delete(q.sizes, id)
+		q.segments = q.segments[1:]
+	}
+
+	if q.config.SyncInterval == 0 {
+		q.writeCheckpointLocked()
+	} else {
+		q.checkpointDirty = true
+	}
+	q.cond.Broadcast()
+}
+
+func (q *DiskQueue) hasDataLocked() bool {
+	return q.readID < q.writeID || q.readOffset < q.writeSize
+}
+
+// Reads the next entry and returns the position after it
+func (q *DiskQueue) readLocked() ([]byte, queuePosition, error) {
+	if q.readID < q.writeID && q.readOffset >= q.sizes[q.readID] {
+		q.nextReadSegmentLocked()
+	}
+	if q.reader == nil {
+		reader, err := os.Open(q.segmentPath(q.readID))
+		if err != nil {
+			q.skipReadSegmentLocked()
+			return nil, queuePosition{}, err
+		}
+		q.reader = reader
+	}
+
+	header := make([]byte, queueRecordHeader)
+	if _, err := q.reader.ReadAt(header, q.readOffset); err != nil {
+		q.skipReadSegmentLocked()
+		return nil, queuePosition{}, err
+	}
+	length := int64(binary.BigEndian.Uint32(header))
+	if q.readOffset+queueRecordHeader+length > q.sizes[q.readID] {
+		q.skipReadSegmentLocked()
+		return nil, queuePosition{}, ErrQueueCorrupt
+	}
+	payload := make([]byte, length)
+	if _, err := q.reader.ReadAt(payload, q.readOffset+queueRecordHeader); err != nil {
+		q.skipReadSegmentLocked()
+		return nil, queuePosition{}, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		q.skipReadSegmentLocked()
+		return nil, queuePosition{}, ErrQueueCorrupt
+	}
+
+	q.readOffset += queueRecordHeader + length
+	return payload, queuePosition{q.readID, q.readOffset}, nil
+}
+
+func (q *DiskQueue) nextReadSegmentLocked() {
+	if q.reader != nil {
+		q.reader.Close()
+		q.reader = nil
+	}
+	for _, id := range q.segments {
+		if id > q.readID {
+			q.readID = id
+			q.readOffset = 0
+			return
+		}
+	}
+}
+
+// The rest of a corrupted segment is skipped. Its entries are never
+// acknowledged, the segment is removed when the checkpoint passes it
+func (q *DiskQueue) skipReadSegmentLocked() {
+	if q.readID < q.writeID {
+		q.nextReadSegmentLocked()
+	} else {
+		q.readOffset = q.writeSize
+	}
+}
+
+func (q *DiskQueue) syncLoop() {
+	defer q.workers.Done()
+	ticker := time.NewTicker(q.config.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+			q.lock.Lock()
+			q.syncLocked()
+			q.lock.Unlock()
+		}
+	}
+}
+
+func (q *DiskQueue) syncLocked() {
+	if q.dirty {
+		if err := q.writer.Sync(); err != nil {
+			q.lastError = err
+		}
+		q.dirty = false
+	}
+	if q.checkpointDirty {
+		q.writeCheckpointLocked()
+	}
+}
+
+func (q *DiskQueue) segmentPath(id int64) string {
+	return filepath.Join(q.config.Dir, fmt.Sprintf("%020d%s", id, queueSegmentExt))
+}
+
+func (q *DiskQueue) readCheckpoint() (queuePosition, error) {
+	var checkpoint queuePosition
+	data, err := os.ReadFile(filepath.Join(q.config.Dir, queueCheckpointFile))
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	} else if err != nil {
+		return checkpoint, err
+	}
+	if _, err := fmt.Sscanf(string(data), "%d %d", &checkpoint.segment, &checkpoint.offset); err != nil {
+		return checkpoint, fmt.Errorf("invalid checkpoint: %v", err)
+	}
+	return checkpoint, nil
+}
+
+// Writes a temporary file and renames it, so the checkpoint is always complete
+func (q *DiskQueue) writeCheckpointLocked() {
+	filename := filepath.Join(q.config.Dir, queueCheckpointFile)
+	tmp := filename + ".tmp"
+	data := fmt.Sprintf("%d %d\n", q.checkpoint.segment, q.checkpoint.offset)
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err == nil {
+		_, err = file.WriteString(data)
+		if err == nil {
+			err = file.Sync()
+		}
+		file.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		q.lastError = err
+		return
+	}
+	q.checkpointDirty = false
+}
+
+// Returns the entries dropped because the queue was full or closed, or a
+// write failed
+func (q *DiskQueue) Dropped() uint64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.dropped
+}
+
+// Returns the disk space used by the segments
+func (q *DiskQueue) Bytes() int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.totalBytes
+}
+
+// Returns the last error
+func (q *DiskQueue) GetLastError() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.lastError
+}
+
+func (q *DiskQueue) setLastError(err error) {
+	q.lock.Lock()
+	q.lastError = err
+	q.lock.Unlock()
+}
+
+// Stops the delivery, waits for the running HandleAck calls, syncs and closes
+// the files. Entries not acknowledged are delivered again by the next
+// NewDiskQueue, later acks are ignored
+func (q *DiskQueue) Close() error {
+	q.lock.Lock()
+	if q.closed {
+		q.lock.Unlock()
+		return nil
+	}
+	q.closed = true
+	close(q.done)
+	q.cond.Broadcast()
+	q.lock.Unlock()
+
+	q.workers.Wait()
+	q.handlers.Wait()
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.stopped = true
+	q.dirty = true
+	q.syncLocked()
+	err := q.lastError
+	if errors.Is(err, ErrQueueClosed) || errors.Is(err, ErrQueueFull) {
+		err = nil
+	}
+	q.closeFiles()
+	return err
+}
+
+func (q *DiskQueue) closeFiles() {
+	if q.reader != nil {
+		q.reader.Close()
+		q.reader = nil
+	}
+	if q.writer != nil {
+		q.writer.Close()
+	}
+}
+
+// Encoding of an entry: varint messageLength, error text and number of keys,
+// then key, type byte and value of every key. The usual LogParts types are
+// kept, other types (e.g. objects of a JSON payload) are stored as JSON
+const (
+	queueTypeNil    = 'n'
+	queueTypeString = 's'
+	queueTypeInt    = 'i'
+	queueTypeInt64  = 'I'
+	queueTypeFloat  = 'f'
+	queueTypeBool   = 'b'
+	queueTypeTime   = 't'
+	queueTypeJSON   = 'j'
+)
+
+func encodeQueueRecord(logParts format.LogParts, messageLength int64, err error) ([]byte, error) {
+	var b bytes.Buffer
+	putVarint(&b, messageLength)
+	if err != nil {
+		putString(&b, err.Error())
+	} else {
+		putString(&b, "")
+	}
+	putVarint(&b, int64(len(logParts)))
+
+	for key, value := range logParts {
+		putString(&b, key)
+		switch v := value.(type) {
+		case nil:
+			b.WriteByte(queueTypeNil)
+		case string:
+			b.WriteByte(queueTypeString)
+			putString(&b, v)
+		case int:
+			b.WriteByte(queueTypeInt)
+			putVarint(&b, int64(v))
+		case int64:
+			b.WriteByte(queueTypeInt64)
+			putVarint(&b, v)
+		case float64:
+			b.WriteByte(queueTypeFloat)
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+			b.Write(buf[:])
+		case bool:
+			b.WriteByte(queueTypeBool)
+			if v {
+				b.WriteByte(1)
+			} else {
+				b.WriteByte(0)
+			}
+		case time.Time:
+			data, err := v.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			b.WriteByte(queueTypeTime)
+			putString(&b, string(data))
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %v", key, err)
+			}
+			b.WriteByte(queueTypeJSON)
+			putString(&b, string(data))
+		}
+	}
+	return b.Bytes(), nil
+}
+
+func decodeQueueRecord(data []byte) (format.LogParts, int64, error, error) {
+	r := bytes.NewReader(data)
+	messageLength, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, 0, nil, ErrQueueCorrupt
+	}
+	errText, err := getString(r)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	var handleErr error
+	if errText != "" {
+		handleErr = errors.New(errText)
+	}
+	count, err := binary.ReadVarint(r)
+	if err != nil || count < 0 || count > int64(len(data)) {
+		return nil, 0, nil, ErrQueueCorrupt
+	}
+
+	logParts := make(format.LogParts, count)
+	for i := int64(0); i < count; i++ {
+		key, err := getString(r)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, 0, nil, ErrQueueCorrupt
+		}
+		var value interface{}
+		switch kind {
+		case queueTypeNil:
+		case queueTypeString:
+			value, err = getString(r)
+		case queueTypeInt, queueTypeInt64:
+			var v int64
+			v, err = binary.ReadVarint(r)
+			if kind == queueTypeInt {
+				value = int(v)
+			} else {
+				value = v
+			}
+		case queueTypeFloat:
+			var buf [8]byte
+			_, err = io.ReadFull(r, buf[:])
+			value = math.Float64frombits(binary.BigEndian.Uint64(buf[:]))
+		case queueTypeBool:
+			var v byte
+			v, err = r.ReadByte()
+			value = v == 1
+		case queueTypeTime:
+			var data string
+			if data, err = getString(r); err == nil {
+				var ts time.Time
+				err = ts.UnmarshalBinary([]byte(data))
+				value = ts
+			}
+		case queueTypeJSON:
+			var data string
+			if data, err = getString(r); err == nil {
+				err = json.Unmarshal([]byte(data), &value)
+			}
+		default:
+			err = ErrQueueCorrupt
+		}
+		if err != nil {
+			return nil, 0, nil, ErrQueueCorrupt
+		}
+		logParts[key] = value
+	}
+	return logParts, messageLength, handleErr, nil
+}
+
+func putVarint(b *bytes.Buffer, v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutVarint(buf[:], v)])
+}
+
+func putString(b *bytes.Buffer, s string) {
+	putVarint(b, int64(len(s)))
+	b.WriteString(s)
+}
+
+func getString(r *bytes.Reader) (string, error) {
+	length, err := binary.ReadVarint(r)
+	if err != nil || length < 0 || length > int64(r.Len()) {
+		return "", ErrQueueCorrupt
+	}
+	buf := make([]byte, length)
+	io.ReadFull(r, buf)
+	return string(buf), nil
+}
@@ -0,0 +1,251 @@
+package syslog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tea4go/gh/syslog/format"
+)
+
+// keeps the ack functions, acknowledges nothing by itself
+type pendingAckHandler struct {
+	lock  sync.Mutex
+	parts []format.LogParts
+	acks  []AckFunc
+}
+
+func (h *pendingAckHandler) HandleAck(logParts format.LogParts, messageLength int64, err error, ack AckFunc) {
+	h.lock.Lock()
+	h.parts = append(h.parts, logParts)
+	h.acks = append(h.acks, ack)
+	h.lock.Unlock()
+}
+
+func (h *pendingAckHandler) count() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return len(h.parts)
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNewDiskQueue_Invalid(t *testing.T) {
+	if _, err := NewDiskQueue(DiskQueueConfig{}, AutoAck(&collectHandler{})); err == nil {
+		t.Error("expected an error without directory")
+	}
+	if _, err := NewDiskQueue(DiskQueueConfig{Dir: t.TempDir()}, nil); err == nil {
+		t.Error("expected an error without handler")
+	}
+}
+
+func TestDiskQueue_RecordEncoding(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 10, 20, 30, 123, time.FixedZone("CST", 8*3600))
+	parts := format.LogParts{
+		"timestamp": ts,
+		"hostname":  "fw01",
+		"priority":  34,
+		"size":      int64(1 << 40),
+		"ratio":     0.5,
+		"ok":        true,
+		"missing":   nil,
+		"nested":    map[string]interface{}{"a": "b"},
+	}
+	data, err := encodeQueueRecord(parts, 42, errors.New("parse error"))
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	decoded, messageLength, handleErr, err := decodeQueueRecord(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if messageLength != 42 || handleErr == nil || handleErr.Error() != "parse error" {
+		t.Errorf("messageLength = %d, err = %v", messageLength, handleErr)
+	}
+	if !decoded["timestamp"].(time.Time).Equal(ts) {
+		t.Errorf("timestamp = %v, want %v", decoded["timestamp"], ts)
+	}
+	for _, key := range []string{"hostname", "priority", "size", "ratio", "ok", "missing"} {
+		if decoded[key] != parts[key] {
+			t.Errorf("%s = %#v, want %#v", key, decoded[key], parts[key])
+		}
+	}
+	if nested, ok := decoded["nested"].(map[string]interface{}); !ok || nested["a"] != "b" {
+		t.Errorf("nested = %#v", decoded["nested"])
+	}
+
+	if _, _, _, err := decodeQueueRecord(data[:len(data)-3]); err == nil {
+		t.Error("expected an error for a truncated record")
+	}
+}
+
+func TestDiskQueue_DeliverInOrder(t *testing.T) {
+	dir := t.TempDir()
+	h := &collectHandler{}
+	q, err := NewDiskQueue(DiskQueueConfig{Dir: dir, SegmentSize: 256}, AutoAck(h))
+	if err != nil {
+		t.Fatalf("NewDiskQueue failed: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		q.Handle(format.LogParts{"n": i}, 10, nil)
+	}
+	waitFor(t, "delivery", func() bool { return h.count() == 50 })
+	if err := q.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	for i, parts := range h.parts {
+		if parts["n"] != i {
+			t.Fatalf("entry %d: n = %v", i, parts["n"])
+		}
+	}
+
+	// acknowledged segments are removed, only the one being written is kept
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+queueSegmentExt))
+	if len(segments) != 1 {
+		t.Errorf("segments = %v, want 1", segments)
+	}
+
+	// nothing is delivered again
+	h2 := &collectHandler{}
+	q, err = NewDiskQueue(DiskQueueConfig{Dir: dir, SegmentSize: 256}, AutoAck(h2))
+	if err != nil {
+		t.Fatalf("NewDiskQueue failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	q.Close()
+	if h2.count() != 0 {
+		t.Errorf("redelivered %d acknowledged entries", h2.count())
+	}
+}
+
+func TestDiskQueue_ReplayUnacknowledged(t *testing.T) {
+	dir := t.TempDir()
+	h := &pendingAckHandler{}
+	q, err := NewDiskQueue(DiskQueueConfig{Dir: dir, SegmentSize: 128, SyncInterval: time.Hour}, h)
+	if err != nil {
+		t.Fatalf("NewDiskQueue failed: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		q.Handle(format.LogParts{"n": i}, 10, nil)
+	}
+	waitFor(t, "delivery", func() bool { return h.count() == 10 })
+
+	// entries 0-2 and 5 are acknowledged, the checkpoint stops after 2
+	for _, i := range []int{0, 1, 2, 5} {
+		h.acks[i](nil)
+	}
+	q.Close()
+	// too late, the queue is closed
+	h.acks[3](nil)
+
+	h2 := &collectHandler{}
+	q, err = NewDiskQueue(DiskQueueConfig{Dir: dir, SegmentSize: 128}, AutoAck(h2))
+	if err != nil {
+		t.Fatalf("NewDiskQueue failed: %v", err)
+	}
+	waitFor(t, "replay", func() bool { return h2.count() == 7 })
+	q.Close()
+	if h2.parts[0]["n"] != 3 || h2.parts[6]["n"] != 9 {
+		t.Errorf("replayed %v ... %v, want 3 ... 9", h2.parts[0]["n"], h2.parts[6]["n"])
+	}
+}
+
+func TestDiskQueue_Retry(t *testing.T) {
+	var lock sync.Mutex
+	attempts := 0
+	handler := &ackFuncHandler{func(logParts format.LogParts, ack AckFunc) {
+		lock.Lock()
+		attempts++
+		n := attempts
+		lock.Unlock()
+		if n == 1 {
+			ack(errors.New("backend down"))
+			return
+		}
+		ack(nil)
+	}}
+	q, err := NewDiskQueue(DiskQueueConfig{Dir: t.TempDir(), RetryInterval: 10 * time.Millisecond}, handler)
+	if err != nil {
+		t.Fatalf("NewDiskQueue failed: %v", err)
+	}
+	q.Handle(format.LogParts{"n": 1}, 10, nil)
+	waitFor(t, "retry", func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return attempts == 2
+	})
+	q.Close()
+}
+
+type ackFuncHandler struct {
+	f func(format.LogParts, AckFunc)
+}
+
+func (h *ackFuncHandler) HandleAck(logParts format.LogParts, messageLength int64, err error, ack AckFunc) {
+	h.f(logParts, ack)
+}
+
+func TestDiskQueue_MaxBytes(t *testing.T) {
+	h := &pendingAckHandler{}
+	q, err := NewDiskQueue(DiskQueueConfig{Dir: t.TempDir(), MaxBytes: 200, MaxInflight: 1}, h)
+	if err != nil {
+		t.Fatalf("NewDiskQueue failed: %v", err)
+	}
+	defer q.Close()
+	for i := 0; i < 20; i++ {
+		q.Handle(format.LogParts{"content": "0123456789"}, 10, nil)
+	}
+	if q.Dropped() == 0 || q.Bytes() > 200 {
+		t.Errorf("dropped = %d, bytes = %d", q.Dropped(), q.Bytes())
+	}
+	if q.GetLastError() != ErrQueueFull {
+		t.Errorf("last error = %v, want ErrQueueFull", q.GetLastError())
+	}
+}
+
+func TestDiskQueue_TornWrite(t *testing.T) {
+	dir := t.TempDir()
+	h := &pendingAckHandler{}
+	q, err := NewDiskQueue(DiskQueueConfig{Dir: dir}, h)
+	if err != nil {
+		t.Fatalf("NewDiskQueue failed: %v", err)
+	}
+	q.Handle(format.LogParts{"n": 1}, 10, nil)
+	q.Handle(format.LogParts{"n": 2}, 10, nil)
+	q.Close()
+
+	// the process died in the middle of a write
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+queueSegmentExt))
+	file, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("open segment failed: %v", err)
+	}
+	file.Write([]byte{0, 0, 0, 50, 1, 2})
+	file.Close()
+
+	h2 := &collectHandler{}
+	q, err = NewDiskQueue(DiskQueueConfig{Dir: dir}, AutoAck(h2))
+	if err != nil {
+		t.Fatalf("NewDiskQueue failed: %v", err)
+	}
+	q.Handle(format.LogParts{"n": 3}, 10, nil)
+	waitFor(t, "replay", func() bool { return h2.count() == 3 })
+	q.Close()
+	for i, parts := range h2.parts {
+		if parts["n"] != i+1 {
+			t.Errorf("entry %d: n = %v", i, parts["n"])
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package syslog
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/tea4go/gh/syslog/format"
+)
+
+const defaultDispatchQueueSize = 1024
+
+type dispatchEntry struct {
+	logParts      format.LogParts
+	messageLength int64
+	err           error
+}
+
+type dispatchTarget struct {
+	handler Handler
+	queue   chan dispatchEntry
+	block   bool
+	dropped uint64
+}
+
+// Options of a Dispatcher target
+type DispatchOptions struct {
+	Workers   int  // goroutines calling the Handler, 1 by default (keeps the order)
+	QueueSize int  // length of the queue, 1024 by default
+	Block     bool // wait when the queue is full instead of dropping and counting the entry
+}
+
+// A Dispatcher fans every entry out to several Handlers, each with its own
+// queue and goroutines, so a slow Handler does not hold up the others. With
+// more than one target every target gets a shallow copy of LogParts
+//
+//	d := syslog.NewDispatcher()
+//	d.Add(fileHandler, syslog.DispatchOptions{Workers: 1})
+//	d.Add(syslog.Chain(alertHandler, syslog.Filter(isCritical)), syslog.DispatchOptions{Workers: 4})
+//	server.SetHandler(d)
+//	...
+//	server.Shutdown(ctx)
+//	d.Close()
+type Dispatcher struct {
+	lock    sync.RWMutex
+	targets []*dispatchTarget
+	workers sync.WaitGroup
+	closed  bool
+}
+
+// NewDispatcher returns a new Dispatcher
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Adds a target Handler and starts its goroutines
+func (d *Dispatcher) Add(handler Handler, options DispatchOptions) {
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = defaultDispatchQueueSize
+	}
+	target := &dispatchTarget{
+		handler: handler,
+		queue:   make(chan dispatchEntry, options.QueueSize),
+		block:   options.Block,
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.closed {
+		return
+	}
+	d.targets = append(d.targets, target)
+	for i := 0; i < options.Workers; i++ {
+		d.workers.Add(1)
+		go func() {
+			defer d.workers.Done()
+			for entry := range target.queue {
+				target.handler.Handle(entry.logParts, entry.messageLength, entry.err)
+			}
+		}()
+	}
+}
+
+// Queues the entry for every target
+func (d *Dispatcher) Handle(logParts format.LogParts, messageLength int64, err error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if d.closed {
+		return
+	}
+
+	// the last target gets the original logParts, once the copies are made, so
+	// a queued target can not change it while it is being copied
+	last := len(d.targets) - 1
+	for i, target := range d.targets {
+		entry := dispatchEntry{logParts, messageLength, err}
+		if i < last {
+			entry.logParts = copyLogParts(logParts)
+		}
+		if target.block {
+			target.queue <- entry
+			continue
+		}
+		select {
+		case target.queue <- entry:
+		default:
+			atomic.AddUint64(&target.dropped, 1)
+		}
+	}
+}
+
+// Returns the entries dropped by every target because its queue was full,
+// in the order of Add
+func (d *Dispatcher) Dropped() []uint64 {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	result := make([]uint64, len(d.targets))
+	for i, target := range d.targets {
+		result[i] = atomic.LoadUint64(&target.dropped)
+	}
+	return result
+}
+
+// Stops accepting entries and waits for the queued ones to be handled
+func (d *Dispatcher) Close() {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return
+	}
+	d.closed = true
+	for _, target := range d.targets {
+		close(target.queue)
+	}
+	d.lock.Unlock()
+
+	d.workers.Wait()
+}
+
+func copyLogParts(logParts format.LogParts) format.LogParts {
+	result := make(format.LogParts, len(logParts))
+	for key, value := range logParts {
+		result[key] = value
+	}
+	return result
+}
@@ -0,0 +1,234 @@
+package syslog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tea4go/gh/syslog/format"
+)
+
+type collectHandler struct {
+	lock  sync.Mutex
+	parts []format.LogParts
+}
+
+func (h *collectHandler) Handle(logParts format.LogParts, messageLength int64, err error) {
+	h.lock.Lock()
+	h.parts = append(h.parts, logParts)
+	h.lock.Unlock()
+}
+
+func (h *collectHandler) count() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return len(h.parts)
+}
+
+func TestChain_Order(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return Enrich(func(format.LogParts) { order = append(order, name) })
+	}
+	h := &collectHandler{}
+	Chain(h, mark("a"), mark("b")).Handle(format.LogParts{}, 0, nil)
+	if strings.Join(order, ",") != "a,b" || h.count() != 1 {
+		t.Errorf("order = %v, handled = %d", order, h.count())
+	}
+}
+
+func TestFilter_Sample(t *testing.T) {
+	h := &collectHandler{}
+	handler := Chain(h,
+		Filter(func(parts format.LogParts) bool { return parts["severity"] != 7 }),
+		Sample(2))
+	for i := 0; i < 10; i++ {
+		handler.Handle(format.LogParts{"severity": i % 8}, 0, nil)
+	}
+	// 9 of 10 pass the filter, every second one is kept
+	if h.count() != 5 {
+		t.Errorf("handled = %d, want 5", h.count())
+	}
+}
+
+func TestNormalizeHostname(t *testing.T) {
+	h := &collectHandler{}
+	handler := Chain(h, NormalizeHostname(true))
+	handler.Handle(format.LogParts{"hostname": "FW01.Example.COM."}, 0, nil)
+	handler.Handle(format.LogParts{"hostname": "10.0.0.1"}, 0, nil)
+	if h.parts[0]["hostname"] != "fw01" || h.parts[1]["hostname"] != "10.0.0.1" {
+		t.Errorf("unexpected hostnames: %v, %v", h.parts[0]["hostname"], h.parts[1]["hostname"])
+	}
+}
+
+func TestReverseDNS_Cache(t *testing.T) {
+	lookups := 0
+	lookup := func(ctx context.Context, ip string) ([]string, error) {
+		lookups++
+		if ip == "10.0.0.1" {
+			return []string{"fw01.example.com."}, nil
+		}
+		return nil, errors.New("not found")
+	}
+	h := &collectHandler{}
+	handler := Chain(h, ReverseDNS(lookup, time.Minute))
+	for i := 0; i < 3; i++ {
+		handler.Handle(format.LogParts{"client": "10.0.0.1:514"}, 0, nil)
+		handler.Handle(format.LogParts{"client": "10.0.0.2:514"}, 0, nil)
+	}
+	if lookups != 2 {
+		t.Errorf("lookups = %d, want 2", lookups)
+	}
+	if h.parts[0]["client_hostname"] != "fw01.example.com" {
+		t.Errorf("client_hostname = %v", h.parts[0]["client_hostname"])
+	}
+	if _, ok := h.parts[1]["client_hostname"]; ok {
+		t.Error("failed lookups should not set client_hostname")
+	}
+}
+
+func TestReverseDNS_Timeout(t *testing.T) {
+	lookup := func(ctx context.Context, ip string) ([]string, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("lookup without deadline")
+		}
+		return []string{"fw01."}, nil
+	}
+	h := &collectHandler{}
+	Chain(h, ReverseDNS(lookup, time.Minute)).Handle(format.LogParts{"client": "10.0.0.1:514"}, 0, nil)
+	if h.parts[0]["client_hostname"] != "fw01" {
+		t.Errorf("client_hostname = %v", h.parts[0]["client_hostname"])
+	}
+}
+
+func TestDNSCache_Size(t *testing.T) {
+	now := time.Now()
+	c := &dnsCache{entries: make(map[string]dnsEntry), size: 3}
+	c.put("10.0.0.1", dnsEntry{name: "expired", expires: now}, now)
+	c.put("10.0.0.2", dnsEntry{expires: now.Add(time.Minute)}, now)
+	c.put("10.0.0.3", dnsEntry{expires: now.Add(time.Minute)}, now)
+	c.put("10.0.0.4", dnsEntry{expires: now.Add(time.Minute)}, now)
+	if _, ok := c.entries["10.0.0.1"]; ok || len(c.entries) != 3 {
+		t.Errorf("expired entry should be removed first, got %v", c.entries)
+	}
+	for i := 5; i < 100; i++ {
+		c.put(fmt.Sprintf("10.0.0.%d", i), dnsEntry{expires: now.Add(time.Minute)}, now)
+	}
+	if len(c.entries) != 3 {
+		t.Errorf("len = %d, want 3", len(c.entries))
+	}
+	if _, ok := c.get("10.0.0.99", now); !ok {
+		t.Error("the last entry should be cached")
+	}
+	if _, ok := c.get("10.0.0.99", now.Add(time.Minute)); ok {
+		t.Error("entry should expire")
+	}
+}
+
+func TestGeoIP(t *testing.T) {
+	db, err := ReadGeoIP(strings.NewReader(`network,country,region,city
+# comment
+10.0.0.0/8,CN,Zhejiang,Hangzhou
+192.168.1.1,192.168.1.255,CN,Zhejiang,Ningbo
+2001:db8::/32,US,California,
+`))
+	if err != nil {
+		t.Fatalf("ReadGeoIP failed: %v", err)
+	}
+	if db.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", db.Len())
+	}
+
+	tests := []struct {
+		ip   string
+		city string
+		ok   bool
+	}{
+		{"10.20.30.40", "Hangzhou", true},
+		{"192.168.1.100", "Ningbo", true},
+		{"192.168.2.1", "", false},
+		{"2001:db8::1", "", true},
+		{"8.8.8.8", "", false},
+	}
+	for _, tt := range tests {
+		location, ok := db.Lookup(net.ParseIP(tt.ip))
+		if ok != tt.ok || location.City != tt.city {
+			t.Errorf("Lookup(%s) = %v, %v", tt.ip, location, ok)
+		}
+	}
+
+	h := &collectHandler{}
+	Chain(h, GeoIP(db)).Handle(format.LogParts{"client": "10.1.1.1:5140"}, 0, nil)
+	if h.parts[0]["geo_country"] != "CN" || h.parts[0]["geo_city"] != "Hangzhou" {
+		t.Errorf("unexpected parts: %v", h.parts[0])
+	}
+}
+
+func TestDispatcher_FanOut(t *testing.T) {
+	a := &collectHandler{}
+	b := &collectHandler{}
+	d := NewDispatcher()
+	d.Add(a, DispatchOptions{})
+	d.Add(Chain(b, Enrich(func(parts format.LogParts) { parts["seen"] = true })), DispatchOptions{Workers: 4, Block: true})
+
+	for i := 0; i < 100; i++ {
+		d.Handle(format.LogParts{"n": i}, 0, nil)
+	}
+	d.Close()
+
+	if a.count() != 100 || b.count() != 100 {
+		t.Fatalf("handled a = %d, b = %d, want 100", a.count(), b.count())
+	}
+	// every target gets its own copy
+	for _, parts := range a.parts {
+		if _, ok := parts["seen"]; ok {
+			t.Fatal("changes of one target should not be visible to the others")
+		}
+	}
+	// entries after Close are ignored
+	d.Handle(format.LogParts{}, 0, nil)
+}
+
+func TestDispatcher_Dropped(t *testing.T) {
+	release := make(chan struct{})
+	slow := HandlerFunc(func(format.LogParts, int64, error) { <-release })
+	d := NewDispatcher()
+	d.Add(slow, DispatchOptions{QueueSize: 1})
+
+	for i := 0; i < 10; i++ {
+		d.Handle(format.LogParts{}, 0, nil)
+	}
+	close(release)
+	d.Close()
+
+	// one entry in the worker, one in the queue
+	if dropped := d.Dropped(); len(dropped) != 1 || dropped[0] < 8 {
+		t.Errorf("dropped = %v, want at least 8", dropped)
+	}
+}
+
+func TestDispatcher_ChangeBeforeCopy(t *testing.T) {
+	// the first target changes the entry while the others are copied
+	a := &collectHandler{}
+	b := &collectHandler{}
+	d := NewDispatcher()
+	d.Add(Chain(a, Enrich(func(parts format.LogParts) { parts["seen"] = true })), DispatchOptions{Workers: 4})
+	d.Add(b, DispatchOptions{Block: true})
+	d.Add(b, DispatchOptions{Block: true})
+
+	for i := 0; i < 100; i++ {
+		d.Handle(format.LogParts{"n": i, "host": "a", "app": "b"}, 0, nil)
+	}
+	d.Close()
+
+	for _, parts := range b.parts {
+		if _, ok := parts["seen"]; ok {
+			t.Fatal("changes of the first target should not be visible to the others")
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package syslog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	logs "github.com/tea4go/gh/log4go"
+	"github.com/tea4go/gh/syslog/format"
+)
+
+const (
+	FileFormatRaw  = "raw"  // one readable line per message: time host app[pid]: content
+	FileFormatJSON = "json" // one LogParts JSON object per line
+
+	defaultFileTemplate    = "{hostname}/{date}.log"
+	defaultFileIdleTimeout = 10 * time.Minute
+)
+
+var fileTemplateKey = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// Configuration of a FileHandler. MaxLines, MaxSize, Daily, MaxDays and Perm
+// are passed to the log4go file adapter, which rotates and expires the files
+type FileHandlerConfig struct {
+	Dir         string        // root directory
+	Template    string        // file path relative to Dir, e.g. "{hostname}/{app_name}/{date}.log"
+	Format      string        // FileFormatRaw (default) or FileFormatJSON
+	MaxLines    int           // max lines per file, 0 for no limit
+	MaxSize     int           // max bytes per file, 0 for no limit
+	Daily       bool          // rotate daily
+	MaxDays     int64         // days to keep rotated files
+	Perm        string        // file permissions, "0660" by default
+	IdleTimeout time.Duration // close files not written for this long, 10 minutes by default
+}
+
+type fileSink struct {
+	logger    *logs.TLogger
+	lastWrite time.Time
+}
+
+// FileHandler writes every syslog entry to the file given by the template.
+// {key} is replaced by the LogParts value of key, {date} (2006-01-02), {year},
+// {month} and {day} come from the timestamp of the entry, or the current time
+type FileHandler struct {
+	config    FileHandlerConfig
+	lock      sync.Mutex
+	sinks     map[string]*fileSink
+	lastSweep time.Time
+	lastError error
+}
+
+// NewFileHandler returns a new FileHandler
+func NewFileHandler(config FileHandlerConfig) (*FileHandler, error) {
+	if config.Dir == "" {
+		return nil, errors.New("please set a valid directory")
+	}
+	if config.Template == "" {
+		config.Template = defaultFileTemplate
+	}
+	switch config.Format {
+	case "":
+		config.Format = FileFormatRaw
+	case FileFormatRaw, FileFormatJSON:
+	default:
+		return nil, fmt.Errorf("unknown file format %q", config.Format)
+	}
+	if config.Perm == "" {
+		config.Perm = "0660"
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultFileIdleTimeout
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileHandler{
+		config:    config,
+		sinks:     make(map[string]*fileSink),
+		lastSweep: time.Now(),
+	}, nil
+}
+
+// Syslog entry receiver
+func (h *FileHandler) Handle(logParts format.LogParts, messageLength int64, err error) {
+	if logParts == nil {
+		return
+	}
+	line, err := h.formatLine(logParts)
+	if err != nil {
+		h.setLastError(err)
+		return
+	}
+	filename := filepath.Join(h.config.Dir, h.FileName(logParts))
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	sink, err := h.getSink(filename)
+	if err != nil {
+		h.lastError = err
+		return
+	}
+	sink.logger.Print("%s", line)
+	sink.lastWrite = time.Now()
+
+	if time.Since(h.lastSweep) > h.config.IdleTimeout/2 {
+		h.closeIdle()
+	}
+}
+
+// Returns the file path of the entry, relative to Dir
+func (h *FileHandler) FileName(logParts format.LogParts) string {
+	ts, ok := logParts["timestamp"].(time.Time)
+	if !ok || ts.IsZero() {
+		ts = time.Now()
+	}
+	return fileTemplateKey.ReplaceAllStringFunc(h.config.Template, func(key string) string {
+		key = key[1 : len(key)-1]
+		switch key {
+		case "date":
+			return ts.Format("2006-01-02")
+		case "year":
+			return ts.Format("2006")
+		case "month":
+			return ts.Format("01")
+		case "day":
+			return ts.Format("02")
+		}
+		return sanitizePathPart(logParts[key])
+	})
+}
+
+// Returns the last error writing a file
+func (h *FileHandler) GetLastError() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.lastError
+}
+
+// Closes all open files
+func (h *FileHandler) Close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for name, sink := range h.sinks {
+		sink.logger.Close()
+		delete(h.sinks, name)
+	}
+}
+
+func (h *FileHandler) setLastError(err error) {
+	h.lock.Lock()
+	h.lastError = err
+	h.lock.Unlock()
+}
+
+func (h *FileHandler) getSink(filename string) (*fileSink, error) {
+	if sink, ok := h.sinks[filename]; ok {
+		return sink, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+
+	config, err := json.Marshal(map[string]interface{}{
+		"filename": filename,
+		"maxlines": h.config.MaxLines,
+		"maxsize":  h.config.MaxSize,
+		"daily":    h.config.Daily,
+		"maxdays":  h.config.MaxDays,
+		"rotate":   true,
+		"level":    logs.LevelPrint,
+		"perm":     h.config.Perm,
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger := logs.NewLogger()
+	if err := logger.SetLogger(logs.AdapterFile, string(config)); err != nil {
+		return nil, err
+	}
+
+	sink := &fileSink{logger: logger}
+	h.sinks[filename] = sink
+	return sink, nil
+}
+
+// Closes the idle files, e.g. those of the previous {date}
+func (h *FileHandler) closeIdle() {
+	h.lastSweep = time.Now()
+	for name, sink := range h.sinks {
+		if time.Since(sink.lastWrite) > h.config.IdleTimeout {
+			sink.logger.Close()
+			delete(h.sinks, name)
+		}
+	}
+}
+
+func (h *FileHandler) formatLine(logParts format.LogParts) (string, error) {
+	if h.config.Format == FileFormatJSON {
+		data, err := json.Marshal(logParts)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	ts, ok := logParts["timestamp"].(time.Time)
+	if !ok || ts.IsZero() {
+		ts = time.Now()
+	}
+	app := firstString(logParts, "tag", "app_name")
+	if pid := firstString(logParts, "pid", "proc_id"); pid != "" && pid != "0" && pid != "-" {
+		app = app + "[" + pid + "]"
+	}
+	content := firstString(logParts, "content", "message")
+	return fmt.Sprintf("%s %s %s: %s", ts.Format(time.RFC3339), firstString(logParts, "hostname"), app, content), nil
+}
+
+// Returns the value of the first key present, as a string
+func firstString(logParts format.LogParts, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := logParts[key]; ok && value != nil {
+			return fmt.Sprint(value)
+		}
+	}
+	return ""
+}
+
+// Makes a template value a single path element, so "../" can not leave Dir
+func sanitizePathPart(value interface{}) string {
+	if value == nil {
+		return "unknown"
+	}
+	str := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', 0:
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(fmt.Sprint(value)))
+	str = strings.Trim(str, ".")
+	if str == "" || str == "-" {
+		return "unknown"
+	}
+	return str
+}
@@ -0,0 +1,158 @@
+package syslog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tea4go/gh/syslog/format"
+)
+
+func testLogParts(hostname, tag, content string) format.LogParts {
+	return format.LogParts{
+		"timestamp": time.Date(2024, 3, 5, 10, 20, 30, 0, time.UTC),
+		"hostname":  hostname,
+		"tag":       tag,
+		"pid":       42,
+		"content":   content,
+		"priority":  34,
+	}
+}
+
+// --- NewFileHandler validation ---
+
+func TestNewFileHandler_Invalid(t *testing.T) {
+	if _, err := NewFileHandler(FileHandlerConfig{}); err == nil {
+		t.Error("expected error without directory")
+	}
+	if _, err := NewFileHandler(FileHandlerConfig{Dir: t.TempDir(), Format: "xml"}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+// --- FileName template expansion ---
+
+func TestFileHandler_FileName(t *testing.T) {
+	h, err := NewFileHandler(FileHandlerConfig{Dir: t.TempDir(), Template: "{hostname}/{tag}/{year}/{month}/{date}.log"})
+	if err != nil {
+		t.Fatalf("NewFileHandler failed: %v", err)
+	}
+	defer h.Close()
+
+	name := h.FileName(testLogParts("router1", "sshd", "hello"))
+	want := filepath.Join("router1", "sshd", "2024", "03", "2024-03-05.log")
+	if filepath.FromSlash(name) != want {
+		t.Errorf("FileName = %q, want %q", name, want)
+	}
+
+	// path separators and missing values must not escape the root directory
+	name = h.FileName(format.LogParts{"hostname": "../../etc", "timestamp": time.Now()})
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		if part == ".." || part == "." {
+			t.Errorf("FileName = %q, should not contain relative elements", name)
+		}
+	}
+	if !strings.Contains(name, "unknown") {
+		t.Errorf("FileName = %q, missing value should become unknown", name)
+	}
+}
+
+// --- raw format ---
+
+func TestFileHandler_HandleRaw(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewFileHandler(FileHandlerConfig{Dir: dir, Template: "{hostname}/{date}.log"})
+	if err != nil {
+		t.Fatalf("NewFileHandler failed: %v", err)
+	}
+
+	h.Handle(testLogParts("host1", "sshd", "first"), 10, nil)
+	h.Handle(testLogParts("host1", "sshd", "second"), 10, nil)
+	h.Handle(testLogParts("host2", "cron", "third"), 10, nil)
+	h.Close()
+	if err := h.GetLastError(); err != nil {
+		t.Fatalf("GetLastError = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "host1", "2024-03-05.log"))
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("host1 has %d lines, want 2: %q", len(lines), data)
+	}
+	if lines[0] != "2024-03-05T10:20:30Z host1 sshd[42]: first" {
+		t.Errorf("line = %q", lines[0])
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "host2", "2024-03-05.log")); err != nil {
+		t.Errorf("host2 file missing: %v", err)
+	}
+}
+
+// --- json format ---
+
+func TestFileHandler_HandleJSON(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewFileHandler(FileHandlerConfig{Dir: dir, Template: "all.log", Format: FileFormatJSON})
+	if err != nil {
+		t.Fatalf("NewFileHandler failed: %v", err)
+	}
+	h.Handle(testLogParts("host1", "sshd", "json line"), 10, nil)
+	h.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, "all.log"))
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	var parts map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(data))), &parts); err != nil {
+		t.Fatalf("line is not JSON: %v (%q)", err, data)
+	}
+	if parts["content"] != "json line" || parts["hostname"] != "host1" {
+		t.Errorf("unexpected JSON line: %v", parts)
+	}
+}
+
+// --- rotation by lines reuses log4go naming ---
+
+func TestFileHandler_RotateByLines(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewFileHandler(FileHandlerConfig{Dir: dir, Template: "rotate.log", MaxLines: 2, MaxDays: 7})
+	if err != nil {
+		t.Fatalf("NewFileHandler failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		h.Handle(testLogParts("host", "app", "line"), 4, nil)
+	}
+	h.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "rotate_*.log"))
+	if len(files) < 2 {
+		t.Errorf("expected rotated files, got %v", files)
+	}
+}
+
+// --- idle files are closed ---
+
+func TestFileHandler_CloseIdle(t *testing.T) {
+	h, err := NewFileHandler(FileHandlerConfig{Dir: t.TempDir(), IdleTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewFileHandler failed: %v", err)
+	}
+	defer h.Close()
+
+	h.Handle(testLogParts("old", "app", "x"), 1, nil)
+	time.Sleep(200 * time.Millisecond)
+	h.Handle(testLogParts("new", "app", "y"), 1, nil)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.sinks) != 1 {
+		t.Errorf("open files = %d, want 1", len(h.sinks))
+	}
+}
@@ -22,21 +22,33 @@ import (
  * format, it would be best to select it explicitly.
  */
 
-type Automatic struct{}
+type Automatic struct {
+	// Lenient is passed to the RFC3164 parser, see RFC3164.Lenient
+	Lenient bool
+}
 
 const (
 	detectedUnknown = iota
 	detectedRFC3164 = iota
 	detectedRFC5424 = iota
 	detectedRFC6587 = iota
+	detectedPayload = iota
 )
 
 func detect(data []byte) (detected int, err error) {
+	// bare CEF, LEEF or JSON lines have no syslog header at all
+	if isBarePayload(data) {
+		return detectedPayload, nil
+	}
 	// all formats have a sapce somewhere
 	if i := bytes.IndexByte(data, ' '); i > 0 {
+		// a frame starting with the priority is no length, and is by far the
+		// most common case: skip Atoi and the error it allocates
 		pLength := data[0:i]
-		if _, err := strconv.Atoi(string(pLength)); err == nil {
-			return detectedRFC6587, nil
+		if data[0] != '<' {
+			if _, err := strconv.Atoi(string(pLength)); err == nil {
+				return detectedRFC6587, nil
+			}
 		}
 
 		// is there a close angle bracket before the ' '? there should be
@@ -56,10 +68,19 @@ func detect(data []byte) (detected int, err error) {
 	return detectedUnknown, nil
 }
 
+// Structured payloads (CEF, LEEF, JSON) in the MSG or as bare lines are
+// recognized as well, see payload.go
 func (f *Automatic) GetParser(line []byte) LogParser {
+	if mayHavePayload(line) {
+		return newPayloadParser(line, f, cefDecoder{}, leefDecoder{}, jsonDecoder{})
+	}
+	return f.envelopeParser(line)
+}
+
+func (f *Automatic) envelopeParser(line []byte) LogParser {
 	switch format, _ := detect(line); format {
 	case detectedRFC3164:
-		return &parserWrapper{rfc3164.NewParser(line)}
+		return f.rfc3164Parser(line)
 	case detectedRFC5424:
 		return &parserWrapper{rfc5424.NewParser(line)}
 	default:
@@ -69,10 +90,16 @@ func (f *Automatic) GetParser(line []byte) LogParser {
 		// will return detectedRFC6587. The line may also simply be malformed after the length in
 		// which case we will have detectedUnknown. In this case we return the simplest parser so
 		// the illegally formatted line is properly handled
-		return &parserWrapper{rfc3164.NewParser(line)}
+		return f.rfc3164Parser(line)
 	}
 }
 
+func (f *Automatic) rfc3164Parser(line []byte) LogParser {
+	parser := rfc3164.NewParser(line)
+	parser.Lenient(f.Lenient)
+	return &parserWrapper{parser}
+}
+
 func (f *Automatic) GetSplitFunc() bufio.SplitFunc {
 	return f.automaticScannerSplit
 }
@@ -85,7 +112,7 @@ func (f *Automatic) automaticScannerSplit(data []byte, atEOF bool) (advance int,
 	switch format, err := detect(data); format {
 	case detectedRFC6587:
 		return rfc6587ScannerSplit(data, atEOF)
-	case detectedRFC3164, detectedRFC5424:
+	case detectedRFC3164, detectedRFC5424, detectedPayload:
 		// the default
 		return bufio.ScanLines(data, atEOF)
 	default:
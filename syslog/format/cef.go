@@ -0,0 +1,89 @@
+package format
+
+import (
+	"bufio"
+	"strings"
+)
+
+// CEF parses ArcSight Common Event Format messages:
+//
+//	CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension
+//
+// The header is stored in the cef_version, cef_device_vendor,
+// cef_device_product, cef_device_version, cef_signature_id, cef_name and
+// cef_severity keys, every extension (src=10.0.0.1 dst=...) in its own key.
+type CEF struct{}
+
+func (f *CEF) GetParser(line []byte) LogParser {
+	return newPayloadParser(line, &Automatic{}, cefDecoder{})
+}
+
+func (f *CEF) GetSplitFunc() bufio.SplitFunc {
+	return (&Automatic{}).GetSplitFunc()
+}
+
+var cefHeaderKeys = []string{
+	"cef_version",
+	"cef_device_vendor",
+	"cef_device_product",
+	"cef_device_version",
+	"cef_signature_id",
+	"cef_name",
+	"cef_severity",
+}
+
+type cefDecoder struct{}
+
+func (cefDecoder) name() string {
+	return PayloadCEF
+}
+
+func (cefDecoder) find(line []byte) (int, bool) {
+	return findRegexp(cefStart, line)
+}
+
+func (cefDecoder) decode(payload []byte, parts LogParts) error {
+	fields := splitEscaped(strings.TrimPrefix(string(payload), "CEF:"), '|', len(cefHeaderKeys)+1)
+	if len(fields) < len(cefHeaderKeys) {
+		return ErrPayloadHeader
+	}
+	for i, key := range cefHeaderKeys {
+		parts[key] = unescapePayload(fields[i])
+	}
+	if len(fields) > len(cefHeaderKeys) {
+		for key, value := range parseCEFExtension(fields[len(cefHeaderKeys)]) {
+			setPayloadField(parts, PayloadCEF, key, value)
+		}
+	}
+	return nil
+}
+
+// Extension values may contain spaces: a value ends where the next "key="
+// begins. '=' inside a value is escaped as "\="
+func parseCEFExtension(ext string) map[string]string {
+	result := make(map[string]string)
+	key := ""
+	valueStart := 0
+	for i := 0; i < len(ext); i++ {
+		switch ext[i] {
+		case '\\':
+			i++
+		case '=':
+			keyStart := strings.LastIndexByte(ext[valueStart:i], ' ')
+			if keyStart < 0 {
+				keyStart = valueStart
+			} else {
+				keyStart += valueStart + 1
+			}
+			if key != "" {
+				result[key] = unescapePayload(strings.TrimSpace(ext[valueStart:keyStart]))
+			}
+			key = strings.TrimSpace(ext[keyStart:i])
+			valueStart = i + 1
+		}
+	}
+	if key != "" {
+		result[key] = unescapePayload(strings.TrimSpace(ext[valueStart:]))
+	}
+	return result
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -698,3 +699,164 @@ func TestAutomatic_Splitter_DetectionError(t *testing.T) {
 		t.Error("expected error for malformed data in automatic splitter")
 	}
 }
+
+// --- Lenient RFC3164 ---
+
+func TestRFC3164_GetParser_Lenient(t *testing.T) {
+	f := &RFC3164{Lenient: true}
+	parser := f.GetParser([]byte("<189>12: *Mar  1 18:46:11: %SYS-5-CONFIG_I: Configured"))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	parts := parser.Dump()
+	if parts["sequence"] != 12 {
+		t.Errorf("sequence = %v, want 12", parts["sequence"])
+	}
+	if parts["variant"] == nil {
+		t.Error("lenient parser should report the variant")
+	}
+}
+
+func TestAutomatic_GetParser_Lenient(t *testing.T) {
+	f := &Automatic{Lenient: true}
+	parser := f.GetParser([]byte("<134>2021-03-05T10:20:30Z fw01 kernel: dropped"))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	parts := parser.Dump()
+	if parts["variant"] != "iso8601" || parts["hostname"] != "fw01" {
+		t.Errorf("unexpected parts: %v", parts)
+	}
+
+	// RFC5424 lines are not affected
+	parser = f.GetParser([]byte("<34>1 2003-10-11T22:14:15Z mymachine su - ID47 - test"))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, ok := parser.Dump()["variant"]; ok {
+		t.Error("RFC5424 parser should not report a variant")
+	}
+}
+
+// --- Structured payloads ---
+
+func TestCEF_GetParser(t *testing.T) {
+	f := &CEF{}
+	line := `<134>Mar  5 10:20:30 fw01 CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 msg=Detected a threat\=worm spt=1232`
+	parser := f.GetParser([]byte(line))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	parts := parser.Dump()
+	expected := map[string]interface{}{
+		"payload":           PayloadCEF,
+		"hostname":          "fw01",
+		"cef_version":       "0",
+		"cef_device_vendor": "Security",
+		"cef_name":          "worm successfully stopped",
+		"cef_severity":      "10",
+		"src":               "10.0.0.1",
+		"dst":               "2.1.2.2",
+		"msg":               "Detected a threat=worm",
+		"spt":               "1232",
+	}
+	for key, value := range expected {
+		if parts[key] != value {
+			t.Errorf("%s = %v, want %v", key, parts[key], value)
+		}
+	}
+	if !strings.HasPrefix(parts["content"].(string), "CEF:0|") {
+		t.Errorf("content = %q, want the whole payload", parts["content"])
+	}
+}
+
+func TestCEF_GetParser_NotFound(t *testing.T) {
+	f := &CEF{}
+	parser := f.GetParser([]byte("<134>Mar  5 10:20:30 fw01 app: plain message"))
+	if err := parser.Parse(); err != ErrPayloadNotFound {
+		t.Errorf("expected ErrPayloadNotFound, got %v", err)
+	}
+}
+
+func TestLEEF_GetParser(t *testing.T) {
+	f := &LEEF{}
+	parser := f.GetParser([]byte("<13>Mar  5 10:20:30 qradar LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.0\tdst=172.50.123.1\tsev=5"))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	parts := parser.Dump()
+	if parts["leef_vendor"] != "Microsoft" || parts["leef_event_id"] != "15345" {
+		t.Errorf("unexpected header: %v", parts)
+	}
+	if parts["src"] != "192.0.2.0" || parts["dst"] != "172.50.123.1" || parts["sev"] != "5" {
+		t.Errorf("unexpected attributes: %v", parts)
+	}
+}
+
+func TestLEEF_GetParser_Delimiter(t *testing.T) {
+	f := &LEEF{}
+	parser := f.GetParser([]byte("LEEF:2.0|Lancope|StealthWatch|1.0|41|x5E|src=10.0.1.8^dst=10.0.0.5^devTime=2024-03-05"))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	parts := parser.Dump()
+	if parts["src"] != "10.0.1.8" || parts["dst"] != "10.0.0.5" || parts["devTime"] != "2024-03-05" {
+		t.Errorf("unexpected attributes: %v", parts)
+	}
+}
+
+func TestJSON_GetParser(t *testing.T) {
+	f := &JSON{}
+	parser := f.GetParser([]byte(`<134>Mar  5 10:20:30 web01 nginx: {"status":404,"path":"/x","hostname":"inner"}`))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	parts := parser.Dump()
+	if parts["payload"] != PayloadJSON || parts["status"] != float64(404) || parts["path"] != "/x" {
+		t.Errorf("unexpected parts: %v", parts)
+	}
+	// envelope keys are not overwritten
+	if parts["hostname"] != "web01" || parts["json_hostname"] != "inner" {
+		t.Errorf("hostname = %v, json_hostname = %v", parts["hostname"], parts["json_hostname"])
+	}
+	if parts["tag"] != "nginx" {
+		t.Errorf("tag = %v, want nginx", parts["tag"])
+	}
+}
+
+func TestAutomatic_GetParser_Payload(t *testing.T) {
+	f := &Automatic{}
+	parser := f.GetParser([]byte(`{"level":"warn","msg":"disk full"}`))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	parts := parser.Dump()
+	if parts["payload"] != PayloadJSON || parts["level"] != "warn" {
+		t.Errorf("unexpected parts: %v", parts)
+	}
+
+	// plain messages are not affected
+	parser = f.GetParser([]byte("<34>Oct 11 22:14:15 mymachine su: 'su root' failed {maybe}"))
+	if err := parser.Parse(); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, ok := parser.Dump()["payload"]; ok {
+		t.Error("plain message should not report a payload")
+	}
+}
+
+func TestAutomatic_Splitter_BarePayload(t *testing.T) {
+	f := &Automatic{}
+	scanner := bufio.NewScanner(strings.NewReader("CEF:0|a|b|1|2|n|3|src=1.1.1.1\n{\"a\":1}\n"))
+	scanner.Split(f.GetSplitFunc())
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if len(lines) != 2 || lines[1] != `{"a":1}` {
+		t.Errorf("unexpected lines: %q", lines)
+	}
+}
@@ -0,0 +1,45 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+)
+
+// JSON parses messages whose body is a JSON object, either inside a syslog
+// envelope ("<134>Mar  5 10:20:30 host app: {...}") or as a bare JSON line.
+// Every top level field of the object is stored in its own key.
+type JSON struct{}
+
+func (f *JSON) GetParser(line []byte) LogParser {
+	return newPayloadParser(line, &Automatic{}, jsonDecoder{})
+}
+
+func (f *JSON) GetSplitFunc() bufio.SplitFunc {
+	return (&Automatic{}).GetSplitFunc()
+}
+
+type jsonDecoder struct{}
+
+func (jsonDecoder) name() string {
+	return PayloadJSON
+}
+
+func (jsonDecoder) find(line []byte) (int, bool) {
+	i := bytes.IndexByte(line, '{')
+	if i < 0 || !json.Valid(bytes.TrimSpace(line[i:])) {
+		return 0, false
+	}
+	return i, true
+}
+
+func (jsonDecoder) decode(payload []byte, parts LogParts) error {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		setPayloadField(parts, PayloadJSON, key, value)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package format
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// LEEF parses IBM QRadar Log Event Extended Format messages:
+//
+//	LEEF:1.0|Vendor|Product|Version|EventID|key=value<TAB>key=value
+//	LEEF:2.0|Vendor|Product|Version|EventID|DelimiterCharacter|key=value^key=value
+//
+// The header is stored in the leef_version, leef_vendor, leef_product,
+// leef_product_version and leef_event_id keys, every attribute in its own key.
+type LEEF struct{}
+
+func (f *LEEF) GetParser(line []byte) LogParser {
+	return newPayloadParser(line, &Automatic{}, leefDecoder{})
+}
+
+func (f *LEEF) GetSplitFunc() bufio.SplitFunc {
+	return (&Automatic{}).GetSplitFunc()
+}
+
+var leefHeaderKeys = []string{
+	"leef_version",
+	"leef_vendor",
+	"leef_product",
+	"leef_product_version",
+	"leef_event_id",
+}
+
+type leefDecoder struct{}
+
+func (leefDecoder) name() string {
+	return PayloadLEEF
+}
+
+func (leefDecoder) find(line []byte) (int, bool) {
+	return findRegexp(leefStart, line)
+}
+
+func (leefDecoder) decode(payload []byte, parts LogParts) error {
+	fields := splitEscaped(strings.TrimPrefix(string(payload), "LEEF:"), '|', len(leefHeaderKeys)+1)
+	if len(fields) < len(leefHeaderKeys) {
+		return ErrPayloadHeader
+	}
+	for i, key := range leefHeaderKeys {
+		parts[key] = unescapePayload(fields[i])
+	}
+	if len(fields) == len(leefHeaderKeys) {
+		return nil
+	}
+
+	attributes := fields[len(leefHeaderKeys)]
+	delimiter := "\t"
+	if strings.HasPrefix(parts["leef_version"].(string), "2") {
+		// LEEF 2.0: the optional delimiter field, a character or its hex code
+		if i := strings.IndexByte(attributes, '|'); i >= 0 {
+			if d, ok := leefDelimiter(attributes[:i]); ok {
+				delimiter = d
+				attributes = attributes[i+1:]
+			}
+		}
+	}
+
+	for _, attribute := range strings.Split(attributes, delimiter) {
+		i := strings.IndexByte(attribute, '=')
+		if i <= 0 {
+			continue
+		}
+		setPayloadField(parts, PayloadLEEF, strings.TrimSpace(attribute[:i]), attribute[i+1:])
+	}
+	return nil
+}
+
+// "^", "x5E" or "0x5E"
+func leefDelimiter(field string) (string, bool) {
+	if len(field) == 1 {
+		return field, true
+	}
+	var hex string
+	switch {
+	case strings.HasPrefix(field, "0x"):
+		hex = field[2:]
+	case strings.HasPrefix(field, "x"):
+		hex = field[1:]
+	default:
+		return "", false
+	}
+	code, err := strconv.ParseUint(hex, 16, 8)
+	if err != nil {
+		return "", false
+	}
+	return string(rune(code)), true
+}
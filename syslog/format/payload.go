@@ -0,0 +1,189 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"time"
+)
+
+/* Structured payloads carried inside the syslog MSG (or sent as bare lines
+ * without any syslog header): ArcSight CEF, IBM QRadar LEEF and JSON.
+ *
+ * The syslog envelope is parsed as usual (RFC3164 or RFC5424, detected
+ * automatically), then the payload is parsed and its fields are added to the
+ * LogParts. The recognized payload is reported in the "payload" key. A payload
+ * field never overwrites an envelope key, it is stored with the payload name
+ * as prefix instead (e.g. "cef_hostname").
+ */
+
+const (
+	PayloadCEF  = "cef"
+	PayloadLEEF = "leef"
+	PayloadJSON = "json"
+)
+
+var (
+	ErrPayloadNotFound = errors.New("No structured payload found")
+	ErrPayloadHeader   = errors.New("Invalid structured payload header")
+
+	cefStart  = regexp.MustCompile(`CEF:\d+\|`)
+	leefStart = regexp.MustCompile(`LEEF:\d+(\.\d+)?\|`)
+)
+
+// locates a payload in line and parses it into parts
+type payloadDecoder interface {
+	name() string
+	find(line []byte) (int, bool)
+	decode(payload []byte, parts LogParts) error
+}
+
+type payloadParser struct {
+	line     []byte
+	envelope LogParser // nil for bare payload lines
+	decoders []payloadDecoder
+	location *time.Location
+	parts    LogParts
+}
+
+// envelope parses the syslog header, lines which do not start with a
+// priority are bare payloads
+func newPayloadParser(line []byte, envelope *Automatic, decoders ...payloadDecoder) *payloadParser {
+	p := &payloadParser{line: line, decoders: decoders}
+	if len(line) > 0 && line[0] == '<' {
+		p.envelope = envelope.envelopeParser(line)
+	}
+	return p
+}
+
+// cheap check before the decoders run on every line of Automatic
+func mayHavePayload(line []byte) bool {
+	return bytes.IndexByte(line, '{') >= 0 ||
+		bytes.Contains(line, []byte("CEF:")) ||
+		bytes.Contains(line, []byte("LEEF:"))
+}
+
+// bare payload lines, without syslog header
+func isBarePayload(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("{")) ||
+		bytes.HasPrefix(data, []byte("CEF:")) ||
+		bytes.HasPrefix(data, []byte("LEEF:"))
+}
+
+func (p *payloadParser) Location(location *time.Location) {
+	p.location = location
+	if p.envelope != nil {
+		p.envelope.Location(location)
+	}
+}
+
+func (p *payloadParser) Dump() LogParts {
+	return p.parts
+}
+
+func (p *payloadParser) Parse() error {
+	var envelopeErr error
+	if p.envelope != nil {
+		envelopeErr = p.envelope.Parse()
+		p.parts = p.envelope.Dump()
+	} else {
+		// RFC3164 sec 4.3.2: no usable header
+		p.parts = LogParts{
+			"timestamp": time.Now().Round(time.Second),
+			"hostname":  "",
+			"content":   string(bytes.TrimSpace(p.line)),
+		}
+	}
+
+	for _, decoder := range p.decoders {
+		start, ok := decoder.find(p.line)
+		if !ok {
+			continue
+		}
+		payload := bytes.TrimSpace(p.line[start:])
+		p.setBody(string(payload))
+		p.parts["payload"] = decoder.name()
+		if err := decoder.decode(payload, p.parts); err != nil {
+			return err
+		}
+		return envelopeErr
+	}
+
+	if envelopeErr != nil {
+		return envelopeErr
+	}
+	if len(p.decoders) == 1 {
+		// an explicit payload format was selected but the line does not carry it
+		return ErrPayloadNotFound
+	}
+	return nil
+}
+
+// The envelope parser may have split the payload (e.g. RFC3164 takes "CEF" as
+// the tag), so the body is reset to the whole payload
+func (p *payloadParser) setBody(payload string) {
+	key := "content"
+	if _, ok := p.parts["message"]; ok {
+		key = "message"
+	}
+	if tag, ok := p.parts["tag"].(string); ok && tag != "" && bytes.HasPrefix([]byte(payload), []byte(tag)) {
+		p.parts["tag"] = ""
+	}
+	p.parts[key] = payload
+}
+
+// stores a payload field without overwriting the envelope keys
+func setPayloadField(parts LogParts, prefix string, key string, value interface{}) {
+	if _, exists := parts[key]; exists {
+		key = prefix + "_" + key
+	}
+	parts[key] = value
+}
+
+func findRegexp(re *regexp.Regexp, line []byte) (int, bool) {
+	loc := re.FindIndex(line)
+	if loc == nil {
+		return 0, false
+	}
+	return loc[0], true
+}
+
+// splits s on sep, honouring backslash escapes, into at most n fields
+func splitEscaped(s string, sep byte, n int) []string {
+	var fields []string
+	start := 0
+	for i := 0; i < len(s) && len(fields) < n-1; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			fields = append(fields, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, s[start:])
+}
+
+// undoes the "\|", "\\", "\=", "\n" and "\r" escapes of CEF and LEEF
+func unescapePayload(s string) string {
+	if !bytes.ContainsRune([]byte(s), '\\') {
+		return s
+	}
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
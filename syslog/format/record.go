@@ -0,0 +1,433 @@
+package format
+
+import (
+	"bytes"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tea4go/gh/syslog/internal/syslogparser"
+	"github.com/tea4go/gh/syslog/internal/syslogparser/rfc5424"
+)
+
+/* Record is the typed counterpart of LogParts for high throughput servers.
+ *
+ * ParseRecord fills a Record which is reused from one message to the next: the
+ * byte slice fields point into the parsed line and nothing is allocated, the
+ * map, the strings and the interface boxing of the LogParts path are all
+ * avoided. The flip side is that a Record, and every slice in it, is only
+ * valid until the next message is parsed: a handler which keeps something
+ * must copy it (or use LogParts()).
+ *
+ * Only the RFC3164 (strict) and RFC5424 envelopes are parsed, detected like
+ * the Automatic format does. Lenient RFC3164 and the structured payloads are
+ * only available through LogParts.
+ */
+
+type Record struct {
+	Priority       int
+	Facility       int
+	Severity       int
+	Version        int // syslogparser.NO_VERSION (-1) for RFC3164
+	Timestamp      time.Time
+	Hostname       []byte
+	AppName        []byte // RFC3164 tag
+	ProcID         []byte // RFC3164 pid
+	MsgID          []byte
+	StructuredData []byte
+	Message        []byte // RFC3164 content
+
+	// Filled in by the server
+	Client   netip.AddrPort // invalid for unix sockets
+	TLSPeer  string
+	Listener string
+}
+
+// Reset clears the record, keeping nothing from the previous message
+func (r *Record) Reset() {
+	*r = Record{}
+}
+
+// IsRFC5424 reports whether the record was parsed from an RFC5424 message
+func (r *Record) IsRFC5424() bool {
+	return r.Version != syslogparser.NO_VERSION
+}
+
+// LogParts converts the record to the keys the RFC3164 and RFC5424 parsers
+// dump, copying every field
+func (r *Record) LogParts() LogParts {
+	if r.IsRFC5424() {
+		return LogParts{
+			"priority":        r.Priority,
+			"facility":        r.Facility,
+			"severity":        r.Severity,
+			"version":         r.Version,
+			"timestamp":       r.Timestamp,
+			"hostname":        string(r.Hostname),
+			"app_name":        string(r.AppName),
+			"proc_id":         string(r.ProcID),
+			"msg_id":          string(r.MsgID),
+			"structured_data": string(r.StructuredData),
+			"message":         string(r.Message),
+		}
+	}
+	pid, err := strconv.Atoi(string(r.ProcID))
+	if err != nil {
+		pid = 0
+	}
+	return LogParts{
+		"timestamp": r.Timestamp,
+		"hostname":  string(r.Hostname),
+		"tag":       string(r.AppName),
+		"pid":       pid,
+		"content":   string(r.Message),
+		"priority":  r.Priority,
+		"facility":  r.Facility,
+		"severity":  r.Severity,
+	}
+}
+
+// ParseRecord parses line into record. location is used for RFC3164
+// timestamps, nil means UTC. On error the fields parsed so far are kept
+func ParseRecord(line []byte, record *Record, location *time.Location) error {
+	client, tlsPeer, listener := record.Client, record.TLSPeer, record.Listener
+	record.Reset()
+	record.Client, record.TLSPeer, record.Listener = client, tlsPeer, listener
+
+	if location == nil {
+		location = time.UTC
+	}
+	if format, _ := detect(line); format == detectedRFC5424 {
+		return parseRecord5424(line, record)
+	}
+	return parseRecord3164(line, record, location)
+}
+
+// Same rules as internal/syslogparser/rfc3164, on byte slices
+func parseRecord3164(buff []byte, r *Record, location *time.Location) error {
+	r.Version = syslogparser.NO_VERSION
+	cursor := 0
+	l := len(buff)
+	pri, err := syslogparser.ParsePriority(buff, &cursor, l)
+	if err != nil {
+		return err
+	}
+	r.Priority, r.Facility, r.Severity = pri.P, pri.F.Value, pri.S.Value
+
+	skipTag := false
+	if ts, n, ok := parseStamp3164(buff[cursor:], location); ok {
+		r.Timestamp = ts
+		cursor += n
+		if cursor < l && buff[cursor] == ' ' {
+			cursor++
+		}
+		from := cursor
+		for cursor < l && buff[cursor] != ' ' {
+			cursor++
+		}
+		r.Hostname = buff[from:cursor]
+		cursor++
+	} else {
+		// RFC3164 sec 4.3.2.
+		r.Timestamp = time.Now().Round(time.Second)
+		skipTag = true
+	}
+
+	if !skipTag && cursor < l {
+		cursor = parseTag3164(buff, cursor, r)
+	}
+	if cursor < l {
+		r.Message = bytes.Trim(buff[cursor:], " ")
+	}
+	return nil
+}
+
+var months = [12]string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+// "Jan 02 15:04:05" or "Jan  2 15:04:05", the year is the current one
+func parseStamp3164(b []byte, location *time.Location) (time.Time, int, bool) {
+	if len(b) < 15 || b[3] != ' ' || b[6] != ' ' || b[9] != ':' || b[12] != ':' {
+		return time.Time{}, 0, false
+	}
+	month := 0
+	for i, name := range months {
+		if lower(b[0]) == name[0] && lower(b[1]) == name[1] && lower(b[2]) == name[2] {
+			month = i + 1
+			break
+		}
+	}
+	var day int
+	var ok bool
+	if b[4] == ' ' {
+		day, ok = digits(b[5:6])
+	} else {
+		day, ok = digits(b[4:6])
+	}
+	hour, okHour := digits(b[7:9])
+	minute, okMinute := digits(b[10:12])
+	second, okSecond := digits(b[13:15])
+	if month == 0 || !ok || !okHour || !okMinute || !okSecond ||
+		day < 1 || day > 31 || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, 0, false
+	}
+	ts := time.Date(time.Now().Year(), time.Month(month), day, hour, minute, second, 0, location)
+	if ts.Day() != day {
+		// Feb 30
+		return time.Time{}, 0, false
+	}
+	return ts, 15, true
+}
+
+// http://tools.ietf.org/html/rfc3164#section-4.1.3, returns the cursor of
+// the content
+func parseTag3164(buff []byte, cursor int, r *Record) int {
+	l := len(buff)
+	from := cursor
+	pidFound := false
+	var tag []byte
+	for {
+		if cursor == l {
+			// no tag found, reset cursor for content
+			return from
+		}
+
+		b := buff[cursor]
+		tagEnd := b == ':' || b == ' '
+		if !pidFound && b == '[' {
+			tag = buff[from:cursor]
+			cursor++
+			from = cursor
+			pidFound = true
+			continue
+		}
+		if pidFound && (b == ']' || tagEnd) {
+			r.ProcID = buff[from:cursor]
+			cursor++
+			if cursor < l && (buff[cursor] == ':' || buff[cursor] == ' ') {
+				cursor++
+			}
+			break
+		}
+		if tagEnd {
+			tag = buff[from:cursor]
+			cursor++
+			break
+		}
+		cursor++
+	}
+
+	r.AppName = tag
+	if cursor < l && buff[cursor] == ' ' {
+		cursor++
+	}
+	return cursor
+}
+
+// Same rules as internal/syslogparser/rfc5424, on byte slices
+func parseRecord5424(buff []byte, r *Record) error {
+	cursor := 0
+	l := len(buff)
+	pri, err := syslogparser.ParsePriority(buff, &cursor, l)
+	if err != nil {
+		return err
+	}
+	r.Priority, r.Facility, r.Severity = pri.P, pri.F.Value, pri.S.Value
+
+	if cursor >= l {
+		return syslogparser.ErrVersionNotFound
+	}
+	r.Version = int(buff[cursor] - '0')
+	cursor += 2
+
+	if cursor >= l {
+		return syslogparser.ErrEOL
+	}
+	if buff[cursor] == rfc5424.NILVALUE {
+		cursor++
+	} else {
+		ts, n, err := parseStamp5424(buff[cursor:])
+		if err != nil {
+			return err
+		}
+		r.Timestamp = ts
+		cursor += n
+	}
+	cursor++
+	if cursor >= l {
+		return syslogparser.ErrEOL
+	}
+
+	field := func(max int) ([]byte, bool) {
+		from := cursor
+		end := from + max
+		for ; cursor < end && cursor < l; cursor++ {
+			if buff[cursor] == ' ' {
+				value := buff[from:cursor]
+				cursor++
+				return value, true
+			}
+		}
+		return nil, false
+	}
+
+	from := cursor
+	for cursor < l && buff[cursor] != ' ' {
+		cursor++
+	}
+	r.Hostname = buff[from:cursor]
+	cursor++
+
+	var ok bool
+	if r.AppName, ok = field(48); !ok {
+		return rfc5424.ErrInvalidAppName
+	}
+	// like the LogParts parser, a bad PROCID or MSGID is not an error
+	if r.ProcID, ok = field(128); ok {
+		r.MsgID, _ = field(32)
+	}
+
+	switch {
+	case cursor >= l:
+		r.StructuredData = nilValue
+		return nil
+	case buff[cursor] == rfc5424.NILVALUE:
+		r.StructuredData = nilValue
+		cursor++
+	case buff[cursor] == '[':
+		// the first ']' followed by a space or the end of the line
+		end := -1
+		for i := cursor; i < l; i++ {
+			if buff[i] == ']' && (i+1 == l || buff[i+1] == ' ') {
+				end = i + 1
+				break
+			}
+		}
+		if end < 0 {
+			return rfc5424.ErrNoStructuredData
+		}
+		r.StructuredData = buff[cursor:end]
+		cursor = end
+	default:
+		return rfc5424.ErrNoStructuredData
+	}
+
+	cursor++
+	if cursor < l {
+		r.Message = buff[cursor:]
+	}
+	return nil
+}
+
+var nilValue = []byte{rfc5424.NILVALUE}
+
+// 2006-01-02T15:04:05[.999999999](Z|-07:00)
+func parseStamp5424(b []byte) (time.Time, int, error) {
+	if len(b) < 20 || b[4] != '-' || b[7] != '-' || b[13] != ':' || b[16] != ':' {
+		return time.Time{}, 0, rfc5424.ErrInvalidTimeFormat
+	}
+	if b[10] != 'T' {
+		return time.Time{}, 0, rfc5424.ErrInvalidTimeFormat
+	}
+	year, ok := digits(b[0:4])
+	if !ok {
+		return time.Time{}, 0, rfc5424.ErrYearInvalid
+	}
+	month, ok := digits(b[5:7])
+	if !ok || month < 1 || month > 12 {
+		return time.Time{}, 0, rfc5424.ErrMonthInvalid
+	}
+	day, ok := digits(b[8:10])
+	if !ok || day < 1 || day > 31 {
+		return time.Time{}, 0, rfc5424.ErrDayInvalid
+	}
+	hour, okHour := digits(b[11:13])
+	minute, okMinute := digits(b[14:16])
+	second, okSecond := digits(b[17:19])
+	if !okHour || !okMinute || !okSecond || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, 0, syslogparser.ErrTimestampUnknownFormat
+	}
+
+	n := 19
+	nsec := 0
+	if b[n] == '.' {
+		n++
+		scale := 100000000
+		start := n
+		for ; n < len(b) && b[n] >= '0' && b[n] <= '9'; n++ {
+			nsec += int(b[n]-'0') * scale
+			scale /= 10
+		}
+		if n == start {
+			return time.Time{}, 0, rfc5424.ErrSecFracInvalid
+		}
+	}
+
+	if n >= len(b) {
+		return time.Time{}, 0, rfc5424.ErrTimeZoneInvalid
+	}
+	var location *time.Location
+	switch b[n] {
+	case 'Z':
+		location = time.UTC
+		n++
+	case '+', '-':
+		if n+6 > len(b) || b[n+3] != ':' {
+			return time.Time{}, 0, rfc5424.ErrTimeZoneInvalid
+		}
+		zoneHour, okHour := digits(b[n+1 : n+3])
+		zoneMinute, okMinute := digits(b[n+4 : n+6])
+		if !okHour || !okMinute || zoneHour > 23 || zoneMinute > 59 {
+			return time.Time{}, 0, rfc5424.ErrTimeZoneInvalid
+		}
+		offset := zoneHour*3600 + zoneMinute*60
+		if b[n] == '-' {
+			offset = -offset
+		}
+		location = fixedZone(offset)
+		n += 6
+	default:
+		return time.Time{}, 0, rfc5424.ErrTimeZoneInvalid
+	}
+
+	return time.Date(year, time.Month(month), day, hour, minute, second, nsec, location), n, nil
+}
+
+var (
+	zoneLock  sync.RWMutex
+	zoneCache = make(map[int]*time.Location)
+)
+
+// time.FixedZone allocates, the handful of offsets seen in practice are cached
+func fixedZone(offset int) *time.Location {
+	zoneLock.RLock()
+	location, ok := zoneCache[offset]
+	zoneLock.RUnlock()
+	if ok {
+		return location
+	}
+
+	location = time.FixedZone("", offset)
+	zoneLock.Lock()
+	zoneCache[offset] = location
+	zoneLock.Unlock()
+	return location
+}
+
+func digits(b []byte) (int, bool) {
+	value := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		value = value*10 + int(c-'0')
+	}
+	return value, true
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,140 @@
+package format
+
+import (
+	"testing"
+	"time"
+)
+
+var (
+	benchRFC3164 = []byte("<34>Oct 11 22:14:15 mymachine su[1234]: 'su root' failed for lonvick on /dev/pts/8")
+	benchRFC5424 = []byte(`<165>1 2003-10-11T22:14:15.003+08:00 mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="Application"] An application event log entry...`)
+)
+
+func TestParseRecord_SameAsLogParts(t *testing.T) {
+	lines := []string{
+		string(benchRFC3164),
+		"<13>Jan  5 08:01:02 host1 kernel: link down",
+		"<13>Mar 01 00:00:00 host1 no tag here",
+		"<13>Apr  1 12:00:00 host1 notag",
+		"<13>May  1 12:00:00 host1",
+		string(benchRFC5424),
+		"<34>1 2003-10-11T22:14:15Z mymachine su - ID47 - 'su root' failed",
+		"<34>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - - %% It's time to make the do-nuts.",
+		"<34>1 - - - - - -",
+		"<34>1 2003-10-11T22:14:15Z host app - - [a@1 x=\"y\"][b@2 z=\"w\"]",
+	}
+
+	var record Record
+	for _, line := range lines {
+		var parser LogParser
+		if format, _ := detect([]byte(line)); format == detectedRFC5424 {
+			parser = (&RFC5424{}).GetParser([]byte(line))
+		} else {
+			parser = (&RFC3164{}).GetParser([]byte(line))
+		}
+		if err := parser.Parse(); err != nil {
+			t.Fatalf("%q: Parse failed: %v", line, err)
+		}
+		if err := ParseRecord([]byte(line), &record, nil); err != nil {
+			t.Fatalf("%q: ParseRecord failed: %v", line, err)
+		}
+
+		expected := parser.Dump()
+		parts := record.LogParts()
+		if len(parts) != len(expected) {
+			t.Errorf("%q: keys %v, want %v", line, parts, expected)
+		}
+		for key, value := range expected {
+			if ts, ok := value.(time.Time); ok {
+				if !ts.Equal(parts[key].(time.Time)) {
+					t.Errorf("%q: %s = %v, want %v", line, key, parts[key], value)
+				}
+				continue
+			}
+			if parts[key] != value {
+				t.Errorf("%q: %s = %#v, want %#v", line, key, parts[key], value)
+			}
+		}
+	}
+}
+
+func TestParseRecord_Location(t *testing.T) {
+	location := time.FixedZone("CST", 8*3600)
+	var record Record
+	if err := ParseRecord(benchRFC3164, &record, location); err != nil {
+		t.Fatalf("ParseRecord failed: %v", err)
+	}
+	if record.Timestamp.Location() != location || record.Timestamp.Hour() != 22 {
+		t.Errorf("timestamp = %v", record.Timestamp)
+	}
+
+	if err := ParseRecord(benchRFC5424, &record, location); err != nil {
+		t.Fatalf("ParseRecord failed: %v", err)
+	}
+	if _, offset := record.Timestamp.Zone(); offset != 8*3600 || record.Timestamp.Nanosecond() != 3000000 {
+		t.Errorf("timestamp = %v", record.Timestamp)
+	}
+}
+
+func TestParseRecord_Errors(t *testing.T) {
+	lines := []string{
+		"",
+		"no priority",
+		"<34>1 2003-10-11 22:14:15Z host app - - -",
+		"<34>1 2003-10-11T22:14:15Z",
+		"<34>1 2003-10-11T22:14:15Z host app - - [unterminated",
+	}
+	var record Record
+	for _, line := range lines {
+		if err := ParseRecord([]byte(line), &record, nil); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+func TestParseRecord_NoAllocation(t *testing.T) {
+	var record Record
+	for _, line := range [][]byte{benchRFC3164, benchRFC5424} {
+		allocs := testing.AllocsPerRun(100, func() {
+			ParseRecord(line, &record, time.UTC)
+		})
+		if allocs != 0 {
+			t.Errorf("%q: %v allocations per message, want 0", line, allocs)
+		}
+	}
+}
+
+func benchmarkLogParts(b *testing.B, f Format, line []byte) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(line)))
+	for i := 0; i < b.N; i++ {
+		parser := f.GetParser(line)
+		parser.Parse()
+		parser.Dump()
+	}
+}
+
+func benchmarkRecord(b *testing.B, line []byte) {
+	var record Record
+	b.ReportAllocs()
+	b.SetBytes(int64(len(line)))
+	for i := 0; i < b.N; i++ {
+		ParseRecord(line, &record, time.UTC)
+	}
+}
+
+func BenchmarkLogParts_RFC3164(b *testing.B) {
+	benchmarkLogParts(b, &RFC3164{}, benchRFC3164)
+}
+
+func BenchmarkRecord_RFC3164(b *testing.B) {
+	benchmarkRecord(b, benchRFC3164)
+}
+
+func BenchmarkLogParts_RFC5424(b *testing.B) {
+	benchmarkLogParts(b, &RFC5424{}, benchRFC5424)
+}
+
+func BenchmarkRecord_RFC5424(b *testing.B) {
+	benchmarkRecord(b, benchRFC5424)
+}
@@ -6,10 +6,17 @@ import (
 	"github.com/tea4go/gh/syslog/internal/syslogparser/rfc3164"
 )
 
-type RFC3164 struct{}
+type RFC3164 struct {
+	// Lenient accepts the vendor variants of RFC3164 (years, ISO8601
+	// timestamps, sequence numbers, missing hostname, FortiGate key=value)
+	// and reports the matched one in the "variant" key
+	Lenient bool
+}
 
 func (f *RFC3164) GetParser(line []byte) LogParser {
-	return &parserWrapper{rfc3164.NewParser(line)}
+	parser := rfc3164.NewParser(line)
+	parser.Lenient(f.Lenient)
+	return &parserWrapper{parser}
 }
 
 func (f *RFC3164) GetSplitFunc() bufio.SplitFunc {
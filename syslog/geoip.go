@@ -0,0 +1,149 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tea4go/gh/syslog/format"
+)
+
+// Location of an address range
+type GeoLocation struct {
+	Country string
+	Region  string
+	City    string
+}
+
+type geoRange struct {
+	start    net.IP // 16 byte form
+	end      net.IP
+	location GeoLocation
+}
+
+// IP address database loaded from a CSV file, one address range per line:
+//
+//	10.0.0.0/8,CN,Zhejiang,Hangzhou
+//	192.168.1.1,192.168.1.255,CN,Zhejiang,Ningbo
+//
+// A CIDR or a first and last address, followed by country, region and city.
+// Empty lines, lines starting with '#' and unknown lines (e.g. a header) are
+// ignored. Ranges must not overlap
+type GeoIPDB struct {
+	ranges []geoRange
+}
+
+// Loads a CSV address database file
+func LoadGeoIP(filename string) (*GeoIPDB, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadGeoIP(file)
+}
+
+// Reads a CSV address database from r
+func ReadGeoIP(r io.Reader) (*GeoIPDB, error) {
+	db := &GeoIPDB{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+		fields, err := csv.NewReader(bytes.NewReader(text)).Read()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if item, ok := parseGeoRange(fields); ok {
+			db.ranges = append(db.ranges, item)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start, db.ranges[j].start) < 0
+	})
+	return db, nil
+}
+
+func parseGeoRange(fields []string) (geoRange, bool) {
+	var item geoRange
+	if _, network, err := net.ParseCIDR(strings.TrimSpace(fields[0])); err == nil {
+		item.start = network.IP.To16()
+		item.end = make(net.IP, net.IPv6len)
+		mask := network.Mask
+		if len(mask) == net.IPv4len {
+			mask = append(net.CIDRMask(96, 128)[:12], mask...)
+		}
+		for i := range item.end {
+			item.end[i] = item.start[i] | ^mask[i]
+		}
+		fields = fields[1:]
+	} else if len(fields) > 1 {
+		start := net.ParseIP(strings.TrimSpace(fields[0]))
+		end := net.ParseIP(strings.TrimSpace(fields[1]))
+		if start == nil || end == nil {
+			return item, false
+		}
+		item.start, item.end = start.To16(), end.To16()
+		fields = fields[2:]
+	} else {
+		return item, false
+	}
+
+	values := make([]string, 3)
+	for i := 0; i < len(values) && i < len(fields); i++ {
+		values[i] = strings.TrimSpace(fields[i])
+	}
+	item.location = GeoLocation{Country: values[0], Region: values[1], City: values[2]}
+	return item, true
+}
+
+// Returns the location of the range containing ip
+func (db *GeoIPDB) Lookup(ip net.IP) (GeoLocation, bool) {
+	ip = ip.To16()
+	if ip == nil {
+		return GeoLocation{}, false
+	}
+	// the last range starting at or before ip
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].start, ip) > 0
+	}) - 1
+	if i < 0 || bytes.Compare(ip, db.ranges[i].end) > 0 {
+		return GeoLocation{}, false
+	}
+	return db.ranges[i].location, true
+}
+
+// Returns the number of ranges
+func (db *GeoIPDB) Len() int {
+	return len(db.ranges)
+}
+
+// Looks up the location of the client address (client key) and sets the
+// geo_country, geo_region and geo_city keys
+func GeoIP(db *GeoIPDB) Middleware {
+	return Enrich(func(logParts format.LogParts) {
+		ip := net.ParseIP(clientIP(logParts))
+		if ip == nil {
+			return
+		}
+		if location, ok := db.Lookup(ip); ok {
+			logParts["geo_country"] = location.Country
+			logParts["geo_region"] = location.Region
+			logParts["geo_city"] = location.City
+		}
+	})
+}
@@ -11,6 +11,13 @@ type Handler interface {
 	Handle(format.LogParts, int64, error)
 }
 
+//The record handler receives every syslog entry as a typed record, without
+//the map allocation of Handler. The record and its byte slices are reused for
+//the next entry once HandleRecord returns, see format.Record
+type RecordHandler interface {
+	HandleRecord(*format.Record, int64, error)
+}
+
 type LogPartsChannel chan format.LogParts
 
 //The ChannelHandler will send all the syslog entries into the given channel
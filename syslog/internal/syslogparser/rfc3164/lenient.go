@@ -0,0 +1,293 @@
+package rfc3164
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tea4go/gh/syslog/internal/syslogparser"
+)
+
+// Variants reported in the "variant" key of a lenient parse. Several of them
+// can match the same line, they are then joined with a comma
+// (e.g. "sequence,rfc3164,no_hostname")
+const (
+	VariantRFC3164    = "rfc3164"     // Mmm dd hh:mm:ss
+	VariantYear       = "year"        // Mmm dd yyyy hh:mm:ss (Huawei, Cisco "service timestamps ... year")
+	VariantISO8601    = "iso8601"     // 2006-01-02T15:04:05+08:00
+	VariantKeyValue   = "kv"          // FortiGate: date=2006-01-02 time=15:04:05 devname="fw" ...
+	VariantSequence   = "sequence"    // Cisco sequence number before the timestamp: "123: "
+	VariantNoHostname = "no_hostname" // no hostname between the timestamp and the tag
+	VariantUnknown    = "unknown"     // no timestamp recognized, RFC3164 sec 4.3.2 applies
+)
+
+type lenientLayout struct {
+	layout  string
+	variant string
+	year    bool // the layout carries the year
+	colon   bool // only valid when the timestamp is terminated by ':' (Cisco)
+}
+
+// Tried against 5, 4, 3, 2 and then 1 space separated tokens. Fractional seconds
+// (Cisco "18:46:11.123") are accepted by time.Parse without being in the layout
+var lenientLayouts = []lenientLayout{
+	{"Jan 2 15:04:05", VariantRFC3164, false, false},
+	{"Jan 2 15:04:05 MST", VariantRFC3164, false, true},
+	{"Jan 2 2006 15:04:05", VariantYear, true, false},
+	{"Jan 2 2006 15:04:05Z07:00", VariantYear, true, false},
+	{"Jan 2 2006 15:04:05 MST", VariantYear, true, true},
+	{"Jan 2 15:04:05 2006", VariantYear, true, false},
+	{time.RFC3339Nano, VariantISO8601, true, false},
+	{"2006-01-02T15:04:05", VariantISO8601, true, false},
+	{"2006-01-02 15:04:05Z07:00", VariantISO8601, true, false},
+	{"2006-01-02 15:04:05", VariantISO8601, true, false},
+}
+
+// Zone abbreviations accepted after a Cisco timestamp, with their UTC offset in
+// seconds. Other upper case words are more likely a tag ("SSH:") than a time
+// zone. CST and IST are ambiguous, the parser location wins when it uses the
+// same abbreviation (e.g. Asia/Shanghai for CST)
+var knownZones = map[string]int{
+	"UTC": 0, "GMT": 0, "CST": -6 * 3600, "CDT": -5 * 3600, "EST": -5 * 3600, "EDT": -4 * 3600,
+	"MST": -7 * 3600, "MDT": -6 * 3600, "PST": -8 * 3600, "PDT": -7 * 3600, "CET": 3600, "CEST": 2 * 3600,
+	"BST": 3600, "MSK": 3 * 3600, "IST": 5*3600 + 1800, "JST": 9 * 3600, "KST": 9 * 3600, "HKT": 8 * 3600,
+	"SGT": 8 * 3600, "AEST": 10 * 3600,
+}
+
+var (
+	kvDate    = regexp.MustCompile(`(?:^|\s)date="?(\d{4}-\d{2}-\d{2})"?`)
+	kvTime    = regexp.MustCompile(`(?:^|\s)time="?(\d{2}:\d{2}:\d{2})"?`)
+	kvTz      = regexp.MustCompile(`(?:^|\s)tz="?([+-]\d{4})"?`)
+	kvDevname = regexp.MustCompile(`(?:^|\s)devname="?([^"\s]+)"?`)
+)
+
+// Lenient switches the parser to a mode which accepts the RFC3164 variants
+// sent by real devices: years and time zones in the timestamp, ISO8601
+// timestamps, sequence numbers before the timestamp, a missing hostname and
+// FortiGate key=value headers. Missing year and time zone are taken from the
+// parser location. The matched variant is reported in the "variant" key
+func (p *Parser) Lenient(lenient bool) {
+	p.lenient = lenient
+}
+
+type token struct {
+	start int
+	end   int
+}
+
+// returns up to max space separated tokens starting at from
+func (p *Parser) tokens(from int, max int) []token {
+	var tokens []token
+	i := from
+	for len(tokens) < max {
+		for i < p.l && p.buff[i] == ' ' {
+			i++
+		}
+		if i >= p.l {
+			break
+		}
+		start := i
+		for i < p.l && p.buff[i] != ' ' {
+			i++
+		}
+		tokens = append(tokens, token{start, i})
+	}
+	return tokens
+}
+
+func (p *Parser) skipSpaces() {
+	for p.cursor < p.l && p.buff[p.cursor] == ' ' {
+		p.cursor++
+	}
+}
+
+func (p *Parser) parseLenient() error {
+	pri, err := p.parsePriority()
+	if err != nil {
+		return err
+	}
+
+	var variants []string
+	hdr := header{}
+
+	p.sequence = -1
+	if seq, ok := p.parseSequence(); ok {
+		p.sequence = seq
+		variants = append(variants, VariantSequence)
+	}
+
+	hostnameFound := false
+	ts, variant, ok := p.parseLenientTimestamp()
+	if !ok {
+		// Cisco with "logging origin-id hostname": "123: router1: *Mar  1 ..."
+		if tokens := p.tokens(p.cursor, 1); len(tokens) == 1 && p.buff[tokens[0].end-1] == ':' {
+			start := p.cursor
+			p.cursor = tokens[0].end
+			if ts, variant, ok = p.parseLenientTimestamp(); ok {
+				hdr.hostname = string(p.buff[tokens[0].start : tokens[0].end-1])
+				hostnameFound = true
+			} else {
+				p.cursor = start
+			}
+		}
+	}
+
+	switch {
+	case ok:
+		hdr.timestamp = ts
+		variants = append(variants, variant)
+		if !hostnameFound {
+			hdr.hostname, hostnameFound = p.parseLenientHostname()
+			if !hostnameFound {
+				variants = append(variants, VariantNoHostname)
+			}
+		}
+	case p.parseKeyValueHeader(&hdr):
+		variants = append(variants, VariantKeyValue)
+		// the whole key=value list is the content
+		p.skipTag = true
+	default:
+		// RFC3164 sec 4.3.2.
+		hdr.timestamp = time.Now().Round(time.Second)
+		p.skipTag = true
+		variants = append(variants, VariantUnknown)
+	}
+
+	msg, err := p.parsemessage()
+	if err != syslogparser.ErrEOL {
+		return err
+	}
+
+	p.priority = pri
+	p.version = syslogparser.NO_VERSION
+	p.header = hdr
+	p.message = msg
+	p.variant = strings.Join(variants, ",")
+
+	return nil
+}
+
+// Cisco "service sequence-numbers": "<189>123: ..."
+func (p *Parser) parseSequence() (int, bool) {
+	i := p.cursor
+	for i < p.l && syslogparser.IsDigit(p.buff[i]) {
+		i++
+	}
+	if i == p.cursor || i >= p.l || p.buff[i] != ':' {
+		return 0, false
+	}
+	seq, err := strconv.Atoi(string(p.buff[p.cursor:i]))
+	if err != nil {
+		return 0, false
+	}
+	p.cursor = i + 1
+	p.skipSpaces()
+	return seq, true
+}
+
+func (p *Parser) parseLenientTimestamp() (time.Time, string, bool) {
+	tokens := p.tokens(p.cursor, 5)
+
+	for k := len(tokens); k > 0; k-- {
+		parts := make([]string, k)
+		for i := 0; i < k; i++ {
+			parts[i] = string(p.buff[tokens[i].start:tokens[i].end])
+		}
+		candidate := strings.Join(parts, " ")
+		colon := strings.HasSuffix(candidate, ":")
+		candidate = strings.TrimSuffix(candidate, ":")
+		// Cisco marks unsynchronized clocks with '*' and lost sync with '.'
+		candidate = strings.TrimLeft(candidate, "*.")
+
+		for _, layout := range lenientLayouts {
+			if layout.colon && !colon {
+				continue
+			}
+			ts, err := time.ParseInLocation(layout.layout, candidate, p.location)
+			if err != nil {
+				continue
+			}
+			if layout.colon {
+				zone := parts[k-1][:len(parts[k-1])-1]
+				offset, ok := knownZones[zone]
+				if !ok {
+					continue
+				}
+				// time.Parse makes up a zero offset for abbreviations
+				// unknown to the parser location
+				if ts.Location() != p.location {
+					ts = time.Date(ts.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(),
+						ts.Second(), ts.Nanosecond(), time.FixedZone(zone, offset))
+				}
+			}
+			if !layout.year {
+				ts = p.guessYear(ts)
+			}
+			p.cursor = tokens[k-1].end
+			p.skipSpaces()
+			return ts, layout.variant, true
+		}
+	}
+
+	return time.Time{}, "", false
+}
+
+// A timestamp without year belongs to the current year, unless that puts it
+// more than a day into the future (a December message received in January)
+func (p *Parser) guessYear(ts time.Time) time.Time {
+	now := time.Now().In(p.location)
+	guess := time.Date(now.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(),
+		ts.Second(), ts.Nanosecond(), ts.Location())
+	if guess.After(now.Add(24 * time.Hour)) {
+		guess = guess.AddDate(-1, 0, 0)
+	}
+	return guess
+}
+
+// The token after the timestamp is the hostname, unless it already looks like
+// a tag ("su:", "sshd[12]:") or a Cisco mnemonic ("%SYS-5-CONFIG_I:")
+func (p *Parser) parseLenientHostname() (string, bool) {
+	tokens := p.tokens(p.cursor, 1)
+	if len(tokens) == 0 {
+		return "", false
+	}
+	tok := p.buff[tokens[0].start:tokens[0].end]
+	if tok[len(tok)-1] == ':' || tok[0] == '%' || strings.IndexByte(string(tok), '[') >= 0 {
+		return "", false
+	}
+	p.cursor = tokens[0].end
+	p.skipSpaces()
+	return string(tok), true
+}
+
+// FortiGate: date=2024-03-05 time=10:20:30 devname="FG100E" tz="+0800" ...
+func (p *Parser) parseKeyValueHeader(hdr *header) bool {
+	rest := string(p.buff[p.cursor:p.l])
+	if !strings.HasPrefix(rest, "date=") {
+		return false
+	}
+	date := kvDate.FindStringSubmatch(rest)
+	clock := kvTime.FindStringSubmatch(rest)
+	if date == nil || clock == nil {
+		return false
+	}
+
+	value := date[1] + " " + clock[1]
+	var ts time.Time
+	var err error
+	if tz := kvTz.FindStringSubmatch(rest); tz != nil {
+		ts, err = time.Parse("2006-01-02 15:04:05 -0700", value+" "+tz[1])
+	} else {
+		ts, err = time.ParseInLocation("2006-01-02 15:04:05", value, p.location)
+	}
+	if err != nil {
+		return false
+	}
+
+	hdr.timestamp = ts
+	if devname := kvDevname.FindStringSubmatch(rest); devname != nil {
+		hdr.hostname = devname[1]
+	}
+	return true
+}
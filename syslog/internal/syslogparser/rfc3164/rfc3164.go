@@ -18,6 +18,9 @@ type Parser struct {
 	message  rfc3164message
 	location *time.Location
 	skipTag  bool
+	lenient  bool
+	variant  string
+	sequence int
 }
 
 type header struct {
@@ -45,6 +48,10 @@ func (p *Parser) Location(location *time.Location) {
 }
 
 func (p *Parser) Parse() error {
+	if p.lenient {
+		return p.parseLenient()
+	}
+
 	pri, err := p.parsePriority()
 	if err != nil {
 		return err
@@ -79,7 +86,7 @@ func (p *Parser) Parse() error {
 }
 
 func (p *Parser) Dump() syslogparser.LogParts {
-	return syslogparser.LogParts{
+	parts := syslogparser.LogParts{
 		"timestamp": p.header.timestamp,
 		"hostname":  p.header.hostname,
 		"tag":       p.message.tag,
@@ -89,6 +96,13 @@ func (p *Parser) Dump() syslogparser.LogParts {
 		"facility":  p.priority.F.Value,
 		"severity":  p.priority.S.Value,
 	}
+	if p.lenient {
+		parts["variant"] = p.variant
+		if p.sequence >= 0 {
+			parts["sequence"] = p.sequence
+		}
+	}
+	return parts
 }
 
 func (p *Parser) parsePriority() (syslogparser.Priority, error) {
@@ -203,7 +217,8 @@ func (p *Parser) parseTag() (string, int, error) {
 
 	from := p.cursor
 	for {
-		if p.cursor == p.l {
+		// the cursor is past the end when the line stops after the hostname
+		if p.cursor >= p.l {
 			// no tag found, reset cursor for content
 			p.cursor = from
 			return "", 0, nil
@@ -214,6 +214,18 @@ func TestParser_Parse_PIDEndBracketAtBufferEnd(t *testing.T) {
 	}
 }
 
+func TestParser_Parse_EndsAfterHostname(t *testing.T) {
+	buff := []byte("<13>Jan  1 00:00:00 host")
+	p := NewParser(buff)
+	if err := p.Parse(); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	parts := p.Dump()
+	if parts["hostname"] != "host" || parts["tag"] != "" || parts["content"] != "" {
+		t.Errorf("unexpected parts: %v", parts)
+	}
+}
+
 // --- Parse: Various timestamp formats ---
 
 func TestParser_Parse_TimestampFormat1(t *testing.T) {
@@ -569,3 +581,180 @@ func TestParser_Parse_NoColonAfterTag(t *testing.T) {
 		t.Errorf("tag = %v, want 'app'", parts["tag"])
 	}
 }
+
+// --- Lenient mode ---
+
+func parseLenient(t *testing.T, line string, location *time.Location) syslogparser.LogParts {
+	t.Helper()
+	p := NewParser([]byte(line))
+	p.Lenient(true)
+	if location != nil {
+		p.Location(location)
+	}
+	if err := p.Parse(); err != nil {
+		t.Fatalf("Parse(%q) failed: %v", line, err)
+	}
+	return p.Dump()
+}
+
+func TestParser_Lenient_StrictLine(t *testing.T) {
+	parts := parseLenient(t, "<34>Oct 11 22:14:15 myhost su: 'su root' failed", nil)
+	if parts["variant"] != VariantRFC3164 {
+		t.Errorf("variant = %v, want %s", parts["variant"], VariantRFC3164)
+	}
+	if parts["hostname"] != "myhost" || parts["tag"] != "su" || parts["content"] != "'su root' failed" {
+		t.Errorf("unexpected parts: %v", parts)
+	}
+	if _, ok := parts["sequence"]; ok {
+		t.Error("sequence should not be reported without sequence number")
+	}
+}
+
+func TestParser_Lenient_YearInTimestamp(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	parts := parseLenient(t, "<187>Mar  5 2021 10:20:30 HUAWEI-SW %%01SHELL/5/CMDRECORD(s)[0]: Recorded command", loc)
+	if parts["variant"] != VariantYear {
+		t.Errorf("variant = %v, want %s", parts["variant"], VariantYear)
+	}
+	want := time.Date(2021, 3, 5, 10, 20, 30, 0, loc)
+	if ts := parts["timestamp"].(time.Time); !ts.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", ts, want)
+	}
+	if parts["hostname"] != "HUAWEI-SW" {
+		t.Errorf("hostname = %v, want HUAWEI-SW", parts["hostname"])
+	}
+}
+
+func TestParser_Lenient_YearWithOffset(t *testing.T) {
+	parts := parseLenient(t, "<187>Mar  5 2021 10:20:30+08:00 sw1 %%01SHELL/5/LOGIN: user login", nil)
+	want := time.Date(2021, 3, 5, 2, 20, 30, 0, time.UTC)
+	if ts := parts["timestamp"].(time.Time); !ts.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", ts, want)
+	}
+}
+
+func TestParser_Lenient_ISO8601(t *testing.T) {
+	parts := parseLenient(t, "<134>2021-03-05T10:20:30.123+08:00 fw01 kernel: packet dropped", nil)
+	if parts["variant"] != VariantISO8601 {
+		t.Errorf("variant = %v, want %s", parts["variant"], VariantISO8601)
+	}
+	want := time.Date(2021, 3, 5, 2, 20, 30, 123000000, time.UTC)
+	if ts := parts["timestamp"].(time.Time); !ts.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", ts, want)
+	}
+	if parts["hostname"] != "fw01" || parts["tag"] != "kernel" {
+		t.Errorf("unexpected parts: %v", parts)
+	}
+}
+
+func TestParser_Lenient_ISO8601WithoutZone(t *testing.T) {
+	loc := time.FixedZone("TEST", 3600)
+	parts := parseLenient(t, "<134>2021-03-05 10:20:30 host app: msg", loc)
+	want := time.Date(2021, 3, 5, 10, 20, 30, 0, loc)
+	if ts := parts["timestamp"].(time.Time); !ts.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", ts, want)
+	}
+}
+
+func TestParser_Lenient_CiscoSequence(t *testing.T) {
+	parts := parseLenient(t, "<189>123: *Mar  1 18:46:11.123 UTC: %SYS-5-CONFIG_I: Configured from console", nil)
+	if parts["variant"] != "sequence,rfc3164,no_hostname" {
+		t.Errorf("variant = %v", parts["variant"])
+	}
+	if parts["sequence"] != 123 {
+		t.Errorf("sequence = %v, want 123", parts["sequence"])
+	}
+	if parts["hostname"] != "" {
+		t.Errorf("hostname = %v, want empty", parts["hostname"])
+	}
+	if parts["tag"] != "%SYS-5-CONFIG_I" || parts["content"] != "Configured from console" {
+		t.Errorf("unexpected parts: %v", parts)
+	}
+	ts := parts["timestamp"].(time.Time)
+	if ts.Month() != time.March || ts.Day() != 1 || ts.Nanosecond() != 123000000 {
+		t.Errorf("timestamp = %v", ts)
+	}
+}
+
+func TestParser_Lenient_CiscoZone(t *testing.T) {
+	parts := parseLenient(t, "<189>12: Mar  1 2021 18:46:11 PST: %SYS-5-CONFIG_I: Configured from console", nil)
+	want := time.Date(2021, 3, 2, 2, 46, 11, 0, time.UTC)
+	if ts := parts["timestamp"].(time.Time); !ts.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", ts, want)
+	}
+
+	// the parser location gives the meaning of an ambiguous abbreviation
+	loc := time.FixedZone("CST", 8*3600)
+	parts = parseLenient(t, "<189>Mar  1 18:46:11 CST: %SYS-5-CONFIG_I: Configured from console", loc)
+	if _, offset := parts["timestamp"].(time.Time).Zone(); offset != 8*3600 {
+		t.Errorf("offset = %d, want %d", offset, 8*3600)
+	}
+}
+
+func TestParser_Lenient_CiscoHostnameBeforeTimestamp(t *testing.T) {
+	parts := parseLenient(t, "<189>45: router1: Mar  1 18:46:11: %LINK-3-UPDOWN: Interface up", nil)
+	if parts["hostname"] != "router1" {
+		t.Errorf("hostname = %v, want router1", parts["hostname"])
+	}
+	if parts["variant"] != "sequence,rfc3164" {
+		t.Errorf("variant = %v", parts["variant"])
+	}
+	if parts["tag"] != "%LINK-3-UPDOWN" {
+		t.Errorf("tag = %v", parts["tag"])
+	}
+}
+
+func TestParser_Lenient_UpperCaseTagIsNotZone(t *testing.T) {
+	parts := parseLenient(t, "<34>Oct 11 22:14:15 SSH: login ok", nil)
+	if parts["tag"] != "SSH" || parts["hostname"] != "" {
+		t.Errorf("unexpected parts: %v", parts)
+	}
+}
+
+func TestParser_Lenient_NoHostname(t *testing.T) {
+	parts := parseLenient(t, "<34>Oct 11 22:14:15 sshd[42]: Accepted password", nil)
+	if parts["variant"] != "rfc3164,no_hostname" {
+		t.Errorf("variant = %v", parts["variant"])
+	}
+	if parts["tag"] != "sshd" || parts["pid"] != 42 {
+		t.Errorf("unexpected parts: %v", parts)
+	}
+}
+
+func TestParser_Lenient_FortiGate(t *testing.T) {
+	line := `<189>date=2021-03-05 time=10:20:30 devname="FG100E" devid="FG100E123" tz="+0800" logid="0000000013" type="traffic"`
+	parts := parseLenient(t, line, nil)
+	if parts["variant"] != VariantKeyValue {
+		t.Errorf("variant = %v, want %s", parts["variant"], VariantKeyValue)
+	}
+	if parts["hostname"] != "FG100E" {
+		t.Errorf("hostname = %v, want FG100E", parts["hostname"])
+	}
+	want := time.Date(2021, 3, 5, 2, 20, 30, 0, time.UTC)
+	if ts := parts["timestamp"].(time.Time); !ts.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", ts, want)
+	}
+	if parts["content"] != line[5:] {
+		t.Errorf("content = %v", parts["content"])
+	}
+}
+
+func TestParser_Lenient_Unknown(t *testing.T) {
+	parts := parseLenient(t, "<34>something completely different", nil)
+	if parts["variant"] != VariantUnknown {
+		t.Errorf("variant = %v, want %s", parts["variant"], VariantUnknown)
+	}
+	if parts["content"] != "something completely different" {
+		t.Errorf("content = %v", parts["content"])
+	}
+}
+
+func TestParser_Lenient_GuessYear(t *testing.T) {
+	p := NewParser(nil)
+	now := time.Now().UTC()
+	future := now.AddDate(0, 0, 10)
+	ts := p.guessYear(time.Date(0, future.Month(), future.Day(), 0, 0, 0, 0, time.UTC))
+	if ts.After(now.Add(24 * time.Hour)) {
+		t.Errorf("guessYear returned a future timestamp %v", ts)
+	}
+}
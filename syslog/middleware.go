@@ -0,0 +1,178 @@
+package syslog
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tea4go/gh/syslog/format"
+)
+
+// The HandlerFunc type allows ordinary functions to be used as a Handler
+type HandlerFunc func(format.LogParts, int64, error)
+
+func (f HandlerFunc) Handle(logParts format.LogParts, messageLength int64, err error) {
+	f(logParts, messageLength, err)
+}
+
+// A Middleware wraps a Handler, it can enrich, change or drop an entry before
+// the next Handler
+type Middleware func(next Handler) Handler
+
+// Wraps handler with the middlewares, the first one runs first:
+//
+//	Chain(h, Filter(f), ReverseDNS(nil, time.Hour)) runs Filter -> ReverseDNS -> h
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Passes the entries for which keep returns true to the next Handler
+func Filter(keep func(format.LogParts) bool) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(logParts format.LogParts, messageLength int64, err error) {
+			if keep(logParts) {
+				next.Handle(logParts, messageLength, err)
+			}
+		})
+	}
+}
+
+// Keeps the first of every n entries, all of them when n <= 1
+func Sample(n int) Middleware {
+	var count uint64
+	return func(next Handler) Handler {
+		return HandlerFunc(func(logParts format.LogParts, messageLength int64, err error) {
+			if n > 1 && (atomic.AddUint64(&count, 1)-1)%uint64(n) != 0 {
+				return
+			}
+			next.Handle(logParts, messageLength, err)
+		})
+	}
+}
+
+// Changes the entry with fn before the next Handler
+func Enrich(fn func(format.LogParts)) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(logParts format.LogParts, messageLength int64, err error) {
+			fn(logParts)
+			next.Handle(logParts, messageLength, err)
+		})
+	}
+}
+
+// Lower cases the hostname and removes the trailing '.'. With stripDomain only
+// the first label is kept (fw01.example.com -> fw01), IP addresses are unchanged
+func NormalizeHostname(stripDomain bool) Middleware {
+	return Enrich(func(logParts format.LogParts) {
+		hostname, ok := logParts["hostname"].(string)
+		if !ok || hostname == "" {
+			return
+		}
+		hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+		if stripDomain && net.ParseIP(hostname) == nil {
+			if i := strings.IndexByte(hostname, '.'); i > 0 {
+				hostname = hostname[:i]
+			}
+		}
+		logParts["hostname"] = hostname
+	})
+}
+
+const (
+	reverseDNSTimeout   = 2 * time.Second
+	reverseDNSCacheSize = 10000
+)
+
+type dnsEntry struct {
+	name    string
+	expires time.Time
+}
+
+// Cache of ReverseDNS. When it is full the expired entries are removed, then
+// random ones, spoofed UDP sources can fill it within the ttl
+type dnsCache struct {
+	lock    sync.Mutex
+	entries map[string]dnsEntry
+	size    int
+}
+
+func (c *dnsCache) get(ip string, now time.Time) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[ip]
+	if !ok || !now.Before(entry.expires) {
+		return "", false
+	}
+	return entry.name, true
+}
+
+func (c *dnsCache) put(ip string, entry dnsEntry, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.entries[ip]; !ok && len(c.entries) >= c.size {
+		for key, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, key)
+			}
+		}
+		for key := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, key)
+		}
+	}
+	c.entries[ip] = entry
+}
+
+// Looks up the host name of the client address (client key) and sets the
+// client_hostname key. Results, failed lookups included, are cached for ttl,
+// at most reverseDNSCacheSize addresses. A lookup is given reverseDNSTimeout,
+// lookup is net.DefaultResolver.LookupAddr when nil
+func ReverseDNS(lookup func(ctx context.Context, ip string) ([]string, error), ttl time.Duration) Middleware {
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupAddr
+	}
+	cache := &dnsCache{entries: make(map[string]dnsEntry), size: reverseDNSCacheSize}
+
+	resolve := func(ip string) string {
+		now := time.Now()
+		if name, ok := cache.get(ip, now); ok {
+			return name
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), reverseDNSTimeout)
+		defer cancel()
+		entry := dnsEntry{expires: now.Add(ttl)}
+		if names, err := lookup(ctx, ip); err == nil && len(names) > 0 {
+			entry.name = strings.TrimSuffix(names[0], ".")
+		}
+		cache.put(ip, entry, now)
+		return entry.name
+	}
+
+	return Enrich(func(logParts format.LogParts) {
+		ip := clientIP(logParts)
+		if ip == "" {
+			return
+		}
+		if name := resolve(ip); name != "" {
+			logParts["client_hostname"] = name
+		}
+	})
+}
+
+// The client key is "ip:port"
+func clientIP(logParts format.LogParts) string {
+	client, _ := logParts["client"].(string)
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		return host
+	}
+	return client
+}
@@ -2,9 +2,11 @@ package syslog
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"errors"
 	"net"
+	"net/netip"
 	"strings"
 	"sync"
 	"time"
@@ -28,27 +30,41 @@ const (
 // ok=false to terminate the connection
 type TlsPeerNameFunc func(tlsConn *tls.Conn) (tlsPeer string, ok bool)
 
+// A function type which receives the errors of a listener. listener is the
+// local address of the listener (or packet connection) the error belongs to
+type ListenerErrorFunc func(listener string, err error)
+
 type Server struct {
 	listeners               []net.Listener
 	connections             []net.PacketConn
 	wait                    sync.WaitGroup
+	receivers               sync.WaitGroup
 	doneTcp                 chan bool
+	doneOnce                sync.Once
 	datagramChannel         chan DatagramMessage
+	datagramOnce            sync.Once
 	format                  format.Format
 	handler                 Handler
+	recordHandler           RecordHandler
+	errorLock               sync.Mutex
 	lastError               error
+	listenerErrorFunc       ListenerErrorFunc
 	readTimeoutMilliseconds int64
+	location                *time.Location
 	tlsPeerNameFunc         TlsPeerNameFunc
 	datagramPool            sync.Pool
+	activeLock              sync.Mutex
+	activeConns             map[net.Conn]struct{}
 }
 
 //NewServer returns a new Server
 func NewServer() *Server {
 	return &Server{tlsPeerNameFunc: defaultTlsPeerName, datagramPool: sync.Pool{
 		New: func() interface{} {
-			return make([]byte, 65536)
+			buf := make([]byte, 65536)
+			return &buf
 		},
-	}}
+	}, activeConns: make(map[net.Conn]struct{})}
 }
 
 //Sets the syslog format (RFC3164 or RFC5424 or RFC6587)
@@ -61,6 +77,20 @@ func (s *Server) SetHandler(handler Handler) {
 	s.handler = handler
 }
 
+// Sets the record handler, which receives every syslog entry as a reused
+// format.Record instead of LogParts. It takes precedence over the handler.
+// The format still selects the framing, the envelope is always detected
+// (RFC3164 or RFC5424), see format.ParseRecord
+func (s *Server) SetRecordHandler(handler RecordHandler) {
+	s.recordHandler = handler
+}
+
+// Sets the location used by the parsers for timestamps without time zone
+// (and, in lenient RFC3164 mode, to guess a missing year). Defaults to UTC
+func (s *Server) SetLocation(location *time.Location) {
+	s.location = location
+}
+
 //Sets the connection timeout for TCP connections, in milliseconds
 func (s *Server) SetTimeout(millseconds int64) {
 	s.readTimeoutMilliseconds = millseconds
@@ -71,6 +101,14 @@ func (s *Server) SetTlsPeerNameFunc(tlsPeerNameFunc TlsPeerNameFunc) {
 	s.tlsPeerNameFunc = tlsPeerNameFunc
 }
 
+// Set the function that receives the errors of every listener (accept, read
+// and parse errors). The function may be called from several goroutines
+func (s *Server) SetListenerErrorFunc(listenerErrorFunc ListenerErrorFunc) {
+	s.errorLock.Lock()
+	s.listenerErrorFunc = listenerErrorFunc
+	s.errorLock.Unlock()
+}
+
 // Default TLS peer name function - returns the CN of the certificate
 func defaultTlsPeerName(tlsConn *tls.Conn) (tlsPeer string, ok bool) {
 	state := tlsConn.ConnectionState()
@@ -150,7 +188,7 @@ func (s *Server) Boot() error {
 		return errors.New("please set a valid format")
 	}
 
-	if s.handler == nil {
+	if s.handler == nil && s.recordHandler == nil {
 		return errors.New("please set a valid handler")
 	}
 
@@ -172,6 +210,7 @@ func (s *Server) Boot() error {
 func (s *Server) goAcceptConnection(listener net.Listener) {
 	s.wait.Add(1)
 	go func(listener net.Listener) {
+		address := listener.Addr().String()
 	loop:
 		for {
 			select {
@@ -181,17 +220,26 @@ func (s *Server) goAcceptConnection(listener net.Listener) {
 			}
 			connection, err := listener.Accept()
 			if err != nil {
+				select {
+				case <-s.doneTcp:
+					break loop
+				default:
+				}
+				s.reportError(address, err)
+				if errors.Is(err, net.ErrClosed) {
+					break loop
+				}
 				continue
 			}
 
-			s.goScanConnection(connection)
+			s.goScanConnection(connection, address)
 		}
 
 		s.wait.Done()
 	}(listener)
 }
 
-func (s *Server) goScanConnection(connection net.Conn) {
+func (s *Server) goScanConnection(connection net.Conn, listener string) {
 	scanner := bufio.NewScanner(connection)
 	if sf := s.format.GetSplitFunc(); sf != nil {
 		scanner.Split(sf)
@@ -207,6 +255,7 @@ func (s *Server) goScanConnection(connection net.Conn) {
 	if tlsConn, ok := connection.(*tls.Conn); ok {
 		// Handshake now so we get the TLS peer information
 		if err := tlsConn.Handshake(); err != nil {
+			s.reportError(listener, err)
 			connection.Close()
 			return
 		}
@@ -223,42 +272,79 @@ func (s *Server) goScanConnection(connection net.Conn) {
 	var scanCloser *ScanCloser
 	scanCloser = &ScanCloser{scanner, connection}
 
+	s.activeLock.Lock()
+	if s.activeConns == nil {
+		s.activeConns = make(map[net.Conn]struct{})
+	}
+	s.activeConns[connection] = struct{}{}
+	s.activeLock.Unlock()
+
 	s.wait.Add(1)
-	go s.scan(scanCloser, client, tlsPeer)
+	go s.scan(scanCloser, client, tlsPeer, listener)
 }
 
-func (s *Server) scan(scanCloser *ScanCloser, client string, tlsPeer string) {
-loop:
+func (s *Server) scan(scanCloser *ScanCloser, client string, tlsPeer string, listener string) {
+	var record *format.Record
+	if s.recordHandler != nil {
+		record = &format.Record{Listener: listener}
+		record.Client, _ = netip.ParseAddrPort(client)
+		record.TLSPeer = tlsPeer
+	}
+
+	draining := false
 	for {
+		if s.readTimeoutMilliseconds > 0 && !draining {
+			scanCloser.closer.SetReadDeadline(time.Now().Add(time.Duration(s.readTimeoutMilliseconds) * time.Millisecond))
+		}
 		select {
 		case <-s.doneTcp:
-			break loop
+			// The server is stopping: do not wait for new data, but still
+			// deliver the frames which are already buffered by the scanner
+			draining = true
+			scanCloser.closer.SetReadDeadline(time.Now())
 		default:
 		}
-		if s.readTimeoutMilliseconds > 0 {
-			scanCloser.closer.SetReadDeadline(time.Now().Add(time.Duration(s.readTimeoutMilliseconds) * time.Millisecond))
+		if !scanCloser.Scan() {
+			break
 		}
-		if scanCloser.Scan() {
-			s.parser([]byte(scanCloser.Text()), client, tlsPeer)
+		// the parsers copy what they keep, the scanner buffer can be used as is
+		if record != nil {
+			s.parseRecord(scanCloser.Bytes(), record, listener)
 		} else {
-			break loop
+			s.parser(scanCloser.Bytes(), client, tlsPeer, listener)
 		}
 	}
+	if err := scanCloser.Err(); err != nil && !draining {
+		s.reportError(listener, err)
+	}
 	scanCloser.closer.Close()
 
+	if connection, ok := scanCloser.closer.(net.Conn); ok {
+		s.activeLock.Lock()
+		delete(s.activeConns, connection)
+		s.activeLock.Unlock()
+	}
+
 	s.wait.Done()
 }
 
-func (s *Server) parser(line []byte, client string, tlsPeer string) {
+func (s *Server) parser(line []byte, client string, tlsPeer string, listener string) {
 	parser := s.format.GetParser(line)
+	if s.location != nil {
+		parser.Location(s.location)
+	}
 	err := parser.Parse()
 	if err != nil {
-		s.lastError = err
+		s.reportError(listener, err)
 	}
 	//fmt.Printf("[原始数据]===> %s\n", line)
 	logParts := parser.Dump()
 	logParts["client"] = client
-	if logParts["hostname"] == "" && s.format == RFC3164 {
+	// fall back to the client address for RFC3164, and for lenient parses
+	// which found no hostname
+	_, isRFC3164 := s.format.(*format.RFC3164)
+	_, isLenient := logParts["variant"]
+	if logParts["hostname"] == "" && (isRFC3164 || isLenient) {
 		if i := strings.Index(client, ":"); i > 1 {
 			logParts["hostname"] = client[:i]
 		} else {
@@ -270,35 +356,104 @@ func (s *Server) parser(line []byte, client string, tlsPeer string) {
 	s.handler.Handle(logParts, int64(len(line)), err)
 }
 
+func (s *Server) parseRecord(line []byte, record *format.Record, listener string) {
+	err := format.ParseRecord(line, record, s.location)
+	if err != nil {
+		s.reportError(listener, err)
+	}
+	s.recordHandler.HandleRecord(record, int64(len(line)), err)
+}
+
+// Records the error as the last error and passes it to the listener error function
+func (s *Server) reportError(listener string, err error) {
+	s.errorLock.Lock()
+	s.lastError = err
+	f := s.listenerErrorFunc
+	s.errorLock.Unlock()
+
+	if f != nil {
+		f(listener, err)
+	}
+}
+
 //Returns the last error
 func (s *Server) GetLastError() error {
+	s.errorLock.Lock()
+	defer s.errorLock.Unlock()
 	return s.lastError
 }
 
-//Kill the server
-func (s *Server) Kill() error {
-	for _, connection := range s.connections {
-		err := connection.Close()
-		if err != nil {
-			return err
-		}
+// Stops receiving: closes the TCP done channel, the listeners and the packet
+// connections. Once every datagram receiver has returned the datagram channel
+// is closed, so the parser goroutine drains what is queued and exits
+func (s *Server) stopReceiving() error {
+	var firstErr error
+
+	// Only need to close channel once to broadcast to all waiting
+	if s.doneTcp != nil {
+		s.doneOnce.Do(func() { close(s.doneTcp) })
 	}
-	s.connections = []net.PacketConn{}
 	for _, listener := range s.listeners {
-		err := listener.Close()
-		if err != nil {
-			return err
+		if err := listener.Close(); err != nil && firstErr == nil {
+			firstErr = err
 		}
 	}
-	// Only need to close channel once to broadcast to all waiting
 	s.listeners = []net.Listener{}
-	if s.doneTcp != nil {
-		close(s.doneTcp)
+	for _, connection := range s.connections {
+		if err := connection.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
+	s.connections = []net.PacketConn{}
+
+	s.receivers.Wait()
 	if s.datagramChannel != nil {
-		close(s.datagramChannel)
+		s.datagramOnce.Do(func() { close(s.datagramChannel) })
+	}
+	return firstErr
+}
+
+// Sets the read deadline of every active TCP connection to now, so blocked
+// scanners return after handing over what they have already buffered
+func (s *Server) interruptConnections(closeThem bool) {
+	s.activeLock.Lock()
+	defer s.activeLock.Unlock()
+	for connection := range s.activeConns {
+		if closeThem {
+			connection.Close()
+		} else {
+			connection.SetReadDeadline(time.Now())
+		}
+	}
+}
+
+//Kill the server
+func (s *Server) Kill() error {
+	return s.stopReceiving()
+}
+
+// Shutdown gracefully stops the server: it stops accepting connections and
+// datagrams, delivers the queued datagrams and the frames already read from
+// TCP connections to the handler, and returns once every goroutine is done.
+// If ctx expires first the remaining TCP connections are closed and ctx.Err()
+// is returned
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.stopReceiving()
+	s.interruptConnections(false)
+
+	done := make(chan struct{})
+	go func() {
+		s.wait.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.interruptConnections(true)
+		return ctx.Err()
 	}
-	return nil
 }
 
 //Waits until the server stops
@@ -317,17 +472,35 @@ type ScanCloser struct {
 }
 
 type DatagramMessage struct {
-	message []byte
-	client  string
+	message  []byte
+	buffer   *[]byte        // pooled buffer of message
+	client   string         // unix sockets
+	addr     netip.AddrPort // UDP, formatted only when needed
+	listener string
 }
 
 func (s *Server) goReceiveDatagrams(packetconn net.PacketConn) {
+	listener := packetconn.LocalAddr().String()
 	s.wait.Add(1)
+	s.receivers.Add(1)
 	go func() {
 		defer s.wait.Done()
+		defer s.receivers.Done()
+		udpConn, _ := packetconn.(*net.UDPConn)
 		for {
-			buf := s.datagramPool.Get().([]byte)
-			n, addr, err := packetconn.ReadFrom(buf)
+			buffer := s.datagramPool.Get().(*[]byte)
+			buf := *buffer
+			var n int
+			var addr net.Addr
+			var addrPort netip.AddrPort
+			var err error
+			if udpConn != nil {
+				// no net.UDPAddr allocated per datagram
+				n, addrPort, err = udpConn.ReadFromUDPAddrPort(buf)
+				addrPort = netip.AddrPortFrom(addrPort.Addr().Unmap(), addrPort.Port())
+			} else {
+				n, addr, err = packetconn.ReadFrom(buf)
+			}
 			if err == nil {
 				// Ignore trailing control characters and NULs
 				for ; (n > 0) && (buf[n-1] < 32); n-- {
@@ -337,12 +510,19 @@ func (s *Server) goReceiveDatagrams(packetconn net.PacketConn) {
 					if addr != nil {
 						address = addr.String()
 					}
-					s.datagramChannel <- DatagramMessage{buf[:n], address}
+					s.datagramChannel <- DatagramMessage{buf[:n], buffer, address, addrPort, listener}
+				} else {
+					s.datagramPool.Put(buffer)
 				}
 			} else {
+				s.datagramPool.Put(buffer)
 				// there has been an error. Either the server has been killed
 				// or may be getting a transitory error due to (e.g.) the
 				// interface being shutdown in which case sleep() to avoid busy wait.
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				s.reportError(listener, err)
 				opError, ok := err.(*net.OpError)
 				if (ok) && !opError.Temporary() && !opError.Timeout() {
 					return
@@ -359,20 +539,37 @@ func (s *Server) goParseDatagrams() {
 	s.wait.Add(1)
 	go func() {
 		defer s.wait.Done()
+		var record *format.Record
+		if s.recordHandler != nil {
+			record = &format.Record{}
+		}
 		for {
 			select {
 			case msg, ok := (<-s.datagramChannel):
 				if !ok {
 					return
 				}
+				line := msg.message
 				if sf := s.format.GetSplitFunc(); sf != nil {
-					if _, token, err := sf(msg.message, true); err == nil {
-						s.parser(token, msg.client, "")
+					_, token, err := sf(msg.message, true)
+					if err != nil {
+						s.datagramPool.Put(msg.buffer)
+						continue
 					}
+					line = token
+				}
+				if record != nil {
+					record.Client = msg.addr
+					record.Listener = msg.listener
+					s.parseRecord(line, record, msg.listener)
 				} else {
-					s.parser(msg.message, msg.client, "")
+					client := msg.client
+					if msg.addr.IsValid() {
+						client = msg.addr.String()
+					}
+					s.parser(line, client, "", msg.listener)
 				}
-				s.datagramPool.Put(msg.message[:cap(msg.message)])
+				s.datagramPool.Put(msg.buffer)
 			}
 		}
 	}()
@@ -2,6 +2,7 @@ package syslog
 
 import (
 	"bufio"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -10,7 +11,9 @@ import (
 	"crypto/x509/pkix"
 	"math/big"
 	"net"
+	"net/netip"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -1410,3 +1413,362 @@ func TestServer_UDP_TrailingControlChars(t *testing.T) {
 	s.Kill()
 	s.Wait()
 }
+
+// gateHandler blocks every Handle call until the gate is opened
+type gateHandler struct {
+	gate  chan struct{}
+	mutex sync.Mutex
+	parts []format.LogParts
+}
+
+func (h *gateHandler) Handle(logParts format.LogParts, messageLength int64, err error) {
+	<-h.gate
+	h.mutex.Lock()
+	h.parts = append(h.parts, logParts)
+	h.mutex.Unlock()
+}
+
+func (h *gateHandler) count() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.parts)
+}
+
+// --- Shutdown drains queued datagrams ---
+
+func TestServer_Shutdown_DrainsDatagrams(t *testing.T) {
+	s := NewServer()
+	handler := &gateHandler{gate: make(chan struct{})}
+	s.SetFormat(RFC3164)
+	s.SetHandler(handler)
+
+	if err := s.ListenUDP("127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	if err := s.Boot(); err != nil {
+		t.Fatalf("Boot failed: %v", err)
+	}
+
+	conn, err := net.Dial("udp", s.connections[0].LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial UDP failed: %v", err)
+	}
+	defer conn.Close()
+
+	const total = 5
+	for i := 0; i < total; i++ {
+		conn.Write([]byte("<34>Oct 11 22:14:15 myhost su: drain test\n"))
+	}
+
+	// one message is blocked in the handler, the others wait in the channel
+	deadline := time.Now().Add(2 * time.Second)
+	for len(s.datagramChannel) < total-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d datagrams queued", len(s.datagramChannel))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+	close(handler.gate)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return")
+	}
+	if handler.count() != total {
+		t.Errorf("handled %d messages, want %d", handler.count(), total)
+	}
+}
+
+// --- Shutdown delivers frames already read from a TCP connection ---
+
+func TestServer_Shutdown_DrainsTCP(t *testing.T) {
+	s := NewServer()
+	handler := &gateHandler{gate: make(chan struct{})}
+	s.SetFormat(RFC3164)
+	s.SetHandler(handler)
+
+	if err := s.ListenTCP("127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenTCP failed: %v", err)
+	}
+	if err := s.Boot(); err != nil {
+		t.Fatalf("Boot failed: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", s.listeners[0].Addr().String())
+	if err != nil {
+		t.Fatalf("Dial TCP failed: %v", err)
+	}
+	defer conn.Close()
+
+	const total = 3
+	var lines string
+	for i := 0; i < total; i++ {
+		lines += "<34>Oct 11 22:14:15 myhost su: tcp drain test\n"
+	}
+	if _, err := conn.Write([]byte(lines)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+	close(handler.gate)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return")
+	}
+	if handler.count() != total {
+		t.Errorf("handled %d messages, want %d", handler.count(), total)
+	}
+}
+
+// --- Shutdown returns when the context expires ---
+
+func TestServer_Shutdown_ContextExpired(t *testing.T) {
+	s := NewServer()
+	handler := &gateHandler{gate: make(chan struct{})}
+	defer close(handler.gate)
+	s.SetFormat(RFC3164)
+	s.SetHandler(handler)
+
+	if err := s.ListenTCP("127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenTCP failed: %v", err)
+	}
+	if err := s.Boot(); err != nil {
+		t.Fatalf("Boot failed: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", s.listeners[0].Addr().String())
+	if err != nil {
+		t.Fatalf("Dial TCP failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("<34>Oct 11 22:14:15 myhost su: blocked\n"))
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// --- Shutdown and Kill may be combined ---
+
+func TestServer_Shutdown_AfterKill(t *testing.T) {
+	s := NewServer()
+	s.SetFormat(RFC3164)
+	s.SetHandler(NewChannelHandler(make(LogPartsChannel, 10)))
+	if err := s.ListenUDP("127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	if err := s.ListenTCP("127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenTCP failed: %v", err)
+	}
+	if err := s.Boot(); err != nil {
+		t.Fatalf("Boot failed: %v", err)
+	}
+
+	if err := s.Kill(); err != nil {
+		t.Fatalf("Kill failed: %v", err)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown after Kill failed: %v", err)
+	}
+}
+
+// --- Listener error function ---
+
+func TestServer_ListenerErrorFunc(t *testing.T) {
+	s := NewServer()
+	channel := make(LogPartsChannel, 10)
+	s.SetFormat(RFC5424)
+	s.SetHandler(NewChannelHandler(channel))
+
+	type listenerError struct {
+		listener string
+		err      error
+	}
+	errs := make(chan listenerError, 10)
+	s.SetListenerErrorFunc(func(listener string, err error) {
+		errs <- listenerError{listener, err}
+	})
+
+	if err := s.ListenUDP("127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	if err := s.Boot(); err != nil {
+		t.Fatalf("Boot failed: %v", err)
+	}
+	udpAddr := s.connections[0].LocalAddr().String()
+
+	conn, err := net.Dial("udp", udpAddr)
+	if err != nil {
+		t.Fatalf("Dial UDP failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("invalid syslog message\n"))
+
+	select {
+	case e := <-errs:
+		if e.listener != udpAddr {
+			t.Errorf("listener = %q, want %q", e.listener, udpAddr)
+		}
+		if e.err == nil || e.err != s.GetLastError() {
+			t.Errorf("err = %v, last error = %v", e.err, s.GetLastError())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for listener error")
+	}
+
+	s.Shutdown(context.Background())
+	select {
+	case e := <-errs:
+		t.Errorf("unexpected error after Shutdown: %v", e.err)
+	default:
+	}
+}
+
+// --- lenient RFC3164 through Automatic with SetLocation ---
+
+func TestServer_LenientAutomatic_Location(t *testing.T) {
+	s := NewServer()
+	channel := make(LogPartsChannel, 10)
+	s.SetFormat(&format.Automatic{Lenient: true})
+	s.SetHandler(NewChannelHandler(channel))
+	loc := time.FixedZone("CST", 8*3600)
+	s.SetLocation(loc)
+
+	if err := s.ListenUDP("127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	if err := s.Boot(); err != nil {
+		t.Fatalf("Boot failed: %v", err)
+	}
+	defer s.Kill()
+
+	conn, err := net.Dial("udp", s.connections[0].LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial UDP failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("<189>7: Mar  5 2021 10:20:30: %SYS-5-CONFIG_I: Configured"))
+
+	select {
+	case logParts := <-channel:
+		want := time.Date(2021, 3, 5, 10, 20, 30, 0, loc)
+		if ts := logParts["timestamp"].(time.Time); !ts.Equal(want) {
+			t.Errorf("timestamp = %v, want %v", ts, want)
+		}
+		if logParts["hostname"] != "127.0.0.1" {
+			t.Errorf("hostname = %v, want client address", logParts["hostname"])
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for syslog message")
+	}
+}
+
+// --- typed record path ---
+
+type recordCopy struct {
+	hostname string
+	appName  string
+	message  string
+	client   netip.AddrPort
+	listener string
+	err      error
+}
+
+type recordChannelHandler chan recordCopy
+
+func (h recordChannelHandler) HandleRecord(record *format.Record, messageLength int64, err error) {
+	// the record is reused once HandleRecord returns
+	h <- recordCopy{string(record.Hostname), string(record.AppName), string(record.Message),
+		record.Client, record.Listener, err}
+}
+
+func TestServer_RecordHandler(t *testing.T) {
+	s := NewServer()
+	records := make(recordChannelHandler, 10)
+	s.SetFormat(RFC3164)
+	s.SetRecordHandler(records)
+
+	if err := s.ListenUDP("127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	if err := s.ListenTCP("127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenTCP failed: %v", err)
+	}
+	if err := s.Boot(); err != nil {
+		t.Fatalf("Boot failed: %v", err)
+	}
+	defer s.Kill()
+
+	udpAddr := s.connections[0].LocalAddr().String()
+	tcpAddr := s.listeners[0].Addr().String()
+	for _, target := range []struct{ network, addr string }{{"udp", udpAddr}, {"tcp", tcpAddr}} {
+		conn, err := net.Dial(target.network, target.addr)
+		if err != nil {
+			t.Fatalf("Dial %s failed: %v", target.network, err)
+		}
+		conn.Write([]byte("<34>Oct 11 22:14:15 mymachine su: 'su root' failed\n"))
+
+		select {
+		case record := <-records:
+			if record.err != nil || record.hostname != "mymachine" || record.appName != "su" ||
+				record.message != "'su root' failed" {
+				t.Errorf("%s: unexpected record %+v", target.network, record)
+			}
+			if record.client.String() != conn.LocalAddr().String() || record.listener != target.addr {
+				t.Errorf("%s: client = %v, listener = %v", target.network, record.client, record.listener)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: timeout waiting for syslog record", target.network)
+		}
+		conn.Close()
+	}
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Handle(format.LogParts, int64, error)      {}
+func (discardHandler) HandleRecord(*format.Record, int64, error) {}
+
+var benchLine = []byte("<34>Oct 11 22:14:15 mymachine su[1234]: 'su root' failed for lonvick on /dev/pts/8")
+
+func BenchmarkServer_LogParts(b *testing.B) {
+	s := NewServer()
+	s.SetFormat(RFC3164)
+	s.SetHandler(discardHandler{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.parser(benchLine, "127.0.0.1:514", "", "")
+	}
+}
+
+func BenchmarkServer_Record(b *testing.B) {
+	s := NewServer()
+	s.SetFormat(RFC3164)
+	s.SetRecordHandler(discardHandler{})
+	record := &format.Record{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.parseRecord(benchLine, record, "")
+	}
+}